@@ -32,6 +32,13 @@ type ClusterStatusSpec struct {
 	Workers         uint32                 `protobuf:"varint,3,opt,name=workers,proto3" json:"workers,omitempty"`
 	DenyEtcdMembers []string               `protobuf:"bytes,4,rep,name=deny_etcd_members,json=denyEtcdMembers,proto3" json:"deny_etcd_members,omitempty"`
 	Kubeconfig      []byte                 `protobuf:"bytes,5,opt,name=kubeconfig,proto3" json:"kubeconfig,omitempty"`
+	// EtcdMembers are kept in the order the members joined the cluster.
+	EtcdMembers  []*ClusterStatusSpec_EtcdMember `protobuf:"bytes,6,rep,name=etcd_members,json=etcdMembers,proto3" json:"etcd_members,omitempty"`
+	EtcdLeader   string                          `protobuf:"bytes,7,opt,name=etcd_leader,json=etcdLeader,proto3" json:"etcd_leader,omitempty"`
+	EtcdRaftTerm uint64                          `protobuf:"varint,8,opt,name=etcd_raft_term,json=etcdRaftTerm,proto3" json:"etcd_raft_term,omitempty"`
+	EtcdAlarms   []*ClusterStatusSpec_EtcdAlarm  `protobuf:"bytes,9,rep,name=etcd_alarms,json=etcdAlarms,proto3" json:"etcd_alarms,omitempty"`
+	// NodeCidrIndexes are the indexes of the node pod CIDRs in the cluster pod CIDRs by the machine ID.
+	NodeCidrIndexes map[string]uint32 `protobuf:"bytes,10,rep,name=node_cidr_indexes,json=nodeCidrIndexes,proto3" json:"node_cidr_indexes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
 	unknownFields   protoimpl.UnknownFields
 	sizeCache       protoimpl.SizeCache
 }
@@ -101,6 +108,41 @@ func (x *ClusterStatusSpec) GetKubeconfig() []byte {
 	return nil
 }
 
+func (x *ClusterStatusSpec) GetEtcdMembers() []*ClusterStatusSpec_EtcdMember {
+	if x != nil {
+		return x.EtcdMembers
+	}
+	return nil
+}
+
+func (x *ClusterStatusSpec) GetEtcdLeader() string {
+	if x != nil {
+		return x.EtcdLeader
+	}
+	return ""
+}
+
+func (x *ClusterStatusSpec) GetEtcdRaftTerm() uint64 {
+	if x != nil {
+		return x.EtcdRaftTerm
+	}
+	return 0
+}
+
+func (x *ClusterStatusSpec) GetEtcdAlarms() []*ClusterStatusSpec_EtcdAlarm {
+	if x != nil {
+		return x.EtcdAlarms
+	}
+	return nil
+}
+
+func (x *ClusterStatusSpec) GetNodeCidrIndexes() map[string]uint32 {
+	if x != nil {
+		return x.NodeCidrIndexes
+	}
+	return nil
+}
+
 // MachineStatusSpec is an emulated machine status.
 type MachineStatusSpec struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -684,6 +726,138 @@ func (x *MachineTaskSpec) GetBootFactoryUrl() string {
 	return ""
 }
 
+// EtcdMember is a member of the emulated etcd cluster.
+type ClusterStatusSpec_EtcdMember struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	MachineId string                 `protobuf:"bytes,2,opt,name=machine_id,json=machineId,proto3" json:"machine_id,omitempty"`
+	Hostname  string                 `protobuf:"bytes,3,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Learner   bool                   `protobuf:"varint,4,opt,name=learner,proto3" json:"learner,omitempty"`
+	// Up is set while the member is running and connected to its peers.
+	Up            bool `protobuf:"varint,5,opt,name=up,proto3" json:"up,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClusterStatusSpec_EtcdMember) Reset() {
+	*x = ClusterStatusSpec_EtcdMember{}
+	mi := &file_specs_specs_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClusterStatusSpec_EtcdMember) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClusterStatusSpec_EtcdMember) ProtoMessage() {}
+
+func (x *ClusterStatusSpec_EtcdMember) ProtoReflect() protoreflect.Message {
+	mi := &file_specs_specs_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClusterStatusSpec_EtcdMember.ProtoReflect.Descriptor instead.
+func (*ClusterStatusSpec_EtcdMember) Descriptor() ([]byte, []int) {
+	return file_specs_specs_proto_rawDescGZIP(), []int{0, 0}
+}
+
+func (x *ClusterStatusSpec_EtcdMember) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ClusterStatusSpec_EtcdMember) GetMachineId() string {
+	if x != nil {
+		return x.MachineId
+	}
+	return ""
+}
+
+func (x *ClusterStatusSpec_EtcdMember) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *ClusterStatusSpec_EtcdMember) GetLearner() bool {
+	if x != nil {
+		return x.Learner
+	}
+	return false
+}
+
+func (x *ClusterStatusSpec_EtcdMember) GetUp() bool {
+	if x != nil {
+		return x.Up
+	}
+	return false
+}
+
+// EtcdAlarm is an alarm raised by the etcd member.
+type ClusterStatusSpec_EtcdAlarm struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	MemberId string                 `protobuf:"bytes,1,opt,name=member_id,json=memberId,proto3" json:"member_id,omitempty"`
+	// Type is the etcd alarm type, NOSPACE or CORRUPT.
+	Type          string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClusterStatusSpec_EtcdAlarm) Reset() {
+	*x = ClusterStatusSpec_EtcdAlarm{}
+	mi := &file_specs_specs_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClusterStatusSpec_EtcdAlarm) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClusterStatusSpec_EtcdAlarm) ProtoMessage() {}
+
+func (x *ClusterStatusSpec_EtcdAlarm) ProtoReflect() protoreflect.Message {
+	mi := &file_specs_specs_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClusterStatusSpec_EtcdAlarm.ProtoReflect.Descriptor instead.
+func (*ClusterStatusSpec_EtcdAlarm) Descriptor() ([]byte, []int) {
+	return file_specs_specs_proto_rawDescGZIP(), []int{0, 1}
+}
+
+func (x *ClusterStatusSpec_EtcdAlarm) GetMemberId() string {
+	if x != nil {
+		return x.MemberId
+	}
+	return ""
+}
+
+func (x *ClusterStatusSpec_EtcdAlarm) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
 type ServiceSpec_Health struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Unknown       bool                   `protobuf:"varint,1,opt,name=unknown,proto3" json:"unknown,omitempty"`
@@ -696,7 +870,7 @@ type ServiceSpec_Health struct {
 
 func (x *ServiceSpec_Health) Reset() {
 	*x = ServiceSpec_Health{}
-	mi := &file_specs_specs_proto_msgTypes[12]
+	mi := &file_specs_specs_proto_msgTypes[15]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -708,7 +882,7 @@ func (x *ServiceSpec_Health) String() string {
 func (*ServiceSpec_Health) ProtoMessage() {}
 
 func (x *ServiceSpec_Health) ProtoReflect() protoreflect.Message {
-	mi := &file_specs_specs_proto_msgTypes[12]
+	mi := &file_specs_specs_proto_msgTypes[15]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -756,7 +930,7 @@ var File_specs_specs_proto protoreflect.FileDescriptor
 
 const file_specs_specs_proto_rawDesc = "" +
 	"\n" +
-	"\x11specs/specs.proto\x12\bemuspecs\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1egoogle/protobuf/duration.proto\"\xc4\x01\n" +
+	"\x11specs/specs.proto\x12\bemuspecs\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1egoogle/protobuf/duration.proto\"\x82\x06\n" +
 	"\x11ClusterStatusSpec\x12\"\n" +
 	"\fbootstrapped\x18\x01 \x01(\bR\fbootstrapped\x12%\n" +
 	"\x0econtrol_planes\x18\x02 \x01(\rR\rcontrolPlanes\x12\x18\n" +
@@ -764,7 +938,29 @@ const file_specs_specs_proto_rawDesc = "" +
 	"\x11deny_etcd_members\x18\x04 \x03(\tR\x0fdenyEtcdMembers\x12\x1e\n" +
 	"\n" +
 	"kubeconfig\x18\x05 \x01(\fR\n" +
-	"kubeconfig\"s\n" +
+	"kubeconfig\x12I\n" +
+	"\fetcd_members\x18\x06 \x03(\v2&.emuspecs.ClusterStatusSpec.EtcdMemberR\vetcdMembers\x12\x1f\n" +
+	"\vetcd_leader\x18\a \x01(\tR\n" +
+	"etcdLeader\x12$\n" +
+	"\x0eetcd_raft_term\x18\b \x01(\x04R\fetcdRaftTerm\x12F\n" +
+	"\vetcd_alarms\x18\t \x03(\v2%.emuspecs.ClusterStatusSpec.EtcdAlarmR\n" +
+	"etcdAlarms\x12\\\n" +
+	"\x11node_cidr_indexes\x18\n" +
+	" \x03(\v20.emuspecs.ClusterStatusSpec.NodeCidrIndexesEntryR\x0fnodeCidrIndexes\x1a\x81\x01\n" +
+	"\n" +
+	"EtcdMember\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1d\n" +
+	"\n" +
+	"machine_id\x18\x02 \x01(\tR\tmachineId\x12\x1a\n" +
+	"\bhostname\x18\x03 \x01(\tR\bhostname\x12\x18\n" +
+	"\alearner\x18\x04 \x01(\bR\alearner\x12\x0e\n" +
+	"\x02up\x18\x05 \x01(\bR\x02up\x1a<\n" +
+	"\tEtcdAlarm\x12\x1b\n" +
+	"\tmember_id\x18\x01 \x01(\tR\bmemberId\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x1aB\n" +
+	"\x14NodeCidrIndexesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\rR\x05value:\x028\x01\"s\n" +
 	"\x11MachineStatusSpec\x12\x1c\n" +
 	"\taddresses\x18\x01 \x03(\tR\taddresses\x12$\n" +
 	"\x0eetcd_member_id\x18\x02 \x01(\tR\fetcdMemberId\x12\x1a\n" +
@@ -825,34 +1021,40 @@ func file_specs_specs_proto_rawDescGZIP() []byte {
 	return file_specs_specs_proto_rawDescData
 }
 
-var file_specs_specs_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_specs_specs_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
 var file_specs_specs_proto_goTypes = []any{
-	(*ClusterStatusSpec)(nil),     // 0: emuspecs.ClusterStatusSpec
-	(*MachineStatusSpec)(nil),     // 1: emuspecs.MachineStatusSpec
-	(*EventSinkStateSpec)(nil),    // 2: emuspecs.EventSinkStateSpec
-	(*VersionSpec)(nil),           // 3: emuspecs.VersionSpec
-	(*ImageSpec)(nil),             // 4: emuspecs.ImageSpec
-	(*CachedImageSpec)(nil),       // 5: emuspecs.CachedImageSpec
-	(*ServiceSpec)(nil),           // 6: emuspecs.ServiceSpec
-	(*RebootSpec)(nil),            // 7: emuspecs.RebootSpec
-	(*RebootStatusSpec)(nil),      // 8: emuspecs.RebootStatusSpec
-	(*MachineSpec)(nil),           // 9: emuspecs.MachineSpec
-	(*MachineTaskSpec)(nil),       // 10: emuspecs.MachineTaskSpec
-	nil,                           // 11: emuspecs.EventSinkStateSpec.VersionsEntry
-	(*ServiceSpec_Health)(nil),    // 12: emuspecs.ServiceSpec.Health
-	(*durationpb.Duration)(nil),   // 13: google.protobuf.Duration
-	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+	(*ClusterStatusSpec)(nil),            // 0: emuspecs.ClusterStatusSpec
+	(*MachineStatusSpec)(nil),            // 1: emuspecs.MachineStatusSpec
+	(*EventSinkStateSpec)(nil),           // 2: emuspecs.EventSinkStateSpec
+	(*VersionSpec)(nil),                  // 3: emuspecs.VersionSpec
+	(*ImageSpec)(nil),                    // 4: emuspecs.ImageSpec
+	(*CachedImageSpec)(nil),              // 5: emuspecs.CachedImageSpec
+	(*ServiceSpec)(nil),                  // 6: emuspecs.ServiceSpec
+	(*RebootSpec)(nil),                   // 7: emuspecs.RebootSpec
+	(*RebootStatusSpec)(nil),             // 8: emuspecs.RebootStatusSpec
+	(*MachineSpec)(nil),                  // 9: emuspecs.MachineSpec
+	(*MachineTaskSpec)(nil),              // 10: emuspecs.MachineTaskSpec
+	(*ClusterStatusSpec_EtcdMember)(nil), // 11: emuspecs.ClusterStatusSpec.EtcdMember
+	(*ClusterStatusSpec_EtcdAlarm)(nil),  // 12: emuspecs.ClusterStatusSpec.EtcdAlarm
+	nil,                                  // 13: emuspecs.ClusterStatusSpec.NodeCidrIndexesEntry
+	nil,                                  // 14: emuspecs.EventSinkStateSpec.VersionsEntry
+	(*ServiceSpec_Health)(nil),           // 15: emuspecs.ServiceSpec.Health
+	(*durationpb.Duration)(nil),          // 16: google.protobuf.Duration
+	(*timestamppb.Timestamp)(nil),        // 17: google.protobuf.Timestamp
 }
 var file_specs_specs_proto_depIdxs = []int32{
-	11, // 0: emuspecs.EventSinkStateSpec.versions:type_name -> emuspecs.EventSinkStateSpec.VersionsEntry
-	12, // 1: emuspecs.ServiceSpec.health:type_name -> emuspecs.ServiceSpec.Health
-	13, // 2: emuspecs.RebootSpec.downtime:type_name -> google.protobuf.Duration
-	14, // 3: emuspecs.ServiceSpec.Health.last_change:type_name -> google.protobuf.Timestamp
-	4,  // [4:4] is the sub-list for method output_type
-	4,  // [4:4] is the sub-list for method input_type
-	4,  // [4:4] is the sub-list for extension type_name
-	4,  // [4:4] is the sub-list for extension extendee
-	0,  // [0:4] is the sub-list for field type_name
+	11, // 0: emuspecs.ClusterStatusSpec.etcd_members:type_name -> emuspecs.ClusterStatusSpec.EtcdMember
+	12, // 1: emuspecs.ClusterStatusSpec.etcd_alarms:type_name -> emuspecs.ClusterStatusSpec.EtcdAlarm
+	13, // 2: emuspecs.ClusterStatusSpec.node_cidr_indexes:type_name -> emuspecs.ClusterStatusSpec.NodeCidrIndexesEntry
+	14, // 3: emuspecs.EventSinkStateSpec.versions:type_name -> emuspecs.EventSinkStateSpec.VersionsEntry
+	15, // 4: emuspecs.ServiceSpec.health:type_name -> emuspecs.ServiceSpec.Health
+	16, // 5: emuspecs.RebootSpec.downtime:type_name -> google.protobuf.Duration
+	17, // 6: emuspecs.ServiceSpec.Health.last_change:type_name -> google.protobuf.Timestamp
+	7,  // [7:7] is the sub-list for method output_type
+	7,  // [7:7] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_specs_specs_proto_init() }
@@ -866,7 +1068,7 @@ func file_specs_specs_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_specs_specs_proto_rawDesc), len(file_specs_specs_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   13,
+			NumMessages:   16,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
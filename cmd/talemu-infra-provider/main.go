@@ -11,6 +11,7 @@ import (
 	"errors"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -30,15 +31,18 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"github.com/siderolabs/talemu/internal/pkg/admin"
 	emuconst "github.com/siderolabs/talemu/internal/pkg/constants"
 	emuruntime "github.com/siderolabs/talemu/internal/pkg/emu"
 	"github.com/siderolabs/talemu/internal/pkg/factory"
 	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
+	machinecontrollers "github.com/siderolabs/talemu/internal/pkg/machine/controllers"
 	"github.com/siderolabs/talemu/internal/pkg/machine/network"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
 	"github.com/siderolabs/talemu/internal/pkg/provider"
 	"github.com/siderolabs/talemu/internal/pkg/provider/clientconfig"
+	machinetask "github.com/siderolabs/talemu/internal/pkg/provider/controllers/machine"
 	"github.com/siderolabs/talemu/internal/pkg/provider/meta"
 	"github.com/siderolabs/talemu/internal/pkg/schematic"
 	"github.com/siderolabs/talemu/internal/version"
@@ -99,11 +103,16 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
-		if err = os.MkdirAll("_out/state", 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		instance, err := runtime.NewInstance(cfg.stateDir, cfg.instanceID)
+		if err != nil {
+			return err
+		}
+
+		if err = os.MkdirAll(cfg.stateDir, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
 			return err
 		}
 
-		emulatorState, backingStore, err := runtime.NewState("_out/state/emulator.db", logger)
+		emulatorState, backingStore, err := runtime.NewState(filepath.Join(cfg.stateDir, "emulator.db"), logger)
 		if err != nil {
 			return err
 		}
@@ -114,12 +123,15 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
-		kubernetes, err := kubefactory.New(cmd.Context(), "_out/state", logger)
+		kubernetes, err := kubefactory.New(cmd.Context(), cfg.stateDir, kubefactory.EtcdConfig{
+			ClientAddress: cfg.etcdClientAddress,
+			PeerAddress:   cfg.etcdPeerAddress,
+		}, logger, kubefactory.WithSharedAPIServers(cfg.sharedAPIServer))
 		if err != nil {
 			return err
 		}
 
-		runtime, err := emuruntime.NewRuntime(emulatorState, kubernetes, logger)
+		runtime, err := emuruntime.NewRuntime(emulatorState, kubernetes, logger, false)
 		if err != nil {
 			return err
 		}
@@ -164,7 +176,10 @@ var rootCmd = &cobra.Command{
 
 		enterpriseChecker := factory.NewEnterpriseChecker()
 
-		if err = provider.RegisterControllers(runtime, kubernetes, nc, schematicService, enterpriseChecker, cfg.nodeProxyingDisabled); err != nil {
+		running := machinetask.NewRunning()
+
+		if err = provider.RegisterControllers(runtime, kubernetes, nc, schematicService, enterpriseChecker, instance, running, cfg.nodeProxyingDisabled, cfg.kubeControllers,
+			cfg.upgradeTimings); err != nil {
 			return err
 		}
 
@@ -187,6 +202,12 @@ var rootCmd = &cobra.Command{
 			})
 		})
 
+		if cfg.adminAddress != "" {
+			eg.Go(func() error {
+				return admin.Serve(ctx, cfg.adminAddress, provider.NewFleet(emulatorState, running), logger.With(zap.String("component", "admin")))
+			})
+		}
+
 		return eg.Wait()
 	},
 }
@@ -242,8 +263,16 @@ var cfg struct {
 	serviceAccountKey    string
 	kernelArgs           string
 	schematicCacheDir    string
+	stateDir             string
+	etcdClientAddress    string
+	etcdPeerAddress      string
+	instanceID           string
+	adminAddress         string
 	createServiceAccount bool
 	nodeProxyingDisabled bool
+	kubeControllers      bool
+	sharedAPIServer      bool
+	upgradeTimings       machinecontrollers.UpgradeTimings
 }
 
 func main() {
@@ -265,8 +294,25 @@ func init() {
 	rootCmd.Flags().StringVar(&meta.ProviderID, "id", meta.ProviderID, "the id of the infra provider, it is used to match the resources with the infra provider label.")
 	rootCmd.Flags().StringVar(&cfg.serviceAccountKey, "key", os.Getenv("OMNI_SERVICE_ACCOUNT_KEY"), "Omni service account key, if not set, defaults to OMNI_SERVICE_ACCOUNT_KEY.")
 	rootCmd.Flags().StringVar(&cfg.schematicCacheDir, "schematic-cache-dir", "/tmp/talemu-schematics", "the directory to use for caching schematics")
+	rootCmd.Flags().StringVar(&cfg.stateDir, "state-dir", emuconst.DefaultStateDir, "the directory to keep the emulator state in")
+	rootCmd.Flags().StringVar(&cfg.etcdClientAddress, "etcd-client-address", emuconst.DefaultEtcdClientAddress, "the client address of the embedded etcd")
+	rootCmd.Flags().StringVar(&cfg.etcdPeerAddress, "etcd-peer-address", emuconst.DefaultEtcdPeerAddress, "the peer address of the embedded etcd")
+	rootCmd.Flags().StringVar(&cfg.instanceID, "instance-id", "",
+		"the emulator instance ID, up to 10 characters: replaces the 'siderolink' prefix of the machine interface names, so that several emulators can share the host")
+	rootCmd.Flags().StringVar(&cfg.adminAddress, "admin-address", "",
+		"the address to run the admin API on, which allows powering the machines on and off with talemuctl, the API is disabled if empty")
 	rootCmd.Flags().BoolVar(&cfg.createServiceAccount, "create-service-account", false,
 		"try creating service account for itself (works only if Omni is running in debug mode)")
 	rootCmd.Flags().BoolVar(&cfg.nodeProxyingDisabled, "disable-node-proxying", false,
 		"disable node-to-node proxying in apid: rejects the 'node' header, validates that a single-entry 'nodes' header targets this node, multi-node 'nodes' is still proxied")
+	rootCmd.Flags().BoolVar(&cfg.kubeControllers, "kube-controllers", false,
+		"run the embedded kube-controller-manager and kube-scheduler of each cluster on the control plane machine holding their leader leases")
+	rootCmd.Flags().BoolVar(&cfg.sharedAPIServer, "shared-apiserver", false,
+		"run a single kube-apiserver per cluster, the api server addresses of the control planes forward to it")
+	rootCmd.Flags().DurationVar(&cfg.upgradeTimings.StaticPodRestart, "static-pod-restart-delay", machinecontrollers.DefaultStaticPodRestartDelay,
+		"how long the control plane static pod stays not ready after the image change, the static pods restart one at a time")
+	rootCmd.Flags().DurationVar(&cfg.upgradeTimings.KubeletRestart, "kubelet-restart-delay", machinecontrollers.DefaultKubeletRestartDelay,
+		"how long the node stays not ready after the kubelet image change")
+	rootCmd.Flags().DurationVar(&cfg.upgradeTimings.DaemonSetRollout, "daemonset-rollout-delay", machinecontrollers.DefaultDaemonSetRolloutDelay,
+		"the termination grace period of the outdated DaemonSet pods, the pods are replaced one node at a time")
 }
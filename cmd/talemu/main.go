@@ -7,29 +7,32 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"os"
 	"os/signal"
-	"strings"
+	"path/filepath"
 	"syscall"
 
-	"github.com/siderolabs/image-factory/pkg/schematic"
 	"github.com/siderolabs/omni/client/pkg/constants"
 	"github.com/spf13/cobra"
-	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/siderolabs/talemu/internal/pkg/admin"
 	emuconst "github.com/siderolabs/talemu/internal/pkg/constants"
 	emuruntime "github.com/siderolabs/talemu/internal/pkg/emu"
 	"github.com/siderolabs/talemu/internal/pkg/factory"
+	"github.com/siderolabs/talemu/internal/pkg/fleet"
 	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
 	"github.com/siderolabs/talemu/internal/pkg/machine"
+	machinecontrollers "github.com/siderolabs/talemu/internal/pkg/machine/controllers"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
 	"github.com/siderolabs/talemu/internal/pkg/machine/network"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
+	"github.com/siderolabs/talemu/internal/pkg/scenario"
 	schematicsvc "github.com/siderolabs/talemu/internal/pkg/schematic"
 )
 
@@ -40,14 +43,45 @@ var rootCmd = &cobra.Command{
 	Long:         `Can simulate as many nodes as you want`,
 	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, _ []string) error {
-		params, err := machine.ParseKernelArgs(cfg.kernelArgs)
+		fleetSpec := fleet.Single(cfg.machinesCount)
+
+		if cfg.fleetPath != "" {
+			var err error
+
+			if fleetSpec, err = fleet.Load(cfg.fleetPath); err != nil {
+				return err
+			}
+		}
+
+		defaults := fleet.Defaults{
+			TalosVersion: cfg.talosVersion,
+			KernelArgs:   cfg.kernelArgs,
+			Extensions:   cfg.extensions,
+		}
+
+		fleetMachines, err := fleetSpec.Machines(defaults, firstSlot)
 		if err != nil {
 			return err
 		}
 
-		eg, ctx := errgroup.WithContext(cmd.Context())
+		var (
+			faultsSpec   *faults.Spec
+			scenarioSpec *scenario.Spec
+		)
+
+		if cfg.faultsPath != "" {
+			if faultsSpec, err = faults.Load(cfg.faultsPath); err != nil {
+				return err
+			}
+		}
+
+		if cfg.scenarioPath != "" {
+			if scenarioSpec, err = scenario.Load(cfg.scenarioPath); err != nil {
+				return err
+			}
+		}
 
-		machines := make([]*machine.Machine, 0, cfg.machinesCount)
+		eg, ctx := errgroup.WithContext(cmd.Context())
 
 		loggerConfig := zap.NewDevelopmentConfig()
 		loggerConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
@@ -59,11 +93,16 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
-		if err = os.MkdirAll("_out/state", 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		instance, err := runtime.NewInstance(cfg.stateDir, cfg.instanceID)
+		if err != nil {
+			return err
+		}
+
+		if err = os.MkdirAll(cfg.stateDir, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
 			return err
 		}
 
-		emulatorState, backingStore, err := runtime.NewState("_out/state/emulator.db", logger)
+		emulatorState, backingStore, err := runtime.NewState(filepath.Join(cfg.stateDir, "emulator.db"), logger)
 		if err != nil {
 			return err
 		}
@@ -74,12 +113,15 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
-		kubernetes, err := kubefactory.New(ctx, "_out/state", logger)
+		kubernetes, err := kubefactory.New(ctx, cfg.stateDir, kubefactory.EtcdConfig{
+			ClientAddress: cfg.etcdClientAddress,
+			PeerAddress:   cfg.etcdPeerAddress,
+		}, logger, kubefactory.WithSharedAPIServers(cfg.sharedAPIServer))
 		if err != nil {
 			return err
 		}
 
-		runtime, err := emuruntime.NewRuntime(emulatorState, kubernetes, logger)
+		runtime, err := emuruntime.NewRuntime(emulatorState, kubernetes, logger, cfg.userspaceNetwork)
 		if err != nil {
 			return err
 		}
@@ -88,13 +130,18 @@ var rootCmd = &cobra.Command{
 			return runtime.Run(ctx)
 		})
 
-		nc := network.NewClient()
+		var nc *network.Client
 
-		if err = nc.Run(cmd.Context()); err != nil {
-			return err
-		}
+		// in the userspace and the network namespace modes each machine runs its own network client
+		if !cfg.userspaceNetwork && !cfg.networkNamespace {
+			nc = network.NewClient()
+
+			if err = nc.Run(cmd.Context()); err != nil {
+				return err
+			}
 
-		defer nc.Close() //nolint:errcheck
+			defer nc.Close() //nolint:errcheck
+		}
 
 		schematicService, err := schematicsvc.NewService(
 			cfg.schematicCacheDir, cfg.imageFactoryBaseURL,
@@ -105,92 +152,99 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
-		initialSchematicID, err := buildInitialSchematicID()
-		if err != nil {
-			return err
-		}
-
 		enterpriseChecker := factory.NewEnterpriseChecker()
 
-		for i := range cfg.machinesCount {
-			m, err := machine.NewMachine(fmt.Sprintf("%04d1802-c798-4da7-a410-f09abb48c8d8", i+1000), logger, emulatorState, schematicService, enterpriseChecker)
-			if err != nil {
-				return err
-			}
-
-			eg.Go(func() error {
-				return m.Run(ctx, params, i+1000, kubernetes, machine.WithNetworkClient(nc), machine.WithTalosVersion(cfg.talosVersion),
-					machine.WithSchematic(initialSchematicID), machine.WithNodeProxyingDisabled(cfg.nodeProxyingDisabled))
-			})
-
-			machines = append(machines, m)
-		}
-
-		var errors error
-
-		if err := eg.Wait(); err != nil {
-			errors = multierr.Append(errors, err)
-		}
-
-		eg = &errgroup.Group{}
-
-		errChannel := make(chan error, len(machines))
+		manager := admin.NewManager(admin.ManagerConfig{
+			GlobalState:       emulatorState,
+			Kubernetes:        kubernetes,
+			SchematicService:  schematicService,
+			EnterpriseChecker: enterpriseChecker,
+			Logger:            logger,
+			Instance:          instance,
+			Defaults:          defaults,
+			Faults:            faults.NewRegistry(faultsSpec),
+			Options: []machine.Option{
+				machine.WithNetworkClient(nc),
+				machine.WithUserspaceNetwork(cfg.userspaceNetwork),
+				machine.WithNetworkNamespace(cfg.networkNamespace),
+				machine.WithNodeProxyingDisabled(cfg.nodeProxyingDisabled),
+				machine.WithKubeControllers(cfg.kubeControllers),
+				machine.WithUpgradeTimings(cfg.upgradeTimings),
+			},
+		}, firstSlot)
 
 		eg.Go(func() error {
-			count := 0
-
-			for e := range errChannel {
-				if e != nil {
-					errors = multierr.Append(errors, e)
-				}
-
-				count++
-
-				if count == len(machines) {
-					break
-				}
-			}
-
-			return nil
+			return manager.Run(ctx, fleetMachines)
 		})
 
-		for _, m := range machines {
+		if scenarioSpec != nil {
 			eg.Go(func() error {
-				errChannel <- m.Cleanup(context.Background())
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-manager.Ready():
+				}
 
-				return nil
+				return runScenario(ctx, manager, scenarioSpec, logger.With(zap.String("component", "scenario")))
 			})
 		}
 
-		if err := eg.Wait(); err != nil {
-			return err
+		if cfg.adminAddress != "" {
+			eg.Go(func() error {
+				return admin.Serve(ctx, cfg.adminAddress, manager, logger.With(zap.String("component", "admin")))
+			})
 		}
 
-		return errors
+		return eg.Wait()
 	},
 }
 
-func buildInitialSchematicID() (string, error) {
-	initialSchematic := schematic.Schematic{
-		Customization: schematic.Customization{
-			ExtraKernelArgs: strings.Fields(cfg.kernelArgs),
-			SystemExtensions: schematic.SystemExtensions{
-				OfficialExtensions: cfg.extensions,
-			},
-		},
+// runScenario runs the scenario, the failed scenario events are logged and don't stop the emulator.
+//
+// The report is written even if the emulator stops before the scenario ends.
+func runScenario(ctx context.Context, fleet admin.Fleet, spec *scenario.Spec, logger *zap.Logger) error {
+	report, err := scenario.Run(ctx, fleet, spec, logger)
+	if err != nil && ctx.Err() == nil {
+		logger.Warn("scenario finished with errors", zap.Error(err))
+	}
+
+	if cfg.scenarioReportPath == "" {
+		return nil
 	}
 
-	return initialSchematic.ID()
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(cfg.scenarioReportPath, data, 0o644)
 }
 
+// firstSlot is the slot of the first emulated machine.
+const firstSlot = 1000
+
 var cfg struct {
 	kernelArgs           string
 	talosVersion         string
 	schematicCacheDir    string
 	imageFactoryBaseURL  string
+	fleetPath            string
+	faultsPath           string
+	scenarioPath         string
+	scenarioReportPath   string
+	stateDir             string
+	etcdClientAddress    string
+	etcdPeerAddress      string
+	instanceID           string
+	adminAddress         string
 	extensions           []string
 	machinesCount        int
 	nodeProxyingDisabled bool
+	kubeControllers      bool
+	sharedAPIServer      bool
+	userspaceNetwork     bool
+	networkNamespace     bool
+	upgradeTimings       machinecontrollers.UpgradeTimings
 }
 
 func main() {
@@ -213,6 +267,37 @@ func init() {
 	rootCmd.Flags().StringVar(&cfg.schematicCacheDir, "schematic-cache-dir", "/tmp/talemu-schematics", "the directory to use for caching schematics")
 	rootCmd.Flags().StringVar(&cfg.imageFactoryBaseURL, "image-factory-base-url", emuconst.DefaultImageFactoryBaseURL, "base URL of the image factory")
 	rootCmd.Flags().IntVar(&cfg.machinesCount, "machines", 1, "the number of machines to emulate")
+	rootCmd.Flags().StringVar(&cfg.fleetPath, "fleet", "",
+		"path to the fleet YAML file describing groups of machines, other flags are used as the defaults for the groups")
+	rootCmd.Flags().StringVar(&cfg.faultsPath, "faults", "",
+		"path to the YAML file with the fault rules injected into the machine API calls, the rules can be changed later through the admin API")
+	rootCmd.Flags().StringVar(&cfg.scenarioPath, "scenario", "", "path to the YAML scenario file, the scenario starts when the machines are started")
+	rootCmd.Flags().StringVar(&cfg.scenarioReportPath, "scenario-report", "", "path to write the JSON report of the scenario run to")
+	rootCmd.Flags().StringVar(&cfg.stateDir, "state-dir", emuconst.DefaultStateDir, "the directory to keep the emulator state in")
+	rootCmd.Flags().StringVar(&cfg.etcdClientAddress, "etcd-client-address", emuconst.DefaultEtcdClientAddress, "the client address of the embedded etcd")
+	rootCmd.Flags().StringVar(&cfg.etcdPeerAddress, "etcd-peer-address", emuconst.DefaultEtcdPeerAddress, "the peer address of the embedded etcd")
+	rootCmd.Flags().StringVar(&cfg.instanceID, "instance-id", "",
+		"the emulator instance ID, up to 10 characters: replaces the 'siderolink' prefix of the machine interface names, so that several emulators can share the host")
+	rootCmd.Flags().StringVar(&cfg.adminAddress, "admin-address", "",
+		"the address to run the admin API on, which allows changing the fleet of the running emulator with talemuctl, the API is disabled if empty")
 	rootCmd.Flags().BoolVar(&cfg.nodeProxyingDisabled, "disable-node-proxying", false,
 		"disable node-to-node proxying in apid: rejects the 'node' header, validates that a single-entry 'nodes' header targets this node, multi-node 'nodes' is still proxied")
+	rootCmd.Flags().BoolVar(&cfg.kubeControllers, "kube-controllers", false,
+		"run the embedded kube-controller-manager and kube-scheduler of each cluster on the control plane machine holding their leader leases")
+	rootCmd.Flags().BoolVar(&cfg.sharedAPIServer, "shared-apiserver", false,
+		"run a single kube-apiserver per cluster, the api server addresses of the control planes forward to it")
+	rootCmd.Flags().DurationVar(&cfg.upgradeTimings.StaticPodRestart, "static-pod-restart-delay", machinecontrollers.DefaultStaticPodRestartDelay,
+		"how long the control plane static pod stays not ready after the image change, the static pods restart one at a time")
+	rootCmd.Flags().DurationVar(&cfg.upgradeTimings.KubeletRestart, "kubelet-restart-delay", machinecontrollers.DefaultKubeletRestartDelay,
+		"how long the node stays not ready after the kubelet image change")
+	rootCmd.Flags().DurationVar(&cfg.upgradeTimings.DaemonSetRollout, "daemonset-rollout-delay", machinecontrollers.DefaultDaemonSetRolloutDelay,
+		"the termination grace period of the outdated DaemonSet pods, the pods are replaced one node at a time")
+	rootCmd.Flags().BoolVar(&cfg.userspaceNetwork, "userspace-network", false,
+		"run the SideroLink tunnels in wireguard-go on top of the userspace netstack: doesn't need root, but the machines are not reachable from the host network")
+
+	rootCmd.Flags().BoolVar(&cfg.networkNamespace, "netns", false,
+		"run each machine in its own network namespace connected to the host through the "+network.DefaultBridge.Name+" bridge, or the bridge of the instance ID")
+
+	rootCmd.MarkFlagsMutuallyExclusive("fleet", "machines")
+	rootCmd.MarkFlagsMutuallyExclusive("userspace-network", "netns")
 }
@@ -0,0 +1,317 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package main is the CLI which changes the fleet of a running Talos emulator.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/talemu/internal/pkg/admin"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+	"github.com/siderolabs/talemu/internal/pkg/scenario"
+)
+
+var rootCmd = &cobra.Command{
+	Use:          "talemuctl",
+	Short:        "Talos emulator control",
+	Long:         `Changes the fleet of the running Talos emulator through its admin API`,
+	SilenceUsage: true,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the emulated machines",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		machines, err := client().List(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		if listCfg.json {
+			return printJSON(machines)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+		fmt.Fprintln(w, "ID\tUUID\tGROUP\tSTATE\tHOSTNAME\tCLUSTER\tROLE\tADDRESSES") //nolint:errcheck
+
+		for _, m := range machines {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+				m.ID, m.UUID, m.Group, m.State, m.Hostname, m.Cluster, m.Role, strings.Join(m.Addresses, ","),
+			)
+		}
+
+		return w.Flush()
+	},
+}
+
+var addCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add machines to the fleet",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		machines, err := client().Add(cmd.Context(), addCfg)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range machines {
+			fmt.Println(m.ID, m.UUID) //nolint:forbidigo
+		}
+
+		return nil
+	},
+}
+
+var kubeconfigCmd = &cobra.Command{
+	Use:   "kubeconfig <cluster>",
+	Short: "Print the admin kubeconfig of the emulated cluster",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kubeconfig, err := client().Kubeconfig(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(kubeconfig)
+
+		return err
+	},
+}
+
+var faultsCmd = &cobra.Command{
+	Use:   "faults",
+	Short: "Manage the faults injected into the machine API calls",
+}
+
+var faultsGetCmd = &cobra.Command{
+	Use:   "get <machine-id>",
+	Short: "Print the fault rules of the machine",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rules, err := client().Faults(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+
+		return encoder.Encode(faults.Spec{Rules: rules})
+	},
+}
+
+var faultsSetCmd = &cobra.Command{
+	Use:   "set <machine-id> <rules-file>",
+	Short: "Replace the fault rules of the machine with the rules from the file",
+	Long:  `The file has the same format as the emulator --faults file, the machines field of the rules is ignored`,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spec, err := faults.Load(args[1])
+		if err != nil {
+			return err
+		}
+
+		for i := range spec.Rules {
+			spec.Rules[i].Machines = nil
+		}
+
+		return client().SetFaults(cmd.Context(), args[0], spec.Rules)
+	},
+}
+
+var faultsClearCmd = &cobra.Command{
+	Use:   "clear <machine-id>...",
+	Short: "Remove all fault rules of the machines",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, id := range args {
+			if err := client().SetFaults(cmd.Context(), id, nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+var serviceHealthCmd = &cobra.Command{
+	Use:   "service-health <machine-id> <service> healthy|unhealthy",
+	Short: "Force the machine service to report unhealthy, or restore its health",
+	Args:  cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var healthy bool
+
+		switch args[2] {
+		case "healthy":
+			healthy = true
+		case "unhealthy":
+		default:
+			return fmt.Errorf("unknown health %q, should be healthy or unhealthy", args[2])
+		}
+
+		return client().SetServiceHealth(cmd.Context(), args[0], args[1], healthy)
+	},
+}
+
+var etcdAlarmCmd = &cobra.Command{
+	Use:   "etcd-alarm <machine-id> nospace|corrupt raise|disarm",
+	Short: "Raise the alarm of the machine etcd member, or disarm it",
+	Long:  `The raised alarm is reported by the etcd status and the etcd alarm list until it is disarmed here or through the Talos API`,
+	Args:  cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var active bool
+
+		switch args[2] {
+		case "raise":
+			active = true
+		case "disarm":
+		default:
+			return fmt.Errorf("unknown alarm action %q, should be raise or disarm", args[2])
+		}
+
+		return client().SetEtcdAlarm(cmd.Context(), args[0], args[1], active)
+	},
+}
+
+var scenarioCmd = &cobra.Command{
+	Use:   "scenario <scenario-file>",
+	Short: "Run the scenario against the running emulator",
+	Long:  `The scenario runs in talemuctl, the events are applied through the admin API`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spec, err := scenario.Load(args[0])
+		if err != nil {
+			return err
+		}
+
+		logger, err := zap.NewDevelopment()
+		if err != nil {
+			return err
+		}
+
+		report, runErr := scenario.Run(cmd.Context(), client(), spec, logger)
+
+		if scenarioCfg.reportPath != "" {
+			var data []byte
+
+			data, err = json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			if err = os.WriteFile(scenarioCfg.reportPath, data, 0o644); err != nil {
+				return err
+			}
+		}
+
+		return runErr
+	},
+}
+
+var (
+	address string
+	addCfg  admin.AddRequest
+	listCfg struct {
+		json bool
+	}
+	scenarioCfg struct {
+		reportPath string
+	}
+)
+
+func client() *admin.Client {
+	return admin.NewClient(address)
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
+
+// machineCmd creates the command which runs the action on each of the machines.
+func machineCmd(use, short string, action func(*admin.Client) func(context.Context, string) error) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " <machine-id>...",
+		Short: short,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			run := action(client())
+
+			for _, id := range args {
+				if err := run(cmd.Context(), id); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func main() {
+	if err := app(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func app() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGHUP, syscall.SIGTERM)
+	defer cancel()
+
+	return rootCmd.ExecuteContext(ctx)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&address, "address", "localhost:8105", "the admin API address of the emulator")
+
+	scenarioCmd.Flags().StringVar(&scenarioCfg.reportPath, "report", "", "path to write the JSON report of the scenario run to")
+
+	listCmd.Flags().BoolVar(&listCfg.json, "json", false, "print the machines as JSON")
+
+	addCmd.Flags().IntVar(&addCfg.Count, "count", 1, "the number of machines to add")
+	addCmd.Flags().StringVar(&addCfg.Name, "name", "", "the name of the group the machines belong to")
+	addCmd.Flags().StringVar(&addCfg.UUIDTemplate, "uuid-template", "", "the text/template of the machine UUIDs, can reference .Slot, .Index and .Group")
+	addCmd.Flags().StringVar(&addCfg.TalosVersion, "talos-version", "", "the Talos version of the machines, the emulator default is used if empty")
+	addCmd.Flags().StringVar(&addCfg.Schematic, "schematic", "", "the schematic ID of the machines")
+	addCmd.Flags().StringVar(&addCfg.KernelArgs, "kernel-args", "", "the kernel args of the machines, the emulator default is used if empty")
+	addCmd.Flags().StringVar(&addCfg.BootFactoryURL, "boot-factory-url", "", "the image factory the machines were booted from")
+	addCmd.Flags().StringSliceVar(&addCfg.Extensions, "extensions", nil, "list of extensions to enable")
+	addCmd.Flags().BoolVar(&addCfg.SecureBoot, "secure-boot", false, "emulate machines booted with SecureBoot")
+
+	rootCmd.AddCommand(
+		listCmd,
+		addCmd,
+		machineCmd("remove", "Stop the machines and remove their state", func(c *admin.Client) func(context.Context, string) error { return c.Remove }),
+		machineCmd("pause", "Stop the machines without disconnecting them, so that they look hung", func(c *admin.Client) func(context.Context, string) error { return c.Pause }),
+		machineCmd("resume", "Boot the paused or powered off machines", func(c *admin.Client) func(context.Context, string) error { return c.Resume }),
+		machineCmd("reboot", "Hard reset the machines", func(c *admin.Client) func(context.Context, string) error { return c.Reboot }),
+		machineCmd("poweroff", "Power off the machines, their Kubernetes nodes go not ready", func(c *admin.Client) func(context.Context, string) error { return c.PowerOff }),
+		machineCmd("poweron", "Power on the powered off machines", func(c *admin.Client) func(context.Context, string) error { return c.PowerOn }),
+		machineCmd("partition", "Bring the SideroLink link of the machines down", func(c *admin.Client) func(context.Context, string) error { return c.Partition }),
+		machineCmd("reconnect", "Bring the SideroLink link of the machines back up", func(c *admin.Client) func(context.Context, string) error { return c.Reconnect }),
+		serviceHealthCmd,
+		etcdAlarmCmd,
+		kubeconfigCmd,
+		faultsCmd,
+		scenarioCmd,
+	)
+
+	faultsCmd.AddCommand(faultsGetCmd, faultsSetCmd, faultsClearCmd)
+}
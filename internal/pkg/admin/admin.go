@@ -0,0 +1,177 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package admin implements the API which changes the fleet of a running emulator.
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+
+	"github.com/siderolabs/talemu/api/specs"
+	"github.com/siderolabs/talemu/internal/pkg/machine/etcdcluster"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
+)
+
+// ErrNotFound is returned when the machine or the cluster doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalidRequest is returned when the request can't be applied.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// MachineState is the power state of the emulated machine.
+type MachineState string
+
+// Machine states.
+const (
+	// MachineRunning is a running machine.
+	MachineRunning MachineState = "running"
+	// MachinePaused is a machine which is stopped without tearing down its network links:
+	// it looks hung to Omni.
+	MachinePaused MachineState = "paused"
+	// MachinePoweredOff is a machine which is stopped and disconnected.
+	MachinePoweredOff MachineState = "powered-off"
+)
+
+// Roles of the machines in the cluster.
+const (
+	RoleControlPlane = "controlplane"
+	RoleWorker       = "worker"
+)
+
+// Machine describes a single emulated machine.
+type Machine struct {
+	ID           string       `json:"id"`
+	UUID         string       `json:"uuid"`
+	Group        string       `json:"group,omitempty"`
+	State        MachineState `json:"state"`
+	Hostname     string       `json:"hostname,omitempty"`
+	Cluster      string       `json:"cluster,omitempty"`
+	Role         string       `json:"role,omitempty"`
+	EtcdMemberID string       `json:"etcd_member_id,omitempty"`
+	Addresses    []string     `json:"addresses,omitempty"`
+	Slot         int          `json:"slot"`
+}
+
+// AddRequest describes the machines to add.
+//
+// The fields have the same meaning as the fleet group fields, empty fields fall back to the emulator defaults.
+type AddRequest struct {
+	Name           string   `json:"name,omitempty"`
+	UUIDTemplate   string   `json:"uuid_template,omitempty"`
+	TalosVersion   string   `json:"talos_version,omitempty"`
+	Schematic      string   `json:"schematic,omitempty"`
+	KernelArgs     string   `json:"kernel_args,omitempty"`
+	BootFactoryURL string   `json:"boot_factory_url,omitempty"`
+	Extensions     []string `json:"extensions,omitempty"`
+	Count          int      `json:"count"`
+	SecureBoot     bool     `json:"secure_boot,omitempty"`
+}
+
+// Fleet manages the machines of the running emulator.
+type Fleet interface {
+	List(ctx context.Context) ([]Machine, error)
+	Add(ctx context.Context, req AddRequest) ([]Machine, error)
+	Remove(ctx context.Context, id string) error
+	Pause(ctx context.Context, id string) error
+	Resume(ctx context.Context, id string) error
+	Reboot(ctx context.Context, id string) error
+	PowerOff(ctx context.Context, id string) error
+	PowerOn(ctx context.Context, id string) error
+	Kubeconfig(ctx context.Context, cluster string) ([]byte, error)
+	Faults(ctx context.Context, id string) ([]faults.Rule, error)
+	SetFaults(ctx context.Context, id string, rules []faults.Rule) error
+	Partition(ctx context.Context, id string) error
+	Reconnect(ctx context.Context, id string) error
+	SetServiceHealth(ctx context.Context, id, service string, healthy bool) error
+	SetEtcdAlarm(ctx context.Context, id, alarm string, active bool) error
+}
+
+// ServiceHealth is the body of the service health request.
+type ServiceHealth struct {
+	Healthy bool `json:"healthy"`
+}
+
+// EtcdAlarm is the body of the etcd alarm request.
+type EtcdAlarm struct {
+	Active bool `json:"active"`
+}
+
+// Describe fills the machine info with the hostname, the addresses and the cluster membership the machine reports.
+func Describe(ctx context.Context, globalState state.State, info Machine) (Machine, error) {
+	status, err := safe.StateGetByID[*emu.MachineStatus](ctx, globalState, info.ID)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return info, nil
+		}
+
+		return Machine{}, err
+	}
+
+	info.Hostname = status.TypedSpec().Value.Hostname
+	info.Addresses = status.TypedSpec().Value.Addresses
+	info.EtcdMemberID = status.TypedSpec().Value.EtcdMemberId
+	info.Cluster, _ = status.Metadata().Labels().Get(emu.LabelCluster)
+
+	if _, ok := status.Metadata().Labels().Get(emu.LabelControlPlaneRole); ok {
+		info.Role = RoleControlPlane
+	} else if _, ok = status.Metadata().Labels().Get(emu.LabelWorkerRole); ok {
+		info.Role = RoleWorker
+	}
+
+	return info, nil
+}
+
+// ClusterKubeconfig returns the admin kubeconfig of the emulated cluster.
+func ClusterKubeconfig(ctx context.Context, globalState state.State, cluster string) ([]byte, error) {
+	clusterStatus, err := safe.StateGetByID[*emu.ClusterStatus](ctx, globalState, cluster)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil, fmt.Errorf("cluster %s: %w", cluster, ErrNotFound)
+		}
+
+		return nil, err
+	}
+
+	if len(clusterStatus.TypedSpec().Value.Kubeconfig) == 0 {
+		return nil, fmt.Errorf("cluster %s kubeconfig: %w", cluster, ErrNotFound)
+	}
+
+	return clusterStatus.TypedSpec().Value.Kubeconfig, nil
+}
+
+// SetEtcdAlarm raises or disarms the alarm of the etcd member of the machine.
+//
+// The alarm stays raised until it is disarmed through the admin API or the Talos API.
+func SetEtcdAlarm(ctx context.Context, globalState state.State, id, alarm string, active bool) error {
+	status, err := safe.StateGetByID[*emu.MachineStatus](ctx, globalState, id)
+	if err != nil && !state.IsNotFoundError(err) {
+		return err
+	}
+
+	if status == nil || status.TypedSpec().Value.EtcdMemberId == "" {
+		return fmt.Errorf("%w: machine %s doesn't have etcd member", ErrInvalidRequest, id)
+	}
+
+	cluster, _ := status.Metadata().Labels().Get(emu.LabelCluster)
+
+	_, err = etcdcluster.Update(ctx, globalState, cluster, func(spec *specs.ClusterStatusSpec) error {
+		if alarmErr := etcdcluster.SetAlarm(spec, status.TypedSpec().Value.EtcdMemberId, strings.ToUpper(alarm), active); alarmErr != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidRequest, alarmErr)
+		}
+
+		return nil
+	})
+	if state.IsNotFoundError(err) {
+		return fmt.Errorf("cluster %s: %w", cluster, ErrNotFound)
+	}
+
+	return err
+}
@@ -0,0 +1,227 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+)
+
+// Client is the admin API client.
+type Client struct {
+	httpClient *http.Client
+	endpoint   string
+}
+
+// NewClient creates the admin API client.
+//
+// The endpoint is either the host:port of the admin API or its base URL.
+func NewClient(endpoint string) *Client {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	return &Client{
+		httpClient: http.DefaultClient,
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+	}
+}
+
+// List implements Fleet.
+func (c *Client) List(ctx context.Context) ([]Machine, error) {
+	var machines []Machine
+
+	if err := c.do(ctx, http.MethodGet, "/v1/machines", nil, &machines); err != nil {
+		return nil, err
+	}
+
+	return machines, nil
+}
+
+// Add implements Fleet.
+func (c *Client) Add(ctx context.Context, req AddRequest) ([]Machine, error) {
+	var machines []Machine
+
+	if err := c.do(ctx, http.MethodPost, "/v1/machines", req, &machines); err != nil {
+		return nil, err
+	}
+
+	return machines, nil
+}
+
+// Remove implements Fleet.
+func (c *Client) Remove(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/machines/"+url.PathEscape(id), nil, nil)
+}
+
+// Pause implements Fleet.
+func (c *Client) Pause(ctx context.Context, id string) error {
+	return c.action(ctx, id, "pause")
+}
+
+// Resume implements Fleet.
+func (c *Client) Resume(ctx context.Context, id string) error {
+	return c.action(ctx, id, "resume")
+}
+
+// Reboot implements Fleet.
+func (c *Client) Reboot(ctx context.Context, id string) error {
+	return c.action(ctx, id, "reboot")
+}
+
+// PowerOff implements Fleet.
+func (c *Client) PowerOff(ctx context.Context, id string) error {
+	return c.action(ctx, id, "poweroff")
+}
+
+// PowerOn implements Fleet.
+func (c *Client) PowerOn(ctx context.Context, id string) error {
+	return c.action(ctx, id, "poweron")
+}
+
+// Kubeconfig implements Fleet.
+func (c *Client) Kubeconfig(ctx context.Context, cluster string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"/v1/clusters/"+url.PathEscape(cluster)+"/kubeconfig", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// Faults implements Fleet.
+func (c *Client) Faults(ctx context.Context, id string) ([]faults.Rule, error) {
+	var rules []faults.Rule
+
+	if err := c.do(ctx, http.MethodGet, "/v1/machines/"+url.PathEscape(id)+"/faults", nil, &rules); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// SetFaults implements Fleet.
+func (c *Client) SetFaults(ctx context.Context, id string, rules []faults.Rule) error {
+	if rules == nil {
+		rules = []faults.Rule{}
+	}
+
+	return c.do(ctx, http.MethodPut, "/v1/machines/"+url.PathEscape(id)+"/faults", rules, nil)
+}
+
+// Partition implements Fleet.
+func (c *Client) Partition(ctx context.Context, id string) error {
+	return c.action(ctx, id, "partition")
+}
+
+// Reconnect implements Fleet.
+func (c *Client) Reconnect(ctx context.Context, id string) error {
+	return c.action(ctx, id, "reconnect")
+}
+
+// SetServiceHealth implements Fleet.
+func (c *Client) SetServiceHealth(ctx context.Context, id, service string, healthy bool) error {
+	return c.do(ctx, http.MethodPut, "/v1/machines/"+url.PathEscape(id)+"/services/"+url.PathEscape(service)+"/health", ServiceHealth{Healthy: healthy}, nil)
+}
+
+// SetEtcdAlarm implements Fleet.
+func (c *Client) SetEtcdAlarm(ctx context.Context, id, alarm string, active bool) error {
+	return c.do(ctx, http.MethodPut, "/v1/machines/"+url.PathEscape(id)+"/etcd/alarms/"+url.PathEscape(alarm), EtcdAlarm{Active: active}, nil)
+}
+
+func (c *Client) action(ctx context.Context, id, action string) error {
+	return c.do(ctx, http.MethodPost, "/v1/machines/"+url.PathEscape(id)+"/"+action, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// apiError is the error returned by the server.
+type apiError struct {
+	sentinel error
+	message  string
+}
+
+func (err *apiError) Error() string {
+	return err.message
+}
+
+func (err *apiError) Unwrap() error {
+	return err.sentinel
+}
+
+// decodeError restores the error returned by the server, keeping ErrNotFound and ErrInvalidRequest matchable.
+func decodeError(resp *http.Response) error {
+	var errResp errorResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+		errResp.Error = resp.Status
+	}
+
+	apiErr := &apiError{message: errResp.Error}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		apiErr.sentinel = ErrNotFound
+	case http.StatusBadRequest:
+		apiErr.sentinel = ErrInvalidRequest
+	}
+
+	return apiErr
+}
@@ -0,0 +1,625 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/cosi-project/runtime/pkg/state"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/siderolabs/talemu/internal/pkg/fleet"
+	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
+	"github.com/siderolabs/talemu/internal/pkg/machine"
+	"github.com/siderolabs/talemu/internal/pkg/machine/controllers"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
+	"github.com/siderolabs/talemu/internal/pkg/schematic"
+)
+
+// ManagerConfig keeps the dependencies shared by all machines of the fleet.
+type ManagerConfig struct {
+	GlobalState       state.State
+	Kubernetes        *kubefactory.Kubernetes
+	SchematicService  *schematic.Service
+	EnterpriseChecker controllers.EnterpriseChecker
+	Logger            *zap.Logger
+	Instance          runtime.Instance
+	// Defaults are used for the fields which are not set when adding the machines.
+	Defaults fleet.Defaults
+	// Faults keeps the fault rules of the machines, no faults are injected if nil.
+	Faults *faults.Registry
+	// Options are appended to the options of every machine.
+	Options []machine.Option
+}
+
+// Manager runs the machines of the static mode fleet and implements Fleet for them.
+type Manager struct {
+	ctx      context.Context //nolint:containedctx
+	machines map[string]*managedMachine
+	errCh    chan error
+	ready    chan struct{}
+	config   ManagerConfig
+	nextSlot int
+	mu       sync.Mutex
+}
+
+// managedMachine is a single machine of the fleet.
+type managedMachine struct {
+	machine *machine.Machine
+	cancel  context.CancelFunc
+	done    chan struct{}
+	state   MachineState
+	fleet.Machine
+	isolatedNetwork bool
+}
+
+// NewManager creates the fleet manager, the machines added to it get the slots starting with firstSlot.
+func NewManager(config ManagerConfig, firstSlot int) *Manager {
+	if config.Faults == nil {
+		config.Faults = faults.NewRegistry(nil)
+	}
+
+	return &Manager{
+		config:   config,
+		machines: map[string]*managedMachine{},
+		errCh:    make(chan error, 1),
+		ready:    make(chan struct{}),
+		nextSlot: firstSlot,
+	}
+}
+
+// Run starts the initial machines and keeps the fleet running until the context is canceled or any machine fails.
+//
+// All machines are stopped and cleaned up before Run returns.
+func (m *Manager) Run(ctx context.Context, machines []fleet.Machine) error {
+	m.mu.Lock()
+
+	m.ctx = ctx
+
+	for _, fm := range machines {
+		if err := m.add(fm); err != nil {
+			m.mu.Unlock()
+
+			return errors.Join(err, m.shutdown())
+		}
+	}
+
+	m.mu.Unlock()
+
+	close(m.ready)
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+	case err = <-m.errCh:
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return multierr.Append(err, m.shutdown())
+}
+
+// Ready is closed when the initial machines are started.
+func (m *Manager) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// List implements Fleet.
+func (m *Manager) List(ctx context.Context) ([]Machine, error) {
+	m.mu.Lock()
+	managed := slices.SortedFunc(maps.Values(m.machines), func(a, b *managedMachine) int {
+		return a.Slot - b.Slot
+	})
+
+	states := make([]MachineState, 0, len(managed))
+
+	for _, mm := range managed {
+		states = append(states, mm.state)
+	}
+	m.mu.Unlock()
+
+	machines := make([]Machine, 0, len(managed))
+
+	for i, mm := range managed {
+		info, err := m.describe(ctx, mm.Machine, states[i])
+		if err != nil {
+			return nil, err
+		}
+
+		machines = append(machines, info)
+	}
+
+	return machines, nil
+}
+
+// Add implements Fleet.
+func (m *Manager) Add(ctx context.Context, req AddRequest) ([]Machine, error) {
+	if req.Count <= 0 {
+		return nil, fmt.Errorf("%w: count should be positive", ErrInvalidRequest)
+	}
+
+	spec := fleet.Spec{
+		Groups: []fleet.Group{
+			{
+				Name:           req.Name,
+				UUIDTemplate:   req.UUIDTemplate,
+				TalosVersion:   req.TalosVersion,
+				Schematic:      req.Schematic,
+				KernelArgs:     req.KernelArgs,
+				BootFactoryURL: req.BootFactoryURL,
+				Extensions:     req.Extensions,
+				Count:          req.Count,
+				SecureBoot:     req.SecureBoot,
+			},
+		},
+	}
+
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ctx == nil || m.ctx.Err() != nil {
+		return nil, errors.New("the fleet is not running")
+	}
+
+	added, err := spec.Machines(m.config.Defaults, m.nextSlot)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	if err = m.checkUUIDs(added); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	for i, fm := range added {
+		if err = m.add(fm); err != nil {
+			// the machines are added all at once: the ones started before the failure are removed
+			for _, started := range added[:i] {
+				id := runtime.MachineID(started.Slot)
+
+				err = errors.Join(err, m.remove(ctx, id, m.machines[id]))
+			}
+
+			return nil, err
+		}
+	}
+
+	machines := make([]Machine, 0, len(added))
+
+	for _, fm := range added {
+		info, err := m.describe(ctx, fm, MachineRunning)
+		if err != nil {
+			return nil, err
+		}
+
+		machines = append(machines, info)
+	}
+
+	return machines, nil
+}
+
+// Remove implements Fleet.
+//
+// The machine is stopped, and its state is removed.
+func (m *Manager) Remove(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mm, err := m.get(id)
+	if err != nil {
+		return err
+	}
+
+	return m.remove(ctx, id, mm)
+}
+
+// remove stops the machine and removes its state.
+func (m *Manager) remove(ctx context.Context, id string, mm *managedMachine) error {
+	if err := m.stop(ctx, mm, true); err != nil {
+		return err
+	}
+
+	delete(m.machines, id)
+
+	m.config.Faults.Forget(id)
+
+	if err := os.RemoveAll(m.config.Instance.GetStateDir(id)); err != nil {
+		return err
+	}
+
+	err := m.config.GlobalState.Destroy(ctx, emu.NewMachineStatus(emu.NamespaceName, id).Metadata())
+	if err != nil && !state.IsNotFoundError(err) {
+		return err
+	}
+
+	m.config.Logger.Info("removed machine", zap.String("machine", id), zap.String("uuid", mm.UUID))
+
+	return nil
+}
+
+// Pause implements Fleet.
+//
+// The machine stops without removing its network links, so it looks hung from the outside.
+// The machines with the userspace network or in the network namespaces can't be paused:
+// their links are gone together with the machine network as soon as they stop.
+func (m *Manager) Pause(ctx context.Context, id string) error {
+	return m.transition(ctx, id, MachinePaused)
+}
+
+// Resume implements Fleet.
+//
+// Resuming the machine boots it again.
+func (m *Manager) Resume(ctx context.Context, id string) error {
+	return m.transition(ctx, id, MachineRunning)
+}
+
+// PowerOff implements Fleet.
+//
+// The running machine marks its Kubernetes node not ready before it stops.
+func (m *Manager) PowerOff(ctx context.Context, id string) error {
+	return m.transition(ctx, id, MachinePoweredOff)
+}
+
+// PowerOn implements Fleet.
+//
+// Only the powered off machines can be powered on, the paused ones are resumed.
+func (m *Manager) PowerOn(ctx context.Context, id string) error {
+	m.mu.Lock()
+
+	mm, err := m.get(id)
+	if err == nil && mm.state == MachinePaused {
+		err = fmt.Errorf("%w: machine %s is %s", ErrInvalidRequest, id, mm.state)
+	}
+
+	m.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return m.transition(ctx, id, MachineRunning)
+}
+
+// Reboot implements Fleet.
+//
+// The machine is stopped and started again, so it gets a new boot ID, as after a hard reset.
+func (m *Manager) Reboot(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mm, err := m.get(id)
+	if err != nil {
+		return err
+	}
+
+	if mm.state != MachineRunning {
+		return fmt.Errorf("%w: machine %s is %s", ErrInvalidRequest, id, mm.state)
+	}
+
+	if err = m.stop(ctx, mm, true); err != nil {
+		return err
+	}
+
+	return m.start(mm)
+}
+
+// Kubeconfig implements Fleet.
+func (m *Manager) Kubeconfig(ctx context.Context, cluster string) ([]byte, error) {
+	return ClusterKubeconfig(ctx, m.config.GlobalState, cluster)
+}
+
+// Faults implements Fleet.
+func (m *Manager) Faults(_ context.Context, id string) ([]faults.Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.get(id); err != nil {
+		return nil, err
+	}
+
+	return m.config.Faults.Injector(id).Rules(), nil
+}
+
+// SetFaults implements Fleet.
+//
+// The rules replace the current machine rules, and apply to the calls started after the change.
+func (m *Manager) SetFaults(_ context.Context, id string, rules []faults.Rule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.get(id); err != nil {
+		return err
+	}
+
+	if err := m.config.Faults.Injector(id).Set(rules); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	m.config.Logger.Info("machine fault rules changed", zap.String("machine", id), zap.Int("rules", len(rules)))
+
+	return nil
+}
+
+// Partition implements Fleet.
+//
+// The SideroLink link of the machine goes down, the machine keeps running.
+func (m *Manager) Partition(ctx context.Context, id string) error {
+	return m.setPartitioned(ctx, id, true)
+}
+
+// Reconnect implements Fleet.
+func (m *Manager) Reconnect(ctx context.Context, id string) error {
+	return m.setPartitioned(ctx, id, false)
+}
+
+// SetServiceHealth implements Fleet.
+func (m *Manager) SetServiceHealth(_ context.Context, id, service string, healthy bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.get(id); err != nil {
+		return err
+	}
+
+	if err := m.config.Faults.Injector(id).SetServiceUnhealthy(service, !healthy); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	m.config.Logger.Info("machine service health changed", zap.String("machine", id), zap.String("service", service), zap.Bool("healthy", healthy))
+
+	return nil
+}
+
+// SetEtcdAlarm implements Fleet.
+func (m *Manager) SetEtcdAlarm(ctx context.Context, id, alarm string, active bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.get(id); err != nil {
+		return err
+	}
+
+	if err := SetEtcdAlarm(ctx, m.config.GlobalState, id, alarm, active); err != nil {
+		return err
+	}
+
+	m.config.Logger.Info("machine etcd alarm changed", zap.String("machine", id), zap.String("alarm", alarm), zap.Bool("active", active))
+
+	return nil
+}
+
+func (m *Manager) setPartitioned(_ context.Context, id string, partitioned bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.get(id); err != nil {
+		return err
+	}
+
+	m.config.Faults.Injector(id).SetPartitioned(partitioned)
+
+	m.config.Logger.Info("machine partition changed", zap.String("machine", id), zap.Bool("partitioned", partitioned))
+
+	return nil
+}
+
+func (m *Manager) transition(ctx context.Context, id string, target MachineState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mm, err := m.get(id)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case mm.state == target:
+		return nil
+	case target == MachinePaused && mm.isolatedNetwork:
+		return fmt.Errorf("%w: machine %s can't be paused, its network is torn down when it stops", ErrInvalidRequest, id)
+	case target == MachineRunning:
+		return m.start(mm)
+	case mm.state == MachineRunning && target == MachinePoweredOff:
+		err = m.powerOff(ctx, mm)
+	case mm.state == MachineRunning:
+		err = m.stop(ctx, mm, false)
+	case target == MachinePoweredOff:
+		// the paused machine has already stopped, only its links are left
+		err = mm.machine.Cleanup(ctx)
+	default:
+		return fmt.Errorf("%w: machine %s is %s", ErrInvalidRequest, id, mm.state)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	mm.state = target
+
+	m.config.Logger.Info("machine state changed", zap.String("machine", id), zap.String("state", string(target)))
+
+	return nil
+}
+
+func (m *Manager) get(id string) (*managedMachine, error) {
+	mm, ok := m.machines[id]
+	if !ok {
+		return nil, fmt.Errorf("machine %s: %w", id, ErrNotFound)
+	}
+
+	return mm, nil
+}
+
+// checkUUIDs makes sure the new machines don't reuse the UUIDs of the fleet, as the machines of a single fleet spec don't.
+func (m *Manager) checkUUIDs(added []fleet.Machine) error {
+	uuids := make(map[string]string, len(m.machines))
+
+	for id, mm := range m.machines {
+		uuids[mm.UUID] = id
+	}
+
+	for _, fm := range added {
+		if id, ok := uuids[fm.UUID]; ok {
+			return fmt.Errorf("UUID %q is already used by machine %s", fm.UUID, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) add(fm fleet.Machine) error {
+	id := runtime.MachineID(fm.Slot)
+
+	if _, ok := m.machines[id]; ok {
+		return fmt.Errorf("machine %s already exists", id)
+	}
+
+	mm := &managedMachine{
+		Machine: fm,
+	}
+
+	if err := m.start(mm); err != nil {
+		return err
+	}
+
+	m.machines[id] = mm
+	m.nextSlot = max(m.nextSlot, fm.Slot+1)
+
+	return nil
+}
+
+func (m *Manager) start(mm *managedMachine) error {
+	params, err := machine.ParseKernelArgs(mm.KernelArgs)
+	if err != nil {
+		return err
+	}
+
+	emuMachine, err := machine.NewMachine(mm.UUID, m.config.Logger, m.config.GlobalState, m.config.SchematicService, m.config.EnterpriseChecker, m.config.Instance)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	done := make(chan struct{})
+
+	options := append(mm.Options(), m.config.Options...)
+	options = append(options, machine.WithFaultInjector(m.config.Faults.Injector(runtime.MachineID(mm.Slot))))
+
+	go func() {
+		defer close(done)
+
+		runErr := emuMachine.Run(ctx, params, mm.Slot, m.config.Kubernetes, options...)
+		if errors.Is(runErr, machine.ErrPoweredOff) {
+			// the lock might be held by a call waiting for the machine to stop, so the state is updated after it stops
+			go m.poweredOff(mm, emuMachine)
+
+			return
+		}
+
+		if runErr != nil && ctx.Err() == nil {
+			select {
+			case m.errCh <- fmt.Errorf("machine %s failed: %w", runtime.MachineID(mm.Slot), runErr):
+			default:
+			}
+		}
+	}()
+
+	mm.machine = emuMachine
+	mm.cancel = cancel
+	mm.done = done
+	mm.state = MachineRunning
+	mm.isolatedNetwork = machine.IsolatedNetwork(options...)
+
+	return nil
+}
+
+// poweredOff records that the machine powered itself off, e.g. after a reset without a reboot.
+func (m *Manager) poweredOff(mm *managedMachine, emuMachine *machine.Machine) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the machine could have been restarted or removed meanwhile
+	if mm.machine != emuMachine || mm.state != MachineRunning {
+		return
+	}
+
+	if err := mm.machine.Cleanup(context.Background()); err != nil {
+		m.config.Logger.Warn("failed to clean up the powered off machine", zap.String("machine", runtime.MachineID(mm.Slot)), zap.Error(err))
+	}
+
+	mm.state = MachinePoweredOff
+
+	m.config.Logger.Info("machine state changed", zap.String("machine", runtime.MachineID(mm.Slot)), zap.String("state", string(MachinePoweredOff)))
+}
+
+// powerOff lets the running machine power itself off, so that its node goes not ready, and removes its network links.
+//
+// The machine is stopped right away if it doesn't power off before the context is done.
+func (m *Manager) powerOff(ctx context.Context, mm *managedMachine) error {
+	mm.machine.PowerOff()
+
+	select {
+	case <-mm.done:
+	case <-ctx.Done():
+		mm.cancel()
+
+		<-mm.done
+	}
+
+	return mm.machine.Cleanup(ctx)
+}
+
+// stop waits for the machine to stop, and optionally removes its network links.
+func (m *Manager) stop(ctx context.Context, mm *managedMachine, cleanup bool) error {
+	if mm.state == MachineRunning {
+		mm.cancel()
+
+		<-mm.done
+	}
+
+	if cleanup && mm.state != MachinePoweredOff {
+		return mm.machine.Cleanup(ctx)
+	}
+
+	return nil
+}
+
+// shutdown stops all machines, it is called when the fleet stops.
+func (m *Manager) shutdown() error {
+	var eg errgroup.Group
+
+	for _, mm := range m.machines {
+		eg.Go(func() error {
+			return m.stop(context.Background(), mm, true)
+		})
+	}
+
+	return eg.Wait()
+}
+
+func (m *Manager) describe(ctx context.Context, fm fleet.Machine, machineState MachineState) (Machine, error) {
+	return Describe(ctx, m.config.GlobalState, Machine{
+		ID:    runtime.MachineID(fm.Slot),
+		UUID:  fm.UUID,
+		Group: fm.Group,
+		State: machineState,
+		Slot:  fm.Slot,
+	})
+}
@@ -0,0 +1,189 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+)
+
+// errorResponse is the body of all failed responses.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler creates the HTTP handler of the admin API.
+func NewHandler(fleet Fleet, logger *zap.Logger) http.Handler {
+	mux := http.NewServeMux()
+
+	actions := map[string]func(context.Context, string) error{
+		"pause":     fleet.Pause,
+		"resume":    fleet.Resume,
+		"reboot":    fleet.Reboot,
+		"poweroff":  fleet.PowerOff,
+		"poweron":   fleet.PowerOn,
+		"partition": fleet.Partition,
+		"reconnect": fleet.Reconnect,
+	}
+
+	mux.HandleFunc("GET /v1/machines", func(w http.ResponseWriter, r *http.Request) {
+		machines, err := fleet.List(r.Context())
+
+		respond(w, logger, machines, err)
+	})
+
+	mux.HandleFunc("POST /v1/machines", func(w http.ResponseWriter, r *http.Request) {
+		var req AddRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respond(w, logger, nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err))
+
+			return
+		}
+
+		machines, err := fleet.Add(r.Context(), req)
+
+		respond(w, logger, machines, err)
+	})
+
+	mux.HandleFunc("DELETE /v1/machines/{id}", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, logger, nil, fleet.Remove(r.Context(), r.PathValue("id")))
+	})
+
+	mux.HandleFunc("POST /v1/machines/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		action, ok := actions[r.PathValue("action")]
+		if !ok {
+			respond(w, logger, nil, fmt.Errorf("%w: unknown action %q", ErrInvalidRequest, r.PathValue("action")))
+
+			return
+		}
+
+		respond(w, logger, nil, action(r.Context(), r.PathValue("id")))
+	})
+
+	mux.HandleFunc("GET /v1/machines/{id}/faults", func(w http.ResponseWriter, r *http.Request) {
+		rules, err := fleet.Faults(r.Context(), r.PathValue("id"))
+
+		respond(w, logger, rules, err)
+	})
+
+	mux.HandleFunc("PUT /v1/machines/{id}/faults", func(w http.ResponseWriter, r *http.Request) {
+		var rules []faults.Rule
+
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			respond(w, logger, nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err))
+
+			return
+		}
+
+		respond(w, logger, nil, fleet.SetFaults(r.Context(), r.PathValue("id"), rules))
+	})
+
+	mux.HandleFunc("PUT /v1/machines/{id}/services/{service}/health", func(w http.ResponseWriter, r *http.Request) {
+		var health ServiceHealth
+
+		if err := json.NewDecoder(r.Body).Decode(&health); err != nil {
+			respond(w, logger, nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err))
+
+			return
+		}
+
+		respond(w, logger, nil, fleet.SetServiceHealth(r.Context(), r.PathValue("id"), r.PathValue("service"), health.Healthy))
+	})
+
+	mux.HandleFunc("PUT /v1/machines/{id}/etcd/alarms/{alarm}", func(w http.ResponseWriter, r *http.Request) {
+		var alarm EtcdAlarm
+
+		if err := json.NewDecoder(r.Body).Decode(&alarm); err != nil {
+			respond(w, logger, nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err))
+
+			return
+		}
+
+		respond(w, logger, nil, fleet.SetEtcdAlarm(r.Context(), r.PathValue("id"), r.PathValue("alarm"), alarm.Active))
+	})
+
+	mux.HandleFunc("GET /v1/clusters/{id}/kubeconfig", func(w http.ResponseWriter, r *http.Request) {
+		kubeconfig, err := fleet.Kubeconfig(r.Context(), r.PathValue("id"))
+		if err != nil {
+			respond(w, logger, nil, err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(kubeconfig) //nolint:errcheck
+	})
+
+	return mux
+}
+
+// Serve runs the admin API on the address until the context is canceled.
+func Serve(ctx context.Context, address string, fleet Fleet, logger *zap.Logger) error {
+	var lc net.ListenConfig
+
+	lis, err := lc.Listen(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("error listening on the admin API address: %w", err)
+	}
+
+	srv := &http.Server{
+		Handler:           NewHandler(fleet, logger),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		srv.Shutdown(shutdownCtx) //nolint:errcheck,contextcheck
+	}()
+
+	logger.Info("admin API is listening", zap.Stringer("address", lis.Addr()))
+
+	if err = srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func respond(w http.ResponseWriter, logger *zap.Logger, body any, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrInvalidRequest):
+			status = http.StatusBadRequest
+		default:
+			logger.Error("admin API request failed", zap.Error(err))
+		}
+
+		w.WriteHeader(status)
+
+		body = errorResponse{Error: err.Error()}
+	}
+
+	if body == nil {
+		body = struct{}{}
+	}
+
+	json.NewEncoder(w).Encode(body) //nolint:errcheck,errchkjson
+}
@@ -0,0 +1,251 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package admin_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/siderolabs/talemu/internal/pkg/admin"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+)
+
+type fakeFleet struct {
+	machines map[string]admin.MachineState
+	faults   map[string][]faults.Rule
+	mu       sync.Mutex
+}
+
+func (f *fakeFleet) List(context.Context) ([]admin.Machine, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	machines := make([]admin.Machine, 0, len(f.machines))
+
+	for id, state := range f.machines {
+		machines = append(machines, admin.Machine{ID: id, State: state})
+	}
+
+	return machines, nil
+}
+
+func (f *fakeFleet) Add(_ context.Context, req admin.AddRequest) ([]admin.Machine, error) {
+	if req.Count <= 0 {
+		return nil, fmt.Errorf("%w: count should be positive", admin.ErrInvalidRequest)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	machines := make([]admin.Machine, 0, req.Count)
+
+	for range req.Count {
+		id := strconv.Itoa(1000 + len(f.machines))
+
+		f.machines[id] = admin.MachineRunning
+
+		machines = append(machines, admin.Machine{ID: id, Group: req.Name, State: admin.MachineRunning})
+	}
+
+	return machines, nil
+}
+
+func (f *fakeFleet) Remove(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.machines[id]; !ok {
+		return fmt.Errorf("machine %s: %w", id, admin.ErrNotFound)
+	}
+
+	delete(f.machines, id)
+
+	return nil
+}
+
+func (f *fakeFleet) Pause(_ context.Context, id string) error {
+	return f.set(id, admin.MachinePaused)
+}
+
+func (f *fakeFleet) Resume(_ context.Context, id string) error {
+	return f.set(id, admin.MachineRunning)
+}
+
+func (f *fakeFleet) Reboot(_ context.Context, id string) error {
+	return f.set(id, admin.MachineRunning)
+}
+
+func (f *fakeFleet) PowerOff(_ context.Context, id string) error {
+	return f.set(id, admin.MachinePoweredOff)
+}
+
+func (f *fakeFleet) PowerOn(_ context.Context, id string) error {
+	return f.set(id, admin.MachineRunning)
+}
+
+func (f *fakeFleet) Kubeconfig(_ context.Context, cluster string) ([]byte, error) {
+	if cluster != "talos-default" {
+		return nil, fmt.Errorf("cluster %s: %w", cluster, admin.ErrNotFound)
+	}
+
+	return []byte("apiVersion: v1\nkind: Config\n"), nil
+}
+
+func (f *fakeFleet) Faults(_ context.Context, id string) ([]faults.Rule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.faults[id], nil
+}
+
+func (f *fakeFleet) SetFaults(_ context.Context, id string, rules []faults.Rule) error {
+	if err := faults.Validate(rules); err != nil {
+		return fmt.Errorf("%w: %w", admin.ErrInvalidRequest, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults[id] = rules
+
+	return nil
+}
+
+func (f *fakeFleet) Partition(_ context.Context, id string) error {
+	return f.check(id)
+}
+
+func (f *fakeFleet) Reconnect(_ context.Context, id string) error {
+	return f.check(id)
+}
+
+func (f *fakeFleet) SetServiceHealth(_ context.Context, id, service string, _ bool) error {
+	if service != "etcd" {
+		return fmt.Errorf("%w: unsupported service %q", admin.ErrInvalidRequest, service)
+	}
+
+	return f.check(id)
+}
+
+func (f *fakeFleet) SetEtcdAlarm(_ context.Context, id, alarm string, _ bool) error {
+	if alarm != "nospace" && alarm != "corrupt" {
+		return fmt.Errorf("%w: unknown etcd alarm %q", admin.ErrInvalidRequest, alarm)
+	}
+
+	return f.check(id)
+}
+
+func (f *fakeFleet) check(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.machines[id]; !ok {
+		return fmt.Errorf("machine %s: %w", id, admin.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (f *fakeFleet) set(id string, state admin.MachineState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.machines[id]; !ok {
+		return fmt.Errorf("machine %s: %w", id, admin.ErrNotFound)
+	}
+
+	f.machines[id] = state
+
+	return nil
+}
+
+func TestAPI(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+
+	srv := httptest.NewServer(admin.NewHandler(&fakeFleet{
+		machines: map[string]admin.MachineState{},
+		faults:   map[string][]faults.Rule{},
+	}, zaptest.NewLogger(t)))
+	t.Cleanup(srv.Close)
+
+	client := admin.NewClient(srv.URL)
+
+	added, err := client.Add(ctx, admin.AddRequest{Name: "workers", Count: 2})
+	require.NoError(t, err)
+	require.Len(t, added, 2)
+	assert.Equal(t, "workers", added[0].Group)
+
+	_, err = client.Add(ctx, admin.AddRequest{})
+	require.ErrorIs(t, err, admin.ErrInvalidRequest)
+	assert.ErrorContains(t, err, "count should be positive")
+
+	require.NoError(t, client.Pause(ctx, "1000"))
+	require.NoError(t, client.PowerOff(ctx, "1001"))
+
+	machines, err := client.List(ctx)
+	require.NoError(t, err)
+
+	states := map[string]admin.MachineState{}
+
+	for _, m := range machines {
+		states[m.ID] = m.State
+	}
+
+	assert.Equal(t, map[string]admin.MachineState{
+		"1000": admin.MachinePaused,
+		"1001": admin.MachinePoweredOff,
+	}, states)
+
+	require.NoError(t, client.Resume(ctx, "1000"))
+	require.NoError(t, client.Reboot(ctx, "1000"))
+	require.NoError(t, client.PowerOn(ctx, "1001"))
+	require.ErrorIs(t, client.PowerOn(ctx, "2000"), admin.ErrNotFound)
+	require.NoError(t, client.Remove(ctx, "1001"))
+	require.ErrorIs(t, client.Remove(ctx, "1001"), admin.ErrNotFound)
+	require.ErrorIs(t, client.Reboot(ctx, "2000"), admin.ErrNotFound)
+
+	kubeconfig, err := client.Kubeconfig(ctx, "talos-default")
+	require.NoError(t, err)
+	assert.Contains(t, string(kubeconfig), "kind: Config")
+
+	_, err = client.Kubeconfig(ctx, "missing")
+	require.ErrorIs(t, err, admin.ErrNotFound)
+
+	rules := []faults.Rule{
+		{
+			Method:  "^/machine.MachineService/Upgrade$",
+			Code:    "Unavailable",
+			Latency: faults.Duration(2 * time.Second),
+		},
+	}
+
+	require.NoError(t, client.SetFaults(ctx, "1000", rules))
+
+	actual, err := client.Faults(ctx, "1000")
+	require.NoError(t, err)
+	assert.Equal(t, rules, actual)
+
+	require.ErrorIs(t, client.SetFaults(ctx, "1000", []faults.Rule{{Method: "("}}), admin.ErrInvalidRequest)
+
+	require.NoError(t, client.Partition(ctx, "1000"))
+	require.NoError(t, client.Reconnect(ctx, "1000"))
+	require.NoError(t, client.SetServiceHealth(ctx, "1000", "etcd", false))
+	require.ErrorIs(t, client.SetServiceHealth(ctx, "1000", "kubelet", false), admin.ErrInvalidRequest)
+	require.NoError(t, client.SetEtcdAlarm(ctx, "1000", "nospace", true))
+	require.ErrorIs(t, client.SetEtcdAlarm(ctx, "1000", "full", true), admin.ErrInvalidRequest)
+	require.ErrorIs(t, client.SetEtcdAlarm(ctx, "2000", "corrupt", false), admin.ErrNotFound)
+	require.ErrorIs(t, client.Partition(ctx, "2000"), admin.ErrNotFound)
+}
@@ -8,6 +8,17 @@ package constants
 // OmniEndpoint is the Omni endpoint inside the siderolink network.
 const OmniEndpoint = "fdae:41e4:649b:9303::1"
 
+// DefaultStateDir is the default root directory of the emulator state.
+const DefaultStateDir = "_out/state"
+
+// DefaultEtcdClientAddress is the default client address of the emulator etcd.
+//
+// It differs from the standard etcd ports to avoid clashing with Omni etcd.
+const DefaultEtcdClientAddress = "localhost:2400"
+
+// DefaultEtcdPeerAddress is the default peer address of the emulator etcd.
+const DefaultEtcdPeerAddress = "localhost:2401"
+
 // APIDService name.
 const APIDService = "apid"
 
@@ -17,6 +28,15 @@ const ETCDService = "etcd"
 // KubeletService name.
 const KubeletService = "kubelet"
 
+// MachinedService name.
+const MachinedService = "machined"
+
+// ExtensionServicePrefix is the prefix of the extension service names.
+const ExtensionServicePrefix = "ext-"
+
+// KernelVersion is the kernel version reported by the emulated machines.
+const KernelVersion = "6.1.82-talos"
+
 // DefaultImageFactoryBaseURL is the default URL for the Talos image factory.
 const DefaultImageFactoryBaseURL = "https://factory.talos.dev"
 
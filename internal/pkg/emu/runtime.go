@@ -28,9 +28,11 @@ type Runtime struct {
 }
 
 // NewRuntime creates new runtime.
-func NewRuntime(globalState state.State, kubernetes *kubefactory.Kubernetes, logger *zap.Logger) (*Runtime, error) {
-	if os.Getuid() != 0 {
-		return nil, errors.New("emulator needs to run as root")
+//
+// The machines need root privileges to manage the kernel network links, unless they all use the userspace network.
+func NewRuntime(globalState state.State, kubernetes *kubefactory.Kubernetes, logger *zap.Logger, userspaceNetwork bool) (*Runtime, error) {
+	if os.Getuid() != 0 && !userspaceNetwork {
+		return nil, errors.New("emulator needs to run as root, or with the userspace network")
 	}
 
 	controllers := []controller.Controller{
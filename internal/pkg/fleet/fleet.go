@@ -0,0 +1,332 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package fleet implements the declarative description of the machines emulated in static mode.
+package fleet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/google/uuid"
+	"github.com/siderolabs/image-factory/pkg/schematic"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine"
+	"github.com/siderolabs/talemu/internal/pkg/machine/hardware"
+)
+
+// DefaultUUIDTemplate reproduces the UUIDs the emulator generates when no fleet file is used.
+const DefaultUUIDTemplate = `{{ printf "%04d" .Slot }}1802-c798-4da7-a410-f09abb48c8d8`
+
+// Spec is the fleet file contents.
+type Spec struct {
+	Groups []Group `yaml:"groups"`
+}
+
+// Group describes a set of identical machines.
+//
+// Empty fields fall back to the defaults coming from the command line flags.
+type Group struct {
+	Name string `yaml:"name"`
+	// UUIDTemplate is a text/template rendered for each machine, it can reference .Slot, .Index and .Group.
+	UUIDTemplate string `yaml:"uuid_template"`
+	TalosVersion string `yaml:"talos_version"`
+	// Schematic is the schematic ID to boot the machines with, when empty it is computed from Extensions and KernelArgs.
+	Schematic string `yaml:"schematic"`
+	// KernelArgs are appended to the kernel args the emulator is started with.
+	KernelArgs string `yaml:"kernel_args"`
+	// BootFactoryURL is the base URL of the image factory the machines' boot media is pretended to come from.
+	BootFactoryURL string `yaml:"boot_factory_url"`
+	// Hardware is the emulated hardware of the machines, the default profile is used when it is not set.
+	Hardware   *hardware.Profile `yaml:"hardware"`
+	Extensions []string          `yaml:"extensions"`
+	Count      int               `yaml:"count"`
+	SecureBoot bool              `yaml:"secure_boot"`
+}
+
+// Defaults are used for the fields which are not set in a group.
+type Defaults struct {
+	TalosVersion string
+	KernelArgs   string
+	Extensions   []string
+}
+
+// Machine is a single machine expanded from a fleet group.
+type Machine struct {
+	UUID           string
+	Group          string
+	TalosVersion   string
+	Schematic      string
+	KernelArgs     string
+	BootFactoryURL string
+	Hardware       *hardware.Profile
+	Slot           int
+	SecureBoot     bool
+}
+
+// Options converts the machine description to the machine options.
+func (m Machine) Options() []machine.Option {
+	return []machine.Option{
+		machine.WithTalosVersion(m.TalosVersion),
+		machine.WithSchematic(m.Schematic),
+		machine.WithSecureBoot(m.SecureBoot),
+		machine.WithBootFactoryURL(m.BootFactoryURL),
+		machine.WithHardwareProfile(m.Hardware),
+	}
+}
+
+// Load reads the fleet spec from the file.
+func Load(path string) (*Spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	spec, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fleet file %q: %w", path, err)
+	}
+
+	return spec, nil
+}
+
+// Parse decodes and validates the fleet spec.
+func Parse(r io.Reader) (*Spec, error) {
+	var spec Spec
+
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&spec); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the fleet file is empty")
+		}
+
+		return nil, err
+	}
+
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &spec, nil
+}
+
+// Single builds the fleet spec consisting of a single group of the specified size.
+func Single(count int) *Spec {
+	return &Spec{
+		Groups: []Group{
+			{
+				Name:  "default",
+				Count: count,
+			},
+		},
+	}
+}
+
+// Validate the spec.
+func (spec *Spec) Validate() error {
+	var errs error
+
+	if len(spec.Groups) == 0 {
+		return errors.New("the fleet has no groups")
+	}
+
+	names := make(map[string]struct{}, len(spec.Groups))
+
+	for i, group := range spec.Groups {
+		name := group.name(i)
+
+		if group.Name != "" {
+			if _, ok := names[group.Name]; ok {
+				errs = errors.Join(errs, fmt.Errorf("group %s: duplicate group name", name))
+			}
+
+			names[group.Name] = struct{}{}
+		}
+
+		if group.Count < 0 {
+			errs = errors.Join(errs, fmt.Errorf("group %s: count can not be negative", name))
+		}
+
+		if group.Schematic != "" && len(group.Extensions) > 0 {
+			errs = errors.Join(errs, fmt.Errorf("group %s: schematic can not be used together with extensions", name))
+		}
+
+		if group.BootFactoryURL != "" {
+			if u, err := url.Parse(group.BootFactoryURL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = errors.Join(errs, fmt.Errorf("group %s: boot_factory_url %q is not a valid base URL", name, group.BootFactoryURL))
+			}
+		}
+
+		if group.Hardware != nil {
+			if err := group.Hardware.Validate(); err != nil {
+				errs = errors.Join(errs, fmt.Errorf("group %s: invalid hardware profile: %w", name, err))
+			}
+		}
+
+		// render the template once up front, so that broken templates are rejected when the file is loaded
+		tmpl, err := group.uuidTemplate()
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("group %s: invalid uuid template: %w", name, err))
+
+			continue
+		}
+
+		if _, err = renderUUID(tmpl, name, 0, 0); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("group %s: %w", name, err))
+		}
+	}
+
+	return errs
+}
+
+// Machines expands all groups into machines, assigning consecutive slots starting with firstSlot.
+func (spec *Spec) Machines(defaults Defaults, firstSlot int) ([]Machine, error) {
+	var machines []Machine
+
+	slot := firstSlot
+	uuids := map[string]struct{}{}
+
+	for i, group := range spec.Groups {
+		name := group.name(i)
+
+		expanded, err := group.expand(name, defaults, slot)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", name, err)
+		}
+
+		for _, m := range expanded {
+			if _, ok := uuids[m.UUID]; ok {
+				return nil, fmt.Errorf("group %s: duplicate UUID %q", name, m.UUID)
+			}
+
+			uuids[m.UUID] = struct{}{}
+		}
+
+		slot += len(expanded)
+
+		machines = append(machines, expanded...)
+	}
+
+	return machines, nil
+}
+
+// name returns the group name, generating one from the group index if it is not set.
+func (group Group) name(index int) string {
+	if group.Name != "" {
+		return group.Name
+	}
+
+	return fmt.Sprintf("group-%d", index)
+}
+
+// uuidTemplate parses the group UUID template, falling back to the default one.
+func (group Group) uuidTemplate() (*template.Template, error) {
+	uuidTemplate := group.UUIDTemplate
+	if uuidTemplate == "" {
+		uuidTemplate = DefaultUUIDTemplate
+	}
+
+	return template.New("uuid").Option("missingkey=error").Parse(uuidTemplate)
+}
+
+// renderUUID renders the UUID of a single machine and checks that the result is a valid UUID.
+func renderUUID(tmpl *template.Template, group string, slot, index int) (string, error) {
+	var buf bytes.Buffer
+
+	if err := tmpl.Execute(&buf, struct {
+		Group string
+		Slot  int
+		Index int
+	}{
+		Group: group,
+		Slot:  slot,
+		Index: index,
+	}); err != nil {
+		return "", fmt.Errorf("failed to render uuid template: %w", err)
+	}
+
+	machineUUID := strings.TrimSpace(buf.String())
+
+	if _, err := uuid.Parse(machineUUID); err != nil {
+		return "", fmt.Errorf("uuid template produced an invalid UUID %q: %w", machineUUID, err)
+	}
+
+	return machineUUID, nil
+}
+
+func (group Group) expand(name string, defaults Defaults, firstSlot int) ([]Machine, error) {
+	tmpl, err := group.uuidTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	talosVersion := group.TalosVersion
+	if talosVersion == "" {
+		talosVersion = defaults.TalosVersion
+	}
+
+	kernelArgs := strings.TrimSpace(strings.Join([]string{defaults.KernelArgs, group.KernelArgs}, " "))
+
+	schematicID := group.Schematic
+	if schematicID == "" {
+		extensions := group.Extensions
+		if extensions == nil {
+			extensions = defaults.Extensions
+		}
+
+		if schematicID, err = SchematicID(kernelArgs, extensions); err != nil {
+			return nil, err
+		}
+	}
+
+	machines := make([]Machine, 0, group.Count)
+
+	for index := range group.Count {
+		slot := firstSlot + index
+
+		machineUUID, err := renderUUID(tmpl, name, slot, index)
+		if err != nil {
+			return nil, err
+		}
+
+		machines = append(machines, Machine{
+			UUID:           machineUUID,
+			Group:          name,
+			Slot:           slot,
+			TalosVersion:   talosVersion,
+			Schematic:      schematicID,
+			KernelArgs:     kernelArgs,
+			BootFactoryURL: group.BootFactoryURL,
+			Hardware:       group.Hardware,
+			SecureBoot:     group.SecureBoot,
+		})
+	}
+
+	return machines, nil
+}
+
+// SchematicID computes the ID of the schematic with the kernel args and official extensions.
+func SchematicID(kernelArgs string, extensions []string) (string, error) {
+	initialSchematic := schematic.Schematic{
+		Customization: schematic.Customization{
+			ExtraKernelArgs: strings.Fields(kernelArgs),
+			SystemExtensions: schematic.SystemExtensions{
+				OfficialExtensions: extensions,
+			},
+		},
+	}
+
+	return initialSchematic.ID()
+}
@@ -0,0 +1,191 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package fleet_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/internal/pkg/fleet"
+	"github.com/siderolabs/talemu/internal/pkg/machine/hardware"
+)
+
+const fleetYAML = `groups:
+  - name: workers
+    count: 2
+    talos_version: v1.9.0
+  - name: no-extensions
+    count: 1
+    extensions: []
+  - name: control-planes
+    count: 1
+    hardware:
+      cpus:
+        - core_count: 16
+        - core_count: 16
+      memory:
+        - size: 32768
+      disks:
+        - type: nvme
+          size: 1099511627776
+          model: Samsung SSD 980
+    uuid_template: '{{ printf "%08d" .Index }}-0000-0000-0000-{{ printf "%012d" .Slot }}'
+    secure_boot: true
+    boot_factory_url: https://factory.example.com
+    schematic: 376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba
+    kernel_args: console=ttyS0
+`
+
+func TestMachines(t *testing.T) {
+	t.Parallel()
+
+	spec, err := fleet.Parse(strings.NewReader(fleetYAML))
+	require.NoError(t, err)
+
+	defaultSchematic, err := fleet.SchematicID("siderolink.api=grpc://127.0.0.1:8090", []string{"siderolabs/hello-world-service"})
+	require.NoError(t, err)
+
+	machines, err := spec.Machines(fleet.Defaults{
+		TalosVersion: "v1.8.0",
+		KernelArgs:   "siderolink.api=grpc://127.0.0.1:8090",
+		Extensions:   []string{"siderolabs/hello-world-service"},
+	}, 1000)
+	require.NoError(t, err)
+	require.Len(t, machines, 4)
+
+	assert.Equal(t, fleet.Machine{
+		UUID:         "10001802-c798-4da7-a410-f09abb48c8d8",
+		Group:        "workers",
+		TalosVersion: "v1.9.0",
+		Schematic:    defaultSchematic,
+		KernelArgs:   "siderolink.api=grpc://127.0.0.1:8090",
+		Slot:         1000,
+	}, machines[0])
+
+	assert.Equal(t, "10011802-c798-4da7-a410-f09abb48c8d8", machines[1].UUID)
+	assert.Equal(t, 1001, machines[1].Slot)
+
+	// an explicitly empty extension list overrides the default extensions, unset talos_version falls back to the default
+	noExtensionsSchematic, err := fleet.SchematicID("siderolink.api=grpc://127.0.0.1:8090", nil)
+	require.NoError(t, err)
+	require.NotEqual(t, defaultSchematic, noExtensionsSchematic)
+
+	assert.Equal(t, fleet.Machine{
+		UUID:         "10021802-c798-4da7-a410-f09abb48c8d8",
+		Group:        "no-extensions",
+		TalosVersion: "v1.8.0",
+		Schematic:    noExtensionsSchematic,
+		KernelArgs:   "siderolink.api=grpc://127.0.0.1:8090",
+		Slot:         1002,
+	}, machines[2])
+
+	assert.Equal(t, fleet.Machine{
+		UUID:           "00000000-0000-0000-0000-000000001003",
+		Group:          "control-planes",
+		TalosVersion:   "v1.8.0",
+		Schematic:      "376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba",
+		KernelArgs:     "siderolink.api=grpc://127.0.0.1:8090 console=ttyS0",
+		BootFactoryURL: "https://factory.example.com",
+		Hardware: &hardware.Profile{
+			CPUs:   []hardware.CPU{{CoreCount: 16}, {CoreCount: 16}},
+			Memory: []hardware.DIMM{{Size: 32768}},
+			Disks:  []hardware.Disk{{Type: hardware.DiskTypeNVMe, Size: 1099511627776, Model: "Samsung SSD 980"}},
+		},
+		Slot:       1003,
+		SecureBoot: true,
+	}, machines[3])
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "empty",
+			input:    "",
+			expected: "the fleet file is empty",
+		},
+		{
+			name:     "no groups",
+			input:    "groups: []",
+			expected: "the fleet has no groups",
+		},
+		{
+			name:     "unknown field",
+			input:    "groups:\n  - cnt: 1",
+			expected: "field cnt not found",
+		},
+		{
+			name:     "duplicate name",
+			input:    "groups:\n  - name: a\n    count: 1\n  - name: a\n    count: 1",
+			expected: "group a: duplicate group name",
+		},
+		{
+			name:     "schematic and extensions",
+			input:    "groups:\n  - count: 1\n    schematic: abc\n    extensions: [siderolabs/iscsi-tools]",
+			expected: "group group-0: schematic can not be used together with extensions",
+		},
+		{
+			name:     "invalid uuid template",
+			input:    "groups:\n  - name: broken\n    count: 1\n    uuid_template: 'machine-{{ .Slot }}'",
+			expected: `group broken: uuid template produced an invalid UUID "machine-0"`,
+		},
+		{
+			name:     "unknown uuid template field",
+			input:    "groups:\n  - name: broken\n    count: 1\n    uuid_template: '{{ .Rack }}'",
+			expected: "group broken: failed to render uuid template",
+		},
+		{
+			name:     "bad hardware profile",
+			input:    "groups:\n  - name: odd\n    count: 1\n    hardware:\n      cpus: [{core_count: 4}]\n      memory: [{size: 4096}]\n      disks: [{type: floppy}]",
+			expected: `group odd: invalid hardware profile: disk 0: unknown disk type "floppy"`,
+		},
+		{
+			name:     "bad boot factory URL",
+			input:    "groups:\n  - count: 1\n    boot_factory_url: factory",
+			expected: `group group-0: boot_factory_url "factory" is not a valid base URL`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := fleet.Parse(strings.NewReader(tt.input))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+}
+
+func TestMachinesDuplicateUUID(t *testing.T) {
+	t.Parallel()
+
+	input := `groups:
+  - name: a
+    count: 2
+    uuid_template: '{{ printf "%08d" .Index }}-0000-0000-0000-000000000000'
+  - name: b
+    count: 1
+    uuid_template: '{{ printf "%08d" .Index }}-0000-0000-0000-000000000000'
+`
+
+	spec, err := fleet.Parse(strings.NewReader(input))
+	require.NoError(t, err)
+
+	_, err = spec.Machines(fleet.Defaults{}, 1)
+	require.EqualError(t, err, `group b: duplicate UUID "00000000-0000-0000-0000-000000000000"`)
+
+	spec, err = fleet.Parse(strings.NewReader("groups:\n  - name: static\n    count: 2\n    uuid_template: 00000000-0000-0000-0000-000000000001"))
+	require.NoError(t, err)
+
+	_, err = spec.Machines(fleet.Defaults{}, 1)
+	require.EqualError(t, err, `group static: duplicate UUID "00000000-0000-0000-0000-000000000001"`)
+}
@@ -0,0 +1,272 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/siderolabs/gen/xslices"
+	"github.com/siderolabs/talos/pkg/machinery/config/config"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"k8s.io/kubernetes/cmd/kube-apiserver/app/options"
+)
+
+const (
+	apiServerConfigAPIVersion = "apiserver.config.k8s.io/v1"
+
+	admissionControlConfigFile = "admission-control-config.yaml"
+	auditPolicyFile            = "audit-policy.yaml"
+	authenticationConfigFile   = "authentication-config.yaml"
+	encryptionConfigFile       = "encryption-config.yaml"
+	auditLogFile               = "audit/kube-apiserver.log"
+
+	// the audit logs are kept much smaller than on Talos, as there are many api servers on a single host.
+	auditLogMaxAge     = 30
+	auditLogMaxBackups = 1
+	auditLogMaxSize    = 10
+)
+
+// managedAPIServerArgs are the kube-apiserver flags set by the emulator, extraArgs can't override them.
+//
+// The feature gates and the emulated version are global to the process, so they can't be set per api server either.
+var managedAPIServerArgs = []string{
+	"admission-control-config-file",
+	"advertise-address",
+	"audit-log-path",
+	"audit-policy-file",
+	"authentication-config",
+	"bind-address",
+	"client-ca-file",
+	"emulated-version",
+	"encryption-provider-config",
+	"endpoint-reconciler-type",
+	"etcd-cafile",
+	"etcd-certfile",
+	"etcd-keyfile",
+	"etcd-prefix",
+	"etcd-servers",
+	"feature-gates",
+	"secure-port",
+	"service-account-key-file",
+	"service-account-signing-key-file",
+	"tls-cert-file",
+	"tls-private-key-file",
+}
+
+// APIServerConfig is the kube-apiserver configuration of the cluster derived from the machine config.
+//
+// The configuration files are kept as the documents the api server reads.
+type APIServerConfig struct {
+	AdmissionConfig      map[string]any
+	AuditPolicy          map[string]any
+	AuthenticationConfig map[string]any
+	EncryptionConfig     map[string]any
+	ExtraArgs            map[string][]string
+	ServiceAccountIssuer string
+	ServiceCIDRs         []string
+}
+
+// NewAPIServerConfig builds the api server configuration the same way Talos builds the kube-apiserver static pod.
+func NewAPIServerConfig(cfg config.Config) *APIServerConfig {
+	apiServerConfig := &APIServerConfig{
+		ExtraArgs: maps.Clone(cfg.K8sAPIServerConfig().ExtraArgs()),
+		ServiceCIDRs: xslices.Map(cfg.K8sNetworkConfig().ServiceCIDRs(), func(prefix netip.Prefix) string {
+			return prefix.String()
+		}),
+	}
+
+	if endpoint := cfg.Cluster().Endpoint(); endpoint != nil {
+		apiServerConfig.ServiceAccountIssuer = endpoint.String()
+	}
+
+	if plugins := cfg.K8sAdmissionControlPluginConfigs(); len(plugins) > 0 {
+		apiServerConfig.AdmissionConfig = map[string]any{
+			"apiVersion": apiServerConfigAPIVersion,
+			"kind":       "AdmissionConfiguration",
+			"plugins": xslices.Map(plugins, func(plugin config.K8sAdmissionControlPluginConfig) any {
+				return map[string]any{
+					"name":          plugin.Name(),
+					"configuration": plugin.Configuration(),
+				}
+			}),
+		}
+	}
+
+	if auditPolicy := cfg.K8sAuditPolicyConfig(); auditPolicy != nil && len(auditPolicy.Configuration()) > 0 {
+		apiServerConfig.AuditPolicy = auditPolicy.Configuration()
+	}
+
+	if authentication := cfg.K8sAuthenticationConfig(); authentication != nil && len(authentication.Configuration()) > 0 {
+		apiServerConfig.AuthenticationConfig = withKind(authentication.Configuration(), "AuthenticationConfiguration")
+	}
+
+	apiServerConfig.EncryptionConfig = encryptionConfig(cfg)
+
+	return apiServerConfig
+}
+
+// Equal returns true if the api server configurations are the same.
+func (c *APIServerConfig) Equal(other *APIServerConfig) bool {
+	return reflect.DeepEqual(c, other)
+}
+
+// encryptionConfig returns the encryption configuration of the secrets at rest.
+//
+// The secretbox secret is preferred over the aescbc one, the identity provider still reads the secrets written before the encryption.
+func encryptionConfig(cfg config.Config) map[string]any {
+	if encryption := cfg.K8sEtcdEncryptionConfig(); encryption != nil && len(encryption.EtcdEncryptionConfig()) > 0 {
+		return withKind(encryption.EtcdEncryptionConfig(), "EncryptionConfiguration")
+	}
+
+	var providers []any
+
+	if secret := cfg.Cluster().SecretboxEncryptionSecret(); secret != "" {
+		providers = append(providers, encryptionProvider("secretbox", "key2", secret))
+	}
+
+	if secret := cfg.Cluster().AESCBCEncryptionSecret(); secret != "" {
+		providers = append(providers, encryptionProvider("aescbc", "key1", secret))
+	}
+
+	if len(providers) == 0 {
+		return nil
+	}
+
+	providers = append(providers, map[string]any{"identity": map[string]any{}})
+
+	return map[string]any{
+		"apiVersion": apiServerConfigAPIVersion,
+		"kind":       "EncryptionConfiguration",
+		"resources": []any{
+			map[string]any{
+				"resources": []any{"secrets"},
+				"providers": providers,
+			},
+		},
+	}
+}
+
+func encryptionProvider(provider, name, secret string) map[string]any {
+	return map[string]any{
+		provider: map[string]any{
+			"keys": []any{
+				map[string]any{
+					"name":   name,
+					"secret": secret,
+				},
+			},
+		},
+	}
+}
+
+// withKind returns the copy of the configuration document with the api server config apiVersion and kind.
+func withKind(document map[string]any, kind string) map[string]any {
+	document = maps.Clone(document)
+
+	document["apiVersion"] = apiServerConfigAPIVersion
+	document["kind"] = kind
+
+	return document
+}
+
+// apply writes the configuration files to the directory and sets the api server options.
+//
+// The extra args are applied last, the same way as the kube-apiserver flags, except the flags managed by the emulator.
+func (c *APIServerConfig) apply(s *options.ServerRunOptions, dir string, logger *zap.Logger) error {
+	if len(c.ServiceCIDRs) > 0 {
+		s.ServiceClusterIPRanges = strings.Join(c.ServiceCIDRs, ",")
+	}
+
+	if c.ServiceAccountIssuer != "" {
+		s.Authentication.ServiceAccounts.Issuers = []string{c.ServiceAccountIssuer}
+		s.Authentication.APIAudiences = []string{c.ServiceAccountIssuer}
+	}
+
+	for _, file := range []struct {
+		document map[string]any
+		option   *string
+		name     string
+	}{
+		{document: c.AdmissionConfig, option: &s.Admission.GenericAdmission.ConfigFile, name: admissionControlConfigFile},
+		{document: c.AuditPolicy, option: &s.Audit.PolicyFile, name: auditPolicyFile},
+		{document: c.AuthenticationConfig, option: &s.Authentication.AuthenticationConfigFile, name: authenticationConfigFile},
+		{document: c.EncryptionConfig, option: &s.Etcd.EncryptionProviderConfigFilepath, name: encryptionConfigFile},
+	} {
+		if file.document == nil {
+			continue
+		}
+
+		path := filepath.Join(dir, file.name)
+
+		if err := writeDocument(path, file.document); err != nil {
+			return err
+		}
+
+		*file.option = path
+	}
+
+	if s.Audit.PolicyFile != "" {
+		s.Audit.LogOptions.Path = filepath.Join(dir, auditLogFile)
+		s.Audit.LogOptions.MaxAge = auditLogMaxAge
+		s.Audit.LogOptions.MaxBackups = auditLogMaxBackups
+		s.Audit.LogOptions.MaxSize = auditLogMaxSize
+
+		if err := os.MkdirAll(filepath.Dir(s.Audit.LogOptions.Path), 0o700); err != nil {
+			return err
+		}
+	}
+
+	return applyExtraArgs(s, c.ExtraArgs, logger)
+}
+
+// applyExtraArgs parses the extra args with the kube-apiserver flags.
+//
+// The unknown and the managed flags are skipped, the invalid values fail the api server the same way as on Talos.
+func applyExtraArgs(s *options.ServerRunOptions, extraArgs map[string][]string, logger *zap.Logger) error {
+	if len(extraArgs) == 0 {
+		return nil
+	}
+
+	fs := pflag.NewFlagSet("kube-apiserver", pflag.ContinueOnError)
+
+	for _, f := range s.Flags().FlagSets {
+		fs.AddFlagSet(f)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(extraArgs)) {
+		if slices.Contains(managedAPIServerArgs, name) || fs.Lookup(name) == nil {
+			logger.Warn("ignoring the kube-apiserver extra arg", zap.String("arg", name))
+
+			continue
+		}
+
+		for _, value := range extraArgs[name] {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("error setting the kube-apiserver extra arg %q: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeDocument(path string, document map[string]any) error {
+	// JSON is a valid YAML document
+	data, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("error marshaling %q: %w", filepath.Base(path), err)
+	}
+
+	return os.WriteFile(path, data, 0o600)
+}
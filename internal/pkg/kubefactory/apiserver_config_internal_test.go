@@ -0,0 +1,150 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/siderolabs/talos/pkg/machinery/config/container"
+	"github.com/siderolabs/talos/pkg/machinery/config/types/meta"
+	configv1alpha1 "github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/kubernetes/cmd/kube-apiserver/app/options"
+)
+
+func testAPIServerConfig(t *testing.T) *APIServerConfig {
+	t.Helper()
+
+	endpoint, err := url.Parse("https://cluster.example.com:6443")
+	require.NoError(t, err)
+
+	provider, err := container.New(&configv1alpha1.Config{
+		ConfigVersion: "v1alpha1",
+		MachineConfig: &configv1alpha1.MachineConfig{
+			MachineType: "controlplane",
+		},
+		ClusterConfig: &configv1alpha1.ClusterConfig{
+			ControlPlane: &configv1alpha1.ControlPlaneConfig{
+				Endpoint: &configv1alpha1.Endpoint{URL: endpoint},
+			},
+			ClusterNetwork: &configv1alpha1.ClusterNetworkConfig{
+				ServiceSubnet: []string{"10.96.0.0/12", "fd00:10:96::/112"},
+			},
+			ClusterSecretboxEncryptionSecret: "c2VjcmV0Ym94LXNlY3JldC1zZWNyZXRib3gtc2VjcmV0",
+			APIServerConfig: &configv1alpha1.APIServerConfig{
+				ExtraArgsConfig: meta.Args{
+					"oidc-issuer-url": meta.NewArgValue("https://dex.example.com", nil),
+					"oidc-client-id":  meta.NewArgValue("kubernetes", nil),
+					"etcd-servers":    meta.NewArgValue("https://127.0.0.1:2379", nil),
+					"unknown-flag":    meta.NewArgValue("value", nil),
+				},
+				AdmissionControlConfig: configv1alpha1.AdmissionPluginConfigList{
+					{
+						PluginName: "PodSecurity",
+						PluginConfiguration: meta.Unstructured{
+							Object: map[string]any{
+								"apiVersion": "pod-security.admission.config.k8s.io/v1alpha1",
+								"kind":       "PodSecurityConfiguration",
+								"defaults": map[string]any{
+									"enforce": "baseline",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	return NewAPIServerConfig(provider)
+}
+
+func TestNewAPIServerConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := testAPIServerConfig(t)
+
+	assert.Equal(t, []string{"10.96.0.0/12", "fd00:10:96::/112"}, cfg.ServiceCIDRs)
+	assert.Equal(t, "https://cluster.example.com:6443", cfg.ServiceAccountIssuer)
+	assert.Equal(t, []string{"https://dex.example.com"}, cfg.ExtraArgs["oidc-issuer-url"])
+
+	assert.Equal(t, "AdmissionConfiguration", cfg.AdmissionConfig["kind"])
+	assert.Len(t, cfg.AdmissionConfig["plugins"], 1)
+
+	// the default Talos audit policy
+	assert.Equal(t, "Policy", cfg.AuditPolicy["kind"])
+
+	assert.Nil(t, cfg.AuthenticationConfig)
+
+	assert.Equal(t, map[string]any{
+		"apiVersion": "apiserver.config.k8s.io/v1",
+		"kind":       "EncryptionConfiguration",
+		"resources": []any{
+			map[string]any{
+				"resources": []any{"secrets"},
+				"providers": []any{
+					encryptionProvider("secretbox", "key2", "c2VjcmV0Ym94LXNlY3JldC1zZWNyZXRib3gtc2VjcmV0"),
+					map[string]any{"identity": map[string]any{}},
+				},
+			},
+		},
+	}, cfg.EncryptionConfig)
+
+	assert.True(t, cfg.Equal(testAPIServerConfig(t)))
+
+	changed := testAPIServerConfig(t)
+	changed.ExtraArgs["oidc-client-id"] = []string{"omni"}
+
+	assert.False(t, cfg.Equal(changed))
+	assert.False(t, cfg.Equal(nil))
+}
+
+func TestAPIServerConfigApply(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	s := options.NewServerRunOptions()
+	s.Etcd.StorageConfig.Transport.ServerList = []string{"https://10.5.0.1:2379"}
+
+	require.NoError(t, testAPIServerConfig(t).apply(s, dir, zaptest.NewLogger(t)))
+
+	assert.Equal(t, "10.96.0.0/12,fd00:10:96::/112", s.ServiceClusterIPRanges)
+	assert.Equal(t, []string{"https://cluster.example.com:6443"}, s.Authentication.ServiceAccounts.Issuers)
+	assert.Equal(t, []string{"https://cluster.example.com:6443"}, s.Authentication.APIAudiences)
+
+	// OIDC is configured with the extra args, the managed flags can't be overridden
+	assert.Equal(t, "https://dex.example.com", s.Authentication.OIDC.IssuerURL)
+	assert.Equal(t, "kubernetes", s.Authentication.OIDC.ClientID)
+	assert.Equal(t, []string{"https://10.5.0.1:2379"}, s.Etcd.StorageConfig.Transport.ServerList)
+
+	assert.Equal(t, filepath.Join(dir, admissionControlConfigFile), s.Admission.GenericAdmission.ConfigFile)
+	assert.Equal(t, filepath.Join(dir, auditPolicyFile), s.Audit.PolicyFile)
+	assert.Equal(t, filepath.Join(dir, auditLogFile), s.Audit.LogOptions.Path)
+	assert.Equal(t, filepath.Join(dir, encryptionConfigFile), s.Etcd.EncryptionProviderConfigFilepath)
+	assert.Empty(t, s.Authentication.AuthenticationConfigFile)
+
+	data, err := os.ReadFile(s.Etcd.EncryptionProviderConfigFilepath)
+	require.NoError(t, err)
+
+	var encryption map[string]any
+
+	require.NoError(t, json.Unmarshal(data, &encryption))
+
+	assert.Equal(t, "EncryptionConfiguration", encryption["kind"])
+
+	require.Error(t, (&APIServerConfig{
+		ExtraArgs: map[string][]string{
+			"event-ttl": {"forever"},
+		},
+	}).apply(options.NewServerRunOptions(), dir, zaptest.NewLogger(t)))
+}
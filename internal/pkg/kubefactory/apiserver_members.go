@@ -0,0 +1,125 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+)
+
+// apiServerMembers are the addresses of the control planes serving the api server of the cluster by the machine ID.
+//
+// The endpoints of the kubernetes service are reconciled from the members instead of the api server leases:
+// the lease endpoint reconciler requires the advertise address to be in the family of the primary service CIDR,
+// while the SideroLink addresses are IPv6 and the service CIDRs usually aren't.
+type apiServerMembers struct {
+	members map[string]string
+	// changed is closed when the members change.
+	changed chan struct{}
+
+	mu sync.Mutex
+}
+
+func newAPIServerMembers() *apiServerMembers {
+	return &apiServerMembers{
+		members: map[string]string{},
+		changed: make(chan struct{}),
+	}
+}
+
+func (m *apiServerMembers) join(machineID, address string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.members[machineID] = address
+
+	m.notify()
+}
+
+func (m *apiServerMembers) leave(machineID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.members, machineID)
+
+	m.notify()
+}
+
+func (m *apiServerMembers) notify() {
+	close(m.changed)
+
+	m.changed = make(chan struct{})
+}
+
+func (m *apiServerMembers) empty() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.members) == 0
+}
+
+// snapshot returns the members and the channel which is closed when they change.
+func (m *apiServerMembers) snapshot() (map[string]string, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return maps.Clone(m.members), m.changed
+}
+
+// syncEndpoints keeps the endpoints of the kubernetes service in sync with the members until the context is canceled.
+func (m *apiServerMembers) syncEndpoints(ctx context.Context, client kubernetes.Interface, logger *zap.Logger) {
+	ticker := time.NewTicker(identityLeaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		members, changed := m.snapshot()
+
+		if err := reconcileEndpoints(ctx, client, members); err != nil {
+			logger.Warn("failed to reconcile the kubernetes service endpoints", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+		}
+	}
+}
+
+// joinAPIServer adds the control plane to the members of the cluster api servers, when each control plane runs its own api server.
+func (k *Kubernetes) joinAPIServer(clusterID, machineID, address string) *apiServerMembers {
+	k.sharedMu.Lock()
+	defer k.sharedMu.Unlock()
+
+	members, ok := k.members[clusterID]
+	if !ok {
+		members = newAPIServerMembers()
+
+		k.members[clusterID] = members
+	}
+
+	members.join(machineID, address)
+
+	return members
+}
+
+func (k *Kubernetes) leaveAPIServer(clusterID, machineID string) {
+	k.sharedMu.Lock()
+	defer k.sharedMu.Unlock()
+
+	members := k.members[clusterID]
+
+	members.leave(machineID)
+
+	if members.empty() {
+		delete(k.members, clusterID)
+	}
+}
@@ -0,0 +1,573 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/siderolabs/omni/client/pkg/panichandler"
+	"go.uber.org/zap"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/cmd/kube-apiserver/app"
+	"k8s.io/kubernetes/pkg/controlplane/reconcilers"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/network"
+)
+
+const (
+	// identityLeaseDuration and identityLeaseRenewInterval are the kube-apiserver identity lease defaults.
+	identityLeaseDuration      = time.Hour
+	identityLeaseRenewInterval = 10 * time.Second
+
+	identityLeaseLabel = "apiserver.kubernetes.io/identity"
+	kubeAPIServer      = "kube-apiserver"
+)
+
+// sharedAPICerts are the files copied from the certs directory of the first control plane,
+// so that the shared api server keeps running when this control plane is removed.
+var sharedAPICerts = []string{
+	"ca.crt",
+	"apiserver.crt",
+	"apiserver.key",
+	"service-account.key",
+	"service-account.pub",
+}
+
+// sharedAPIServer is the api server of the cluster shared by its control planes.
+//
+// The control planes serve the api server handler on their own addresses with their own certificates.
+type sharedAPIServer struct {
+	*apiServerMembers
+
+	handler atomic.Pointer[http.Handler]
+
+	// config is the api server configuration of the control plane which joined last.
+	config    atomic.Pointer[APIServerConfig]
+	restartCh chan struct{}
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	refs int
+}
+
+// ServeHTTP implements http.Handler.
+func (s *sharedAPIServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	handler := s.handler.Load()
+	if handler == nil {
+		http.Error(w, "the kube-apiserver is starting", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	(*handler).ServeHTTP(w, req)
+}
+
+// setConfig restarts the api server if the configuration changes.
+func (s *sharedAPIServer) setConfig(cfg *APIServerConfig) {
+	if s.config.Swap(cfg).Equal(cfg) {
+		return
+	}
+
+	s.restart()
+}
+
+func (s *sharedAPIServer) restart() {
+	select {
+	case s.restartCh <- struct{}{}:
+	default:
+	}
+}
+
+// host returns the control plane the api server runs as, so that its own identity lease is the lease of that control plane.
+func (s *sharedAPIServer) host() string {
+	members, _ := s.snapshot()
+
+	if len(members) == 0 {
+		return ""
+	}
+
+	return slices.Min(slices.Collect(maps.Keys(members)))
+}
+
+// runSharedAPIService serves the api server of the cluster on the control plane address until the context is canceled.
+func (k *Kubernetes) runSharedAPIService(ctx context.Context, nc *network.Client, address, iface, machineID, certsDir, clusterID string,
+	versionInfo *version.Info, cfg *APIServerConfig,
+) error {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certsDir, "apiserver.crt"), filepath.Join(certsDir, "apiserver.key"))
+	if err != nil {
+		return err
+	}
+
+	lis, err := nc.Listen(ctx, iface, net.JoinHostPort(address, "6443"))
+	if err != nil {
+		return err
+	}
+
+	defer lis.Close() //nolint:errcheck
+
+	shared, err := k.acquireSharedAPIServer(ctx, address, machineID, certsDir, clusterID, cfg)
+	if err != nil {
+		return err
+	}
+
+	defer k.releaseSharedAPIServer(clusterID)
+	defer shared.leave(machineID)
+
+	srv := &http.Server{
+		// the control planes report the version of their own kube-apiserver image
+		Handler: withRequestVersion(shared, versionInfo),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			// the client certificates are verified by the api server authenticator
+			ClientAuth: tls.RequestClientCert,
+			MinVersion: tls.VersionTLS12,
+			NextProtos: []string{"h2", "http/1.1"},
+		},
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- srv.ServeTLS(lis, "", "")
+	}()
+
+	select {
+	case <-ctx.Done():
+		return srv.Close()
+	case err = <-errCh:
+		return err
+	}
+}
+
+// acquireSharedAPIServer joins the control plane to the api server of the cluster, the api server is started by the first control plane.
+func (k *Kubernetes) acquireSharedAPIServer(ctx context.Context, address, machineID, certsDir, clusterID string, cfg *APIServerConfig) (*sharedAPIServer, error) {
+	k.sharedMu.Lock()
+	defer k.sharedMu.Unlock()
+
+	if shared, ok := k.sharedAPIServers[clusterID]; ok {
+		shared.refs++
+
+		shared.join(machineID, address)
+		shared.setConfig(cfg)
+
+		return shared, nil
+	}
+
+	dir := filepath.Join(k.dataDir, "apiservers", clusterID)
+
+	if err := copyFiles(certsDir, dir, sharedAPICerts); err != nil {
+		return nil, err
+	}
+
+	// the api server outlives the control plane which started it
+	serverCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	shared := &sharedAPIServer{
+		apiServerMembers: newAPIServerMembers(),
+		restartCh:        make(chan struct{}, 1),
+		cancel:           cancel,
+		done:             make(chan struct{}),
+		refs:             1,
+	}
+
+	shared.config.Store(cfg)
+	shared.join(machineID, address)
+
+	k.sharedAPIServers[clusterID] = shared
+
+	logger := k.logger.With(zap.String("cluster", clusterID))
+
+	panichandler.Go(func() {
+		k.runSharedAPIServer(serverCtx, shared, address, dir, clusterID, logger) //nolint:contextcheck
+	}, logger)
+
+	return shared, nil
+}
+
+// releaseSharedAPIServer stops the api server of the cluster once the last control plane stops serving it.
+func (k *Kubernetes) releaseSharedAPIServer(clusterID string) {
+	k.sharedMu.Lock()
+
+	shared := k.sharedAPIServers[clusterID]
+
+	shared.refs--
+
+	if shared.refs > 0 {
+		k.sharedMu.Unlock()
+
+		return
+	}
+
+	delete(k.sharedAPIServers, clusterID)
+
+	k.sharedMu.Unlock()
+
+	shared.cancel()
+
+	<-shared.done
+}
+
+// runSharedAPIServer restarts the api server until the context is canceled.
+//
+// The api server runs in its own goroutine, so that the loop survives runtime.Goexit from klog.Fatal.
+// It is also restarted when a control plane joins with a different api server configuration,
+// and when the control plane the api server runs as leaves.
+func (k *Kubernetes) runSharedAPIServer(ctx context.Context, shared *sharedAPIServer, address, certsDir, clusterID string, logger *zap.Logger) {
+	defer close(shared.done)
+
+	for {
+		done := make(chan struct{})
+
+		serveCtx, cancel := context.WithCancel(ctx)
+
+		panichandler.Go(func() {
+			defer close(done)
+
+			if err := k.serveSharedAPIServer(serveCtx, shared, address, certsDir, clusterID, logger); err != nil {
+				logger.Error("shared kubernetes api server crashed", zap.Error(err))
+			}
+		}, logger)
+
+		select {
+		case <-done:
+		case <-shared.restartCh:
+			logger.Info("restarting the shared kubernetes api server")
+
+			cancel()
+
+			<-done
+		}
+
+		cancel()
+
+		shared.handler.Store(nil)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (k *Kubernetes) serveSharedAPIServer(ctx context.Context, shared *sharedAPIServer, address, certsDir, clusterID string, logger *zap.Logger) error {
+	var lc net.ListenConfig
+
+	// the api server itself listens only on the host loopback, the control planes forward to its handler
+	lis, err := lc.Listen(ctx, "tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	defer lis.Close() //nolint:errcheck
+
+	s, err := k.apiServerOptions(lis, address, certsDir, clusterID, shared.config.Load())
+	if err != nil {
+		return err
+	}
+
+	// the api server identity lease is the lease of one of the control planes, so there are no leases of other hosts
+	host := shared.host()
+
+	k.mu.Lock()
+	server.SetHostnameFuncForTests(host)
+
+	completedOptions, err := s.Complete(ctx)
+	if err != nil {
+		k.mu.Unlock()
+
+		return err
+	}
+
+	if errs := completedOptions.Validate(); len(errs) != 0 {
+		k.mu.Unlock()
+
+		return utilerrors.NewAggregate(errs)
+	}
+
+	config, err := app.NewConfig(completedOptions)
+
+	k.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	buildHandlerChain := config.Aggregator.GenericConfig.BuildHandlerChainFunc
+
+	// the version is passed with the requests by the control planes
+	config.Aggregator.GenericConfig.BuildHandlerChainFunc = func(apiHandler http.Handler, c *server.Config) http.Handler {
+		return buildHandlerChain(withVersion(apiHandler, nil), c)
+	}
+
+	completed, err := config.Complete()
+	if err != nil {
+		return err
+	}
+
+	aggregator, err := app.CreateServerChain(completed)
+	if err != nil {
+		return err
+	}
+
+	prepared, err := aggregator.PrepareRun()
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewForConfig(aggregator.GenericAPIServer.LoopbackClientConfig)
+	if err != nil {
+		return err
+	}
+
+	var handler http.Handler = aggregator.GenericAPIServer.Handler
+
+	shared.handler.Store(&handler)
+
+	membersCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	panichandler.Go(func() {
+		shared.reconcileMembers(membersCtx, client, host, logger)
+	}, logger)
+
+	return prepared.Run(ctx)
+}
+
+// reconcileMembers keeps the endpoints of the kubernetes service and the api server identity leases
+// in sync with the control planes serving the api server.
+//
+// The api server renews the lease of the host it runs as, it is restarted as another control plane once the host leaves.
+func (s *sharedAPIServer) reconcileMembers(ctx context.Context, client kubernetes.Interface, host string, logger *zap.Logger) {
+	ticker := time.NewTicker(identityLeaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		members, changed := s.snapshot()
+
+		if _, ok := members[host]; !ok && len(members) > 0 {
+			s.restart()
+
+			return
+		}
+
+		if err := reconcileEndpoints(ctx, client, members); err != nil {
+			logger.Warn("failed to reconcile the kubernetes service endpoints", zap.Error(err))
+		}
+
+		if err := renewIdentityLeases(ctx, client, members, host); err != nil {
+			logger.Warn("failed to renew the api server identity leases", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+		}
+	}
+}
+
+// reconcileEndpoints points the kubernetes service to the control plane addresses, as the lease endpoint reconciler does.
+func reconcileEndpoints(ctx context.Context, client kubernetes.Interface, members map[string]string) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, identityLeaseRenewInterval)
+	defer cancel()
+
+	subsets := endpointSubsets(members)
+
+	endpoints, err := client.CoreV1().Endpoints(metav1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{}) //nolint:staticcheck
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	adapter := reconcilers.NewEndpointsAdapter(client.CoreV1(), client.DiscoveryV1()) //nolint:staticcheck
+
+	if apierrors.IsNotFound(err) {
+		_, err = adapter.Create(metav1.NamespaceDefault, &corev1.Endpoints{ //nolint:staticcheck
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kubernetes",
+				Namespace: metav1.NamespaceDefault,
+				Labels: map[string]string{
+					discoveryv1.LabelSkipMirror: "true",
+				},
+			},
+			Subsets: subsets,
+		})
+
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(endpoints.Subsets, subsets) {
+		return nil
+	}
+
+	endpoints.Subsets = subsets
+
+	_, err = adapter.Update(metav1.NamespaceDefault, endpoints)
+
+	return err
+}
+
+// endpointSubsets returns the kubernetes service endpoints of the control planes.
+func endpointSubsets(members map[string]string) []corev1.EndpointSubset { //nolint:staticcheck
+	addresses := slices.Sorted(maps.Values(members))
+	addresses = slices.Compact(addresses)
+
+	subset := corev1.EndpointSubset{ //nolint:staticcheck
+		Ports: []corev1.EndpointPort{ //nolint:staticcheck
+			{
+				Name:     "https",
+				Port:     6443,
+				Protocol: corev1.ProtocolTCP,
+			},
+		},
+	}
+
+	for _, address := range addresses {
+		subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{IP: address}) //nolint:staticcheck
+	}
+
+	return []corev1.EndpointSubset{subset} //nolint:staticcheck
+}
+
+// renewIdentityLeases renews the kube-apiserver identity lease of each control plane, as if each of them ran its own api server.
+//
+// The lease of the host is renewed by the api server itself. The leases of the other hosts, e.g. the control planes which left, are removed.
+func renewIdentityLeases(ctx context.Context, client kubernetes.Interface, members map[string]string, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, identityLeaseRenewInterval)
+	defer cancel()
+
+	leaseClient := client.CoordinationV1().Leases(metav1.NamespaceSystem)
+
+	leases, err := leaseClient.List(ctx, metav1.ListOptions{
+		LabelSelector: identityLeaseLabel + "=" + kubeAPIServer,
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, lease := range leases.Items {
+		if _, ok := members[lease.Labels[corev1.LabelHostname]]; ok {
+			continue
+		}
+
+		if err = leaseClient.Delete(ctx, lease.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+
+	for machineID := range members {
+		if machineID == host {
+			continue
+		}
+
+		name := apiServerID(machineID)
+
+		var lease *coordinationv1.Lease
+
+		lease, err = leaseClient.Get(ctx, name, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if apierrors.IsNotFound(err) {
+			_, err = leaseClient.Create(ctx, &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: metav1.NamespaceSystem,
+					Labels: map[string]string{
+						identityLeaseLabel:   kubeAPIServer,
+						corev1.LabelHostname: machineID,
+					},
+				},
+				Spec: coordinationv1.LeaseSpec{
+					HolderIdentity:       new(name + "_" + string(uuid.NewUUID())),
+					LeaseDurationSeconds: new(int32(identityLeaseDuration.Seconds())),
+					RenewTime:            &now,
+				},
+			}, metav1.CreateOptions{})
+		} else {
+			lease.Spec.RenewTime = &now
+
+			_, err = leaseClient.Update(ctx, lease, metav1.UpdateOptions{})
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// apiServerID returns the identity lease name of the api server running on the host, the same way the api server builds it.
+func apiServerID(hostname string) string {
+	var data []byte
+
+	for _, value := range []string{hostname, kubeAPIServer} {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(value))) //nolint:gosec
+		data = append(data, value...)
+	}
+
+	hash := sha256.Sum256(data)
+
+	return "apiserver-" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(hash[:16]))
+}
+
+func copyFiles(src, dst string, names []string) error {
+	if err := os.MkdirAll(dst, 0o700); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(src, name))
+		if err != nil {
+			return fmt.Errorf("error reading %q: %w", name, err)
+		}
+
+		if err = os.WriteFile(filepath.Join(dst, name), data, 0o600); err != nil {
+			return fmt.Errorf("error writing %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
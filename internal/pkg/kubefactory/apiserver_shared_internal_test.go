@@ -0,0 +1,106 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAPIServerID(t *testing.T) {
+	t.Parallel()
+
+	// the identity lease name of the kube-apiserver running on the host "1000"
+	assert.Equal(t, "apiserver-ku3vtjmrebjjtt2hicrnpnssy4", apiServerID("1000"))
+	assert.NotEqual(t, apiServerID("1000"), apiServerID("1001"))
+}
+
+func TestEndpointSubsets(t *testing.T) {
+	t.Parallel()
+
+	subsets := endpointSubsets(map[string]string{
+		"1002": "fdae:41e4:649b:9303::3",
+		"1000": "fdae:41e4:649b:9303::1",
+		"1001": "fdae:41e4:649b:9303::2",
+	})
+
+	require.Len(t, subsets, 1)
+
+	assert.Equal(t, []corev1.EndpointAddress{ //nolint:staticcheck
+		{IP: "fdae:41e4:649b:9303::1"},
+		{IP: "fdae:41e4:649b:9303::2"},
+		{IP: "fdae:41e4:649b:9303::3"},
+	}, subsets[0].Addresses)
+	assert.Equal(t, []corev1.EndpointPort{{Name: "https", Port: 6443, Protocol: corev1.ProtocolTCP}}, subsets[0].Ports) //nolint:staticcheck
+}
+
+func TestRenewIdentityLeases(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+
+	// the lease of the control plane which left
+	client := fake.NewClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      apiServerID("1002"),
+			Namespace: metav1.NamespaceSystem,
+			Labels: map[string]string{
+				identityLeaseLabel:   kubeAPIServer,
+				corev1.LabelHostname: "1002",
+			},
+		},
+	})
+
+	members := map[string]string{
+		"1000": "fdae:41e4:649b:9303::1",
+		"1001": "fdae:41e4:649b:9303::2",
+	}
+
+	require.NoError(t, renewIdentityLeases(ctx, client, members, "1000"))
+
+	leases, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+
+	// the lease of the host is created by the api server itself
+	require.Len(t, leases.Items, 1)
+	assert.Equal(t, apiServerID("1001"), leases.Items[0].Name)
+	assert.Equal(t, "1001", leases.Items[0].Labels[corev1.LabelHostname])
+
+	renewed := leases.Items[0].Spec.RenewTime
+
+	require.NoError(t, renewIdentityLeases(ctx, client, members, "1000"))
+
+	lease, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Get(ctx, apiServerID("1001"), metav1.GetOptions{})
+	require.NoError(t, err)
+
+	assert.False(t, lease.Spec.RenewTime.Before(renewed))
+	assert.Equal(t, leases.Items[0].Spec.HolderIdentity, lease.Spec.HolderIdentity)
+}
+
+func TestSharedAPIServerHost(t *testing.T) {
+	t.Parallel()
+
+	shared := &sharedAPIServer{
+		apiServerMembers: newAPIServerMembers(),
+		restartCh:        make(chan struct{}, 1),
+	}
+
+	assert.Empty(t, shared.host())
+
+	shared.join("1001", "fdae:41e4:649b:9303::2")
+	shared.join("1000", "fdae:41e4:649b:9303::1")
+
+	assert.Equal(t, "1000", shared.host())
+
+	shared.leave("1000")
+
+	assert.Equal(t, "1001", shared.host())
+}
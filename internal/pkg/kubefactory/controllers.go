@@ -0,0 +1,380 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	cacheddiscovery "k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	controllersmetrics "k8s.io/component-base/metrics/prometheus/controllers"
+	"k8s.io/controller-manager/pkg/clientbuilder"
+	controllerhealthz "k8s.io/controller-manager/pkg/healthz"
+	"k8s.io/controller-manager/pkg/informerfactory"
+	kcmapp "k8s.io/kubernetes/cmd/kube-controller-manager/app"
+	kcmconfig "k8s.io/kubernetes/cmd/kube-controller-manager/app/config"
+	kcmoptions "k8s.io/kubernetes/cmd/kube-controller-manager/app/options"
+	"k8s.io/kubernetes/cmd/kube-controller-manager/names"
+	"k8s.io/kubernetes/pkg/controller/garbagecollector"
+	"k8s.io/kubernetes/pkg/scheduler"
+	"k8s.io/kubernetes/pkg/scheduler/apis/config/latest"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/network"
+)
+
+// The leader election timings are the kube-controller-manager and kube-scheduler defaults.
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+const (
+	controllerManagerName = "kube-controller-manager"
+	schedulerName         = "kube-scheduler"
+)
+
+// RunControllerManager runs kube-controller-manager of the cluster while the machine holds its leader lease.
+//
+// The kubeconfig and the root CA are read from the machine certs directory.
+// The controllers are stopped when the lease is lost, and started again once the machine gets it back.
+func (k *Kubernetes) RunControllerManager(ctx context.Context, certsDir, identity string) error {
+	return k.runElected(ctx, filepath.Join(certsDir, "controller-manager.kubeconfig"), controllerManagerName, identity, func(ctx context.Context) error {
+		return k.runControllerManager(ctx, certsDir)
+	})
+}
+
+// RunScheduler runs kube-scheduler of the cluster while the machine holds its leader lease.
+//
+// The kubeconfig is read from the machine certs directory.
+func (k *Kubernetes) RunScheduler(ctx context.Context, certsDir, identity string) error {
+	kubeconfig := filepath.Join(certsDir, "scheduler.kubeconfig")
+
+	return k.runElected(ctx, kubeconfig, schedulerName, identity, func(ctx context.Context) error {
+		return runScheduler(ctx, kubeconfig)
+	})
+}
+
+// runElected runs the component each time the identity becomes the leader of the component lease in the kube-system namespace.
+//
+// The component gets the context which is canceled once the lease is lost.
+// If the component fails, the lease is released, so that the other control plane takes over.
+func (k *Kubernetes) runElected(ctx context.Context, kubeconfig, name, identity string, run func(ctx context.Context) error) error {
+	config, err := loadKubeconfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewForConfig(rest.AddUserAgent(config, name+"-leader-election"))
+	if err != nil {
+		return err
+	}
+
+	return k.runLeaderElection(ctx, client, name, identity, run)
+}
+
+// runLeaderElection runs the leader election of the component through the client until the context is canceled.
+func (k *Kubernetes) runLeaderElection(ctx context.Context, client kubernetes.Interface, name, identity string, run func(ctx context.Context) error) error {
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		metav1.NamespaceSystem,
+		name,
+		client.CoreV1(),
+		client.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity},
+	)
+	if err != nil {
+		return err
+	}
+
+	logger := k.logger.With(zap.String("component", name), zap.String("identity", identity))
+
+	for {
+		electionCtx, cancel := context.WithCancel(ctx)
+
+		var elector *leaderelection.LeaderElector
+
+		elector, err = leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			Name:            name,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					logger.Info("started leading")
+
+					if runErr := run(ctx); runErr != nil {
+						logger.Error("failed to run", zap.Error(runErr))
+					}
+
+					cancel()
+				},
+				OnStoppedLeading: func() {
+					logger.Info("stopped leading")
+				},
+			},
+		})
+		if err != nil {
+			cancel()
+
+			return err
+		}
+
+		elector.Run(electionCtx)
+
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryPeriod):
+		}
+	}
+}
+
+func (k *Kubernetes) runControllerManager(ctx context.Context, certsDir string) error {
+	s, err := kcmoptions.NewKubeControllerManagerOptions()
+	if err != nil {
+		return err
+	}
+
+	// the controller manager doesn't serve the health and metrics endpoints
+	s.SecureServing.BindPort = 0
+
+	// the lease is already held by runElected
+	s.Generic.LeaderElection.LeaderElect = false
+	s.Generic.ClientConnection.Kubeconfig = filepath.Join(certsDir, "controller-manager.kubeconfig")
+
+	s.SAController.RootCAFile = filepath.Join(certsDir, "ca.crt")
+
+	// the config applies the metrics feature gates to the global feature gate
+	k.mu.Lock()
+	c, err := s.Config(ctx, kcmapp.KnownControllers(), kcmapp.ControllersDisabledByDefault(), kcmapp.ControllerAliases())
+	k.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// the apiserver might be running in the userspace network
+	c.Kubeconfig.Dial = network.DialContext
+
+	if c.Client, err = kubernetes.NewForConfig(rest.AddUserAgent(c.Kubeconfig, kcmoptions.KubeControllerManagerUserAgent)); err != nil {
+		return err
+	}
+
+	c.EventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: c.Client.CoreV1().Events("")})
+	defer c.EventBroadcaster.Shutdown()
+
+	cc := c.Complete()
+
+	controllerCtx, err := newControllerContext(ctx, cc)
+	if err != nil {
+		return err
+	}
+
+	// the node pod CIDRs are allocated by the emulated kubelets, the service account tokens are not minted
+	controllers, err := kcmapp.BuildControllers(ctx, controllerCtx, kcmapp.NewControllerDescriptors(), nil, controllerhealthz.NewMutableHealthzHandler())
+	if err != nil {
+		return err
+	}
+
+	controllerCtx.InformerFactory.Start(ctx.Done())
+	defer controllerCtx.InformerFactory.Shutdown()
+
+	controllerCtx.ObjectOrMetadataInformerFactory.Start(ctx.Done())
+	close(controllerCtx.InformersStarted)
+
+	if !kcmapp.RunControllers(ctx, controllerCtx, controllers, kcmapp.ControllerStartJitter, cc.ControllerShutdownTimeout) {
+		return errors.New("controller shutdown timeout reached")
+	}
+
+	return nil
+}
+
+// newControllerContext builds the controller context the same way kcmapp.CreateControllerContext does.
+//
+// kcmapp.CreateControllerContext registers the process wide informer name, so it can't be called for more than one cluster.
+func newControllerContext(ctx context.Context, cc *kcmconfig.CompletedConfig) (kcmapp.ControllerContext, error) {
+	// trim the managed fields to keep the informers caches smaller
+	trim := func(obj any) (any, error) {
+		if accessor, err := meta.Accessor(obj); err == nil && accessor.GetManagedFields() != nil {
+			accessor.SetManagedFields(nil)
+		}
+
+		return obj, nil
+	}
+
+	clientBuilder := clientbuilder.SimpleControllerClientBuilder{
+		ClientConfig: cc.Kubeconfig,
+	}
+
+	versionedClient, err := clientBuilder.Client("shared-informers")
+	if err != nil {
+		return kcmapp.ControllerContext{}, err
+	}
+
+	sharedInformers := informers.NewSharedInformerFactoryWithOptions(versionedClient, kcmapp.ResyncPeriod(cc)(), informers.WithTransform(trim))
+
+	metadataConfig, err := clientBuilder.Config("metadata-informers")
+	if err != nil {
+		return kcmapp.ControllerContext{}, err
+	}
+
+	metadataClient, err := metadata.NewForConfig(metadataConfig)
+	if err != nil {
+		return kcmapp.ControllerContext{}, err
+	}
+
+	metadataInformers := metadatainformer.NewSharedInformerFactoryWithOptions(metadataClient, kcmapp.ResyncPeriod(cc)(), metadatainformer.WithTransform(trim))
+
+	discoveryClient, err := clientBuilder.DiscoveryClient("controller-discovery")
+	if err != nil {
+		return kcmapp.ControllerContext{}, err
+	}
+
+	restMapper := restmapper.NewDeferredDiscoveryRESTMapper(cacheddiscovery.NewMemCacheClient(discoveryClient))
+
+	go wait.Until(restMapper.Reset, 30*time.Second, ctx.Done())
+
+	controllerCtx := kcmapp.ControllerContext{
+		ClientBuilder:                   clientBuilder,
+		InformerFactory:                 sharedInformers,
+		ObjectOrMetadataInformerFactory: informerfactory.NewInformerFactory(sharedInformers, metadataInformers),
+		ComponentConfig:                 cc.ComponentConfig,
+		RESTMapper:                      restMapper,
+		InformersStarted:                make(chan struct{}),
+		ResyncPeriod:                    kcmapp.ResyncPeriod(cc),
+		ControllerManagerMetrics:        controllersmetrics.NewControllerManagerMetrics(controllerManagerName),
+	}
+
+	if controllerCtx.ComponentConfig.GarbageCollectorController.EnableGarbageCollector &&
+		controllerCtx.IsControllerEnabled(kcmapp.NewControllerDescriptors()[names.GarbageCollectorController]) {
+		ignoredResources := map[schema.GroupResource]struct{}{}
+
+		for _, r := range controllerCtx.ComponentConfig.GarbageCollectorController.GCIgnoredResources {
+			ignoredResources[schema.GroupResource{Group: r.Group, Resource: r.Resource}] = struct{}{}
+		}
+
+		controllerCtx.GraphBuilder = garbagecollector.NewDependencyGraphBuilder(
+			ctx,
+			metadataClient,
+			restMapper,
+			ignoredResources,
+			controllerCtx.ObjectOrMetadataInformerFactory,
+			controllerCtx.InformersStarted,
+		)
+	}
+
+	controllersmetrics.Register()
+
+	return controllerCtx, nil
+}
+
+func runScheduler(ctx context.Context, kubeconfig string) error {
+	cfg, err := latest.Default()
+	if err != nil {
+		return err
+	}
+
+	config, err := loadKubeconfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	config = rest.AddUserAgent(config, schedulerName)
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	broadcaster := events.NewEventBroadcasterAdapterWithContext(ctx, client)
+
+	broadcaster.StartRecordingToSink(ctx.Done())
+	defer broadcaster.Shutdown()
+
+	informerFactory := scheduler.NewInformerFactory(client, 0)
+	dynamicInformerFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 0, corev1.NamespaceAll, nil)
+
+	sched, err := scheduler.New(
+		ctx,
+		client,
+		informerFactory,
+		dynamicInformerFactory,
+		func(name string) events.EventRecorderLogger {
+			return broadcaster.NewRecorder(name)
+		},
+		scheduler.WithComponentConfigVersion(cfg.APIVersion),
+		scheduler.WithKubeConfig(config),
+		scheduler.WithProfiles(cfg.Profiles...),
+		scheduler.WithPercentageOfNodesToScore(cfg.PercentageOfNodesToScore),
+		scheduler.WithPodMaxBackoffSeconds(cfg.PodMaxBackoffSeconds),
+		scheduler.WithPodInitialBackoffSeconds(cfg.PodInitialBackoffSeconds),
+		scheduler.WithExtenders(cfg.Extenders...),
+		scheduler.WithParallelism(cfg.Parallelism),
+	)
+	if err != nil {
+		return err
+	}
+
+	informerFactory.Start(ctx.Done())
+	defer informerFactory.Shutdown()
+
+	dynamicInformerFactory.Start(ctx.Done())
+	defer dynamicInformerFactory.Shutdown()
+
+	informerFactory.WaitForCacheSync(ctx.Done())
+	dynamicInformerFactory.WaitForCacheSync(ctx.Done())
+
+	if err = sched.WaitForHandlersSync(ctx); err != nil {
+		return fmt.Errorf("failed to sync the scheduler event handlers: %w", err)
+	}
+
+	sched.Run(ctx)
+
+	return nil
+}
+
+// loadKubeconfig reads the component kubeconfig, the apiserver is dialed through the machine network.
+func loadKubeconfig(path string) (*rest.Config, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", path)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Dial = network.DialContext
+
+	return config, nil
+}
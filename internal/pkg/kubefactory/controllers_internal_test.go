@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRunLeaderElectionHandOff(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewClientset()
+	k := &Kubernetes{logger: zaptest.NewLogger(t)}
+
+	leaders := make(chan string, 4)
+
+	run := func(identity string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			leaders <- identity
+
+			<-ctx.Done()
+
+			return nil
+		}
+	}
+
+	elect := func(ctx context.Context, identity string) <-chan error {
+		errCh := make(chan error, 1)
+
+		go func() {
+			errCh <- k.runLeaderElection(ctx, client, schedulerName, identity, run(identity))
+		}()
+
+		return errCh
+	}
+
+	waitLeader := func(expected string) {
+		select {
+		case identity := <-leaders:
+			require.Equal(t, expected, identity)
+		case <-time.After(renewDeadline):
+			require.FailNow(t, "timeout waiting for the leader", expected)
+		}
+	}
+
+	firstCtx, firstCancel := context.WithCancel(t.Context())
+	defer firstCancel()
+
+	firstErrCh := elect(firstCtx, "1000")
+
+	waitLeader("1000")
+
+	secondCtx, secondCancel := context.WithCancel(t.Context())
+	defer secondCancel()
+
+	secondErrCh := elect(secondCtx, "1001")
+
+	// the second control plane waits while the lease is held
+	select {
+	case identity := <-leaders:
+		require.FailNow(t, "unexpected leader", identity)
+	case <-time.After(2 * retryPeriod):
+	}
+
+	// the lease is released once the leader stops, so the second control plane takes over before the lease expires
+	firstCancel()
+
+	require.NoError(t, <-firstErrCh)
+
+	waitLeader("1001")
+
+	lease, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Get(t.Context(), schedulerName, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "1001", *lease.Spec.HolderIdentity)
+
+	secondCancel()
+
+	require.NoError(t, <-secondErrCh)
+}
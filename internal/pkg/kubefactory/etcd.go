@@ -29,19 +29,41 @@ type Etcd struct {
 	client *clientv3.Client
 }
 
+// EtcdConfig defines the embedded etcd listeners.
+type EtcdConfig struct {
+	// ClientAddress is the host:port the etcd clients connect to.
+	ClientAddress string
+	// PeerAddress is the host:port of the etcd peer listener.
+	PeerAddress string
+}
+
 // NewEmbeddedEtcd creates new embedded etcd instance.
-func NewEmbeddedEtcd(ctx context.Context, path string, logger *zap.Logger) (*Etcd, error) {
+func NewEmbeddedEtcd(ctx context.Context, path string, etcdConfig EtcdConfig, logger *zap.Logger) (*Etcd, error) {
 	logger = logger.WithOptions(
 		// never enable debug logs for etcd, they are too chatty
 		zap.IncreaseLevel(zap.ErrorLevel),
 	)
 
-	logger.Info("starting embedded etcd server", zap.String("data_dir", path))
+	logger.Info("starting embedded etcd server",
+		zap.String("data_dir", path),
+		zap.String("client_address", etcdConfig.ClientAddress),
+		zap.String("peer_address", etcdConfig.PeerAddress),
+	)
 
 	if err := os.MkdirAll(path, 0o775); err != nil && !os.IsExist(err) {
 		return nil, err
 	}
 
+	caddr, err := url.Parse("http://" + etcdConfig.ClientAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid etcd client address %q: %w", etcdConfig.ClientAddress, err)
+	}
+
+	paddr, err := url.Parse("http://" + etcdConfig.PeerAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid etcd peer address %q: %w", etcdConfig.PeerAddress, err)
+	}
+
 	cfg := embed.NewConfig()
 	cfg.Dir = path
 	cfg.EnableGRPCGateway = false
@@ -53,10 +75,6 @@ func NewEmbeddedEtcd(ctx context.Context, path string, logger *zap.Logger) (*Etc
 	cfg.ExperimentalCompactHashCheckEnabled = true
 	cfg.ExperimentalInitialCorruptCheck = true
 
-	// run the emulator etcd on a different port to avoid clashing with Omni etcd
-	caddr, _ := url.Parse("http://localhost:2400") //nolint:errcheck
-	paddr, _ := url.Parse("http://localhost:2401") //nolint:errcheck
-
 	cfg.InitialCluster = fmt.Sprintf("default=%s", paddr.String())
 	cfg.ListenClientUrls = []url.URL{*caddr}
 	cfg.AdvertiseClientUrls = []url.URL{*caddr}
@@ -64,13 +82,6 @@ func NewEmbeddedEtcd(ctx context.Context, path string, logger *zap.Logger) (*Etc
 	cfg.ListenPeerUrls = []url.URL{*paddr}
 	cfg.AdvertisePeerUrls = []url.URL{*paddr}
 
-	peerURL, err := url.Parse("http://localhost:0")
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse URL: %w", err)
-	}
-
-	cfg.ListenPeerUrls = []url.URL{*peerURL}
-
 	embeddedServer, err := embed.StartEtcd(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start embedded etcd: %w", err)
@@ -6,22 +6,29 @@
 package kubefactory
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sync"
 
 	"github.com/go-logr/zapr"
+	"github.com/siderolabs/omni/client/pkg/panichandler"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/cmd/kube-apiserver/app"
 	"k8s.io/kubernetes/cmd/kube-apiserver/app/options"
+	"k8s.io/kubernetes/pkg/controlplane/reconcilers"
 
 	"github.com/siderolabs/talemu/internal/pkg/machine/network"
 )
@@ -43,27 +50,53 @@ type Kubernetes struct {
 	etcd   *Etcd
 	logger *zap.Logger
 
-	dataDir string
-	mu      sync.Mutex
+	// sharedAPIServers keeps the api servers of the clusters, it is nil unless the api servers are shared.
+	sharedAPIServers map[string]*sharedAPIServer
+	// members are the control planes running the api servers of the clusters, when the api servers aren't shared.
+	members map[string]*apiServerMembers
+
+	dataDir  string
+	mu       sync.Mutex
+	sharedMu sync.Mutex
+}
+
+// Option configures the kubernetes simulator.
+type Option func(*Kubernetes)
+
+// WithSharedAPIServers runs a single api server per cluster instead of one per control plane machine,
+// the api server addresses of the control planes forward to it.
+func WithSharedAPIServers(value bool) Option {
+	return func(k *Kubernetes) {
+		if value {
+			k.sharedAPIServers = map[string]*sharedAPIServer{}
+		}
+	}
 }
 
 // New creates a kubernetes simulator.
-func New(ctx context.Context, dataDir string, logger *zap.Logger) (*Kubernetes, error) { //nolint:contextcheck
+func New(ctx context.Context, dataDir string, etcdConfig EtcdConfig, logger *zap.Logger, opts ...Option) (*Kubernetes, error) { //nolint:contextcheck
 	klog.SetLogger(zapr.NewLogger(
 		logger.WithOptions(zap.IncreaseLevel(zapcore.WarnLevel)).
 			With(zap.String("component", "kubernetes")),
 	))
 
-	etcd, err := NewEmbeddedEtcd(ctx, filepath.Join(dataDir, "etcd.db"), logger)
+	etcd, err := NewEmbeddedEtcd(ctx, filepath.Join(dataDir, "etcd.db"), etcdConfig, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Kubernetes{
+	k := &Kubernetes{
 		dataDir: dataDir,
 		etcd:    etcd,
 		logger:  logger,
-	}, nil
+		members: map[string]*apiServerMembers{},
+	}
+
+	for _, opt := range opts {
+		opt(k)
+	}
+
+	return k, nil
 }
 
 // DeleteEtcdState removes all keys related to the cluster with the specified id.
@@ -80,33 +113,163 @@ func (k *Kubernetes) DeleteEtcdState(ctx context.Context, clusterID string) erro
 	return nil
 }
 
-// RunAPIService spawns an api service on the specified address and using etcd state for the cluster ID.
-func (k *Kubernetes) RunAPIService(ctx context.Context, address, iface, machineID, clusterID string) error {
-	certsDir := filepath.Join("_out/state/machines", machineID, "certs")
+// SnapshotEtcdState writes the etcd snapshot of the cluster with the specified id.
+//
+// The snapshot keeps the keys the way the cluster etcd stores them, without the cluster prefix.
+func (k *Kubernetes) SnapshotEtcdState(ctx context.Context, clusterID string, w io.Writer) error {
+	resp, err := k.etcd.Client().Get(ctx, clusterPrefix(clusterID)+"/", clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
 
-	s := options.NewServerRunOptions()
+	kvs := make([]KeyValue, 0, len(resp.Kvs))
 
-	s.ServiceAccountSigningKeyFile = filepath.Join(certsDir, "service-account.key")
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, KeyValue{
+			Key:   bytes.TrimPrefix(kv.Key, []byte("/"+clusterID)),
+			Value: kv.Value,
+		})
+	}
+
+	return WriteSnapshot(w, kvs)
+}
+
+// RestoreEtcdState replaces the keys of the cluster with the specified id with the Kubernetes keys read from the etcd snapshot.
+func (k *Kubernetes) RestoreEtcdState(ctx context.Context, clusterID string, kvs []KeyValue) error {
+	client := k.etcd.Client()
+
+	if _, err := client.Delete(ctx, clusterPrefix(clusterID)+"/", clientv3.WithPrefix()); err != nil {
+		return err
+	}
+
+	ops := make([]clientv3.Op, 0, len(kvs))
+
+	for _, kv := range kvs {
+		if !bytes.HasPrefix(kv.Key, []byte(registryPrefix)) {
+			continue
+		}
 
-	var lc net.ListenConfig
+		ops = append(ops, clientv3.OpPut("/"+clusterID+string(kv.Key), string(kv.Value)))
+	}
+
+	for batch := range slices.Chunk(ops, maxTxnOps) {
+		if _, err := client.Txn(ctx).Then(batch...).Commit(); err != nil {
+			return err
+		}
+	}
 
-	lc.Control = network.BindToInterface(iface)
+	k.logger.Info("restored etcd state", zap.String("cluster", clusterID), zap.Int("keys_restored", len(ops)))
 
-	lis, err := lc.Listen(ctx, "tcp", net.JoinHostPort(address, "6443"))
+	return nil
+}
+
+// RunAPIService spawns an api service on the specified address and using etcd state for the cluster ID.
+//
+// The certificates are read from the machine certs directory, the api server configuration files are written next to them.
+// The api service reports the specified Kubernetes version, which is the kube-apiserver image tag.
+// If the api servers are shared, the address forwards to the api server of the cluster instead.
+func (k *Kubernetes) RunAPIService(ctx context.Context, nc *network.Client, address, iface, machineID, certsDir, clusterID, kubernetesVersion string,
+	cfg *APIServerConfig,
+) error {
+	versionInfo, err := apiServerVersion(kubernetesVersion)
+	if err != nil {
+		k.logger.Warn("reporting the vendored Kubernetes version", zap.String("machine", machineID), zap.Error(err))
+	}
+
+	if k.sharedAPIServers != nil {
+		return k.runSharedAPIService(ctx, nc, address, iface, machineID, certsDir, clusterID, versionInfo, cfg)
+	}
+
+	lis, err := nc.Listen(ctx, iface, net.JoinHostPort(address, "6443"))
 	if err != nil {
 		return err
 	}
 
 	defer lis.Close() //nolint:errcheck
 
+	// the apiserver loopback clients use the host network
+	if lis, err = nc.ListenHostLoopback(ctx, lis); err != nil {
+		return err
+	}
+
+	s, err := k.apiServerOptions(lis, address, certsDir, clusterID, cfg)
+	if err != nil {
+		return err
+	}
+
+	members := k.joinAPIServer(clusterID, machineID, address)
+	defer k.leaveAPIServer(clusterID, machineID)
+
+	k.mu.Lock()
+	server.SetHostnameFuncForTests(machineID)
+
+	// set default options
+	completedOptions, err := s.Complete(ctx)
+
+	k.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// validate options
+	if errs := completedOptions.Validate(); len(errs) != 0 {
+		return errors.NewAggregate(errs)
+	}
+
+	config, err := app.NewConfig(completedOptions)
+	if err != nil {
+		return err
+	}
+
+	buildHandlerChain := config.Aggregator.GenericConfig.BuildHandlerChainFunc
+
+	config.Aggregator.GenericConfig.BuildHandlerChainFunc = func(apiHandler http.Handler, c *server.Config) http.Handler {
+		return buildHandlerChain(withVersion(apiHandler, versionInfo), c)
+	}
+
+	completed, err := config.Complete()
+	if err != nil {
+		return err
+	}
+
+	aggregator, err := app.CreateServerChain(completed)
+	if err != nil {
+		return err
+	}
+
+	prepared, err := aggregator.PrepareRun()
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewForConfig(aggregator.GenericAPIServer.LoopbackClientConfig)
+	if err != nil {
+		return err
+	}
+
+	membersCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logger := k.logger.With(zap.String("machine", machineID))
+
+	panichandler.Go(func() {
+		members.syncEndpoints(membersCtx, client, logger)
+	}, logger)
+
+	return prepared.Run(ctx)
+}
+
+func (k *Kubernetes) apiServerOptions(lis net.Listener, address, certsDir, clusterID string, cfg *APIServerConfig) (*options.ServerRunOptions, error) {
+	s := options.NewServerRunOptions()
+
+	s.ServiceAccountSigningKeyFile = filepath.Join(certsDir, "service-account.key")
+
 	s.SecureServing.ServerCert.CertKey.CertFile = filepath.Join(certsDir, "apiserver.crt")
 	s.SecureServing.ServerCert.CertKey.KeyFile = filepath.Join(certsDir, "apiserver.key")
 	s.SecureServing.Listener = lis
 	s.SecureServing.ExternalAddress = net.ParseIP(address)
 
-	k.mu.Lock()
-	server.SetHostnameFuncForTests(machineID)
-
 	s.ServiceClusterIPRanges = address + "/108"
 
 	s.Authentication.Anonymous.Allow = false
@@ -119,23 +282,26 @@ func (k *Kubernetes) RunAPIService(ctx context.Context, address, iface, machineI
 	s.Etcd.StorageConfig.Transport.ServerList = k.etcd.Client().Endpoints()
 	s.Etcd.StorageConfig.Prefix = clusterPrefix(clusterID)
 
-	// set default options
-	completedOptions, err := s.Complete(ctx)
+	// the endpoints of the kubernetes service are the control plane addresses, they are reconciled by apiServerMembers
+	s.EndpointReconcilerType = string(reconcilers.NoneEndpointReconcilerType)
 
-	k.mu.Unlock()
-
-	if err != nil {
-		return err
+	if cfg == nil {
+		return s, nil
 	}
 
-	// validate options
-	if errs := completedOptions.Validate(); len(errs) != 0 {
-		return errors.NewAggregate(errs)
+	if err := cfg.apply(s, certsDir, k.logger.With(zap.String("cluster", clusterID))); err != nil {
+		return nil, err
 	}
 
-	return app.Run(ctx, completedOptions)
+	return s, nil
 }
 
+// registryPrefix is the etcd prefix of the Kubernetes keys.
+const registryPrefix = "/registry/"
+
+// maxTxnOps is the default limit of the operations in a single etcd transaction.
+const maxTxnOps = 128
+
 func clusterPrefix(clusterID string) string {
 	return fmt.Sprintf("/%s/registry", clusterID)
 }
@@ -0,0 +1,178 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/server/v3/lease"
+	"go.etcd.io/etcd/server/v3/storage/backend"
+	"go.etcd.io/etcd/server/v3/storage/mvcc"
+	"go.etcd.io/etcd/server/v3/storage/schema"
+	"go.uber.org/zap"
+)
+
+// snapshotPageSize is the alignment of the etcd database, the snapshots with the hash have 32 extra bytes.
+const snapshotPageSize = 512
+
+// KeyValue is a key stored in the etcd snapshot.
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// WriteSnapshot writes the keys in the etcd snapshot format: the etcd backend database followed by its sha256 hash.
+//
+// The snapshot can be restored by etcdutl the same way the snapshots taken from the etcd maintenance API are.
+func WriteSnapshot(w io.Writer, kvs []KeyValue) error {
+	return withStore(func(be backend.Backend, st mvcc.KV) error {
+		for _, kv := range kvs {
+			st.Put(kv.Key, kv.Value, lease.NoLease)
+		}
+
+		snapshot := be.Snapshot()
+		defer snapshot.Close() //nolint:errcheck
+
+		hash := sha256.New()
+
+		if _, err := snapshot.WriteTo(io.MultiWriter(w, hash)); err != nil {
+			return fmt.Errorf("error writing snapshot: %w", err)
+		}
+
+		_, err := w.Write(hash.Sum(nil))
+
+		return err
+	})
+}
+
+// ReadSnapshot reads the keys from the etcd snapshot.
+//
+// The snapshot hash is verified unless skipHashCheck is set, the snapshots without the hash (e.g. copied etcd databases)
+// can only be read with skipHashCheck.
+func ReadSnapshot(ctx context.Context, snapshot []byte, skipHashCheck bool) ([]KeyValue, error) {
+	if len(snapshot)%snapshotPageSize == sha256.Size {
+		db := snapshot[:len(snapshot)-sha256.Size]
+		sum := sha256.Sum256(db)
+
+		if !skipHashCheck && !bytes.Equal(sum[:], snapshot[len(db):]) {
+			return nil, errors.New("snapshot hash mismatch")
+		}
+
+		snapshot = db
+	} else if !skipHashCheck {
+		return nil, errors.New("snapshot is missing the hash")
+	}
+
+	return readSnapshotKeys(ctx, snapshot)
+}
+
+// readSnapshotKeys reads the latest revision of each key from the etcd database.
+//
+// The database is read with bbolt directly, so that the malformed snapshots are reported as errors.
+func readSnapshotKeys(ctx context.Context, snapshot []byte) ([]KeyValue, error) {
+	dir, err := os.MkdirTemp("", "talemu-etcd-snapshot-")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	path := filepath.Join(dir, "db")
+
+	if err = os.WriteFile(path, snapshot, 0o600); err != nil {
+		return nil, err
+	}
+
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening snapshot: %w", err)
+	}
+
+	defer db.Close() //nolint:errcheck
+
+	var (
+		keys   []string
+		values = map[string][]byte{}
+	)
+
+	if err = db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(schema.Key.Name())
+		if bucket == nil {
+			return errors.New("snapshot doesn't have the key bucket")
+		}
+
+		// the revisions are ordered, so the latest revision of the key is the last one
+		return bucket.ForEach(func(rev, data []byte) error {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+
+			var kv mvccpb.KeyValue
+
+			if err = kv.Unmarshal(data); err != nil {
+				return fmt.Errorf("error decoding revision %x: %w", rev, err)
+			}
+
+			key := string(kv.Key)
+
+			if mvcc.IsTombstone(rev) {
+				delete(values, key)
+
+				return nil
+			}
+
+			if _, ok := values[key]; !ok {
+				keys = append(keys, key)
+			}
+
+			values[key] = kv.Value
+
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %w", err)
+	}
+
+	slices.Sort(keys)
+
+	kvs := make([]KeyValue, 0, len(values))
+
+	for _, key := range slices.Compact(keys) {
+		if value, ok := values[key]; ok {
+			kvs = append(kvs, KeyValue{Key: []byte(key), Value: value})
+		}
+	}
+
+	return kvs, nil
+}
+
+// withStore opens the etcd store in a temporary database.
+func withStore(fn func(be backend.Backend, st mvcc.KV) error) error {
+	dir, err := os.MkdirTemp("", "talemu-etcd-snapshot-")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	be := backend.NewDefaultBackend(zap.NewNop(), filepath.Join(dir, "db"))
+	defer be.Close() //nolint:errcheck
+
+	st := mvcc.NewStore(zap.NewNop(), be, &lease.FakeLessor{}, mvcc.StoreConfig{})
+	defer st.Close() //nolint:errcheck
+
+	return fn(be, st)
+}
@@ -0,0 +1,53 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	kvs := []kubefactory.KeyValue{
+		{Key: []byte("/registry/namespaces/default"), Value: []byte("default")},
+		{Key: []byte("/registry/namespaces/kube-system"), Value: []byte("kube-system")},
+	}
+
+	var buf bytes.Buffer
+
+	require.NoError(t, kubefactory.WriteSnapshot(&buf, kvs))
+
+	snapshot := buf.Bytes()
+
+	restored, err := kubefactory.ReadSnapshot(t.Context(), snapshot, false)
+	require.NoError(t, err)
+	assert.Equal(t, kvs, restored)
+
+	// the etcd database without the hash is only accepted with the hash check skipped
+	db := snapshot[:len(snapshot)-32]
+
+	_, err = kubefactory.ReadSnapshot(t.Context(), db, false)
+	require.Error(t, err)
+
+	restored, err = kubefactory.ReadSnapshot(t.Context(), db, true)
+	require.NoError(t, err)
+	assert.Equal(t, kvs, restored)
+
+	corrupted := bytes.Clone(snapshot)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	_, err = kubefactory.ReadSnapshot(t.Context(), corrupted, false)
+	require.Error(t, err)
+
+	_, err = kubefactory.ReadSnapshot(t.Context(), []byte("not a snapshot"), true)
+	require.Error(t, err)
+}
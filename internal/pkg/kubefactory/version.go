@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/version"
+	componentversion "k8s.io/component-base/version"
+)
+
+// apiServerVersion returns the version info of the api server with the specified Kubernetes version.
+//
+// The embedded api server is always the vendored Kubernetes, only the reported version follows the kube-apiserver image tag.
+// Nil is returned for the empty version, so that the vendored version is reported.
+func apiServerVersion(kubernetesVersion string) (*version.Info, error) {
+	if kubernetesVersion == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	v, err := utilversion.ParseSemantic(kubernetesVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Kubernetes version %q: %w", kubernetesVersion, err)
+	}
+
+	info := componentversion.Get()
+
+	info.Major = strconv.FormatUint(uint64(v.Major()), 10)
+	info.Minor = strconv.FormatUint(uint64(v.Minor()), 10)
+	info.GitVersion = "v" + v.String()
+	info.EmulationMajor = info.Major
+	info.EmulationMinor = info.Minor
+	info.MinCompatibilityMajor = info.Major
+	info.MinCompatibilityMinor = strconv.FormatUint(uint64(max(v.Minor(), 1)-1), 10)
+
+	return &info, nil
+}
+
+type versionContextKey struct{}
+
+// withRequestVersion passes the version info to the api server with the request,
+// so that the shared api server reports the version of the control plane which serves the request.
+func withRequestVersion(next http.Handler, info *version.Info) http.Handler {
+	if info == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), versionContextKey{}, info)))
+	})
+}
+
+// withVersion serves /version with the specified version info or the version info passed with the request,
+// the rest of the requests go to the api server.
+//
+// The handler is wrapped into the api server handler chain, so /version requires the authentication as the rest of the api.
+func withVersion(next http.Handler, info *version.Info) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || (req.URL.Path != "/version" && req.URL.Path != "/version/") {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		reported := info
+		if reported == nil {
+			reported, _ = req.Context().Value(versionContextKey{}).(*version.Info) //nolint:errcheck
+		}
+
+		if reported == nil {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		body, err := json.Marshal(reported)
+		if err != nil {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body) //nolint:errcheck
+	})
+}
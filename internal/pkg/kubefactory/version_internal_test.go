@@ -0,0 +1,89 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package kubefactory
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+func TestAPIServerVersion(t *testing.T) {
+	t.Parallel()
+
+	info, err := apiServerVersion("v1.30.1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "1", info.Major)
+	assert.Equal(t, "30", info.Minor)
+	assert.Equal(t, "v1.30.1", info.GitVersion)
+	assert.Equal(t, "30", info.EmulationMinor)
+	assert.Equal(t, "29", info.MinCompatibilityMinor)
+
+	info, err = apiServerVersion("")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	_, err = apiServerVersion("latest")
+	require.Error(t, err)
+}
+
+func TestWithVersion(t *testing.T) {
+	t.Parallel()
+
+	info, err := apiServerVersion("v1.31.0-rc.1")
+	require.NoError(t, err)
+
+	handler := withVersion(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), info)
+
+	for _, path := range []string{"/version", "/version/"} {
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var reported version.Info
+
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reported))
+
+		assert.Equal(t, "v1.31.0-rc.1", reported.GitVersion)
+		assert.Equal(t, "31", reported.Minor)
+	}
+
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+
+	// the shared api server reports the version passed with the request by the control plane
+	handler = withRequestVersion(withVersion(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), nil), info)
+
+	rec = httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"gitVersion":"v1.31.0-rc.1"`)
+
+	// the vendored version is reported without the version info
+	rec = httptest.NewRecorder()
+
+	withVersion(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+}
@@ -23,6 +23,7 @@ import (
 	"go4.org/netipx"
 
 	machinenetwork "github.com/siderolabs/talemu/internal/pkg/machine/network"
+	"github.com/siderolabs/talemu/internal/pkg/machine/network/userspace"
 )
 
 // AddressSpecController applies network.AddressSpec to the actual interfaces.
@@ -93,16 +94,25 @@ func (ctrl *AddressSpecController) Run(ctx context.Context, r controller.Runtime
 			}
 		}
 
-		// list rtnetlink links (interfaces)
-		links, err := ctrl.NC.Conn().Link.List()
-		if err != nil {
-			return fmt.Errorf("error listing links: %w", err)
-		}
+		var (
+			links []rtnetlink.LinkMessage
+			addrs []rtnetlink.AddressMessage
+		)
 
-		// list rtnetlink addresses
-		addrs, err := ctrl.NC.Conn().Address.List()
-		if err != nil {
-			return fmt.Errorf("error listing addresses: %w", err)
+		stack := ctrl.NC.Userspace()
+
+		if stack == nil {
+			// list rtnetlink links (interfaces)
+			links, err = ctrl.NC.Conn().Link.List()
+			if err != nil {
+				return fmt.Errorf("error listing links: %w", err)
+			}
+
+			// list rtnetlink addresses
+			addrs, err = ctrl.NC.Conn().Address.List()
+			if err != nil {
+				return fmt.Errorf("error listing addresses: %w", err)
+			}
 		}
 
 		visited := make(map[string]struct{}, len(list.Items))
@@ -113,7 +123,13 @@ func (ctrl *AddressSpecController) Run(ctx context.Context, r controller.Runtime
 
 			logger.Info("reconcile address", zap.String("address", res.Metadata().ID()), zap.String("link", address.TypedSpec().LinkName))
 
-			if err = ctrl.syncAddress(ctx, r, logger, ctrl.NC.Conn(), links, addrs, address); err != nil {
+			if stack != nil {
+				err = ctrl.syncUserspaceAddress(ctx, r, logger, stack, address)
+			} else {
+				err = ctrl.syncAddress(ctx, r, logger, ctrl.NC.Conn(), links, addrs, address)
+			}
+
+			if err != nil {
 				return err
 			}
 
@@ -201,6 +217,8 @@ func (ctrl *AddressSpecController) syncAddress(ctx context.Context, r controller
 			return nil
 		}
 
+		ctrl.NC.TrackAddress(address.TypedSpec().Address.Addr(), false)
+
 		if existing := findAddress(addrs, linkIndex, address.TypedSpec().Address); existing != nil {
 			// delete address
 			if err := conn.Address.Delete(existing); err != nil {
@@ -222,6 +240,8 @@ func (ctrl *AddressSpecController) syncAddress(ctx context.Context, r controller
 			return nil
 		}
 
+		ctrl.NC.TrackAddress(address.TypedSpec().Address.Addr(), true)
+
 		if existing := findAddress(addrs, linkIndex, address.TypedSpec().Address); existing != nil {
 			// clear out tentative flag, it is set by the kernel, we shouldn't try to enforce it
 			existing.Flags &= ^uint8(nethelpers.AddressTentative)
@@ -274,7 +294,9 @@ func (ctrl *AddressSpecController) syncAddress(ctx context.Context, r controller
 		logger.Info("assigned address", zap.Stringer("address", address.TypedSpec().Address), zap.String("link", address.TypedSpec().LinkName))
 
 		if address.TypedSpec().AnnounceWithARP {
-			if err := ctrl.gratuitousARP(logger, linkIndex, address.TypedSpec().Address.Addr()); err != nil {
+			if err := ctrl.NC.Do(func() error {
+				return ctrl.gratuitousARP(logger, linkIndex, address.TypedSpec().Address.Addr())
+			}); err != nil {
 				logger.Warn("failure sending gratuitous ARP", zap.Stringer("address", address.TypedSpec().Address), zap.String("link", address.TypedSpec().LinkName), zap.Error(err))
 			}
 		}
@@ -283,6 +305,44 @@ func (ctrl *AddressSpecController) syncAddress(ctx context.Context, r controller
 	return nil
 }
 
+// syncUserspaceAddress assigns the address to the link of the userspace network.
+func (ctrl *AddressSpecController) syncUserspaceAddress(ctx context.Context, r controller.Runtime, logger *zap.Logger, stack *userspace.Stack, address *network.AddressSpec) error {
+	linkName := address.TypedSpec().LinkName
+
+	switch address.Metadata().Phase() {
+	case resource.PhaseTearingDown:
+		if err := stack.RemoveAddress(linkName, address.TypedSpec().Address); err != nil {
+			return fmt.Errorf("error removing address: %w", err)
+		}
+
+		logger.Sugar().Infof("removed address %s from %q", address.TypedSpec().Address, linkName)
+
+		// now remove finalizer as address was deleted
+		if err := r.RemoveFinalizer(ctx, address.Metadata(), ctrl.Name()); err != nil {
+			return fmt.Errorf("error removing finalizer: %w", err)
+		}
+	case resource.PhaseRunning:
+		if stack.HasAddress(linkName, address.TypedSpec().Address) {
+			return nil
+		}
+
+		if err := stack.AddAddress(linkName, address.TypedSpec().Address); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// address can't be assigned as link doesn't exist (yet), skip it
+				logger.Info("the address can not be assigned as the link doesn't exist yet")
+
+				return nil
+			}
+
+			return fmt.Errorf("error adding address %s to %q: %w", address.TypedSpec().Address, linkName, err)
+		}
+
+		logger.Info("assigned address", zap.Stringer("address", address.TypedSpec().Address), zap.String("link", linkName))
+	}
+
+	return nil
+}
+
 func (ctrl *AddressSpecController) gratuitousARP(logger *zap.Logger, linkIndex uint32, ip netip.Addr) error {
 	etherBroadcast := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
 
@@ -13,7 +13,6 @@ import (
 	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/siderolabs/gen/optional"
-	"github.com/siderolabs/talos/pkg/machinery/constants"
 	"github.com/siderolabs/talos/pkg/machinery/resources/config"
 	"github.com/siderolabs/talos/pkg/machinery/resources/network"
 	"github.com/siderolabs/talos/pkg/machinery/resources/secrets"
@@ -27,9 +26,10 @@ import (
 
 // APIDController interacts with SideroLink API and brings up the SideroLink Wireguard interface.
 type APIDController struct {
-	APID     *services.APID
-	address  netip.Prefix
-	insecure bool
+	APID            *services.APID
+	InterfacePrefix string
+	address         netip.Prefix
+	insecure        bool
 }
 
 // Name implements controller.Controller interface.
@@ -128,7 +128,7 @@ func (ctrl *APIDController) reconcile(ctx context.Context, r controller.Runtime,
 	}
 
 	siderolink, found := addresses.Find(func(address *network.AddressStatus) bool {
-		return strings.HasPrefix(address.TypedSpec().LinkName, constants.SideroLinkName)
+		return strings.HasPrefix(address.TypedSpec().LinkName, ctrl.InterfacePrefix)
 	})
 	if !found {
 		logger.Info("apid is waiting for siderolink interface to be up")
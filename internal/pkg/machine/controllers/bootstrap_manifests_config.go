@@ -0,0 +1,135 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/controller/generic/transform"
+	"github.com/siderolabs/gen/xerrors"
+	"github.com/siderolabs/gen/xslices"
+	sideronet "github.com/siderolabs/net"
+	talosconfig "github.com/siderolabs/talos/pkg/machinery/config/config"
+	"github.com/siderolabs/talos/pkg/machinery/constants"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
+	"go.uber.org/zap"
+)
+
+// BootstrapManifestsConfigController manages k8s.BootstrapManifestsConfig based on configuration.
+type BootstrapManifestsConfigController = transform.Controller[*config.MachineConfig, *k8s.BootstrapManifestsConfig]
+
+// NewBootstrapManifestsConfigController instanciates the controller.
+func NewBootstrapManifestsConfigController() *BootstrapManifestsConfigController {
+	return transform.NewController(
+		transform.Settings[*config.MachineConfig, *k8s.BootstrapManifestsConfig]{
+			Name:                    "k8s.BootstrapManifestsConfigController",
+			MapMetadataOptionalFunc: rootMapFunc(k8s.NewBootstrapManifestsConfig(), true),
+			TransformFunc: func(_ context.Context, _ controller.Reader, _ *zap.Logger, cfg *config.MachineConfig, res *k8s.BootstrapManifestsConfig) error {
+				cfgProvider := cfg.Config()
+				spec := res.TypedSpec()
+
+				networkConfig := cfgProvider.K8sNetworkConfig()
+				if networkConfig == nil {
+					return xerrors.NewTaggedf[transform.SkipReconcileTag]("machine config has no cluster network")
+				}
+
+				podCIDRs := xslices.Map(networkConfig.PodCIDRs(), netip.Prefix.String)
+
+				dnsServiceIPs, err := sideronet.NthIPInCIDRSet(networkConfig.ServiceCIDRs(), 10)
+				if err != nil {
+					return fmt.Errorf("error building DNS service IPs: %w", err)
+				}
+
+				spec.DNSServiceIP = ""
+				spec.DNSServiceIPv6 = ""
+
+				for _, ip := range dnsServiceIPs {
+					if ip.Is4() && spec.DNSServiceIP == "" {
+						spec.DNSServiceIP = ip.String()
+					}
+
+					if ip.Is6() && spec.DNSServiceIPv6 == "" {
+						spec.DNSServiceIPv6 = ip.String()
+					}
+				}
+
+				endpoint := cfgProvider.Cluster().Endpoint()
+
+				spec.Server = endpoint.String()
+				spec.ClusterDomain = networkConfig.DNSDomain()
+				spec.PodCIDRs = podCIDRs
+
+				proxyConfig := cfgProvider.K8sProxyConfig()
+
+				spec.ProxyEnabled = proxyConfig.Enabled()
+				spec.ProxyImage = proxyConfig.Image()
+				spec.ProxyArgs = proxyArgs(proxyConfig, podCIDRs)
+
+				spec.CoreDNSEnabled = cfgProvider.Cluster().CoreDNS().Enabled()
+				spec.CoreDNSImage = cfgProvider.Cluster().CoreDNS().Image()
+
+				flannelConfig := cfgProvider.K8sFlannelCNIConfig()
+
+				// the flannel config is only present when the flannel CNI is managed by Talos
+				spec.FlannelEnabled = flannelConfig != nil
+				spec.FlannelImage = fmt.Sprintf("ghcr.io/siderolabs/flannel:%s", constants.FlannelVersion)
+				spec.FlannelExtraArgs = nil
+				spec.FlannelBackendType = constants.FlannelDefaultBackend
+				spec.CNIName = constants.CustomCNI
+
+				if flannelConfig != nil {
+					spec.CNIName = constants.FlannelCNI
+					spec.FlannelExtraArgs = flannelConfig.ExtraArgs()
+					spec.FlannelKubeNetworkPoliciesEnabled = flannelConfig.KubeNetworkPoliciesEnabled()
+
+					if backendType := flannelConfig.BackendType(); backendType != "" {
+						spec.FlannelBackendType = backendType
+					}
+				}
+
+				// flannel talks to the apiserver directly, as it runs before the service network is up
+				spec.FlannelKubeServiceHost = endpoint.Hostname()
+				spec.FlannelKubeServicePort = endpoint.Port()
+
+				if spec.FlannelKubeServicePort == "" {
+					spec.FlannelKubeServicePort = "443"
+				}
+
+				return nil
+			},
+		},
+		transform.WithIgnoreTearingDownInputs(),
+	)
+}
+
+func proxyArgs(proxyConfig talosconfig.K8sProxyConfig, podCIDRs []string) []string {
+	mode := proxyConfig.Mode()
+	if mode == "" {
+		mode = "iptables"
+	}
+
+	args := map[string]string{
+		"cluster-cidr":           strings.Join(podCIDRs, ","),
+		"hostname-override":      "$(NODE_NAME)",
+		"kubeconfig":             "/etc/kubernetes/kubeconfig",
+		"proxy-mode":             mode,
+		"conntrack-max-per-core": "0",
+	}
+
+	for key, values := range proxyConfig.ExtraArgs() {
+		args[key] = strings.Join(values, ",")
+	}
+
+	return xslices.Map(slices.Sorted(maps.Keys(args)), func(key string) string {
+		return fmt.Sprintf("--%s=%s", key, args[key])
+	})
+}
@@ -0,0 +1,486 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/gen/optional"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
+	"github.com/siderolabs/talos/pkg/machinery/resources/secrets"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	kubecontroller "k8s.io/kubernetes/pkg/controller"
+	"k8s.io/kubernetes/pkg/controller/daemon"
+	daemonutil "k8s.io/kubernetes/pkg/controller/daemon/util"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
+)
+
+const (
+	// daemonSetSyncInterval is how often the DaemonSet pods of the node are checked.
+	daemonSetSyncInterval = 5 * time.Second
+	// daemonSetTemplateHashLabel is the label of the DaemonSet pods with the hash of the pod template they were created from.
+	daemonSetTemplateHashLabel = appsv1.DefaultDaemonSetUniqueLabelKey
+
+	daemonSetKind = "DaemonSet"
+)
+
+// DaemonSetPodController runs the DaemonSet pods on the machine node, as the kube-controller-manager DaemonSet controller does.
+//
+// The pods are updated one node at a time: the outdated pod is deleted with the RolloutDelay grace period,
+// and the pod from the new template is created once the old one is gone.
+// The control plane machines also report the DaemonSet status, so that the rollout can be followed.
+// Nothing is done if the embedded kube-controller-manager is running.
+type DaemonSetPodController struct {
+	GlobalState state.State
+
+	client kubernetesClient
+
+	KubeControllers bool
+	RolloutDelay    time.Duration
+}
+
+// Name implements controller.Controller interface.
+func (ctrl *DaemonSetPodController) Name() string {
+	return "k8s.DaemonSetPodController"
+}
+
+// Inputs implements controller.Controller interface.
+func (ctrl *DaemonSetPodController) Inputs() []controller.Input {
+	return []controller.Input{
+		{
+			Namespace: config.NamespaceName,
+			Type:      config.MachineConfigType,
+			ID:        optional.Some(config.ActiveID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: secrets.NamespaceName,
+			Type:      secrets.KubernetesType,
+			ID:        optional.Some(secrets.KubernetesID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: k8s.NamespaceName,
+			Type:      k8s.NodenameType,
+			ID:        optional.Some(k8s.NodenameID),
+			Kind:      controller.InputWeak,
+		},
+	}
+}
+
+// Outputs implements controller.Controller interface.
+func (ctrl *DaemonSetPodController) Outputs() []controller.Output {
+	return nil
+}
+
+// Run implements controller.Controller interface.
+func (ctrl *DaemonSetPodController) Run(ctx context.Context, r controller.Runtime, logger *zap.Logger) error {
+	ticker := time.NewTicker(daemonSetSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.EventCh():
+		case <-ticker.C:
+		}
+
+		if ctrl.KubeControllers {
+			continue
+		}
+
+		if err := ctrl.sync(ctx, r, logger); err != nil {
+			// the pods are synced on the next tick
+			logger.Warn("failed to sync the DaemonSet pods", zap.Error(err))
+
+			continue
+		}
+
+		r.ResetRestartBackoff()
+	}
+}
+
+func (ctrl *DaemonSetPodController) sync(ctx context.Context, r controller.Runtime, logger *zap.Logger) error {
+	cfg, err := machineconfig.GetComplete(ctx, r)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if cfg.Metadata().Phase() == resource.PhaseTearingDown {
+		return nil
+	}
+
+	nodename, err := safe.ReaderGetByID[*k8s.Nodename](ctx, r, k8s.NodenameID)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	client, err := ctrl.client.get(ctx, r, ctrl.GlobalState, cfg)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, daemonSetSyncInterval)
+	defer cancel()
+
+	node, err := client.CoreV1().Nodes().Get(ctx, nodename.TypedSpec().Nodename, metav1.GetOptions{})
+	if err != nil {
+		// the pods are bound to the node once it is registered
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	daemonSets, err := client.AppsV1().DaemonSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	if len(daemonSets.Items) == 0 {
+		return nil
+	}
+
+	// the pods and the nodes are listed once for all DaemonSets, as the machines of the cluster sync them all the time
+	podList, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	podsByOwner := map[types.UID][]*v1.Pod{}
+
+	for _, pod := range podList.Items {
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == daemonSetKind {
+			podsByOwner[owner.UID] = append(podsByOwner[owner.UID], &pod)
+		}
+	}
+
+	controlPlane := cfg.Provider().Machine().Type().IsControlPlane()
+
+	var nodes []v1.Node
+
+	if controlPlane {
+		// the nodes are listed after the pods, so that the pods of the just registered nodes are not orphaned
+		nodeList, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+
+		nodes = nodeList.Items
+	}
+
+	for _, ds := range daemonSets.Items {
+		pods := podsByOwner[ds.UID]
+		hash := daemonSetTemplateHash(&ds)
+
+		shouldRun, shouldContinueRunning := daemonSetSchedules(&ds, node)
+
+		switch {
+		case shouldRun:
+			err = ctrl.syncNodePod(ctx, client, &ds, pods, hash, node.Name, logger)
+		case !shouldContinueRunning:
+			err = removeNodePods(ctx, client, pods, node.Name)
+		}
+
+		if err != nil {
+			return fmt.Errorf("error syncing DaemonSet %s/%s pod: %w", ds.Namespace, ds.Name, err)
+		}
+
+		if !controlPlane {
+			continue
+		}
+
+		if pods, err = removeOrphanedPods(ctx, client, pods, nodes); err != nil {
+			return err
+		}
+
+		status := daemonSetStatus(&ds, pods, nodes, hash)
+		if daemonSetStatusEqual(ds.Status, status) {
+			continue
+		}
+
+		ds.Status = status
+
+		// the other control planes might have updated the status meanwhile
+		if _, err = client.AppsV1().DaemonSets(ds.Namespace).UpdateStatus(ctx, &ds, metav1.UpdateOptions{}); err != nil && !errors.IsConflict(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncNodePod creates the missing DaemonSet pod of the node, and replaces the outdated one once it's the node turn.
+func (ctrl *DaemonSetPodController) syncNodePod(ctx context.Context, client *kubernetes.Clientset, ds *appsv1.DaemonSet, pods []*v1.Pod, hash, nodeName string,
+	logger *zap.Logger,
+) error {
+	var current *v1.Pod
+
+	for _, pod := range pods {
+		if pod.Spec.NodeName != nodeName {
+			continue
+		}
+
+		// the new pod is created once the old one is gone
+		if pod.DeletionTimestamp != nil {
+			return nil
+		}
+
+		current = pod
+	}
+
+	if current == nil {
+		pod := daemonSetPod(ds, hash, nodeName)
+
+		if _, err := client.CoreV1().Pods(ds.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+
+		logger.Info("created DaemonSet pod", zap.String("daemonset", ds.Namespace+"/"+ds.Name))
+
+		return nil
+	}
+
+	if current.Labels[daemonSetTemplateHashLabel] == hash || ds.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+		return nil
+	}
+
+	if next := daemonSetRolloutNext(pods, hash); next != nodeName {
+		return nil
+	}
+
+	gracePeriod := int64(delayOrDefault(ctrl.RolloutDelay, DefaultDaemonSetRolloutDelay).Round(time.Second).Seconds())
+
+	err := client.CoreV1().Pods(current.Namespace).Delete(ctx, current.Name, metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		Preconditions:      metav1.NewUIDPreconditions(string(current.UID)),
+	})
+	if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+		return err
+	}
+
+	logger.Info("replacing outdated DaemonSet pod", zap.String("daemonset", ds.Namespace+"/"+ds.Name), zap.String("pod", current.Name))
+
+	return nil
+}
+
+// daemonSetRolloutNext returns the node which replaces its outdated pod next.
+//
+// The pods are replaced one at a time in the node name order, as with the default rolling update max unavailable of one:
+// the outdated pods which are not ready are replaced first, and the next pod waits for the replaced one to become ready.
+func daemonSetRolloutNext(pods []*v1.Pod, hash string) string {
+	var outdated, unavailable []string
+
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			return ""
+		}
+
+		if pod.Labels[daemonSetTemplateHashLabel] == hash {
+			if !podReady(pod) {
+				return ""
+			}
+
+			continue
+		}
+
+		outdated = append(outdated, pod.Spec.NodeName)
+
+		if !podReady(pod) {
+			unavailable = append(unavailable, pod.Spec.NodeName)
+		}
+	}
+
+	switch {
+	case len(unavailable) > 0:
+		return slices.Min(unavailable)
+	case len(outdated) > 0:
+		return slices.Min(outdated)
+	default:
+		return ""
+	}
+}
+
+// removeNodePods removes the DaemonSet pods of the node which the DaemonSet no longer runs on, e.g. after the node got tainted.
+func removeNodePods(ctx context.Context, client *kubernetes.Clientset, pods []*v1.Pod, nodeName string) error {
+	for _, pod := range pods {
+		if pod.Spec.NodeName != nodeName || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+			Preconditions: metav1.NewUIDPreconditions(string(pod.UID)),
+		})
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeOrphanedPods removes the DaemonSet pods of the removed nodes, as the pod garbage collector does.
+func removeOrphanedPods(ctx context.Context, client *kubernetes.Clientset, pods []*v1.Pod, nodes []v1.Node) ([]*v1.Pod, error) {
+	nodeNames := make(map[string]struct{}, len(nodes))
+
+	for _, node := range nodes {
+		nodeNames[node.Name] = struct{}{}
+	}
+
+	result := make([]*v1.Pod, 0, len(pods))
+
+	for _, pod := range pods {
+		if _, ok := nodeNames[pod.Spec.NodeName]; ok {
+			result = append(result, pod)
+
+			continue
+		}
+
+		err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+			GracePeriodSeconds: new(int64),
+			Preconditions:      metav1.NewUIDPreconditions(string(pod.UID)),
+		})
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// daemonSetPod renders the DaemonSet pod bound to the node.
+func daemonSetPod(ds *appsv1.DaemonSet, hash, nodeName string) *v1.Pod {
+	podLabels := maps.Clone(ds.Spec.Template.Labels)
+	if podLabels == nil {
+		podLabels = map[string]string{}
+	}
+
+	podLabels[daemonSetTemplateHashLabel] = hash
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName:    ds.Name + "-",
+			Namespace:       ds.Namespace,
+			Labels:          podLabels,
+			Annotations:     maps.Clone(ds.Spec.Template.Annotations),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(ds, appsv1.SchemeGroupVersion.WithKind(daemonSetKind))},
+		},
+		Spec: *ds.Spec.Template.Spec.DeepCopy(),
+	}
+
+	pod.Spec.NodeName = nodeName
+
+	daemonutil.AddOrUpdateDaemonPodTolerations(&pod.Spec)
+
+	return pod
+}
+
+// daemonSetTemplateHash returns the hash of the DaemonSet pod template.
+//
+// The hash is the same as the controller revision hash of the DaemonSet controller,
+// so the pods aren't replaced when the embedded kube-controller-manager takes over.
+func daemonSetTemplateHash(ds *appsv1.DaemonSet) string {
+	return kubecontroller.ComputeHash(&ds.Spec.Template, ds.Status.CollisionCount)
+}
+
+// daemonSetSchedules checks if the DaemonSet runs a pod on the node, and if the running pod can stay on the node.
+//
+// The node selector, the node affinity and the taints are checked the same way as by the DaemonSet controller.
+func daemonSetSchedules(ds *appsv1.DaemonSet, node *v1.Node) (shouldRun, shouldContinueRunning bool) {
+	return daemon.NodeShouldRunDaemonPod(klog.Background(), node, ds)
+}
+
+// daemonSetStatus computes the DaemonSet status from its pods.
+func daemonSetStatus(ds *appsv1.DaemonSet, pods []*v1.Pod, nodes []v1.Node, hash string) appsv1.DaemonSetStatus {
+	status := appsv1.DaemonSetStatus{
+		ObservedGeneration: ds.Generation,
+		Conditions:         ds.Status.Conditions,
+		CollisionCount:     ds.Status.CollisionCount,
+	}
+
+	scheduled := map[string]bool{}
+
+	for _, node := range nodes {
+		shouldRun, _ := daemonSetSchedules(ds, &node)
+
+		scheduled[node.Name] = shouldRun
+
+		if shouldRun {
+			status.DesiredNumberScheduled++
+		}
+	}
+
+	misscheduled := map[string]struct{}{}
+
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		if !scheduled[pod.Spec.NodeName] {
+			misscheduled[pod.Spec.NodeName] = struct{}{}
+
+			continue
+		}
+
+		status.CurrentNumberScheduled++
+
+		if pod.Labels[daemonSetTemplateHashLabel] == hash {
+			status.UpdatedNumberScheduled++
+		}
+
+		if podReady(pod) {
+			status.NumberReady++
+			status.NumberAvailable++
+		}
+	}
+
+	status.NumberMisscheduled = int32(len(misscheduled)) //nolint:gosec
+	status.NumberUnavailable = max(status.DesiredNumberScheduled-status.NumberAvailable, 0)
+
+	return status
+}
+
+func daemonSetStatusEqual(a, b appsv1.DaemonSetStatus) bool {
+	return a.ObservedGeneration == b.ObservedGeneration &&
+		a.DesiredNumberScheduled == b.DesiredNumberScheduled &&
+		a.CurrentNumberScheduled == b.CurrentNumberScheduled &&
+		a.UpdatedNumberScheduled == b.UpdatedNumberScheduled &&
+		a.NumberReady == b.NumberReady &&
+		a.NumberAvailable == b.NumberAvailable &&
+		a.NumberUnavailable == b.NumberUnavailable &&
+		a.NumberMisscheduled == b.NumberMisscheduled
+}
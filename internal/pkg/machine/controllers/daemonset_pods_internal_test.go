@@ -0,0 +1,241 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func daemonSetTestPod(nodeName, hash string, ready bool) *v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "kube-proxy-" + nodeName,
+			Labels: map[string]string{daemonSetTemplateHashLabel: hash},
+		},
+		Spec: v1.PodSpec{
+			NodeName: nodeName,
+		},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{
+				{
+					Type:   v1.PodReady,
+					Status: status,
+				},
+			},
+		},
+	}
+}
+
+func TestDaemonSetRolloutNext(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name     string
+		pods     []*v1.Pod
+		expected string
+	}{
+		{
+			name: "up to date",
+			pods: []*v1.Pod{
+				daemonSetTestPod("node-1", "new", true),
+				daemonSetTestPod("node-2", "new", true),
+			},
+		},
+		{
+			name: "node order",
+			pods: []*v1.Pod{
+				daemonSetTestPod("node-3", "old", true),
+				daemonSetTestPod("node-1", "new", true),
+				daemonSetTestPod("node-2", "old", true),
+			},
+			expected: "node-2",
+		},
+		{
+			name: "waits for the updated pod",
+			pods: []*v1.Pod{
+				daemonSetTestPod("node-1", "new", false),
+				daemonSetTestPod("node-2", "old", true),
+			},
+		},
+		{
+			name: "waits for the terminating pod",
+			pods: func() []*v1.Pod {
+				terminating := daemonSetTestPod("node-1", "old", true)
+				terminating.DeletionTimestamp = new(metav1.Now())
+
+				return []*v1.Pod{terminating, daemonSetTestPod("node-2", "old", true)}
+			}(),
+		},
+		{
+			name: "unavailable first",
+			pods: []*v1.Pod{
+				daemonSetTestPod("node-1", "old", true),
+				daemonSetTestPod("node-2", "old", false),
+			},
+			expected: "node-2",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.expected, daemonSetRolloutNext(tt.pods, "new"))
+		})
+	}
+}
+
+func TestDaemonSetStatus(t *testing.T) {
+	t.Parallel()
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "kube-proxy",
+			Generation: 3,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					NodeSelector: map[string]string{"kubernetes.io/os": osLinux},
+					Containers: []v1.Container{
+						{
+							Name:  "kube-proxy",
+							Image: "registry.k8s.io/kube-proxy:v1.30.1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	hash := daemonSetTemplateHash(ds)
+
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"kubernetes.io/os": osLinux}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-2", Labels: map[string]string{"kubernetes.io/os": osLinux}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-3", Labels: map[string]string{"kubernetes.io/os": osLinux}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "windows", Labels: map[string]string{"kubernetes.io/os": "windows"}}},
+	}
+
+	terminating := daemonSetTestPod("node-3", "old", true)
+	terminating.DeletionTimestamp = new(metav1.Now())
+
+	status := daemonSetStatus(ds, []*v1.Pod{
+		daemonSetTestPod("node-1", hash, true),
+		daemonSetTestPod("node-2", hash, false),
+		terminating,
+	}, nodes, hash)
+
+	assert.Equal(t, appsv1.DaemonSetStatus{
+		ObservedGeneration:     3,
+		DesiredNumberScheduled: 3,
+		CurrentNumberScheduled: 2,
+		UpdatedNumberScheduled: 2,
+		NumberReady:            1,
+		NumberAvailable:        1,
+		NumberUnavailable:      2,
+	}, status)
+
+	ds.Spec.Template.Spec.Containers[0].Image = "registry.k8s.io/kube-proxy:v1.31.0"
+
+	newHash := daemonSetTemplateHash(ds)
+
+	assert.NotEqual(t, hash, newHash)
+
+	pod := daemonSetPod(ds, newHash, "node-1")
+
+	assert.Equal(t, "node-1", pod.Spec.NodeName)
+	assert.Equal(t, newHash, pod.Labels[daemonSetTemplateHashLabel])
+	assert.Equal(t, "kube-proxy-", pod.GenerateName)
+	assert.Equal(t, "registry.k8s.io/kube-proxy:v1.31.0", pod.Spec.Containers[0].Image)
+	assert.Contains(t, pod.Spec.Tolerations, v1.Toleration{
+		Key:      v1.TaintNodeNotReady,
+		Operator: v1.TolerationOpExists,
+		Effect:   v1.TaintEffectNoExecute,
+	})
+}
+
+func TestDaemonSetSchedules(t *testing.T) {
+	t.Parallel()
+
+	controlPlaneTaint := v1.Taint{Key: "node-role.kubernetes.io/control-plane", Effect: v1.TaintEffectNoSchedule}
+	evictTaint := v1.Taint{Key: "example.com/evict", Effect: v1.TaintEffectNoExecute}
+
+	for _, tt := range []struct {
+		name        string
+		tolerations []v1.Toleration
+		taints      []v1.Taint
+
+		shouldRun             bool
+		shouldContinueRunning bool
+	}{
+		{
+			name:                  "no taints",
+			shouldRun:             true,
+			shouldContinueRunning: true,
+		},
+		{
+			name:                  "untolerated NoSchedule",
+			taints:                []v1.Taint{controlPlaneTaint},
+			shouldContinueRunning: true,
+		},
+		{
+			name:                  "tolerated NoSchedule",
+			taints:                []v1.Taint{controlPlaneTaint},
+			tolerations:           []v1.Toleration{{Key: controlPlaneTaint.Key, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}},
+			shouldRun:             true,
+			shouldContinueRunning: true,
+		},
+		{
+			name:   "untolerated NoExecute",
+			taints: []v1.Taint{evictTaint},
+		},
+		{
+			name:                  "tolerate everything",
+			taints:                []v1.Taint{controlPlaneTaint, evictTaint},
+			tolerations:           []v1.Toleration{{Operator: v1.TolerationOpExists}},
+			shouldRun:             true,
+			shouldContinueRunning: true,
+		},
+		{
+			name:                  "default tolerations",
+			taints:                []v1.Taint{{Key: v1.TaintNodeUnschedulable, Effect: v1.TaintEffectNoSchedule}},
+			shouldRun:             true,
+			shouldContinueRunning: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := &appsv1.DaemonSet{
+				Spec: appsv1.DaemonSetSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Tolerations: tt.tolerations,
+						},
+					},
+				},
+			}
+
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+				Spec:       v1.NodeSpec{Taints: tt.taints},
+			}
+
+			shouldRun, shouldContinueRunning := daemonSetSchedules(ds, node)
+
+			assert.Equal(t, tt.shouldRun, shouldRun)
+			assert.Equal(t, tt.shouldContinueRunning, shouldContinueRunning)
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"slices"
+	"time"
 
 	"github.com/cosi-project/runtime/pkg/controller"
 	"github.com/cosi-project/runtime/pkg/safe"
@@ -19,7 +20,11 @@ import (
 	"github.com/siderolabs/talos/pkg/machinery/resources/v1alpha1"
 	"go.uber.org/zap"
 
+	"github.com/siderolabs/talemu/api/specs"
 	"github.com/siderolabs/talemu/internal/pkg/constants"
+	"github.com/siderolabs/talemu/internal/pkg/machine/etcdcluster"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
 	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
 )
@@ -27,9 +32,28 @@ import (
 // EtcdController generates node identity.
 type EtcdController struct {
 	GlobalState state.State
+	// Faults can force etcd to report unhealthy.
+	Faults *faults.Injector
+	// ServiceLogs get the etcd member changes.
+	ServiceLogs *logging.ServiceLogs
 	MachineID   string
+	// LearnerPromotionDelay is the time the learner takes to catch up with the leader, the default is used if zero.
+	LearnerPromotionDelay time.Duration
+
+	// promoteCh fires when the learner can be promoted.
+	promoteCh <-chan time.Time
+	// learnerSince is the time the member was first seen up as a learner.
+	learnerSince time.Time
+	// clusterID and memberID are set once the member joins the cluster.
+	clusterID string
+	memberID  string
+	// memberState is the last member state written to the etcd logs.
+	memberState string
 }
 
+// learnerPromotionDelay is the default time the learner takes to catch up with the leader.
+const learnerPromotionDelay = 10 * time.Second
+
 // Name implements controller.Controller interface.
 func (ctrl *EtcdController) Name() string {
 	return "runtime.EtcdController"
@@ -72,10 +96,25 @@ func (ctrl *EtcdController) Run(ctx context.Context, r controller.Runtime, logge
 		return err
 	}
 
+	faultsCh, stopFaultsWatch := ctrl.Faults.Watch()
+	defer stopFaultsWatch()
+
+	defer ctrl.memberDown(logger) //nolint:contextcheck
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-ctrl.promoteCh:
+			ctrl.promoteCh = nil
+
+			if err := ctrl.reconcile(ctx, r, logger); err != nil {
+				return err
+			}
+		case <-faultsCh:
+			if err := ctrl.reconcile(ctx, r, logger); err != nil {
+				return err
+			}
 		case <-r.EventCh():
 			// The machine's own config can arrive after the cluster has already bootstrapped (e.g. a control
 			// plane joining an existing cluster). Reconcile here so etcd still comes up in that ordering, not
@@ -165,30 +204,129 @@ func (ctrl *EtcdController) reconcileRunning(ctx context.Context, r controller.R
 
 		res.TypedSpec().MemberID = memberID
 
+		ctrl.ServiceLogs.Printf(constants.ETCDService, "added member %s to cluster %s", memberID, config.Provider().Cluster().ID())
+
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
-	// EtcdMemberList/EtcdStatus read the member from the shared global status and filter it by the cluster
-	// and control-plane labels. Those labels are otherwise written once by ApplyConfiguration, separately
-	// from the member, so a machine could end up with a member but no labels and drop out of the member
-	// list. Write both together here, every reconcile, so a control plane that has a member is always
-	// counted for its cluster.
-	if err = ctrl.syncGlobalMember(ctx, config.Provider().Cluster().ID(), member.TypedSpec().MemberID); err != nil {
+	// EtcdStatus and the admin API read the member from the shared global status and find its cluster by the
+	// cluster and control-plane labels. Those labels are otherwise written once by ApplyConfiguration, separately
+	// from the member, so a machine could end up with a member but no labels. Write both together here, every
+	// reconcile, so a control plane that has a member is always counted for its cluster.
+	machineStatus, err := ctrl.syncGlobalMember(ctx, config.Provider().Cluster().ID(), member.TypedSpec().MemberID)
+	if err != nil {
 		return err
 	}
 
-	if slices.Contains(clusterStatus.TypedSpec().Value.DenyEtcdMembers, member.TypedSpec().MemberID) {
+	memberID := member.TypedSpec().MemberID
+
+	if slices.Contains(clusterStatus.TypedSpec().Value.DenyEtcdMembers, memberID) {
+		ctrl.logMemberState("removed", "the member %s has been permanently removed from the cluster", memberID)
+
+		return nil
+	}
+
+	up := !ctrl.Faults.ServiceUnhealthy(constants.ETCDService)
+
+	ctrl.clusterID = config.Provider().Cluster().ID()
+	ctrl.memberID = memberID
+
+	cluster, err := etcdcluster.Update(ctx, ctrl.GlobalState, ctrl.clusterID, func(spec *specs.ClusterStatusSpec) error {
+		etcdcluster.Join(spec, memberID, ctrl.MachineID, machineStatus.TypedSpec().Value.Hostname)
+		etcdcluster.SetUp(spec, memberID, up)
+
+		if ctrl.promote(spec, memberID) {
+			etcdcluster.Promote(spec, memberID)
+		}
+
 		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	healthy = true
+	clusterMember := etcdcluster.Member(cluster, memberID)
+
+	switch {
+	case !up:
+		ctrl.logMemberState("unhealthy", "the member %s lost the connection to the cluster peers", memberID)
+	case !etcdcluster.HasQuorum(cluster):
+		ctrl.logMemberState("no-quorum", "the member %s has no leader, the cluster lost the quorum", memberID)
+	case clusterMember != nil && clusterMember.Learner:
+		ctrl.logMemberState("learner", "the member %s joined the cluster as a learner", memberID)
+
+		healthy = true
+	default:
+		ctrl.logMemberState("healthy", "serving client traffic as member %s", memberID)
+
+		healthy = true
+	}
 
 	return nil
 }
 
+// promote returns true if the learner has caught up with the leader and can be promoted.
+//
+// The learner catches up in the promotion delay after it is seen up for the first time, the controller wakes up
+// when the delay passes.
+func (ctrl *EtcdController) promote(spec *specs.ClusterStatusSpec, memberID string) bool {
+	member := etcdcluster.Member(spec, memberID)
+	if member == nil || !member.Learner || !member.Up {
+		ctrl.learnerSince = time.Time{}
+
+		return false
+	}
+
+	delay := ctrl.LearnerPromotionDelay
+	if delay == 0 {
+		delay = learnerPromotionDelay
+	}
+
+	if ctrl.learnerSince.IsZero() {
+		ctrl.learnerSince = time.Now()
+	}
+
+	if remaining := time.Until(ctrl.learnerSince.Add(delay)); remaining > 0 {
+		ctrl.promoteCh = time.After(remaining)
+
+		return false
+	}
+
+	return true
+}
+
+// memberDown marks the member down when the controller stops, e.g. when the machine reboots or powers off.
+func (ctrl *EtcdController) memberDown(logger *zap.Logger) {
+	if ctrl.memberID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := etcdcluster.Update(ctx, ctrl.GlobalState, ctrl.clusterID, func(spec *specs.ClusterStatusSpec) error {
+		etcdcluster.SetUp(spec, ctrl.memberID, false)
+
+		return nil
+	}); err != nil && !state.IsNotFoundError(err) && !state.IsPhaseConflictError(err) {
+		logger.Warn("failed to mark the etcd member down", zap.Error(err))
+	}
+}
+
+// logMemberState writes the line to the etcd logs when the member state changes.
+func (ctrl *EtcdController) logMemberState(memberState, format string, args ...any) {
+	if ctrl.memberState == memberState {
+		return
+	}
+
+	ctrl.memberState = memberState
+
+	ctrl.ServiceLogs.Printf(constants.ETCDService, format, args...)
+}
+
 func genMemberID() (string, error) {
 	buf := make([]byte, 8)
 	if _, err := rand.Read(buf); err != nil {
@@ -198,8 +336,8 @@ func genMemberID() (string, error) {
 	return etcd.FormatMemberID(binary.LittleEndian.Uint64(buf)), nil
 }
 
-func (ctrl *EtcdController) syncGlobalMember(ctx context.Context, clusterID, memberID string) error {
-	_, err := safe.StateUpdateWithConflicts(ctx, ctrl.GlobalState, emu.NewMachineStatus(emu.NamespaceName, ctrl.MachineID).Metadata(), func(res *emu.MachineStatus) error {
+func (ctrl *EtcdController) syncGlobalMember(ctx context.Context, clusterID, memberID string) (*emu.MachineStatus, error) {
+	return safe.StateUpdateWithConflicts(ctx, ctrl.GlobalState, emu.NewMachineStatus(emu.NamespaceName, ctrl.MachineID).Metadata(), func(res *emu.MachineStatus) error {
 		res.TypedSpec().Value.EtcdMemberId = memberID
 
 		res.Metadata().Labels().Set(emu.LabelCluster, clusterID)
@@ -207,6 +345,4 @@ func (ctrl *EtcdController) syncGlobalMember(ctx context.Context, clusterID, mem
 
 		return nil
 	})
-
-	return err
 }
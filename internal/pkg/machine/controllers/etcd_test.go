@@ -7,6 +7,7 @@ package controllers_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	cosiruntime "github.com/cosi-project/runtime/pkg/controller/runtime"
 	"github.com/cosi-project/runtime/pkg/resource/rtestutils"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/siderolabs/talemu/internal/pkg/constants"
 	"github.com/siderolabs/talemu/internal/pkg/machine/controllers"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
 )
 
@@ -45,7 +47,7 @@ func TestEtcdControllerReconcilesOnConfig(t *testing.T) {
 	ctx := t.Context()
 
 	globalState := state.WrapCore(namespaced.NewState(inmem.Build))
-	localState := startEtcdController(t, ctx, globalState, machineID)
+	localState := startEtcdController(t, ctx, globalState, machineID, nil)
 
 	// A control-plane config with no cluster status present yet. On the fixed controller the config event
 	// triggers a reconcile that publishes the etcd service (not yet healthy, still waiting for bootstrap). The
@@ -86,11 +88,11 @@ func TestEtcdControllerControlPlanesRegisterOnBootstrap(t *testing.T) {
 	localStates := map[string]state.State{}
 
 	for _, id := range early {
-		localStates[id] = startEtcdController(t, ctx, globalState, id)
+		localStates[id] = startEtcdController(t, ctx, globalState, id, nil)
 		require.NoError(t, localStates[id].Create(ctx, controlPlaneConfig(t, clusterID)))
 	}
 
-	localStates[late] = startEtcdController(t, ctx, globalState, late)
+	localStates[late] = startEtcdController(t, ctx, globalState, late, nil)
 
 	bootstrapCluster(t, ctx, globalState, clusterID)
 
@@ -104,8 +106,8 @@ func TestEtcdControllerControlPlanesRegisterOnBootstrap(t *testing.T) {
 		rtestutils.AssertResource(ctx, t, globalState, id, func(res *emu.MachineStatus, a *assert.Assertions) {
 			a.NotEmptyf(res.TypedSpec().Value.EtcdMemberId, "control plane %q must register an etcd member", id)
 
-			// EtcdMemberList filters the global status by these labels, so the member is only counted when
-			// they are written alongside it. Assert both are present on the same status as the member.
+			// EtcdStatus finds the cluster of the member by these labels, so they must be written alongside
+			// it. Assert both are present on the same status as the member.
 			cluster, hasCluster := res.Metadata().Labels().Get(emu.LabelCluster)
 			a.Truef(hasCluster && cluster == clusterID, "control plane %q must carry the cluster label with its member", id)
 
@@ -115,10 +117,69 @@ func TestEtcdControllerControlPlanesRegisterOnBootstrap(t *testing.T) {
 	}
 }
 
+// TestEtcdControllerClusterModel verifies the shared etcd cluster of the control planes: the members joining
+// after the first one are promoted from the learners, and the cluster loses the leader and etcd goes unhealthy
+// when the majority of the voters is down.
+func TestEtcdControllerClusterModel(t *testing.T) {
+	t.Parallel()
+
+	const clusterID = "test-cluster"
+
+	ctx := t.Context()
+
+	globalState := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	bootstrapCluster(t, ctx, globalState, clusterID)
+
+	localStates := map[string]state.State{}
+	injectors := map[string]*faults.Injector{}
+
+	for _, id := range []string{"1", "2", "3"} {
+		injectors[id] = faults.NewInjector()
+		localStates[id] = startEtcdController(t, ctx, globalState, id, injectors[id])
+
+		require.NoError(t, localStates[id].Create(ctx, controlPlaneConfig(t, clusterID)))
+	}
+
+	rtestutils.AssertResource(ctx, t, globalState, clusterID, func(res *emu.ClusterStatus, a *assert.Assertions) {
+		spec := res.TypedSpec().Value
+
+		a.Len(spec.EtcdMembers, 3)
+		a.NotEmpty(spec.EtcdLeader)
+
+		for _, member := range spec.EtcdMembers {
+			a.Falsef(member.Learner, "the learner %s must be promoted", member.Id)
+			a.True(member.Up)
+		}
+	})
+
+	require.NoError(t, injectors["1"].SetServiceUnhealthy(constants.ETCDService, true))
+	require.NoError(t, injectors["2"].SetServiceUnhealthy(constants.ETCDService, true))
+
+	rtestutils.AssertResource(ctx, t, globalState, clusterID, func(res *emu.ClusterStatus, a *assert.Assertions) {
+		a.Empty(res.TypedSpec().Value.EtcdLeader, "the cluster without the quorum must have no leader")
+	})
+
+	rtestutils.AssertResource(ctx, t, localStates["3"], etcdServiceID, func(res *v1alpha1.Service, a *assert.Assertions) {
+		a.False(res.TypedSpec().Healthy, "etcd must be unhealthy without the quorum")
+		a.True(res.TypedSpec().Running)
+	})
+
+	require.NoError(t, injectors["1"].SetServiceUnhealthy(constants.ETCDService, false))
+
+	rtestutils.AssertResource(ctx, t, globalState, clusterID, func(res *emu.ClusterStatus, a *assert.Assertions) {
+		a.NotEmpty(res.TypedSpec().Value.EtcdLeader, "the leader must be elected once the quorum is back")
+	})
+
+	rtestutils.AssertResource(ctx, t, localStates["3"], etcdServiceID, func(res *v1alpha1.Service, a *assert.Assertions) {
+		a.True(res.TypedSpec().Healthy)
+	})
+}
+
 // startEtcdController stands up an in-memory machine runtime with only the EtcdController registered, sharing
 // globalState with the other machines, and returns the machine's local state. It mirrors the provider seeding
 // the machine's global status before the runtime starts.
-func startEtcdController(t *testing.T, ctx context.Context, globalState state.State, machineID string) state.State {
+func startEtcdController(t *testing.T, ctx context.Context, globalState state.State, machineID string, injector *faults.Injector) state.State {
 	t.Helper()
 
 	localState := state.WrapCore(namespaced.NewState(inmem.Build))
@@ -129,8 +190,10 @@ func startEtcdController(t *testing.T, ctx context.Context, globalState state.St
 	require.NoError(t, err)
 
 	require.NoError(t, rt.RegisterController(&controllers.EtcdController{
-		GlobalState: globalState,
-		MachineID:   machineID,
+		GlobalState:           globalState,
+		MachineID:             machineID,
+		Faults:                injector,
+		LearnerPromotionDelay: 100 * time.Millisecond,
 	}))
 
 	// Wait for the runtime to fully stop before the test returns, otherwise its goroutine can log through the
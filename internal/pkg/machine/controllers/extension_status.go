@@ -19,6 +19,7 @@ import (
 	"go.uber.org/zap"
 
 	emuconst "github.com/siderolabs/talemu/internal/pkg/constants"
+	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/talos"
 	"github.com/siderolabs/talemu/internal/pkg/schematic"
 )
@@ -26,6 +27,8 @@ import (
 // ExtensionStatusController computes extensions list from the configuration.
 type ExtensionStatusController struct {
 	SchematicService *schematic.Service
+	// ServiceLogs get the extension service start lines.
+	ServiceLogs      *logging.ServiceLogs
 	ImageFactoryHost string
 }
 
@@ -127,6 +130,10 @@ func (ctrl *ExtensionStatusController) Run(ctx context.Context, r controller.Run
 			}); err != nil {
 				return err
 			}
+
+			if service := emuconst.ExtensionServicePrefix + nameWithoutPrefix; !ctrl.ServiceLogs.Has(service) {
+				ctrl.ServiceLogs.Printf(service, "starting extension service %s", nameWithoutPrefix)
+			}
 		}
 
 		list, err := safe.ReaderListAll[*runtime.ExtensionStatus](ctx, r)
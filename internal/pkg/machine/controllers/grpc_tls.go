@@ -9,7 +9,6 @@ import (
 	stdlibx509 "crypto/x509"
 	"fmt"
 	"net"
-	"net/netip"
 	"strings"
 	"time"
 
@@ -20,7 +19,6 @@ import (
 	"github.com/siderolabs/crypto/x509"
 	"github.com/siderolabs/gen/optional"
 	"github.com/siderolabs/talos/pkg/machinery/config/machine"
-	"github.com/siderolabs/talos/pkg/machinery/constants"
 	"github.com/siderolabs/talos/pkg/machinery/resources/config"
 	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
 	"github.com/siderolabs/talos/pkg/machinery/resources/network"
@@ -33,7 +31,10 @@ import (
 )
 
 // GRPCTLSController manages secrets.API based on configuration to provide apid certificate.
-type GRPCTLSController struct{}
+type GRPCTLSController struct {
+	NC              *emunet.Client
+	InterfacePrefix string
+}
 
 // Name implements controller.Controller interface.
 func (ctrl *GRPCTLSController) Name() string {
@@ -330,19 +331,14 @@ func (ctrl *GRPCTLSController) generateWorker(ctx context.Context, r controller.
 	}
 
 	address, found := links.Find(func(r *network.AddressStatus) bool {
-		return strings.HasPrefix(r.TypedSpec().LinkName, constants.SideroLinkName)
+		return strings.HasPrefix(r.TypedSpec().LinkName, ctrl.InterfacePrefix)
 	})
 	if !found {
 		return fmt.Errorf("failed to find sideroaddress address")
 	}
 
 	remoteGen, err := gen.NewRemoteGenerator(func(ctx context.Context, addr string) (net.Conn, error) {
-		var dialer net.Dialer
-
-		dialer.LocalAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(address.TypedSpec().Address.Addr(), 0))
-		dialer.Control = emunet.BindToInterface(address.TypedSpec().LinkName)
-
-		return dialer.DialContext(ctx, "tcp", addr)
+		return ctrl.NC.DialContext(ctx, address.TypedSpec().LinkName, address.TypedSpec().Address.Addr(), "tcp", addr)
 	}, rootSpec.Token, endpointsStr, rootSpec.AcceptedCAs)
 	if err != nil {
 		return fmt.Errorf("failed creating trustd client: %w", err)
@@ -0,0 +1,246 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/gen/optional"
+	"github.com/siderolabs/go-procfs/procfs"
+	"github.com/siderolabs/talos/pkg/machinery/constants"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+	"github.com/siderolabs/talos/pkg/machinery/resources/runtime"
+	"go.uber.org/zap"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
+	emunet "github.com/siderolabs/talemu/internal/pkg/machine/network"
+)
+
+// KmsgLogConfigController collects the kernel log destinations from the kernel args and the machine config.
+type KmsgLogConfigController struct {
+	BaseKernelArgs string
+}
+
+// Name implements controller.Controller interface.
+func (ctrl *KmsgLogConfigController) Name() string {
+	return "runtime.KmsgLogConfigController"
+}
+
+// Inputs implements controller.Controller interface.
+func (ctrl *KmsgLogConfigController) Inputs() []controller.Input {
+	return []controller.Input{
+		{
+			Namespace: config.NamespaceName,
+			Type:      config.MachineConfigType,
+			ID:        optional.Some(config.ActiveID),
+			Kind:      controller.InputWeak,
+		},
+	}
+}
+
+// Outputs implements controller.Controller interface.
+func (ctrl *KmsgLogConfigController) Outputs() []controller.Output {
+	return []controller.Output{
+		{
+			Type: runtime.KmsgLogConfigType,
+			Kind: controller.OutputExclusive,
+		},
+	}
+}
+
+// Run implements controller.Controller interface.
+func (ctrl *KmsgLogConfigController) Run(ctx context.Context, r controller.Runtime, _ *zap.Logger) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.EventCh():
+		}
+
+		var destinations []*url.URL
+
+		if s := procfs.NewCmdline(ctrl.BaseKernelArgs).Get(constants.KernelParamLoggingKernel).Get(0); s != nil {
+			endpoint, err := url.Parse(*s)
+			if err != nil {
+				return fmt.Errorf("error parsing %q kernel arg: %w", constants.KernelParamLoggingKernel, err)
+			}
+
+			destinations = append(destinations, endpoint)
+		}
+
+		// the partial config documents (e.g. KmsgLogConfig sent in the maintenance mode) are honored as well
+		cfg, err := safe.ReaderGetByID[*config.MachineConfig](ctx, r, config.ActiveID)
+		if err != nil && !state.IsNotFoundError(err) {
+			return fmt.Errorf("error getting machine config: %w", err)
+		}
+
+		if cfg != nil {
+			destinations = append(destinations, cfg.Config().Runtime().KmsgLogURLs()...)
+		}
+
+		if len(destinations) == 0 {
+			if err = r.Destroy(ctx, runtime.NewKmsgLogConfig().Metadata()); err != nil && !state.IsNotFoundError(err) {
+				return fmt.Errorf("error destroying kmsg log config: %w", err)
+			}
+
+			continue
+		}
+
+		if err = safe.WriterModify(ctx, r, runtime.NewKmsgLogConfig(), func(res *runtime.KmsgLogConfig) error {
+			res.TypedSpec().Destinations = destinations
+
+			return nil
+		}); err != nil {
+			return fmt.Errorf("error updating kmsg log config: %w", err)
+		}
+	}
+}
+
+// KmsgLogDeliveryController streams the kernel messages to the configured destinations.
+//
+// The messages are sent from the siderolink address, the same way the Talos logs are.
+type KmsgLogDeliveryController struct {
+	Kmsg            *logging.Kmsg
+	NC              *emunet.Client
+	InterfacePrefix string
+}
+
+// Name implements controller.Controller interface.
+func (ctrl *KmsgLogDeliveryController) Name() string {
+	return "runtime.KmsgLogDeliveryController"
+}
+
+// Inputs implements controller.Controller interface.
+func (ctrl *KmsgLogDeliveryController) Inputs() []controller.Input {
+	return []controller.Input{
+		{
+			Namespace: runtime.NamespaceName,
+			Type:      runtime.KmsgLogConfigType,
+			ID:        optional.Some(runtime.KmsgLogConfigID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: network.NamespaceName,
+			Type:      network.AddressStatusType,
+			Kind:      controller.InputWeak,
+		},
+	}
+}
+
+// Outputs implements controller.Controller interface.
+func (ctrl *KmsgLogDeliveryController) Outputs() []controller.Output {
+	return nil
+}
+
+// Run implements controller.Controller interface.
+func (ctrl *KmsgLogDeliveryController) Run(ctx context.Context, r controller.Runtime, logger *zap.Logger) error {
+	var (
+		destinations []string
+		senders      []*logging.LogSender
+		stop         func()
+	)
+
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.EventCh():
+		}
+
+		cfg, err := safe.ReaderGetByID[*runtime.KmsgLogConfig](ctx, r, runtime.KmsgLogConfigID)
+		if err != nil && !state.IsNotFoundError(err) {
+			return fmt.Errorf("error getting kmsg log config: %w", err)
+		}
+
+		var endpoints []*url.URL
+
+		if cfg != nil {
+			endpoints = cfg.TypedSpec().Destinations
+		}
+
+		updated := make([]string, 0, len(endpoints))
+
+		for _, endpoint := range endpoints {
+			updated = append(updated, endpoint.String())
+		}
+
+		if !slices.Equal(destinations, updated) {
+			if stop != nil {
+				stop()
+				stop = nil
+			}
+
+			destinations = updated
+			senders = make([]*logging.LogSender, 0, len(endpoints))
+
+			for _, endpoint := range endpoints {
+				senders = append(senders, logging.NewLogSender(endpoint, ctrl.NC))
+			}
+
+			if len(senders) > 0 {
+				logger.Info("starting kmsg delivery", zap.Strings("destinations", destinations))
+
+				stop = ctrl.deliver(ctx, logger, senders)
+			}
+		}
+
+		addresses, err := safe.ReaderListAll[*network.AddressStatus](ctx, r)
+		if err != nil {
+			return fmt.Errorf("error listing addresses: %w", err)
+		}
+
+		for address := range addresses.All() {
+			if !strings.HasPrefix(address.TypedSpec().LinkName, ctrl.InterfacePrefix) {
+				continue
+			}
+
+			for _, sender := range senders {
+				sender.Configure(address.TypedSpec().LinkName, address.TypedSpec().Address)
+			}
+		}
+	}
+}
+
+// deliver runs the delivery in the background, the returned function stops it and closes the senders.
+func (ctrl *KmsgLogDeliveryController) deliver(ctx context.Context, logger *zap.Logger, senders []*logging.LogSender) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := ctrl.Kmsg.Deliver(ctx, senders); err != nil {
+			logger.Warn("kmsg delivery failed", zap.Error(err))
+		}
+	}()
+
+	return func() {
+		cancel()
+
+		<-done
+
+		closeCtx, closeCancel := context.WithTimeout(context.Background(), time.Second)
+		defer closeCancel()
+
+		for _, sender := range senders {
+			sender.Close(closeCtx) //nolint:errcheck
+		}
+	}
+}
@@ -0,0 +1,514 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/gen/optional"
+	"github.com/siderolabs/omni/client/pkg/panichandler"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
+	"github.com/siderolabs/talos/pkg/machinery/resources/secrets"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/siderolabs/talemu/internal/pkg/constants"
+	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
+	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
+	"github.com/siderolabs/talemu/internal/pkg/machine/podcidr"
+)
+
+// podResyncPeriod is how often the pods of the node are reconciled without the pod changes,
+// so that the pods follow the node readiness.
+const podResyncPeriod = 30 * time.Second
+
+// KubeletPodController runs the pods bound to the machine node with the fake containers, as the kubelet does.
+//
+// The pods get the pod IPs from the node pod CIDRs, the terminating pods are removed once their grace period ends.
+// The pods are not started while the node is not ready. The static pod mirrors are handled by the StaticPodController.
+type KubeletPodController struct {
+	GlobalState state.State
+	ServiceLogs *logging.ServiceLogs
+
+	client kubernetesClient
+
+	MachineID string
+
+	// informer watches the pods bound to the node, it is started again when the node name or the client changes.
+	informer       cache.SharedIndexInformer
+	informerNode   string
+	informerClient *kubernetes.Clientset
+	stopInformer   context.CancelFunc
+	// podsCh is notified on the pod changes.
+	podsCh chan struct{}
+	// terminateCh fires when the grace period of the next terminating pod ends.
+	terminateCh <-chan time.Time
+}
+
+// Name implements controller.Controller interface.
+func (ctrl *KubeletPodController) Name() string {
+	return "k8s.KubeletPodController"
+}
+
+// Inputs implements controller.Controller interface.
+func (ctrl *KubeletPodController) Inputs() []controller.Input {
+	return []controller.Input{
+		{
+			Namespace: config.NamespaceName,
+			Type:      config.MachineConfigType,
+			ID:        optional.Some(config.ActiveID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: secrets.NamespaceName,
+			Type:      secrets.KubernetesType,
+			ID:        optional.Some(secrets.KubernetesID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: k8s.NamespaceName,
+			Type:      k8s.NodenameType,
+			ID:        optional.Some(k8s.NodenameID),
+			Kind:      controller.InputWeak,
+		},
+	}
+}
+
+// Outputs implements controller.Controller interface.
+func (ctrl *KubeletPodController) Outputs() []controller.Output {
+	return nil
+}
+
+// Run implements controller.Controller interface.
+func (ctrl *KubeletPodController) Run(ctx context.Context, r controller.Runtime, logger *zap.Logger) error {
+	ctrl.podsCh = make(chan struct{}, 1)
+
+	defer ctrl.stopWatch()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.EventCh():
+		case <-ctrl.podsCh:
+		case <-ctrl.terminateCh:
+			ctrl.terminateCh = nil
+		}
+
+		if err := ctrl.reconcile(ctx, r, logger); err != nil {
+			return err
+		}
+
+		r.ResetRestartBackoff()
+	}
+}
+
+func (ctrl *KubeletPodController) reconcile(ctx context.Context, r controller.Runtime, logger *zap.Logger) error {
+	cfg, err := machineconfig.GetComplete(ctx, r)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			ctrl.stopWatch()
+
+			return nil
+		}
+
+		return err
+	}
+
+	if cfg.Metadata().Phase() == resource.PhaseTearingDown {
+		ctrl.stopWatch()
+
+		return nil
+	}
+
+	nodename, err := safe.ReaderGetByID[*k8s.Nodename](ctx, r, k8s.NodenameID)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	client, err := ctrl.client.get(ctx, r, ctrl.GlobalState, cfg)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if err = ctrl.watch(ctx, client, nodename.TypedSpec().Nodename, logger); err != nil {
+		return err
+	}
+
+	// the informer notifies about the pods once it gets them
+	if !ctrl.informer.HasSynced() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	node, err := client.CoreV1().Nodes().Get(ctx, nodename.TypedSpec().Nodename, metav1.GetOptions{})
+	if err != nil {
+		// the pods are bound to the node once it is registered
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	return ctrl.syncPods(ctx, client, node, logger)
+}
+
+//nolint:gocognit,gocyclo,cyclop
+func (ctrl *KubeletPodController) syncPods(ctx context.Context, client *kubernetes.Clientset, node *v1.Node, logger *zap.Logger) error {
+	var (
+		pods      []*v1.Pod
+		nodeCIDRs []netip.Prefix
+		hostIPs   []string
+	)
+
+	used := map[netip.Addr]struct{}{}
+
+	for _, obj := range ctrl.informer.GetStore().List() {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			continue
+		}
+
+		if _, ok = pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+
+		pods = append(pods, pod)
+
+		if pod.Spec.HostNetwork {
+			continue
+		}
+
+		for _, podIP := range pod.Status.PodIPs {
+			if addr, err := netip.ParseAddr(podIP.IP); err == nil {
+				used[addr] = struct{}{}
+			}
+		}
+	}
+
+	for _, podCIDR := range node.Spec.PodCIDRs {
+		if prefix, err := netip.ParsePrefix(podCIDR); err == nil {
+			nodeCIDRs = append(nodeCIDRs, prefix)
+		}
+	}
+
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP || address.Type == v1.NodeExternalIP {
+			hostIPs = append(hostIPs, address.Address)
+		}
+	}
+
+	ready := nodeReady(node)
+	now := metav1.Now()
+
+	var nextTermination time.Time
+
+	for _, pod := range pods {
+		var (
+			status  *v1.PodStatus
+			message string
+		)
+
+		switch {
+		case !ready:
+			// the kubelet of the node which is not ready doesn't run the pods, and the node lifecycle controller
+			// marks its running pods not ready
+			if pod.Status.Phase != v1.PodRunning || !podReady(pod) {
+				continue
+			}
+
+			status = pod.Status.DeepCopy()
+
+			setPodCondition(status, v1.PodReady, v1.ConditionFalse, now)
+		case pod.DeletionTimestamp != nil:
+			// the fake containers take the whole grace period to stop
+			if now.Before(pod.DeletionTimestamp) {
+				if nextTermination.IsZero() || pod.DeletionTimestamp.Time.Before(nextTermination) {
+					nextTermination = pod.DeletionTimestamp.Time
+				}
+
+				continue
+			}
+
+			err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+				GracePeriodSeconds: new(int64),
+				Preconditions:      metav1.NewUIDPreconditions(string(pod.UID)),
+			})
+			if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+				return err
+			}
+
+			ctrl.ServiceLogs.Printf(constants.KubeletService, "\"Pod was deleted and then removed from the API server\" pod=%q", pod.Namespace+"/"+pod.Name)
+
+			continue
+		case pod.Status.Phase == v1.PodPending || pod.Status.Phase == "":
+			var podIPs []string
+
+			if pod.Spec.HostNetwork {
+				podIPs = hostIPs
+			} else {
+				for _, nodeCIDR := range nodeCIDRs {
+					addr, err := podcidr.NextAddress(nodeCIDR, func(addr netip.Addr) bool {
+						_, ok := used[addr]
+
+						return ok
+					})
+					if err != nil {
+						return err
+					}
+
+					used[addr] = struct{}{}
+
+					podIPs = append(podIPs, addr.String())
+				}
+			}
+
+			status = runningPodStatus(pod, podIPs, hostIPs, now)
+			message = "Started pod"
+		case pod.Status.Phase == v1.PodRunning && !podReady(pod):
+			// the node is ready again
+			podIPs := make([]string, 0, len(pod.Status.PodIPs))
+
+			for _, podIP := range pod.Status.PodIPs {
+				podIPs = append(podIPs, podIP.IP)
+			}
+
+			status = runningPodStatus(pod, podIPs, hostIPs, now)
+
+			if pod.Status.StartTime != nil {
+				status.StartTime = pod.Status.StartTime
+			}
+		default:
+			continue
+		}
+
+		pod = pod.DeepCopy()
+		pod.Status = *status
+
+		if _, err := client.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+			// the pod was changed or removed meanwhile, the informer brings the new version
+			if errors.IsNotFound(err) || errors.IsConflict(err) {
+				continue
+			}
+
+			return err
+		}
+
+		if message != "" {
+			logger.Info("started pod", zap.String("pod", pod.Namespace+"/"+pod.Name))
+
+			ctrl.ServiceLogs.Printf(constants.KubeletService, "%q pod=%q podIP=%q", message, pod.Namespace+"/"+pod.Name, pod.Status.PodIP)
+		}
+	}
+
+	if !nextTermination.IsZero() {
+		ctrl.terminateCh = time.After(time.Until(nextTermination))
+	}
+
+	return nil
+}
+
+// watch starts the informer of the pods bound to the node.
+func (ctrl *KubeletPodController) watch(ctx context.Context, client *kubernetes.Clientset, nodename string, logger *zap.Logger) error {
+	if ctrl.informer != nil && ctrl.informerNode == nodename && ctrl.informerClient == client {
+		return nil
+	}
+
+	ctrl.stopWatch()
+
+	informer := coreinformers.NewFilteredPodInformer(client, metav1.NamespaceAll, podResyncPeriod, cache.Indexers{}, func(opts *metav1.ListOptions) {
+		opts.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", nodename).String()
+	})
+
+	notify := func() {
+		select {
+		case ctrl.podsCh <- struct{}{}:
+		default:
+		}
+	}
+
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { notify() },
+		UpdateFunc: func(any, any) { notify() },
+		DeleteFunc: func(any) { notify() },
+	}); err != nil {
+		return err
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+
+	panichandler.Go(func() {
+		informer.RunWithContext(watchCtx)
+	}, logger)
+
+	ctrl.informer = informer
+	ctrl.informerNode = nodename
+	ctrl.informerClient = client
+	ctrl.stopInformer = cancel
+
+	return nil
+}
+
+func (ctrl *KubeletPodController) stopWatch() {
+	if ctrl.stopInformer != nil {
+		ctrl.stopInformer()
+	}
+
+	ctrl.informer = nil
+	ctrl.informerNode = ""
+	ctrl.informerClient = nil
+	ctrl.stopInformer = nil
+	ctrl.terminateCh = nil
+}
+
+// runningPodStatus renders the status of the pod with all containers running and ready.
+//
+// The init containers are completed, except for the sidecars which keep running.
+func runningPodStatus(pod *v1.Pod, podIPs, hostIPs []string, now metav1.Time) *v1.PodStatus {
+	status := &v1.PodStatus{
+		Phase:     v1.PodRunning,
+		StartTime: &now,
+		QOSClass:  pod.Status.QOSClass,
+	}
+
+	for _, condition := range []v1.PodConditionType{
+		v1.PodReadyToStartContainers,
+		v1.PodInitialized,
+		v1.PodReady,
+		v1.ContainersReady,
+		v1.PodScheduled,
+	} {
+		setPodCondition(status, condition, v1.ConditionTrue, now)
+	}
+
+	if len(hostIPs) > 0 {
+		status.HostIP = hostIPs[0]
+	}
+
+	for _, hostIP := range hostIPs {
+		status.HostIPs = append(status.HostIPs, v1.HostIP{IP: hostIP})
+	}
+
+	if len(podIPs) > 0 {
+		status.PodIP = podIPs[0]
+	}
+
+	for _, podIP := range podIPs {
+		status.PodIPs = append(status.PodIPs, v1.PodIP{IP: podIP})
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		containerStatus := runningContainerStatus(pod, container, now)
+
+		if container.RestartPolicy == nil || *container.RestartPolicy != v1.ContainerRestartPolicyAlways {
+			containerStatus.Started = new(false)
+			containerStatus.State = v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{
+					ExitCode:    0,
+					Reason:      "Completed",
+					StartedAt:   now,
+					FinishedAt:  now,
+					ContainerID: containerStatus.ContainerID,
+				},
+			}
+		}
+
+		status.InitContainerStatuses = append(status.InitContainerStatuses, containerStatus)
+	}
+
+	for _, container := range pod.Spec.Containers {
+		status.ContainerStatuses = append(status.ContainerStatuses, runningContainerStatus(pod, container, now))
+	}
+
+	return status
+}
+
+func runningContainerStatus(pod *v1.Pod, container v1.Container, now metav1.Time) v1.ContainerStatus {
+	id := sha256.Sum256([]byte(string(pod.UID) + "/" + container.Name))
+
+	return v1.ContainerStatus{
+		Name:        container.Name,
+		Image:       container.Image,
+		ImageID:     container.Image,
+		ContainerID: "containerd://" + hex.EncodeToString(id[:]),
+		Started:     new(true),
+		Ready:       true,
+		State: v1.ContainerState{
+			Running: &v1.ContainerStateRunning{
+				StartedAt: now,
+			},
+		},
+	}
+}
+
+// setPodCondition sets the status of the pod condition, the transition time is only changed with the status.
+func setPodCondition(status *v1.PodStatus, conditionType v1.PodConditionType, conditionStatus v1.ConditionStatus, now metav1.Time) {
+	for i := range status.Conditions {
+		condition := &status.Conditions[i]
+
+		if condition.Type != conditionType {
+			continue
+		}
+
+		if condition.Status != conditionStatus {
+			condition.Status = conditionStatus
+			condition.LastTransitionTime = now
+		}
+
+		return
+	}
+
+	status.Conditions = append(status.Conditions, v1.PodCondition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		LastTransitionTime: now,
+	})
+}
+
+func podReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func nodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
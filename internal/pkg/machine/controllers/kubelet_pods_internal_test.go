@@ -0,0 +1,71 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRunningPodStatus(t *testing.T) {
+	t.Parallel()
+
+	now := metav1.Now()
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+			UID:       "1234",
+		},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{
+				{Name: "migrate", Image: "migrate:v1"},
+				{Name: "proxy", Image: "proxy:v1", RestartPolicy: new(v1.ContainerRestartPolicyAlways)},
+			},
+			Containers: []v1.Container{
+				{Name: "web", Image: "nginx:1.27"},
+			},
+		},
+	}
+
+	status := runningPodStatus(pod, []string{"10.244.1.2", "fd00:10:244:1::2"}, []string{"172.20.0.2"}, now)
+
+	assert.Equal(t, v1.PodRunning, status.Phase)
+	assert.Equal(t, "10.244.1.2", status.PodIP)
+	assert.Equal(t, []v1.PodIP{{IP: "10.244.1.2"}, {IP: "fd00:10:244:1::2"}}, status.PodIPs)
+	assert.Equal(t, "172.20.0.2", status.HostIP)
+
+	pod.Status = *status
+
+	assert.True(t, podReady(pod))
+
+	require.Len(t, status.InitContainerStatuses, 2)
+	assert.NotNil(t, status.InitContainerStatuses[0].State.Terminated, "the init container is completed")
+	assert.NotNil(t, status.InitContainerStatuses[1].State.Running, "the sidecar keeps running")
+
+	require.Len(t, status.ContainerStatuses, 1)
+	assert.True(t, status.ContainerStatuses[0].Ready)
+	assert.Equal(t, "nginx:1.27", status.ContainerStatuses[0].Image)
+	assert.Contains(t, status.ContainerStatuses[0].ContainerID, "containerd://")
+
+	later := metav1.NewTime(now.Add(1))
+
+	setPodCondition(status, v1.PodReady, v1.ConditionTrue, later)
+	setPodCondition(status, v1.ContainersReady, v1.ConditionFalse, later)
+
+	for _, condition := range status.Conditions {
+		switch condition.Type { //nolint:exhaustive
+		case v1.PodReady:
+			assert.Equal(t, now, condition.LastTransitionTime, "the transition time is kept without the status change")
+		case v1.ContainersReady:
+			assert.Equal(t, later, condition.LastTransitionTime)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package controllers
 import (
 	"context"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cosi-project/runtime/pkg/controller"
@@ -14,7 +15,6 @@ import (
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/siderolabs/gen/optional"
 	"github.com/siderolabs/omni/client/pkg/panichandler"
-	"github.com/siderolabs/talos/pkg/machinery/constants"
 	"github.com/siderolabs/talos/pkg/machinery/resources/config"
 	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
 	"github.com/siderolabs/talos/pkg/machinery/resources/network"
@@ -24,13 +24,23 @@ import (
 	emuconst "github.com/siderolabs/talemu/internal/pkg/constants"
 	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
 	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
+	machinenetwork "github.com/siderolabs/talemu/internal/pkg/machine/network"
 )
 
 // KubernetesController interacts with SideroLink API and brings up the SideroLink Wireguard interface.
 type KubernetesController struct {
-	Kubernetes *kubefactory.Kubernetes
-	MachineID  string
-	address    string
+	Kubernetes      *kubefactory.Kubernetes
+	NC              *machinenetwork.Client
+	MachineID       string
+	CertsDir        string
+	InterfacePrefix string
+	// KubeControllers runs the embedded kube-controller-manager and kube-scheduler next to the api server.
+	KubeControllers bool
+	address         string
+	// version is the Kubernetes version reported by the running api server.
+	version string
+	// apiServerConfig is the configuration of the running api server.
+	apiServerConfig *kubefactory.APIServerConfig
 }
 
 // Name implements controller.Controller interface.
@@ -84,10 +94,13 @@ func (ctrl *KubernetesController) Run(ctx context.Context, r controller.Runtime,
 	serverCtx, cancelServerCtx := context.WithCancel(ctx)
 	defer cancelServerCtx()
 
-	var stopCh chan struct{}
+	var (
+		running sync.WaitGroup
+		serving bool
+	)
 
 	stopServer := func() {
-		if stopCh == nil {
+		if !serving {
 			return
 		}
 
@@ -95,12 +108,15 @@ func (ctrl *KubernetesController) Run(ctx context.Context, r controller.Runtime,
 
 		cancelServerCtx()
 
-		<-stopCh
-		stopCh = nil
+		running.Wait()
+
+		serving = false
 
 		logger.Info("kubernetes api server stopped")
 
 		ctrl.address = ""
+		ctrl.version = ""
+		ctrl.apiServerConfig = nil
 	}
 
 	for {
@@ -129,7 +145,7 @@ func (ctrl *KubernetesController) Run(ctx context.Context, r controller.Runtime,
 			)
 
 			siderolink, found := addresses.Find(func(address *network.AddressStatus) bool {
-				return strings.HasPrefix(address.TypedSpec().LinkName, constants.SideroLinkName)
+				return strings.HasPrefix(address.TypedSpec().LinkName, ctrl.InterfacePrefix)
 			})
 			if found {
 				address = siderolink.TypedSpec().Address.Addr().String()
@@ -172,7 +188,13 @@ func (ctrl *KubernetesController) Run(ctx context.Context, r controller.Runtime,
 
 				started = true
 
-				if ctrl.address == address {
+				// the api server is restarted on the upgrade, so that it reports the new version
+				version := getImageVersion(config.Provider().K8sAPIServerConfig().Image())
+
+				// and on the configuration change, the same way the static pod is restarted
+				apiServerConfig := kubefactory.NewAPIServerConfig(config.Provider())
+
+				if ctrl.address == address && ctrl.version == version && apiServerConfig.Equal(ctrl.apiServerConfig) {
 					return nil
 				}
 
@@ -180,11 +202,11 @@ func (ctrl *KubernetesController) Run(ctx context.Context, r controller.Runtime,
 
 				serverCtx, cancelServerCtx = context.WithCancel(ctx) //nolint:fatcontext
 
-				logger.Info("starting kubernetes api server", zap.String("address", address))
+				logger.Info("starting kubernetes api server", zap.String("address", address), zap.String("version", version))
 
-				stopCh = make(chan struct{}, 1)
+				serving = true
 
-				// Each RunAPIService call runs in its own inner goroutine to make
+				// Each component runs in its own inner goroutine to make
 				// the restart loop resilient to runtime.Goexit from klog.Fatal.
 				//
 				// The primary crash scenario is PostStartHook timeouts during machine
@@ -198,38 +220,55 @@ func (ctrl *KubernetesController) Run(ctx context.Context, r controller.Runtime,
 				// set and preventing the controller from ever restarting the apiserver.
 				// The inner goroutine + done channel ensures the outer loop survives
 				// and can retry.
-				panichandler.Go(func() {
-					defer func() {
-						select {
-						case stopCh <- struct{}{}:
-						default:
-						}
-					}()
+				runComponent := func(serverCtx context.Context, name string, run func(ctx context.Context) error) {
+					running.Add(1)
 
-					for {
-						done := make(chan struct{})
+					panichandler.Go(func() {
+						defer running.Done()
 
-						panichandler.Go(func() {
-							defer close(done)
+						for {
+							done := make(chan struct{})
 
-							if runErr := ctrl.Kubernetes.RunAPIService(serverCtx, address, iface, ctrl.MachineID, config.Provider().Cluster().ID()); runErr != nil {
-								logger.Error("kubernetes api server crashed", zap.Error(runErr))
-							}
-						}, logger)
+							panichandler.Go(func() {
+								defer close(done)
+
+								if runErr := run(serverCtx); runErr != nil {
+									logger.Error(name+" crashed", zap.Error(runErr))
+								}
+							}, logger)
 
-						<-done
+							<-done
 
-						select {
-						case <-serverCtx.Done():
-							return
-						case <-ctx.Done():
-							return
-						case <-time.After(time.Second):
+							select {
+							case <-serverCtx.Done():
+								return
+							case <-ctx.Done():
+								return
+							case <-time.After(time.Second):
+							}
 						}
-					}
-				}, logger)
+					}, logger)
+				}
+
+				clusterID := config.Provider().Cluster().ID()
+
+				runComponent(serverCtx, "kubernetes api server", func(ctx context.Context) error {
+					return ctrl.Kubernetes.RunAPIService(ctx, ctrl.NC, address, iface, ctrl.MachineID, ctrl.CertsDir, clusterID, version, apiServerConfig)
+				})
+
+				if ctrl.KubeControllers {
+					runComponent(serverCtx, "kube-controller-manager", func(ctx context.Context) error {
+						return ctrl.Kubernetes.RunControllerManager(ctx, ctrl.CertsDir, ctrl.MachineID)
+					})
+
+					runComponent(serverCtx, "kube-scheduler", func(ctx context.Context) error {
+						return ctrl.Kubernetes.RunScheduler(ctx, ctrl.CertsDir, ctrl.MachineID)
+					})
+				}
 
 				ctrl.address = address
+				ctrl.version = version
+				ctrl.apiServerConfig = apiServerConfig
 
 				return nil
 			}()
@@ -0,0 +1,106 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/secrets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	machinenetwork "github.com/siderolabs/talemu/internal/pkg/machine/network"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
+)
+
+// kubernetesClient keeps the client of the cluster the machine is in, the client is created again when the kubeconfig changes.
+type kubernetesClient struct {
+	client  *kubernetes.Clientset
+	dynamic *dynamic.DynamicClient
+	config  []byte
+}
+
+// get returns the client of the cluster.
+//
+// The control planes use their own admin kubeconfig, the workers use the one the emulator keeps for the cluster.
+func (c *kubernetesClient) get(ctx context.Context, r controller.Reader, globalState state.State, machineConfig *config.MachineConfig) (*kubernetes.Clientset, error) {
+	secrets, err := safe.ReaderGetByID[*secrets.Kubernetes](ctx, r, secrets.KubernetesID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	var config []byte
+
+	if secrets != nil {
+		config = []byte(secrets.TypedSpec().LocalhostAdminKubeconfig)
+	}
+
+	if config == nil {
+		var cluster *emu.ClusterStatus
+
+		cluster, err = safe.ReaderGetByID[*emu.ClusterStatus](ctx, globalState, machineConfig.Provider().Cluster().ID())
+		if err != nil {
+			return nil, err
+		}
+
+		config = cluster.TypedSpec().Value.Kubeconfig
+
+		if config == nil {
+			return nil, fmt.Errorf("the kubeconfig is not present in the cluster yet")
+		}
+	}
+
+	if bytes.Equal(c.config, config) && c.client != nil {
+		return c.client, nil
+	}
+
+	cfg, err := clientcmd.NewClientConfigFromBytes(config)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCfg, err := cfg.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// the apiserver might be running in the userspace network
+	clientCfg.Dial = machinenetwork.DialContext
+
+	client, err := kubernetes.NewForConfig(clientCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(clientCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c.client = client
+	c.dynamic = dynamicClient
+	c.config = config
+
+	return client, err
+}
+
+// getDynamic returns the dynamic client of the cluster together with the typed one.
+func (c *kubernetesClient) getDynamic(ctx context.Context, r controller.Reader, globalState state.State, machineConfig *config.MachineConfig) (
+	*kubernetes.Clientset, *dynamic.DynamicClient, error,
+) {
+	client, err := c.get(ctx, r, globalState, machineConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, c.dynamic, nil
+}
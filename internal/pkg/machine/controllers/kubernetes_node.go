@@ -5,11 +5,11 @@
 package controllers
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"maps"
 	"net/netip"
+	"slices"
 	"strings"
 	"time"
 
@@ -19,6 +19,8 @@ import (
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/siderolabs/gen/optional"
 	"github.com/siderolabs/gen/xslices"
+	talosconstants "github.com/siderolabs/talos/pkg/machinery/constants"
+	"github.com/siderolabs/talos/pkg/machinery/resources/block"
 	"github.com/siderolabs/talos/pkg/machinery/resources/config"
 	"github.com/siderolabs/talos/pkg/machinery/resources/hardware"
 	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
@@ -31,28 +33,37 @@ import (
 	kresource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/siderolabs/talemu/internal/pkg/constants"
+	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
 	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
-	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
+	"github.com/siderolabs/talemu/internal/pkg/machine/podcidr"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/talos"
 )
 
 const (
 	machineIDLabel    = "talemu.dev/machine"
 	inputVersionLabel = "talemu.dev/inputversion"
+	versionLabel      = "app.kubernetes.io/version"
 	osLinux           = "linux"
 )
 
 // KubernetesNodeController registers machine in the kubernetes state.
+//
+// When the kubelet image changes, the kubelet restarts and the node is not ready for the KubeletRestartDelay.
+// The node taints, annotations and allocatable resources follow the machine config the same way as on Talos.
 type KubernetesNodeController struct {
 	GlobalState state.State
+	ServiceLogs *logging.ServiceLogs
+
+	client kubernetesClient
 
-	client *kubernetes.Clientset
+	MachineID           string
+	KubeletRestartDelay time.Duration
 
-	MachineID string
-	config    []byte
+	kubeletImage           string
+	kubeletRestartDeadline time.Time
+	kubeletRestartCh       <-chan time.Time
 }
 
 // Name implements controller.Controller interface.
@@ -121,6 +132,12 @@ func (ctrl *KubernetesNodeController) Inputs() []controller.Input {
 			Type:      hardware.ProcessorType,
 			Kind:      controller.InputWeak,
 		},
+		{
+			Namespace: block.NamespaceName,
+			Type:      block.VolumeStatusType,
+			ID:        optional.Some(talosconstants.EphemeralPartitionLabel),
+			Kind:      controller.InputWeak,
+		},
 	}
 }
 
@@ -138,6 +155,8 @@ func (ctrl *KubernetesNodeController) Run(ctx context.Context, r controller.Runt
 		case <-ctx.Done():
 			return nil
 		case <-r.EventCh():
+		case <-ctrl.kubeletRestartCh:
+			ctrl.kubeletRestartCh = nil
 		}
 
 		config, err := machineconfig.GetComplete(ctx, r)
@@ -158,7 +177,7 @@ func (ctrl *KubernetesNodeController) Run(ctx context.Context, r controller.Runt
 			return err
 		}
 
-		client, err := ctrl.getClient(ctx, r, config)
+		client, err := ctrl.client.get(ctx, r, ctrl.GlobalState, config)
 		if err != nil {
 			if state.IsNotFoundError(err) {
 				continue
@@ -172,6 +191,12 @@ func (ctrl *KubernetesNodeController) Run(ctx context.Context, r controller.Runt
 			// Omni will clean it up if the deletion fails
 			if err = ctrl.removeNode(ctx, client, nodename); err != nil {
 				logger.Warn("failed to destroy the node", zap.Error(err))
+			} else {
+				ctrl.ServiceLogs.Printf(constants.KubeletService, "\"Node was deleted\" node=%q", nodename.TypedSpec().Nodename)
+			}
+
+			if err = podcidr.Free(ctx, ctrl.GlobalState, config.Provider().Cluster().ID(), ctrl.MachineID); err != nil && !state.IsNotFoundError(err) {
+				logger.Warn("failed to release the node pod CIDRs", zap.Error(err))
 			}
 
 			if err = r.RemoveFinalizer(ctx, config.Metadata(), ctrl.Name()); err != nil {
@@ -185,7 +210,35 @@ func (ctrl *KubernetesNodeController) Run(ctx context.Context, r controller.Runt
 			return err
 		}
 
-		podCIDRs := xslices.Map(config.Provider().K8sNetworkConfig().PodCIDRs(), netip.Prefix.String)
+		if image := config.Provider().Machine().Kubelet().Image(); image != ctrl.kubeletImage {
+			if ctrl.kubeletImage != "" {
+				delay := delayOrDefault(ctrl.KubeletRestartDelay, DefaultKubeletRestartDelay)
+
+				ctrl.kubeletRestartDeadline = time.Now().Add(delay)
+				ctrl.kubeletRestartCh = time.After(delay)
+
+				ctrl.ServiceLogs.Printf(constants.KubeletService, "\"Restarting the kubelet\" image=%q", image)
+			}
+
+			ctrl.kubeletImage = image
+		}
+
+		// the node pod CIDRs are allocated by the controller manager node IPAM on real clusters
+		cidrIndex, err := podcidr.Reserve(ctx, ctrl.GlobalState, config.Provider().Cluster().ID(), ctrl.MachineID)
+		if err != nil {
+			if state.IsNotFoundError(err) {
+				continue
+			}
+
+			return err
+		}
+
+		nodeCIDRs, err := podcidr.NodeCIDRs(config.Provider().K8sNetworkConfig().PodCIDRs(), cidrIndex)
+		if err != nil {
+			return err
+		}
+
+		podCIDRs := xslices.Map(nodeCIDRs, netip.Prefix.String)
 
 		spec := v1.NodeSpec{
 			PodCIDR:  podCIDRs[0],
@@ -202,11 +255,22 @@ func (ctrl *KubernetesNodeController) Run(ctx context.Context, r controller.Runt
 			return err
 		}
 
-		status, err := ctrl.computeNodeStatus(ctx, r, config, hostname, version)
+		controlPlane := config.Config().Machine().Type().IsControlPlane()
+
+		kubeletCfg, err := parseKubeletConfig(config.Config().Machine().Kubelet().ExtraConfig(), controlPlane)
+		if err != nil {
+			logger.Warn("ignoring the kubelet extra config", zap.Error(err))
+
+			kubeletCfg, _ = parseKubeletConfig(nil, controlPlane) //nolint:errcheck
+		}
+
+		status, err := ctrl.computeNodeStatus(ctx, r, config, hostname, version, kubeletCfg)
 		if err != nil {
 			return err
 		}
 
+		taints := nodeTaints(config.Config().Machine().NodeTaints(), controlPlane && !config.Config().Cluster().ScheduleOnControlPlanes())
+
 		inputVersion := nodename.Metadata().Version().String()
 
 		labels := ctrl.computeNodeLabels(config, hostname, version)
@@ -229,20 +293,31 @@ func (ctrl *KubernetesNodeController) Run(ctx context.Context, r controller.Runt
 				Status: *status,
 			}
 
+			// the kubelet sets the registration taints only once, they aren't owned by the config
+			node.Spec.Taints = slices.Clone(kubeletCfg.RegisterWithTaints)
+
+			applyNodeAnnotations(node, config.Config().Machine().NodeAnnotations())
+			applyNodeTaints(node, taints)
+
 			if _, err = client.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{}); err != nil {
 				return err
 			}
 
 			logger.Info("created node", zap.String("node", nodename.TypedSpec().Nodename))
+
+			ctrl.ServiceLogs.Printf(constants.KubeletService, "\"Successfully registered node\" node=%q", nodename.TypedSpec().Nodename)
 		} else {
 			node.Status = *status
 
-			if _, err = client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{}); err != nil {
+			if node, err = client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{}); err != nil {
 				return err
 			}
 
 			node.Labels = labels
 
+			applyNodeAnnotations(node, config.Config().Machine().NodeAnnotations())
+			applyNodeTaints(node, taints)
+
 			if _, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
 				return err
 			}
@@ -269,19 +344,14 @@ func (ctrl *KubernetesNodeController) Run(ctx context.Context, r controller.Runt
 }
 
 func (ctrl *KubernetesNodeController) computeNodeStatus(ctx context.Context, r controller.Runtime, config *config.MachineConfig,
-	hostname *network.HostnameStatus, version *talos.Version,
+	hostname *network.HostnameStatus, version *talos.Version, kubeletCfg kubeletConfig,
 ) (*v1.NodeStatus, error) {
 	var (
 		nodeInfo  v1.NodeSystemInfo
 		addresses []v1.NodeAddress //nolint:prealloc
 	)
 
-	conditions := []v1.NodeCondition{{
-		Type:    v1.NodeReady,
-		Reason:  "KubeletReady",
-		Status:  v1.ConditionTrue,
-		Message: "kubelet is posting ready status",
-	}}
+	conditions := []v1.NodeCondition{nodeReadyCondition(!time.Now().Before(ctrl.kubeletRestartDeadline))}
 
 	systemInformation, err := safe.ReaderGetByID[*hardware.SystemInformation](ctx, r, hardware.SystemInformationID)
 	if err != nil && !state.IsNotFoundError(err) {
@@ -293,7 +363,7 @@ func (ctrl *KubernetesNodeController) computeNodeStatus(ctx context.Context, r c
 	}
 
 	nodeInfo.ContainerRuntimeVersion = "containerd://1.7.13"
-	nodeInfo.KernelVersion = "6.1.82-talos"
+	nodeInfo.KernelVersion = constants.KernelVersion
 	nodeInfo.OperatingSystem = osLinux
 
 	if version != nil {
@@ -361,15 +431,48 @@ func (ctrl *KubernetesNodeController) computeNodeStatus(ctx context.Context, r c
 		return nil, err
 	}
 
+	// the kubelet reports the size of the filesystem mounted at /var
+	ephemeralCapacity := int64(defaultEphemeralStorage)
+
+	ephemeral, err := safe.ReaderGetByID[*block.VolumeStatus](ctx, r, talosconstants.EphemeralPartitionLabel)
+	if err != nil && !state.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	if ephemeral != nil && ephemeral.TypedSpec().Size > 0 {
+		ephemeralCapacity = int64(ephemeral.TypedSpec().Size) //nolint:gosec
+	}
+
 	status.Capacity = v1.ResourceList{}
 	status.Capacity[v1.ResourceMemory] = *kresource.NewQuantity(memCapacity, kresource.DecimalSI)
 	status.Capacity[v1.ResourceCPU] = *kresource.NewQuantity(cpuCapacity, kresource.DecimalSI)
-	status.Capacity[v1.ResourceEphemeralStorage] = *kresource.NewQuantity(5e9, kresource.DecimalSI)
-	status.Capacity[v1.ResourcePods] = *kresource.NewQuantity(110, kresource.DecimalSI)
+	status.Capacity[v1.ResourceEphemeralStorage] = *kresource.NewQuantity(ephemeralCapacity, kresource.DecimalSI)
+	status.Capacity[v1.ResourcePods] = *kresource.NewQuantity(kubeletCfg.MaxPods, kresource.DecimalSI)
+
+	status.Allocatable = nodeAllocatable(status.Capacity, kubeletCfg)
 
 	return status, nil
 }
 
+// nodeReadyCondition returns the node ready condition, the node is not ready while the kubelet restarts.
+func nodeReadyCondition(ready bool) v1.NodeCondition {
+	if !ready {
+		return v1.NodeCondition{
+			Type:    v1.NodeReady,
+			Reason:  "KubeletNotReady",
+			Status:  v1.ConditionFalse,
+			Message: "container runtime status check may not have completed yet",
+		}
+	}
+
+	return v1.NodeCondition{
+		Type:    v1.NodeReady,
+		Reason:  "KubeletReady",
+		Status:  v1.ConditionTrue,
+		Message: "kubelet is posting ready status",
+	}
+}
+
 func (ctrl *KubernetesNodeController) computeNodeLabels(config *config.MachineConfig, hostname *network.HostnameStatus, version *talos.Version) map[string]string {
 	labels := map[string]string{}
 
@@ -418,58 +521,6 @@ func (ctrl *KubernetesNodeController) removeNode(ctx context.Context, client *ku
 	return nil
 }
 
-func (ctrl *KubernetesNodeController) getClient(ctx context.Context, r controller.Runtime, machineConfig *config.MachineConfig) (*kubernetes.Clientset, error) {
-	secrets, err := safe.ReaderGetByID[*secrets.Kubernetes](ctx, r, secrets.KubernetesID)
-	if err != nil && !state.IsNotFoundError(err) {
-		return nil, err
-	}
-
-	var config []byte
-
-	if secrets != nil {
-		config = []byte(secrets.TypedSpec().LocalhostAdminKubeconfig)
-	}
-
-	if config == nil {
-		var cluster *emu.ClusterStatus
-
-		cluster, err = safe.ReaderGetByID[*emu.ClusterStatus](ctx, ctrl.GlobalState, machineConfig.Provider().Cluster().ID())
-		if err != nil {
-			return nil, err
-		}
-
-		config = cluster.TypedSpec().Value.Kubeconfig
-
-		if config == nil {
-			return nil, fmt.Errorf("the kubeconfig is not present in the cluster yet")
-		}
-	}
-
-	if bytes.Equal(ctrl.config, config) && ctrl.client != nil {
-		return ctrl.client, nil
-	}
-
-	cfg, err := clientcmd.NewClientConfigFromBytes(config)
-	if err != nil {
-		return nil, err
-	}
-
-	clientCfg, err := cfg.ClientConfig()
-	if err != nil {
-		return nil, err
-	}
-
-	client, err := kubernetes.NewForConfig(clientCfg)
-	if err != nil {
-		return nil, err
-	}
-
-	ctrl.client = client
-	ctrl.config = config
-
-	return client, err
-}
-
 func getImageVersion(image string) string {
 	_, version, _ := strings.Cut(image, ":")
 
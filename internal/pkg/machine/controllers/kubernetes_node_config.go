@@ -0,0 +1,273 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	talosconstants "github.com/siderolabs/talos/pkg/machinery/constants"
+	v1 "k8s.io/api/core/v1"
+	kresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	defaultMaxPods = 110
+
+	// defaultEphemeralStorage is the node ephemeral storage if the machine has no EPHEMERAL volume.
+	defaultEphemeralStorage = 5e9
+)
+
+// defaultEvictionHard are the kubelet hard eviction thresholds, Talos doesn't override them.
+var defaultEvictionHard = map[string]string{
+	"memory.available":  "100Mi",
+	"nodefs.available":  "10%",
+	"nodefs.inodesFree": "5%",
+	"imagefs.available": "15%",
+}
+
+// kubeletConfig is the part of the kubelet configuration which changes the node registration and the node allocatable.
+type kubeletConfig struct {
+	SystemReserved     map[string]string `json:"systemReserved"`
+	KubeReserved       map[string]string `json:"kubeReserved"`
+	EvictionHard       map[string]string `json:"evictionHard"`
+	RegisterWithTaints []v1.Taint        `json:"registerWithTaints"`
+	MaxPods            int64             `json:"maxPods"`
+}
+
+// parseKubeletConfig applies the kubelet extraConfig on top of the configuration Talos generates.
+func parseKubeletConfig(extraConfig map[string]any, controlPlane bool) (kubeletConfig, error) {
+	systemReservedMemory := talosconstants.KubeletSystemReservedMemoryWorker
+	if controlPlane {
+		systemReservedMemory = talosconstants.KubeletSystemReservedMemoryControlPlane
+	}
+
+	cfg := kubeletConfig{
+		SystemReserved: map[string]string{
+			string(v1.ResourceCPU):              talosconstants.KubeletSystemReservedCPU,
+			string(v1.ResourceMemory):           systemReservedMemory,
+			string(v1.ResourceEphemeralStorage): talosconstants.KubeletSystemReservedEphemeralStorage,
+			"pid":                               talosconstants.KubeletSystemReservedPid,
+		},
+		MaxPods: defaultMaxPods,
+	}
+
+	if len(extraConfig) > 0 {
+		data, err := json.Marshal(extraConfig)
+		if err != nil {
+			return kubeletConfig{}, err
+		}
+
+		var extra kubeletConfig
+
+		if err = json.Unmarshal(data, &extra); err != nil {
+			return kubeletConfig{}, fmt.Errorf("error parsing the kubelet extra config: %w", err)
+		}
+
+		// the reservations are merged by the resource name, the same way Talos merges the extra config
+		maps.Copy(cfg.SystemReserved, extra.SystemReserved)
+
+		cfg.KubeReserved = extra.KubeReserved
+		cfg.EvictionHard = extra.EvictionHard
+		cfg.RegisterWithTaints = extra.RegisterWithTaints
+
+		if extra.MaxPods > 0 {
+			cfg.MaxPods = extra.MaxPods
+		}
+	}
+
+	if cfg.EvictionHard == nil {
+		cfg.EvictionHard = defaultEvictionHard
+	}
+
+	for _, reserved := range []map[string]string{cfg.SystemReserved, cfg.KubeReserved} {
+		for name, value := range reserved {
+			if _, err := kresource.ParseQuantity(value); err != nil {
+				return kubeletConfig{}, fmt.Errorf("error parsing the reserved %s %q: %w", name, value, err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// nodeAllocatable returns the resources of the node available for the pods.
+//
+// The same as the kubelet, the allocatable is the capacity minus the system and kube reservations and the hard eviction threshold.
+func nodeAllocatable(capacity v1.ResourceList, cfg kubeletConfig) v1.ResourceList {
+	allocatable := capacity.DeepCopy()
+
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage} {
+		value, ok := allocatable[name]
+		if !ok {
+			continue
+		}
+
+		for _, reserved := range []map[string]string{cfg.SystemReserved, cfg.KubeReserved} {
+			if quantity, err := kresource.ParseQuantity(reserved[string(name)]); err == nil {
+				value.Sub(quantity)
+			}
+		}
+
+		value.Sub(evictionThreshold(name, capacity[name], cfg.EvictionHard))
+
+		if value.Sign() < 0 {
+			value = *kresource.NewQuantity(0, value.Format)
+		}
+
+		allocatable[name] = value
+	}
+
+	return allocatable
+}
+
+// evictionThreshold returns the hard eviction threshold of the resource, either absolute or the percentage of the capacity.
+func evictionThreshold(name v1.ResourceName, capacity kresource.Quantity, evictionHard map[string]string) kresource.Quantity {
+	var signal string
+
+	switch name { //nolint:exhaustive
+	case v1.ResourceMemory:
+		signal = "memory.available"
+	case v1.ResourceEphemeralStorage:
+		signal = "nodefs.available"
+	default:
+		return kresource.Quantity{}
+	}
+
+	threshold, ok := evictionHard[signal]
+	if !ok {
+		return kresource.Quantity{}
+	}
+
+	if percentage, found := strings.CutSuffix(threshold, "%"); found {
+		value, err := strconv.ParseFloat(percentage, 64)
+		if err != nil {
+			return kresource.Quantity{}
+		}
+
+		return *kresource.NewQuantity(int64(float64(capacity.Value())*value/100), capacity.Format)
+	}
+
+	quantity, err := kresource.ParseQuantity(threshold)
+	if err != nil {
+		return kresource.Quantity{}
+	}
+
+	return quantity
+}
+
+// nodeTaints returns the node taints from the machine config.
+//
+// The values are either the effect or the value and the effect separated by a colon.
+// The control planes are tainted unless the workloads are allowed on the control planes.
+func nodeTaints(configTaints map[string]string, taintControlPlane bool) []v1.Taint {
+	taints := make([]v1.Taint, 0, len(configTaints)+1)
+
+	for _, key := range slices.Sorted(maps.Keys(configTaints)) {
+		value, effect, found := strings.Cut(configTaints[key], ":")
+		if !found {
+			value, effect = "", value
+		}
+
+		taints = append(taints, v1.Taint{
+			Key:    key,
+			Value:  value,
+			Effect: v1.TaintEffect(effect),
+		})
+	}
+
+	if taintControlPlane {
+		taints = append(taints, v1.Taint{
+			Key:    talosconstants.LabelNodeRoleControlPlane,
+			Effect: v1.TaintEffectNoSchedule,
+		})
+	}
+
+	return taints
+}
+
+// applyNodeAnnotations sets the annotations from the machine config.
+//
+// The annotations removed from the config are removed from the node only if they were set from the config,
+// the same way Talos tracks them in the owned annotations annotation.
+func applyNodeAnnotations(node *v1.Node, annotations map[string]string) {
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+
+	for _, key := range ownedKeys(node.Annotations[talosconstants.AnnotationOwnedAnnotations]) {
+		if _, ok := annotations[key]; !ok {
+			delete(node.Annotations, key)
+		}
+	}
+
+	maps.Copy(node.Annotations, annotations)
+
+	setOwnedKeys(node, talosconstants.AnnotationOwnedAnnotations, slices.Collect(maps.Keys(annotations)))
+}
+
+// applyNodeTaints sets the taints from the machine config.
+//
+// The taints set by others, e.g. the node lifecycle controller, are kept.
+func applyNodeTaints(node *v1.Node, taints []v1.Taint) {
+	configured := func(key string) bool {
+		return slices.ContainsFunc(taints, func(taint v1.Taint) bool { return taint.Key == key })
+	}
+
+	owned := ownedKeys(node.Annotations[talosconstants.AnnotationOwnedTaints])
+
+	node.Spec.Taints = slices.DeleteFunc(node.Spec.Taints, func(taint v1.Taint) bool {
+		return configured(taint.Key) || slices.Contains(owned, taint.Key)
+	})
+
+	node.Spec.Taints = append(node.Spec.Taints, taints...)
+
+	if len(node.Spec.Taints) == 0 {
+		node.Spec.Taints = nil
+	}
+
+	keys := make([]string, 0, len(taints))
+
+	for _, taint := range taints {
+		keys = append(keys, taint.Key)
+	}
+
+	setOwnedKeys(node, talosconstants.AnnotationOwnedTaints, keys)
+}
+
+func ownedKeys(annotation string) []string {
+	var keys []string
+
+	if annotation == "" || json.Unmarshal([]byte(annotation), &keys) != nil {
+		return nil
+	}
+
+	return keys
+}
+
+func setOwnedKeys(node *v1.Node, annotation string, keys []string) {
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+
+	if len(keys) == 0 {
+		delete(node.Annotations, annotation)
+
+		return
+	}
+
+	slices.Sort(keys)
+
+	data, err := json.Marshal(slices.Compact(keys))
+	if err != nil {
+		return
+	}
+
+	node.Annotations[annotation] = string(data)
+}
@@ -0,0 +1,152 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"testing"
+
+	talosconstants "github.com/siderolabs/talos/pkg/machinery/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	kresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseKubeletConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := parseKubeletConfig(nil, true)
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 110, cfg.MaxPods)
+	assert.Equal(t, "512Mi", cfg.SystemReserved["memory"])
+	assert.Equal(t, defaultEvictionHard, cfg.EvictionHard)
+
+	cfg, err = parseKubeletConfig(map[string]any{
+		"maxPods": 250,
+		"systemReserved": map[string]any{
+			"memory": "1Gi",
+		},
+		"kubeReserved": map[string]any{
+			"cpu": "500m",
+		},
+		"registerWithTaints": []any{
+			map[string]any{
+				"key":    "example.com/uninitialized",
+				"effect": "NoSchedule",
+			},
+		},
+	}, false)
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 250, cfg.MaxPods)
+	assert.Equal(t, "1Gi", cfg.SystemReserved["memory"])
+	assert.Equal(t, "50m", cfg.SystemReserved["cpu"])
+	assert.Equal(t, "500m", cfg.KubeReserved["cpu"])
+	assert.Equal(t, []v1.Taint{{Key: "example.com/uninitialized", Effect: v1.TaintEffectNoSchedule}}, cfg.RegisterWithTaints)
+
+	_, err = parseKubeletConfig(map[string]any{
+		"kubeReserved": map[string]any{
+			"memory": "lots",
+		},
+	}, false)
+	require.Error(t, err)
+}
+
+func TestNodeAllocatable(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := parseKubeletConfig(map[string]any{
+		"kubeReserved": map[string]any{
+			"cpu":    "950m",
+			"memory": "512Mi",
+		},
+	}, false)
+	require.NoError(t, err)
+
+	allocatable := nodeAllocatable(v1.ResourceList{
+		v1.ResourceCPU:              kresource.MustParse("4"),
+		v1.ResourceMemory:           kresource.MustParse("8Gi"),
+		v1.ResourceEphemeralStorage: kresource.MustParse("100Gi"),
+		v1.ResourcePods:             kresource.MustParse("110"),
+	}, cfg)
+
+	// 4 - 50m - 950m
+	assert.EqualValues(t, 3000, allocatable.Cpu().MilliValue())
+	// 8Gi - 384Mi - 512Mi - 100Mi
+	assert.EqualValues(t, (8192-384-512-100)*1024*1024, allocatable.Memory().Value())
+	// 100Gi - 256Mi - 10%
+	assert.EqualValues(t, 100*1024*1024*1024-256*1024*1024-10*1024*1024*1024, allocatable.StorageEphemeral().Value())
+	assert.EqualValues(t, 110, allocatable.Pods().Value())
+
+	allocatable = nodeAllocatable(v1.ResourceList{
+		v1.ResourceMemory: kresource.MustParse("256Mi"),
+	}, cfg)
+
+	assert.True(t, allocatable.Memory().IsZero())
+}
+
+func TestNodeTaints(t *testing.T) {
+	t.Parallel()
+
+	taints := nodeTaints(map[string]string{
+		"example.com/dedicated": "gpu:NoSchedule",
+		"example.com/noexec":    "NoExecute",
+	}, true)
+
+	assert.Equal(t, []v1.Taint{
+		{Key: "example.com/dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+		{Key: "example.com/noexec", Effect: v1.TaintEffectNoExecute},
+		{Key: talosconstants.LabelNodeRoleControlPlane, Effect: v1.TaintEffectNoSchedule},
+	}, taints)
+
+	assert.Empty(t, nodeTaints(nil, false))
+}
+
+func TestApplyNodeTaintsAndAnnotations(t *testing.T) {
+	t.Parallel()
+
+	unreachable := v1.Taint{Key: v1.TaintNodeUnreachable, Effect: v1.TaintEffectNoExecute}
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				"node.alpha.kubernetes.io/ttl": "0",
+			},
+		},
+		Spec: v1.NodeSpec{
+			Taints: []v1.Taint{unreachable},
+		},
+	}
+
+	applyNodeAnnotations(node, map[string]string{"example.com/rack": "r1", "example.com/zone": "z1"})
+	applyNodeTaints(node, nodeTaints(map[string]string{"example.com/dedicated": "gpu:NoSchedule"}, false))
+
+	assert.Equal(t, map[string]string{
+		"node.alpha.kubernetes.io/ttl":            "0",
+		"example.com/rack":                        "r1",
+		"example.com/zone":                        "z1",
+		talosconstants.AnnotationOwnedAnnotations: `["example.com/rack","example.com/zone"]`,
+		talosconstants.AnnotationOwnedTaints:      `["example.com/dedicated"]`,
+	}, node.Annotations)
+
+	assert.Equal(t, []v1.Taint{
+		unreachable,
+		{Key: "example.com/dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+	}, node.Spec.Taints)
+
+	// the keys removed from the config are removed from the node, the rest is kept
+	applyNodeAnnotations(node, map[string]string{"example.com/rack": "r2"})
+	applyNodeTaints(node, nil)
+
+	assert.Equal(t, map[string]string{
+		"node.alpha.kubernetes.io/ttl":            "0",
+		"example.com/rack":                        "r2",
+		talosconstants.AnnotationOwnedAnnotations: `["example.com/rack"]`,
+	}, node.Annotations)
+
+	assert.Equal(t, []v1.Taint{unreachable}, node.Spec.Taints)
+}
@@ -0,0 +1,36 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import "time"
+
+const (
+	// DefaultStaticPodRestartDelay is the default time the restarted control plane static pod stays not ready.
+	DefaultStaticPodRestartDelay = 5 * time.Second
+	// DefaultKubeletRestartDelay is the default time the node stays not ready while the kubelet restarts.
+	DefaultKubeletRestartDelay = 10 * time.Second
+	// DefaultDaemonSetRolloutDelay is the default time it takes to replace the DaemonSet pod of a node.
+	DefaultDaemonSetRolloutDelay = 3 * time.Second
+)
+
+// UpgradeTimings are the timings of the emulated Kubernetes upgrade steps.
+//
+// The images of the Kubernetes components are changed by the machine config, and the components restart as they do on Talos:
+// the control plane static pods one at a time, then the kubelet, and the DaemonSet pods one node at a time.
+// The defaults are used for the zero timings.
+type UpgradeTimings struct {
+	StaticPodRestart time.Duration
+	KubeletRestart   time.Duration
+	DaemonSetRollout time.Duration
+}
+
+// delayOrDefault returns the delay, or the default one if the delay is not set.
+func delayOrDefault(delay, defaultDelay time.Duration) time.Duration {
+	if delay == 0 {
+		return defaultDelay
+	}
+
+	return delay
+}
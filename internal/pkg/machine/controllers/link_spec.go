@@ -27,6 +27,7 @@ import (
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
 	machinenetwork "github.com/siderolabs/talemu/internal/pkg/machine/network"
+	"github.com/siderolabs/talemu/internal/pkg/machine/network/userspace"
 )
 
 // LinkSpecController applies network.LinkSpec to the actual interfaces.
@@ -87,6 +88,16 @@ func (ctrl *LinkSpecController) Run(ctx context.Context, r controller.Runtime, l
 			}
 		}
 
+		if stack := ctrl.NC.Userspace(); stack != nil {
+			if err = ctrl.syncUserspaceLinks(ctx, r, logger, stack, list.Items); err != nil {
+				return err
+			}
+
+			r.ResetRestartBackoff()
+
+			continue
+		}
+
 		// list rtnetlink links (interfaces)
 		links, err := ctrl.NC.Conn().Link.List()
 		if err != nil {
@@ -344,6 +355,60 @@ func (ctrl *LinkSpecController) syncLink(ctx context.Context, r controller.Runti
 	return nil
 }
 
+// syncUserspaceLinks syncs the userspace network with the LinkSpec links.
+//
+// Only the WireGuard links are created there, physical links don't exist in the userspace network.
+func (ctrl *LinkSpecController) syncUserspaceLinks(ctx context.Context, r controller.Runtime, logger *zap.Logger, stack *userspace.Stack, items []resource.Resource) error {
+	var multiErr *multierror.Error
+
+	for _, res := range items {
+		link := res.(*network.LinkSpec) //nolint:forcetypeassert,errcheck
+
+		linkLogger := logger.With(zap.String("link", link.TypedSpec().Name))
+
+		switch link.Metadata().Phase() {
+		case resource.PhaseTearingDown:
+			if link.TypedSpec().Logical {
+				stack.RemoveLink(link.TypedSpec().Name)
+
+				linkLogger.Info("deleted link")
+			}
+
+			if err := r.RemoveFinalizer(ctx, link.Metadata(), ctrl.Name()); err != nil {
+				return fmt.Errorf("error removing finalizer: %w", err)
+			}
+		case resource.PhaseRunning:
+			if !link.TypedSpec().Logical || link.TypedSpec().Kind != network.LinkKindWireguard {
+				continue
+			}
+
+			changed, err := stack.SetLink(link.TypedSpec().Name, link.TypedSpec().Wireguard, link.TypedSpec().MTU, link.TypedSpec().Up)
+			if err != nil {
+				multiErr = multierror.Append(multiErr, fmt.Errorf("error configuring userspace link %q: %w", link.TypedSpec().Name, err))
+
+				continue
+			}
+
+			if !changed {
+				continue
+			}
+
+			linkLogger.Info("reconfigured userspace wireguard link", zap.Int("peers", len(link.TypedSpec().Wireguard.Peers)))
+
+			// notify link status controller, as userspace links can't be watched at all
+			if err = safe.WriterModify[*network.LinkRefresh](ctx, r, network.NewLinkRefresh(network.NamespaceName, network.LinkKindWireguard), func(r *network.LinkRefresh) error {
+				r.TypedSpec().Bump()
+
+				return nil
+			}); err != nil {
+				return errors.New("error bumping link refresh")
+			}
+		}
+	}
+
+	return multiErr.ErrorOrNil()
+}
+
 // WireguardSpec adapter provides encoding/decoding to netlink structures.
 //
 //nolint:nolintlint,revive
@@ -19,19 +19,21 @@ import (
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/jsimonetti/rtnetlink"
 	"github.com/mdlayher/ethtool"
-	"github.com/siderolabs/talos/pkg/machinery/constants"
 	"github.com/siderolabs/talos/pkg/machinery/nethelpers"
 	"github.com/siderolabs/talos/pkg/machinery/resources/network"
 	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
 	machinenetwork "github.com/siderolabs/talemu/internal/pkg/machine/network"
+	"github.com/siderolabs/talemu/internal/pkg/machine/network/userspace"
 )
 
 // LinkStatusController manages secrets.Etcd based on configuration.
 type LinkStatusController struct {
-	NC *machinenetwork.Client
+	NC              *machinenetwork.Client
+	InterfacePrefix string
 }
 
 // Name implements controller.Controller interface.
@@ -106,11 +108,6 @@ func (ctrl *LinkStatusController) reconcile(
 		itemsToDelete[r.Metadata().ID()] = struct{}{}
 	}
 
-	links, err := conn.Link.List()
-	if err != nil {
-		return fmt.Errorf("error listing links: %w", err)
-	}
-
 	// fake eth0 interface
 	if err = safe.WriterModify(ctx, r, network.NewLinkStatus(network.NamespaceName, "eth0"), func(r *network.LinkStatus) error {
 		status := r.TypedSpec()
@@ -138,6 +135,16 @@ func (ctrl *LinkStatusController) reconcile(
 		return err
 	}
 
+	var links []rtnetlink.LinkMessage
+
+	if stack := ctrl.NC.Userspace(); stack != nil {
+		if err = ctrl.reconcileUserspace(ctx, r, logger, stack, itemsToDelete); err != nil {
+			return err
+		}
+	} else if links, err = conn.Link.List(); err != nil {
+		return fmt.Errorf("error listing links: %w", err)
+	}
+
 	// for every rtnetlink discovered link
 	for _, link := range links {
 		var (
@@ -189,7 +196,7 @@ func (ctrl *LinkStatusController) reconcile(
 			}
 		}
 
-		if !strings.HasPrefix(link.Attributes.Name, constants.SideroLinkName) {
+		if !strings.HasPrefix(link.Attributes.Name, ctrl.InterfacePrefix) {
 			continue
 		}
 
@@ -304,3 +311,52 @@ func (ctrl *LinkStatusController) reconcile(
 
 	return nil
 }
+
+// reconcileUserspace publishes the status of the links of the userspace network.
+func (ctrl *LinkStatusController) reconcileUserspace(ctx context.Context, r controller.Runtime, logger *zap.Logger, stack *userspace.Stack, itemsToDelete map[resource.ID]struct{}) error {
+	for _, link := range stack.Links() {
+		spec, err := safe.ReaderGetByID[*network.LinkSpec](ctx, r, network.LayeredID(network.ConfigOperator, link.Name))
+		if err != nil {
+			if state.IsNotFoundError(err) {
+				continue
+			}
+
+			return err
+		}
+
+		if err = safe.WriterModify(ctx, r, network.NewLinkStatus(network.NamespaceName, link.Name), func(r *network.LinkStatus) error {
+			status := r.TypedSpec()
+
+			status.Index = link.Index
+			status.Type = spec.TypedSpec().Type
+			status.Kind = network.LinkKindWireguard
+			status.MTU = link.MTU
+			status.Port = nethelpers.Port(ethtool.Other)
+			status.Duplex = nethelpers.Duplex(ethtool.Unknown)
+			status.LinkState = link.Up
+
+			if link.Up {
+				status.Flags = nethelpers.LinkFlags(unix.IFF_UP | unix.IFF_RUNNING | unix.IFF_NOARP | unix.IFF_POINTOPOINT)
+				status.OperationalState = nethelpers.OperStateUnknown
+			} else {
+				status.Flags = nethelpers.LinkFlags(unix.IFF_NOARP | unix.IFF_POINTOPOINT)
+				status.OperationalState = nethelpers.OperStateDown
+			}
+
+			wgDev, devErr := stack.Device(link.Name)
+			if devErr != nil {
+				logger.Warn("failure getting wireguard attributes", zap.Error(devErr), zap.String("link", link.Name))
+			} else {
+				WireguardSpec(&status.Wireguard).Decode(wgDev, true)
+			}
+
+			return nil
+		}); err != nil {
+			return fmt.Errorf("error modifying resource: %w", err)
+		}
+
+		delete(itemsToDelete, link.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	stdlibtemplate "text/template"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/gen/optional"
+	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
+	"github.com/siderolabs/talos/pkg/machinery/resources/secrets"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ManifestController renders the bootstrap manifests from k8s.BootstrapManifestsConfig.
+type ManifestController struct{}
+
+// Name implements controller.Controller interface.
+func (ctrl *ManifestController) Name() string {
+	return "k8s.ManifestController"
+}
+
+// Inputs implements controller.Controller interface.
+func (ctrl *ManifestController) Inputs() []controller.Input {
+	return []controller.Input{
+		{
+			Namespace: k8s.ControlPlaneNamespaceName,
+			Type:      k8s.BootstrapManifestsConfigType,
+			ID:        optional.Some(k8s.BootstrapManifestsConfigID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: secrets.NamespaceName,
+			Type:      secrets.KubernetesRootType,
+			ID:        optional.Some(secrets.KubernetesRootID),
+			Kind:      controller.InputWeak,
+		},
+	}
+}
+
+// Outputs implements controller.Controller interface.
+func (ctrl *ManifestController) Outputs() []controller.Output {
+	return []controller.Output{
+		{
+			Type: k8s.ManifestType,
+			Kind: controller.OutputExclusive,
+		},
+	}
+}
+
+// Run implements controller.Controller interface.
+func (ctrl *ManifestController) Run(ctx context.Context, r controller.Runtime, _ *zap.Logger) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.EventCh():
+		}
+
+		manifests, err := ctrl.render(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		for id, items := range manifests {
+			if err = safe.WriterModify(ctx, r, k8s.NewManifest(k8s.ControlPlaneNamespaceName, id), func(res *k8s.Manifest) error {
+				res.TypedSpec().Items = items
+
+				return nil
+			}); err != nil {
+				return fmt.Errorf("error updating manifest %q: %w", id, err)
+			}
+		}
+
+		list, err := safe.ReaderList[*k8s.Manifest](ctx, r, resource.NewMetadata(k8s.ControlPlaneNamespaceName, k8s.ManifestType, "", resource.VersionUndefined))
+		if err != nil {
+			return fmt.Errorf("error listing manifests: %w", err)
+		}
+
+		for res := range list.All() {
+			if _, ok := manifests[res.Metadata().ID()]; ok {
+				continue
+			}
+
+			if err = r.Destroy(ctx, res.Metadata()); err != nil {
+				return fmt.Errorf("error cleaning up manifests: %w", err)
+			}
+		}
+
+		r.ResetRestartBackoff()
+	}
+}
+
+// render returns the bootstrap manifests by the manifest ID, the manifests are not rendered until the inputs are ready.
+func (ctrl *ManifestController) render(ctx context.Context, r controller.Runtime) (map[resource.ID][]k8s.SingleManifest, error) {
+	cfg, err := safe.ReaderGetByID[*k8s.BootstrapManifestsConfig](ctx, r, k8s.BootstrapManifestsConfigID)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting bootstrap manifests config: %w", err)
+	}
+
+	rootSecrets, err := safe.ReaderGetByID[*secrets.KubernetesRoot](ctx, r, secrets.KubernetesRootID)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting root secrets: %w", err)
+	}
+
+	data, err := newManifestTemplateData(cfg.TypedSpec(), rootSecrets.TypedSpec())
+	if err != nil {
+		return nil, err
+	}
+
+	return renderManifests(data)
+}
+
+type manifestTemplateData struct {
+	*k8s.BootstrapManifestsConfigSpec
+
+	Secrets *secrets.KubernetesRootSpec
+
+	NetConf             string
+	InClusterKubeconfig string
+	Corefile            string
+
+	DNSServiceIPs        []string
+	DNSServiceIPFamilies []v1.IPFamily
+}
+
+func newManifestTemplateData(cfg *k8s.BootstrapManifestsConfigSpec, rootSecrets *secrets.KubernetesRootSpec) (*manifestTemplateData, error) {
+	data := &manifestTemplateData{
+		BootstrapManifestsConfigSpec: cfg,
+		Secrets:                      rootSecrets,
+	}
+
+	if cfg.DNSServiceIP != "" {
+		data.DNSServiceIPs = append(data.DNSServiceIPs, cfg.DNSServiceIP)
+		data.DNSServiceIPFamilies = append(data.DNSServiceIPFamilies, v1.IPv4Protocol)
+	}
+
+	if cfg.DNSServiceIPv6 != "" {
+		data.DNSServiceIPs = append(data.DNSServiceIPs, cfg.DNSServiceIPv6)
+		data.DNSServiceIPFamilies = append(data.DNSServiceIPFamilies, v1.IPv6Protocol)
+	}
+
+	netConf := map[string]any{
+		"Backend": map[string]any{
+			"Type": cfg.FlannelBackendType,
+		},
+	}
+
+	for _, podCIDR := range cfg.PodCIDRs {
+		prefix, err := netip.ParsePrefix(podCIDR)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing pod CIDR %q: %w", podCIDR, err)
+		}
+
+		if prefix.Addr().Is4() {
+			netConf["Network"] = podCIDR
+		} else {
+			netConf["IPv6Network"] = podCIDR
+			netConf["EnableIPv6"] = true
+		}
+	}
+
+	if _, ok := netConf["Network"]; !ok {
+		netConf["EnableIPv4"] = false
+	}
+
+	netConfJSON, err := json.MarshalIndent(netConf, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	data.NetConf = string(netConfJSON)
+
+	data.InClusterKubeconfig = fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: %s
+    certificate-authority: /var/run/secrets/kubernetes.io/serviceaccount/ca.crt
+users:
+- name: service-account
+  user:
+    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token
+contexts:
+- context:
+    cluster: local
+    user: service-account
+`, cfg.Server)
+
+	data.Corefile = fmt.Sprintf(`.:53 {
+    errors
+    health {
+        lameduck 5s
+    }
+    ready
+    log . {
+        class error
+    }
+    prometheus :9153
+
+    kubernetes %s in-addr.arpa ip6.arpa {
+        pods insecure
+        fallthrough in-addr.arpa ip6.arpa
+        ttl 30
+    }
+    forward . /etc/resolv.conf {
+       max_concurrent 1000
+    }
+    cache 30 {
+        denial 9984 30
+    }
+    loop
+    reload
+    loadbalance
+}
+`, cfg.ClusterDomain)
+
+	return data, nil
+}
+
+type manifestTemplate struct {
+	id       resource.ID
+	template string
+}
+
+// renderManifests renders the same manifest set as Talos does for the control planes.
+func renderManifests(data *manifestTemplateData) (map[resource.ID][]k8s.SingleManifest, error) {
+	templates := []manifestTemplate{
+		{"00-kubelet-bootstrapping-token", kubeletBootstrappingTokenTemplate},
+		{"01-csr-node-bootstrap", csrNodeBootstrapTemplate},
+		{"01-csr-approver-role-binding", csrApproverRoleBindingTemplate},
+		{"01-csr-renewal-role-binding", csrRenewalRoleBindingTemplate},
+		{"02-kube-system-sa-role-binding", kubeSystemSARoleBindingTemplate},
+		{"11-kube-config-in-cluster", kubeConfigInClusterTemplate},
+	}
+
+	if data.FlannelEnabled {
+		templates = append(templates, manifestTemplate{"05-flannel", flannelTemplate})
+	}
+
+	if data.ProxyEnabled {
+		templates = append(templates, manifestTemplate{"10-kube-proxy", kubeProxyTemplate})
+	}
+
+	if data.CoreDNSEnabled {
+		templates = append(templates, manifestTemplate{"11-core-dns", coreDNSTemplate})
+
+		if len(data.DNSServiceIPs) > 0 {
+			templates = append(templates, manifestTemplate{"11-core-dns-svc", coreDNSSvcTemplate})
+		}
+	}
+
+	funcs := stdlibtemplate.FuncMap{
+		"json": func(value any) (string, error) {
+			out, err := json.Marshal(value)
+
+			return string(out), err
+		},
+	}
+
+	manifests := make(map[resource.ID][]k8s.SingleManifest, len(templates))
+
+	for _, templ := range templates {
+		t, err := stdlibtemplate.New(templ.id).Funcs(funcs).Parse(templ.template)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing manifest template %q: %w", templ.id, err)
+		}
+
+		var buf bytes.Buffer
+
+		if err = t.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("error executing manifest template %q: %w", templ.id, err)
+		}
+
+		decoder := yaml.NewYAMLOrJSONDecoder(&buf, buf.Len())
+
+		for {
+			obj := &unstructured.Unstructured{}
+
+			if err = decoder.Decode(obj); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				return nil, fmt.Errorf("error decoding manifest %q: %w", templ.id, err)
+			}
+
+			manifests[templ.id] = append(manifests[templ.id], k8s.SingleManifest{Object: obj.Object})
+		}
+	}
+
+	return manifests, nil
+}
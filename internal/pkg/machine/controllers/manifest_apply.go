@@ -0,0 +1,188 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/gen/optional"
+	"github.com/siderolabs/talos/pkg/machinery/constants"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
+	"github.com/siderolabs/talos/pkg/machinery/resources/secrets"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	cacheddiscovery "k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
+)
+
+// manifestApplyTimeout is the timeout of applying the whole manifest set.
+const manifestApplyTimeout = time.Minute
+
+// ManifestApplyController applies the bootstrap manifests to the cluster.
+//
+// Talos applies the manifests once after the bootstrap, here they are applied again each time they change,
+// so that the cluster follows the machine config.
+type ManifestApplyController struct {
+	GlobalState state.State
+
+	client kubernetesClient
+}
+
+// Name implements controller.Controller interface.
+func (ctrl *ManifestApplyController) Name() string {
+	return "k8s.ManifestApplyController"
+}
+
+// Inputs implements controller.Controller interface.
+func (ctrl *ManifestApplyController) Inputs() []controller.Input {
+	return []controller.Input{
+		{
+			Namespace: config.NamespaceName,
+			Type:      config.MachineConfigType,
+			ID:        optional.Some(config.ActiveID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: secrets.NamespaceName,
+			Type:      secrets.KubernetesType,
+			ID:        optional.Some(secrets.KubernetesID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: k8s.ControlPlaneNamespaceName,
+			Type:      k8s.ManifestType,
+			Kind:      controller.InputWeak,
+		},
+	}
+}
+
+// Outputs implements controller.Controller interface.
+func (ctrl *ManifestApplyController) Outputs() []controller.Output {
+	return []controller.Output{
+		{
+			Type: k8s.ManifestStatusType,
+			Kind: controller.OutputExclusive,
+		},
+	}
+}
+
+// Run implements controller.Controller interface.
+func (ctrl *ManifestApplyController) Run(ctx context.Context, r controller.Runtime, logger *zap.Logger) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.EventCh():
+		}
+
+		if err := ctrl.reconcile(ctx, r, logger); err != nil {
+			return err
+		}
+
+		r.ResetRestartBackoff()
+	}
+}
+
+func (ctrl *ManifestApplyController) reconcile(ctx context.Context, r controller.Runtime, logger *zap.Logger) error {
+	cfg, err := machineconfig.GetComplete(ctx, r)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if cfg.Metadata().Phase() == resource.PhaseTearingDown || !cfg.Provider().Machine().Type().IsControlPlane() {
+		return nil
+	}
+
+	manifests, err := safe.ReaderList[*k8s.Manifest](ctx, r, resource.NewMetadata(k8s.ControlPlaneNamespaceName, k8s.ManifestType, "", resource.VersionUndefined))
+	if err != nil {
+		return fmt.Errorf("error listing manifests: %w", err)
+	}
+
+	if manifests.Len() == 0 {
+		return nil
+	}
+
+	client, dynamicClient, err := ctrl.client.getDynamic(ctx, r, ctrl.GlobalState, cfg)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, manifestApplyTimeout)
+	defer cancel()
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(cacheddiscovery.NewMemCacheClient(client.Discovery()))
+
+	applied := make([]string, 0, manifests.Len())
+
+	// the manifests are sorted by the ID, so the manifest prefixes define the apply order, as in Talos
+	for manifest := range manifests.All() {
+		for _, item := range manifest.TypedSpec().Items {
+			obj := &unstructured.Unstructured{Object: item.Object}
+
+			if err = applyManifest(ctx, dynamicClient, mapper, obj); err != nil {
+				return fmt.Errorf("error applying manifest %q %s %s/%s: %w", manifest.Metadata().ID(), obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+			}
+		}
+
+		applied = append(applied, manifest.Metadata().ID())
+	}
+
+	logger.Info("applied bootstrap manifests", zap.Strings("manifests", applied))
+
+	return safe.WriterModify(ctx, r, k8s.NewManifestStatus(k8s.ControlPlaneNamespaceName), func(res *k8s.ManifestStatus) error {
+		res.TypedSpec().ManifestsApplied = applied
+
+		return nil
+	})
+}
+
+// applyManifest applies the object with the server-side apply using the Talos field manager,
+// so that the manifest sync sees the objects as managed by Talos.
+func applyManifest(ctx context.Context, dynamicClient *dynamic.DynamicClient, mapper *restmapper.DeferredDiscoveryRESTMapper, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fmt.Errorf("error mapping the object kind: %w", err)
+	}
+
+	var resourceClient dynamic.ResourceInterface = dynamicClient.Resource(mapping.Resource)
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+
+		resourceClient = dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	}
+
+	_, err = resourceClient.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: constants.KubernetesFieldManagerName,
+		Force:        true,
+	})
+
+	return err
+}
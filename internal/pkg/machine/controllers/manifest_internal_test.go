@@ -0,0 +1,103 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
+	"github.com/siderolabs/talos/pkg/machinery/resources/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRenderManifests(t *testing.T) {
+	t.Parallel()
+
+	cfg := &k8s.BootstrapManifestsConfigSpec{
+		Server:                 "https://example.com:6443",
+		ClusterDomain:          "cluster.local",
+		PodCIDRs:               []string{"10.244.0.0/16", "fd00:10:244::/56"},
+		ProxyEnabled:           true,
+		ProxyImage:             "registry.k8s.io/kube-proxy:v1.30.1",
+		ProxyArgs:              []string{"--cluster-cidr=10.244.0.0/16", "--hostname-override=$(NODE_NAME)"},
+		CoreDNSEnabled:         true,
+		CoreDNSImage:           "registry.k8s.io/coredns/coredns:v1.11.1",
+		DNSServiceIP:           "10.96.0.10",
+		DNSServiceIPv6:         "fd00:10:96::a",
+		FlannelEnabled:         true,
+		FlannelImage:           "ghcr.io/siderolabs/flannel:v0.25.1",
+		FlannelBackendType:     "vxlan",
+		FlannelKubeServiceHost: "example.com",
+		FlannelKubeServicePort: "6443",
+	}
+
+	rootSecrets := &secrets.KubernetesRootSpec{
+		BootstrapTokenID:     "abcdef",
+		BootstrapTokenSecret: "0123456789abcdef",
+	}
+
+	data, err := newManifestTemplateData(cfg, rootSecrets)
+	require.NoError(t, err)
+
+	manifests, err := renderManifests(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"00-kubelet-bootstrapping-token",
+		"01-csr-approver-role-binding",
+		"01-csr-node-bootstrap",
+		"01-csr-renewal-role-binding",
+		"02-kube-system-sa-role-binding",
+		"05-flannel",
+		"10-kube-proxy",
+		"11-core-dns",
+		"11-core-dns-svc",
+		"11-kube-config-in-cluster",
+	}, slices.Sorted(maps.Keys(manifests)))
+
+	token := unstructured.Unstructured{Object: manifests["00-kubelet-bootstrapping-token"][0].Object}
+
+	assert.Equal(t, "bootstrap-token-abcdef", token.GetName())
+
+	proxy := unstructured.Unstructured{Object: manifests["10-kube-proxy"][0].Object}
+
+	containers, _, err := unstructured.NestedSlice(proxy.Object, "spec", "template", "spec", "containers")
+	require.NoError(t, err)
+	require.Len(t, containers, 1)
+
+	container, ok := containers[0].(map[string]any)
+	require.True(t, ok)
+
+	assert.Equal(t, "registry.k8s.io/kube-proxy:v1.30.1", container["image"])
+	assert.Equal(t, []any{"/usr/local/bin/kube-proxy", "--cluster-cidr=10.244.0.0/16", "--hostname-override=$(NODE_NAME)"}, container["command"])
+
+	dnsService := unstructured.Unstructured{Object: manifests["11-core-dns-svc"][0].Object}
+
+	clusterIPs, _, err := unstructured.NestedStringSlice(dnsService.Object, "spec", "clusterIPs")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"10.96.0.10", "fd00:10:96::a"}, clusterIPs)
+
+	policy, _, err := unstructured.NestedString(dnsService.Object, "spec", "ipFamilyPolicy")
+	require.NoError(t, err)
+
+	assert.Equal(t, "RequireDualStack", policy)
+
+	cfg.ProxyEnabled = false
+	cfg.CoreDNSEnabled = false
+	cfg.FlannelEnabled = false
+
+	manifests, err = renderManifests(data)
+	require.NoError(t, err)
+
+	assert.NotContains(t, manifests, "05-flannel")
+	assert.NotContains(t, manifests, "10-kube-proxy")
+	assert.NotContains(t, manifests, "11-core-dns")
+	assert.Contains(t, manifests, "11-kube-config-in-cluster")
+}
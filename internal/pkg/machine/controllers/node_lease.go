@@ -0,0 +1,193 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/gen/optional"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
+	"github.com/siderolabs/talos/pkg/machinery/resources/secrets"
+	"go.uber.org/zap"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
+)
+
+const (
+	// nodeLeaseDuration is the kubelet default node lease duration.
+	nodeLeaseDuration = 40 * time.Second
+	// nodeLeaseRenewInterval is the kubelet default node lease renew interval.
+	nodeLeaseRenewInterval = 10 * time.Second
+)
+
+// NodeLeaseController renews the node lease in the kube-node-lease namespace, as the kubelet does.
+//
+// The node lifecycle controller of the kube-controller-manager marks the node unknown once the lease expires,
+// so the lease stops being renewed when the machine is powered off.
+type NodeLeaseController struct {
+	GlobalState state.State
+
+	client kubernetesClient
+}
+
+// Name implements controller.Controller interface.
+func (ctrl *NodeLeaseController) Name() string {
+	return "k8s.NodeLeaseController"
+}
+
+// Inputs implements controller.Controller interface.
+func (ctrl *NodeLeaseController) Inputs() []controller.Input {
+	return []controller.Input{
+		{
+			Namespace: config.NamespaceName,
+			Type:      config.MachineConfigType,
+			ID:        optional.Some(config.ActiveID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: secrets.NamespaceName,
+			Type:      secrets.KubernetesType,
+			ID:        optional.Some(secrets.KubernetesID),
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: k8s.NamespaceName,
+			Type:      k8s.NodenameType,
+			ID:        optional.Some(k8s.NodenameID),
+			Kind:      controller.InputWeak,
+		},
+	}
+}
+
+// Outputs implements controller.Controller interface.
+func (ctrl *NodeLeaseController) Outputs() []controller.Output {
+	return nil
+}
+
+// Run implements controller.Controller interface.
+func (ctrl *NodeLeaseController) Run(ctx context.Context, r controller.Runtime, logger *zap.Logger) error {
+	ticker := time.NewTicker(nodeLeaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.EventCh():
+		case <-ticker.C:
+		}
+
+		if err := ctrl.renew(ctx, r); err != nil {
+			// the node lease is renewed on the next tick
+			logger.Warn("failed to renew the node lease", zap.Error(err))
+
+			continue
+		}
+
+		r.ResetRestartBackoff()
+	}
+}
+
+func (ctrl *NodeLeaseController) renew(ctx context.Context, r controller.Runtime) error {
+	cfg, err := machineconfig.GetComplete(ctx, r)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	// the lease is removed together with the node
+	if cfg.Metadata().Phase() == resource.PhaseTearingDown {
+		return nil
+	}
+
+	nodename, err := safe.ReaderGetByID[*k8s.Nodename](ctx, r, k8s.NodenameID)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	client, err := ctrl.client.get(ctx, r, ctrl.GlobalState, cfg)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, nodeLeaseRenewInterval)
+	defer cancel()
+
+	return renewNodeLease(ctx, client, nodename.TypedSpec().Nodename, time.Now())
+}
+
+// renewNodeLease creates the lease of the node or updates its renew time.
+func renewNodeLease(ctx context.Context, client kubernetes.Interface, name string, renewTime time.Time) error {
+	node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		// the lease is owned by the node, so it is created once the node is registered
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	leases := client.CoordinationV1().Leases(v1.NamespaceNodeLease)
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	now := metav1.NewMicroTime(renewTime)
+
+	if errors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: v1.NamespaceNodeLease,
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: v1.SchemeGroupVersion.String(),
+						Kind:       "Node",
+						Name:       node.Name,
+						UID:        node.UID,
+					},
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       new(name),
+				LeaseDurationSeconds: new(int32(nodeLeaseDuration.Seconds())),
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+
+		return err
+	}
+
+	lease.Spec.RenewTime = &now
+
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+
+	return err
+}
@@ -0,0 +1,64 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRenewNodeLease(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	client := fake.NewClientset()
+	leases := client.CoordinationV1().Leases(v1.NamespaceNodeLease)
+
+	created := time.Now().Truncate(time.Microsecond)
+
+	// the node isn't registered yet
+	require.NoError(t, renewNodeLease(ctx, client, "worker-1", created))
+
+	_, err := leases.Get(ctx, "worker-1", metav1.GetOptions{})
+	require.True(t, errors.IsNotFound(err))
+
+	node, err := client.CoreV1().Nodes().Create(ctx, &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "worker-1",
+			UID:  "1234",
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, renewNodeLease(ctx, client, "worker-1", created))
+
+	lease, err := leases.Get(ctx, "worker-1", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	require.Len(t, lease.OwnerReferences, 1)
+	assert.Equal(t, "Node", lease.OwnerReferences[0].Kind)
+	assert.Equal(t, node.UID, lease.OwnerReferences[0].UID)
+	assert.Equal(t, "worker-1", *lease.Spec.HolderIdentity)
+	assert.EqualValues(t, nodeLeaseDuration.Seconds(), *lease.Spec.LeaseDurationSeconds)
+	assert.True(t, lease.Spec.RenewTime.Time.Equal(created))
+
+	renewed := created.Add(nodeLeaseRenewInterval)
+
+	require.NoError(t, renewNodeLease(ctx, client, "worker-1", renewed))
+
+	lease, err = leases.Get(ctx, "worker-1", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	assert.True(t, lease.Spec.RenewTime.Time.Equal(renewed))
+	assert.Equal(t, "worker-1", *lease.Spec.HolderIdentity)
+	assert.Equal(t, node.UID, lease.OwnerReferences[0].UID)
+}
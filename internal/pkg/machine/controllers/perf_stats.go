@@ -13,8 +13,11 @@ import (
 	"github.com/cosi-project/runtime/pkg/resource"
 	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/talos/pkg/machinery/resources/hardware"
 	"github.com/siderolabs/talos/pkg/machinery/resources/perf"
 	"go.uber.org/zap"
+
+	machinehardware "github.com/siderolabs/talemu/internal/pkg/machine/hardware"
 )
 
 const (
@@ -33,7 +36,18 @@ func (ctrl *PerfStatsController) Name() string {
 
 // Inputs implements controller.Controller interface.
 func (ctrl *PerfStatsController) Inputs() []controller.Input {
-	return nil
+	return []controller.Input{
+		{
+			Namespace: hardware.NamespaceName,
+			Type:      hardware.ProcessorType,
+			Kind:      controller.InputWeak,
+		},
+		{
+			Namespace: hardware.NamespaceName,
+			Type:      hardware.MemoryModuleType,
+			Kind:      controller.InputWeak,
+		},
+	}
 }
 
 // Outputs implements controller.Controller interface.
@@ -98,7 +112,12 @@ func (ctrl *PerfStatsController) reconcile(ctx context.Context, r controller.Run
 	// CPUStat fields are cumulative jiffies (USER_HZ=100), matching the real Talos format.
 	// The Omni chart computes diff(new, old) to get per-interval usage, so values must always increase.
 	// Each simulated 30-second interval contributes numCores * hz * intervalSeconds total jiffies.
-	const intervalJiffies = 64.0 * 100.0 * float64(perfUpdateInterval/time.Second) //nolint:mnd
+	totals, err := machinehardware.ReadTotals(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	intervalJiffies := float64(totals.Cores) * 100.0 * float64(perfUpdateInterval/time.Second) //nolint:mnd
 
 	userPct := 0.05 + rand.Float64()*0.25   //nolint:mnd
 	systemPct := 0.02 + rand.Float64()*0.13 //nolint:mnd
@@ -118,7 +137,7 @@ func (ctrl *PerfStatsController) reconcile(ctx context.Context, r controller.Run
 		return err
 	}
 
-	const totalMem = 64 * 1024 * 1024 * 1024
+	totalMem := totals.MemoryBytes
 
 	usedMem := uint64(float64(totalMem) * (0.1 + rand.Float64()*0.2)) //nolint:mnd
 
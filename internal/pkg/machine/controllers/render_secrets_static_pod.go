@@ -30,7 +30,7 @@ import (
 
 // RenderSecretsStaticPodController manages k8s.SecretsReady and renders secrets from secrets.Kubernetes.
 type RenderSecretsStaticPodController struct {
-	MachineID string
+	CertsDir string
 }
 
 // Name implements controller.Controller interface.
@@ -82,7 +82,7 @@ func (ctrl *RenderSecretsStaticPodController) Outputs() []controller.Output {
 //
 //nolint:gocyclo,cyclop,gocognit,maintidx
 func (ctrl *RenderSecretsStaticPodController) Run(ctx context.Context, r controller.Runtime, _ *zap.Logger) error {
-	certsDir := filepath.Join("_out/state/machines", ctrl.MachineID, "certs")
+	certsDir := ctrl.CertsDir
 
 	for {
 		select {
@@ -216,6 +216,30 @@ func (ctrl *RenderSecretsStaticPodController) Run(ctx context.Context, r control
 					},
 				},
 			},
+			{
+				name:      "kube-controller-manager",
+				directory: certsDir,
+				uid:       constants.KubernetesControllerManagerRunUser,
+				gid:       constants.KubernetesControllerManagerRunGroup,
+				templates: []template{
+					{
+						filename: "controller-manager.kubeconfig",
+						template: "{{ .Secrets.ControllerManagerKubeconfig }}",
+					},
+				},
+			},
+			{
+				name:      "kube-scheduler",
+				directory: certsDir,
+				uid:       constants.KubernetesSchedulerRunUser,
+				gid:       constants.KubernetesSchedulerRunGroup,
+				templates: []template{
+					{
+						filename: "scheduler.kubeconfig",
+						template: "{{ .Secrets.SchedulerKubeconfig }}",
+					},
+				},
+			},
 		} {
 			if err = os.MkdirAll(pod.directory, 0o755); err != nil {
 				return fmt.Errorf("error creating secrets directory for %q: %w", pod.name, err)
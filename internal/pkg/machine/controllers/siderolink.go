@@ -30,25 +30,28 @@ import (
 	"github.com/siderolabs/talos/pkg/machinery/resources/siderolink"
 	"github.com/siderolabs/talos/pkg/machinery/version"
 	"go.uber.org/zap"
-	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
 	machinenetwork "github.com/siderolabs/talemu/internal/pkg/machine/network"
 )
 
 // ManagerController interacts with SideroLink API and brings up the SideroLink Wireguard interface.
 type ManagerController struct {
-	NC      *machinenetwork.Client
-	pd      provisionData
-	nodeKey wgtypes.Key
-	Slot    int
+	NC *machinenetwork.Client
+	// Faults partitions the machine from SideroLink by bringing the link down.
+	Faults          *faults.Injector
+	pd              provisionData
+	InterfacePrefix string
+	nodeKey         wgtypes.Key
+	Slot            int
 }
 
 func (ctrl *ManagerController) interfaceName() string {
-	return fmt.Sprintf("%s%d", constants.SideroLinkName, ctrl.Slot)
+	return fmt.Sprintf("%s%d", ctrl.InterfacePrefix, ctrl.Slot)
 }
 
 // Name implements controller.Controller interface.
@@ -116,12 +119,16 @@ func (ctrl *ManagerController) Run(ctx context.Context, r controller.Runtime, lo
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
+	faultsCh, stopFaultsWatch := ctrl.Faults.Watch()
+	defer stopFaultsWatch()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-faultsCh:
 		case <-ticker.C:
-			reconnect, err := ctrl.shouldReconnect(ctrl.NC.Wg())
+			reconnect, err := ctrl.shouldReconnect()
 			if err != nil {
 				return err
 			}
@@ -180,10 +187,13 @@ func (ctrl *ManagerController) Run(ctx context.Context, r controller.Runtime, lo
 			return errors.New("host returned no endpoints")
 		}
 
+		partitioned := ctrl.Faults.Partitioned()
+
 		logger.Info(
 			"configuring siderolink connection",
 			zap.String("peer_endpoint", ep),
 			zap.String("next_peer_endpoint", ctrl.pd.PeekNextEndpoint()),
+			zap.Bool("partitioned", partitioned),
 		)
 
 		if err = safe.WriterModify(ctx, r, linkSpec,
@@ -194,7 +204,7 @@ func (ctrl *ManagerController) Run(ctx context.Context, r controller.Runtime, lo
 				spec.Name = ctrl.interfaceName()
 				spec.Type = nethelpers.LinkNone
 				spec.Kind = "wireguard"
-				spec.Up = true
+				spec.Up = !partitioned
 				spec.Logical = ctrl.pd.grpcPeerAddrPort == ""
 				spec.MTU = wireguard.LinkMTU
 
@@ -499,8 +509,8 @@ func (ctrl *ManagerController) cleanupAddressSpecs(ctx context.Context, r contro
 	return nil
 }
 
-func (ctrl *ManagerController) shouldReconnect(wgClient *wgctrl.Client) (bool, error) {
-	wgDevice, err := wgClient.Device(ctrl.interfaceName())
+func (ctrl *ManagerController) shouldReconnect() (bool, error) {
+	wgDevice, err := ctrl.NC.WireguardDevice(ctrl.interfaceName())
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			// no Wireguard device, so no need to reconnect
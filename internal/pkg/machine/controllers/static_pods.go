@@ -16,6 +16,7 @@ import (
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/siderolabs/gen/optional"
 	"github.com/siderolabs/go-pointer"
+	talosconstants "github.com/siderolabs/talos/pkg/machinery/constants"
 	"github.com/siderolabs/talos/pkg/machinery/resources/config"
 	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
 	"github.com/siderolabs/talos/pkg/machinery/resources/network"
@@ -31,14 +32,23 @@ import (
 
 	"github.com/siderolabs/talemu/internal/pkg/constants"
 	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
+	machinenetwork "github.com/siderolabs/talemu/internal/pkg/machine/network"
 )
 
 // StaticPodController renders fake static pod states.
+//
+// When the image of a component changes, the static pods restart one at a time as they do on Talos:
+// the restarted pod gets the new image and stays not ready for the RestartDelay.
 type StaticPodController struct {
 	client *kubernetes.Clientset
 
-	MachineID string
-	config    []byte
+	MachineID    string
+	RestartDelay time.Duration
+	config       []byte
+
+	restarting      string
+	restartDeadline time.Time
+	restartCh       <-chan time.Time
 }
 
 // Name implements controller.Controller interface.
@@ -94,6 +104,8 @@ func (ctrl *StaticPodController) Run(ctx context.Context, r controller.Runtime,
 		case <-ctx.Done():
 			return nil
 		case <-r.EventCh():
+		case <-ctrl.restartCh:
+			ctrl.restartCh = nil
 		}
 
 		if err := ctrl.reconcile(ctx, r, logger); err != nil {
@@ -203,6 +215,10 @@ func (ctrl *StaticPodController) reconcile(ctx context.Context, r controller.Run
 
 	nodenameVersion := nodename.Metadata().Version().String()
 
+	if ctrl.restarting != "" && !time.Now().Before(ctrl.restartDeadline) {
+		ctrl.restarting = ""
+	}
+
 	for _, cb := range []func(config *config.MachineConfig, nodename *k8s.Nodename) (*v1.Pod, error){
 		ctrl.renderAPIServer,
 		ctrl.renderControllerManager,
@@ -217,6 +233,7 @@ func (ctrl *StaticPodController) reconcile(ctx context.Context, r controller.Run
 		pod.Status.HostIP = address.TypedSpec().Addresses[0].String()
 		pod.Labels[machineIDLabel] = ctrl.MachineID
 		pod.Labels[inputVersionLabel] = nodenameVersion
+		pod.Labels[versionLabel] = getImageVersion(pod.Spec.Containers[0].Image)
 
 		// The control-plane components run as static pods on real Talos, so a node drain skips them (a
 		// kubelet marks its static pods with the mirror annotation). Mirror that here, otherwise draining a
@@ -227,56 +244,36 @@ func (ctrl *StaticPodController) reconcile(ctx context.Context, r controller.Run
 
 		pod.Annotations[v1.MirrorPodAnnotationKey] = ctrl.MachineID
 
+		// Talos marks the static pods with the machine config version, the Kubernetes upgrade waits for the pods
+		// with the new config version to become ready
+		pod.Annotations[talosconstants.AnnotationStaticPodConfigVersion] = cfg.Metadata().Version().String()
+
 		pod.Spec.SchedulerName = "default-scheduler"
 		pod.Spec.NodeName = nodename.TypedSpec().Nodename
 		pod.Spec.HostNetwork = true
 
-		pod.Status.Phase = v1.PodRunning
-		pod.Status.Conditions = []v1.PodCondition{
-			{
-				Type:   v1.PodReadyToStartContainers,
-				Status: v1.ConditionTrue,
-			},
-			{
-				Type:   v1.PodInitialized,
-				Status: v1.ConditionTrue,
-			},
-			{
-				Type:   v1.PodReady,
-				Status: v1.ConditionTrue,
-			},
-			{
-				Type:   v1.ContainersReady,
-				Status: v1.ConditionTrue,
-			},
-			{
-				Type:   v1.PodScheduled,
-				Status: v1.ConditionTrue,
-			},
-		}
-
-		pod.Status.ContainerStatuses = make([]v1.ContainerStatus, 0, len(pod.Spec.Containers))
-
-		for _, container := range pod.Spec.Containers {
-			pod.Status.ContainerStatuses = append(
-				pod.Status.ContainerStatuses,
-				v1.ContainerStatus{
-					Name:    container.Name,
-					Image:   container.Image,
-					Started: new(true),
-					Ready:   true,
-					State: v1.ContainerState{
-						Running: &v1.ContainerStateRunning{},
-					},
-				},
-			)
-		}
-
 		existing, err := client.CoreV1().Pods(ns).Get(ctx, pod.Name, metav1.GetOptions{})
 		if err != nil && !errors.IsNotFound(err) {
 			return err
 		}
 
+		if existing.Name != "" && !staticPodImagesMatch(existing, pod) && ctrl.restarting != pod.Name {
+			if ctrl.restarting != "" {
+				// another static pod is restarting, the pod keeps the old image until it is ready
+				continue
+			}
+
+			delay := delayOrDefault(ctrl.RestartDelay, DefaultStaticPodRestartDelay)
+
+			ctrl.restarting = pod.Name
+			ctrl.restartDeadline = time.Now().Add(delay)
+			ctrl.restartCh = time.After(delay)
+
+			logger.Info("restarting static pod", zap.String("name", pod.Name), zap.Duration("delay", delay))
+		}
+
+		pod.Status = staticPodStatus(pod, ctrl.restarting != pod.Name)
+
 		if existing.Name != "" {
 			if _, err = client.CoreV1().Pods(ns).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
 				return err
@@ -287,6 +284,7 @@ func (ctrl *StaticPodController) reconcile(ctx context.Context, r controller.Run
 			}
 
 			existing.Labels = pod.Labels
+			existing.Annotations = pod.Annotations
 
 			if _, err = client.CoreV1().Pods(ns).Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
 				return err
@@ -326,6 +324,74 @@ func (ctrl *StaticPodController) reconcile(ctx context.Context, r controller.Run
 	return nil
 }
 
+// staticPodImagesMatch checks if the pod containers run the images of the rendered pod.
+func staticPodImagesMatch(existing, pod *v1.Pod) bool {
+	if len(existing.Spec.Containers) != len(pod.Spec.Containers) {
+		return false
+	}
+
+	for index, container := range pod.Spec.Containers {
+		if existing.Spec.Containers[index].Image != container.Image {
+			return false
+		}
+	}
+
+	return true
+}
+
+// staticPodStatus returns the running static pod status, the restarting pod containers are running but not ready yet.
+func staticPodStatus(pod *v1.Pod, ready bool) v1.PodStatus {
+	readyStatus := v1.ConditionTrue
+	if !ready {
+		readyStatus = v1.ConditionFalse
+	}
+
+	status := v1.PodStatus{
+		Phase: v1.PodRunning,
+		Conditions: []v1.PodCondition{
+			{
+				Type:   v1.PodReadyToStartContainers,
+				Status: v1.ConditionTrue,
+			},
+			{
+				Type:   v1.PodInitialized,
+				Status: v1.ConditionTrue,
+			},
+			{
+				Type:   v1.PodReady,
+				Status: readyStatus,
+			},
+			{
+				Type:   v1.ContainersReady,
+				Status: readyStatus,
+			},
+			{
+				Type:   v1.PodScheduled,
+				Status: v1.ConditionTrue,
+			},
+		},
+		HostIP:            pod.Status.HostIP,
+		ContainerStatuses: make([]v1.ContainerStatus, 0, len(pod.Spec.Containers)),
+	}
+
+	for _, container := range pod.Spec.Containers {
+		status.ContainerStatuses = append(
+			status.ContainerStatuses,
+			v1.ContainerStatus{
+				Name:    container.Name,
+				Image:   container.Image,
+				Started: new(true),
+				Ready:   ready,
+				State: v1.ContainerState{
+					Running: &v1.ContainerStateRunning{},
+				},
+			},
+		)
+	}
+
+	return status
+}
+
 func (ctrl *StaticPodController) renderAPIServer(machineConfig *config.MachineConfig, nodename *k8s.Nodename) (*v1.Pod, error) {
 	var pod v1.Pod
 
@@ -427,6 +493,9 @@ func (ctrl *StaticPodController) getClient(ctx context.Context, r controller.Run
 		return nil, err
 	}
 
+	// the apiserver might be running in the userspace network
+	clientCfg.Dial = machinenetwork.DialContext
+
 	client, err := kubernetes.NewForConfig(clientCfg)
 	if err != nil {
 		return nil, err
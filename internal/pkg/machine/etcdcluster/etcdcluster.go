@@ -0,0 +1,261 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package etcdcluster implements the emulated etcd cluster of the control planes.
+//
+// The cluster is kept in the global cluster status, so that all members of the cluster see the same leader,
+// learners and alarms. The members are voters or learners, the leader is elected among the voters which are up,
+// and the cluster has no leader without the quorum.
+package etcdcluster
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+
+	"github.com/siderolabs/talemu/api/specs"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
+)
+
+// Alarm types, the same as etcd reports them.
+const (
+	AlarmNoSpace = "NOSPACE"
+	AlarmCorrupt = "CORRUPT"
+)
+
+// Alarms are the alarm types the members can raise.
+var Alarms = []string{AlarmNoSpace, AlarmCorrupt}
+
+// Update changes the etcd cluster of the cluster status, and returns the updated cluster.
+func Update(ctx context.Context, st state.State, clusterID string, fn func(spec *specs.ClusterStatusSpec) error) (*specs.ClusterStatusSpec, error) {
+	res, err := safe.StateUpdateWithConflicts(ctx, st, emu.NewClusterStatus(emu.NamespaceName, clusterID).Metadata(), func(res *emu.ClusterStatus) error {
+		return fn(res.TypedSpec().Value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.TypedSpec().Value, nil
+}
+
+// Member returns the member by its ID, nil if it is not in the cluster.
+func Member(spec *specs.ClusterStatusSpec, id string) *specs.ClusterStatusSpec_EtcdMember {
+	for _, member := range spec.EtcdMembers {
+		if member.Id == id {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// MachineMember returns the member of the machine, nil if the machine is not in the cluster.
+func MachineMember(spec *specs.ClusterStatusSpec, machineID string) *specs.ClusterStatusSpec_EtcdMember {
+	for _, member := range spec.EtcdMembers {
+		if member.MachineId == machineID {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// Join adds the member to the cluster, the member is added as a learner if the cluster already has voters.
+//
+// The members removed from the cluster can't join it again.
+func Join(spec *specs.ClusterStatusSpec, id, machineID, hostname string) {
+	if slices.Contains(spec.DenyEtcdMembers, id) {
+		return
+	}
+
+	if member := Member(spec, id); member != nil {
+		if member.Hostname == "" {
+			member.Hostname = hostname
+		}
+
+		return
+	}
+
+	spec.EtcdMembers = append(spec.EtcdMembers, &specs.ClusterStatusSpec_EtcdMember{
+		Id:        id,
+		MachineId: machineID,
+		Hostname:  hostname,
+		Learner:   slices.ContainsFunc(spec.EtcdMembers, isVoter),
+	})
+
+	elect(spec)
+}
+
+// SetUp marks the member up or down, the leader is elected again if the quorum or the leader changes.
+func SetUp(spec *specs.ClusterStatusSpec, id string, up bool) {
+	member := Member(spec, id)
+	if member == nil || member.Up == up {
+		return
+	}
+
+	member.Up = up
+
+	elect(spec)
+}
+
+// Promote makes the learner a voter, the learner can only be promoted by the leader, so the cluster needs the quorum.
+//
+// Promote returns false if the member wasn't promoted.
+func Promote(spec *specs.ClusterStatusSpec, id string) bool {
+	member := Member(spec, id)
+	if member == nil || !member.Learner || !member.Up || spec.EtcdLeader == "" {
+		return false
+	}
+
+	member.Learner = false
+
+	elect(spec)
+
+	return true
+}
+
+// Remove removes the member from the cluster together with its alarms.
+func Remove(spec *specs.ClusterStatusSpec, id string) {
+	if !slices.Contains(spec.DenyEtcdMembers, id) {
+		spec.DenyEtcdMembers = append(spec.DenyEtcdMembers, id)
+	}
+
+	spec.EtcdMembers = slices.DeleteFunc(spec.EtcdMembers, func(member *specs.ClusterStatusSpec_EtcdMember) bool {
+		return member.Id == id
+	})
+
+	spec.EtcdAlarms = slices.DeleteFunc(spec.EtcdAlarms, func(alarm *specs.ClusterStatusSpec_EtcdAlarm) bool {
+		return alarm.MemberId == id
+	})
+
+	elect(spec)
+}
+
+// HasQuorum returns true if the majority of the voters is up.
+func HasQuorum(spec *specs.ClusterStatusSpec) bool {
+	var voters, up int
+
+	for _, member := range spec.EtcdMembers {
+		if !isVoter(member) {
+			continue
+		}
+
+		voters++
+
+		if member.Up {
+			up++
+		}
+	}
+
+	return voters > 0 && up*2 > voters
+}
+
+// ForfeitLeadership moves the leadership from the member to the next voter which is up.
+//
+// ForfeitLeadership returns the ID of the new leader, it is empty if the member is not the leader, or there is
+// no other voter to move the leadership to.
+func ForfeitLeadership(spec *specs.ClusterStatusSpec, id string) string {
+	if spec.EtcdLeader != id || id == "" {
+		return ""
+	}
+
+	index := slices.IndexFunc(spec.EtcdMembers, func(member *specs.ClusterStatusSpec_EtcdMember) bool {
+		return member.Id == id
+	})
+
+	for i := 1; i < len(spec.EtcdMembers); i++ {
+		member := spec.EtcdMembers[(index+i)%len(spec.EtcdMembers)]
+
+		if isVoter(member) && member.Up {
+			spec.EtcdLeader = member.Id
+			spec.EtcdRaftTerm++
+
+			return member.Id
+		}
+	}
+
+	return ""
+}
+
+// SetAlarm raises or disarms the alarm of the member.
+func SetAlarm(spec *specs.ClusterStatusSpec, id, alarm string, active bool) error {
+	if !slices.Contains(Alarms, alarm) {
+		return fmt.Errorf("unknown etcd alarm %q, the supported alarms are %s", alarm, strings.Join(Alarms, ", "))
+	}
+
+	if Member(spec, id) == nil {
+		return fmt.Errorf("etcd member %s is not in the cluster", id)
+	}
+
+	index := slices.IndexFunc(spec.EtcdAlarms, func(a *specs.ClusterStatusSpec_EtcdAlarm) bool {
+		return a.MemberId == id && a.Type == alarm
+	})
+
+	switch {
+	case active && index == -1:
+		spec.EtcdAlarms = append(spec.EtcdAlarms, &specs.ClusterStatusSpec_EtcdAlarm{
+			MemberId: id,
+			Type:     alarm,
+		})
+	case !active && index != -1:
+		spec.EtcdAlarms = slices.Delete(spec.EtcdAlarms, index, index+1)
+	}
+
+	return nil
+}
+
+// DisarmAlarms disarms all alarms of the cluster, and returns the disarmed alarms.
+func DisarmAlarms(spec *specs.ClusterStatusSpec) []*specs.ClusterStatusSpec_EtcdAlarm {
+	alarms := spec.EtcdAlarms
+
+	spec.EtcdAlarms = nil
+
+	return alarms
+}
+
+// MemberAlarms returns the alarms raised by the member.
+func MemberAlarms(spec *specs.ClusterStatusSpec, id string) []string {
+	var alarms []string
+
+	for _, alarm := range spec.EtcdAlarms {
+		if alarm.MemberId == id {
+			alarms = append(alarms, alarm.Type)
+		}
+	}
+
+	return alarms
+}
+
+// elect keeps the leader while it is an up voter and the cluster has the quorum, otherwise the first up voter
+// becomes the leader in the new term.
+//
+// The cluster without the quorum has no leader.
+func elect(spec *specs.ClusterStatusSpec) {
+	if !HasQuorum(spec) {
+		spec.EtcdLeader = ""
+
+		return
+	}
+
+	if leader := Member(spec, spec.EtcdLeader); leader != nil && isVoter(leader) && leader.Up {
+		return
+	}
+
+	for _, member := range spec.EtcdMembers {
+		if isVoter(member) && member.Up {
+			spec.EtcdLeader = member.Id
+			spec.EtcdRaftTerm++
+
+			return
+		}
+	}
+}
+
+func isVoter(member *specs.ClusterStatusSpec_EtcdMember) bool {
+	return !member.Learner
+}
@@ -0,0 +1,134 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package etcdcluster_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/api/specs"
+	"github.com/siderolabs/talemu/internal/pkg/machine/etcdcluster"
+)
+
+// newCluster creates the cluster of three voters which are up, the first one leads it.
+func newCluster(t *testing.T) *specs.ClusterStatusSpec {
+	t.Helper()
+
+	spec := &specs.ClusterStatusSpec{}
+
+	for _, id := range []string{"a", "b", "c"} {
+		etcdcluster.Join(spec, id, "machine-"+id, "host-"+id)
+		etcdcluster.SetUp(spec, id, true)
+		etcdcluster.Promote(spec, id)
+	}
+
+	require.Equal(t, "a", spec.EtcdLeader)
+
+	return spec
+}
+
+func TestJoin(t *testing.T) {
+	t.Parallel()
+
+	spec := &specs.ClusterStatusSpec{}
+
+	etcdcluster.Join(spec, "a", "machine-a", "host-a")
+	etcdcluster.Join(spec, "b", "machine-b", "host-b")
+
+	assert.False(t, etcdcluster.Member(spec, "a").Learner)
+	assert.True(t, etcdcluster.Member(spec, "b").Learner)
+	assert.Empty(t, spec.EtcdLeader, "the cluster has no leader until the voter is up")
+
+	etcdcluster.SetUp(spec, "a", true)
+	assert.Equal(t, "a", spec.EtcdLeader)
+	assert.EqualValues(t, 1, spec.EtcdRaftTerm)
+
+	assert.False(t, etcdcluster.Promote(spec, "b"), "the learner which is down can't be promoted")
+
+	etcdcluster.SetUp(spec, "b", true)
+	assert.True(t, etcdcluster.Promote(spec, "b"))
+	assert.False(t, etcdcluster.Member(spec, "b").Learner)
+	assert.Equal(t, "host-b", etcdcluster.MachineMember(spec, "machine-b").Hostname)
+
+	etcdcluster.Remove(spec, "b")
+	etcdcluster.Join(spec, "b", "machine-b", "host-b")
+	assert.Nil(t, etcdcluster.Member(spec, "b"), "the removed member can't join again")
+}
+
+func TestQuorum(t *testing.T) {
+	t.Parallel()
+
+	spec := newCluster(t)
+
+	etcdcluster.SetUp(spec, "a", false)
+	assert.True(t, etcdcluster.HasQuorum(spec))
+	assert.Equal(t, "b", spec.EtcdLeader, "the leader moves to the next voter which is up")
+	assert.EqualValues(t, 2, spec.EtcdRaftTerm)
+
+	etcdcluster.SetUp(spec, "c", false)
+	assert.False(t, etcdcluster.HasQuorum(spec))
+	assert.Empty(t, spec.EtcdLeader)
+
+	etcdcluster.SetUp(spec, "a", true)
+	assert.True(t, etcdcluster.HasQuorum(spec))
+	assert.Equal(t, "a", spec.EtcdLeader)
+	assert.EqualValues(t, 3, spec.EtcdRaftTerm)
+
+	etcdcluster.Remove(spec, "b")
+	assert.False(t, etcdcluster.HasQuorum(spec), "one of two voters is not the majority")
+	assert.Empty(t, spec.EtcdLeader)
+	assert.Contains(t, spec.DenyEtcdMembers, "b")
+}
+
+func TestForfeitLeadership(t *testing.T) {
+	t.Parallel()
+
+	spec := newCluster(t)
+
+	assert.Empty(t, etcdcluster.ForfeitLeadership(spec, "b"), "only the leader can forfeit the leadership")
+	assert.Equal(t, "b", etcdcluster.ForfeitLeadership(spec, "a"))
+	assert.Equal(t, "b", spec.EtcdLeader)
+
+	etcdcluster.SetUp(spec, "c", false)
+	assert.Equal(t, "a", etcdcluster.ForfeitLeadership(spec, "b"), "the voters which are down are skipped")
+
+	etcdcluster.SetUp(spec, "c", true)
+	etcdcluster.Join(spec, "d", "machine-d", "host-d")
+	etcdcluster.SetUp(spec, "d", true)
+
+	assert.Equal(t, "b", etcdcluster.ForfeitLeadership(spec, "a"))
+	assert.Equal(t, "c", etcdcluster.ForfeitLeadership(spec, "b"))
+	assert.Equal(t, "a", etcdcluster.ForfeitLeadership(spec, "c"), "the leadership doesn't move to the learners")
+	assert.EqualValues(t, 6, spec.EtcdRaftTerm)
+}
+
+func TestAlarms(t *testing.T) {
+	t.Parallel()
+
+	spec := newCluster(t)
+
+	require.NoError(t, etcdcluster.SetAlarm(spec, "a", etcdcluster.AlarmNoSpace, true))
+	require.NoError(t, etcdcluster.SetAlarm(spec, "a", etcdcluster.AlarmNoSpace, true))
+	require.NoError(t, etcdcluster.SetAlarm(spec, "b", etcdcluster.AlarmCorrupt, true))
+	require.Error(t, etcdcluster.SetAlarm(spec, "a", "FULL", true))
+	require.Error(t, etcdcluster.SetAlarm(spec, "x", etcdcluster.AlarmNoSpace, true))
+
+	assert.Equal(t, []string{etcdcluster.AlarmNoSpace}, etcdcluster.MemberAlarms(spec, "a"))
+
+	require.NoError(t, etcdcluster.SetAlarm(spec, "a", etcdcluster.AlarmNoSpace, false))
+	assert.Empty(t, etcdcluster.MemberAlarms(spec, "a"))
+
+	require.NoError(t, etcdcluster.SetAlarm(spec, "a", etcdcluster.AlarmNoSpace, true))
+
+	disarmed := etcdcluster.DisarmAlarms(spec)
+	assert.Len(t, disarmed, 2)
+	assert.Empty(t, spec.EtcdAlarms)
+
+	require.NoError(t, etcdcluster.SetAlarm(spec, "c", etcdcluster.AlarmCorrupt, true))
+	etcdcluster.Remove(spec, "c")
+	assert.Empty(t, spec.EtcdAlarms, "the alarms of the removed member are gone")
+}
@@ -21,7 +21,6 @@ import (
 	"github.com/siderolabs/gen/xslices"
 	"github.com/siderolabs/siderolink/api/events"
 	"github.com/siderolabs/talos/pkg/machinery/api/machine"
-	"github.com/siderolabs/talos/pkg/machinery/constants"
 	"github.com/siderolabs/talos/pkg/machinery/resources/network"
 	"github.com/siderolabs/talos/pkg/machinery/resources/runtime"
 	"github.com/siderolabs/talos/pkg/machinery/resources/v1alpha1"
@@ -38,14 +37,22 @@ import (
 )
 
 // Handler watches machine status resource and turns each resource change into an event.
+//
+// The events are kept in the history for the Events API and published to the event sink.
 type Handler struct {
-	state state.State
+	state           state.State
+	nc              *emunet.Client
+	history         *History
+	interfacePrefix string
 }
 
 // NewHandler creates new events handler.
-func NewHandler(st state.State) (*Handler, error) {
+func NewHandler(st state.State, nc *emunet.Client, interfacePrefix string, history *History) (*Handler, error) {
 	return &Handler{
-		state: st,
+		state:           st,
+		nc:              nc,
+		history:         history,
+		interfacePrefix: interfacePrefix,
 	}, nil
 }
 
@@ -61,6 +68,15 @@ func (h *Handler) Run(ctx context.Context, logger *zap.Logger) error {
 
 	endpoint := config.TypedSpec().Endpoint
 
+	// the history is recorded regardless of the event sink connection
+	var historyEg errgroup.Group
+
+	defer historyEg.Wait() //nolint:errcheck
+
+	defer cancel()
+
+	h.recordHistory(ctx, logger, &historyEg)
+
 	// The siderolink address can change at runtime: when Omni resolves a UUID conflict it assigns a
 	// new UUID and the machine re-provisions, getting a brand new address. Events must originate from
 	// the address Omni currently associates with this machine, so watch the address and rebuild the
@@ -135,7 +151,7 @@ func (h *Handler) siderolinkAddress(ctx context.Context) (netip.Addr, string, bo
 	}
 
 	addr, ok := list.Find(func(r *network.AddressStatus) bool {
-		return strings.HasPrefix(r.TypedSpec().LinkName, constants.SideroLinkName)
+		return strings.HasPrefix(r.TypedSpec().LinkName, h.interfacePrefix)
 	})
 	if !ok {
 		return netip.Addr{}, "", false, nil
@@ -147,19 +163,12 @@ func (h *Handler) siderolinkAddress(ctx context.Context) (netip.Addr, string, bo
 // startEventSink dials the event sink bound to the given address and starts publishing events.
 // The returned group winds down (closing the connection) once ctx is canceled.
 func (h *Handler) startEventSink(ctx context.Context, logger *zap.Logger, endpoint string, addr netip.Addr, linkName string) (*errgroup.Group, error) {
-	bindAddress := net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, 0))
-
 	conn, err := grpc.NewClient(
 		endpoint,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithSharedWriteBuffer(true),
 		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
-			var dialer net.Dialer
-
-			dialer.LocalAddr = bindAddress
-			dialer.Control = emunet.BindToInterface(linkName)
-
-			return dialer.DialContext(ctx, "tcp", address)
+			return h.nc.DialContext(ctx, linkName, addr, "tcp", address)
 		}),
 	)
 	if err != nil {
@@ -180,73 +189,153 @@ func (h *Handler) startEventSink(ctx context.Context, logger *zap.Logger, endpoi
 	for _, id := range []string{emuconst.APIDService, emuconst.ETCDService, emuconst.KubeletService} {
 		eg.Go(func() error {
 			return h.runWithRetries(ctx, logger, func() error {
-				return generateEvents(ctx, h, v1alpha1.NewService(id), client, func(res *v1alpha1.Service) (*events.EventRequest, error) {
-					id := xid.NewWithTime(res.Metadata().Updated())
-
-					state := "Stopped"
-
-					switch {
-					case res.TypedSpec().Running && res.TypedSpec().Healthy:
-						state = "Running"
-					case res.TypedSpec().Running && !res.TypedSpec().Healthy:
-						state = "Starting"
-					}
-
-					payload := &machine.ServiceEvent{
-						State: state,
-						Ts:    timestamppb.Now(),
-					}
-
-					data, err := anypb.New(payload)
-					if err != nil {
-						return nil, err
-					}
-
-					return &events.EventRequest{
-						Id:   id.String(),
-						Data: data,
-					}, nil
-				}, logger)
+				return generateEvents(ctx, h, v1alpha1.NewService(id), client, serviceEvent, logger)
 			})
 		})
 	}
 
 	eg.Go(func() error {
 		return h.runWithRetries(ctx, logger, func() error {
-			return generateEvents(ctx, h, runtime.NewMachineStatus(), client, func(res *runtime.MachineStatus) (*events.EventRequest, error) {
-				id := xid.NewWithTime(res.Metadata().Updated())
-
-				payload := &machine.MachineStatusEvent{
-					Stage: machine.MachineStatusEvent_MachineStage(res.TypedSpec().Stage),
-					Status: &machine.MachineStatusEvent_MachineStatus{
-						Ready: res.TypedSpec().Status.Ready,
-						UnmetConditions: xslices.Map(res.TypedSpec().Status.UnmetConditions, func(cond runtime.UnmetCondition) *machine.MachineStatusEvent_MachineStatus_UnmetCondition {
-							return &machine.MachineStatusEvent_MachineStatus_UnmetCondition{
-								Name:   cond.Name,
-								Reason: cond.Reason,
-							}
-						}),
-					},
-				}
+			return generateEvents(ctx, h, runtime.NewMachineStatus(), client, machineStatusEvent, logger)
+		})
+	})
 
-				logger.Debug("machine status event", zap.Reflect("payload", payload))
+	eg.Go(func() error {
+		return h.runWithRetries(ctx, logger, func() error {
+			return generateEvents(ctx, h, network.NewNodeAddress(network.NamespaceName, network.NodeAddressDefaultID), client, h.addressEvent, logger)
+		})
+	})
 
-				data, err := anypb.New(payload)
-				if err != nil {
-					return nil, err
+	// the sequence events are not backed by resources, so they are forwarded from the history while the sink is connected
+	eg.Go(func() error {
+		return h.runWithRetries(ctx, logger, func() error {
+			return h.history.Watch(ctx, WatchOptions{}, func(event *machine.Event) error {
+				if !event.GetData().MessageIs(&machine.SequenceEvent{}) {
+					return nil
 				}
 
-				return &events.EventRequest{
-					Id:   id.String(),
-					Data: data,
-				}, nil
-			}, logger)
+				_, err := client.Publish(ctx, &events.EventRequest{
+					Id:      event.GetId(),
+					Data:    event.GetData(),
+					ActorId: event.GetActorId(),
+				})
+
+				return err
+			})
 		})
 	})
 
 	return eg, nil
 }
 
+// recordHistory starts recording the resource events to the history.
+func (h *Handler) recordHistory(ctx context.Context, logger *zap.Logger, eg *errgroup.Group) {
+	for _, id := range []string{emuconst.APIDService, emuconst.ETCDService, emuconst.KubeletService} {
+		eg.Go(func() error {
+			return h.runWithRetries(ctx, logger, func() error {
+				return recordEvents(ctx, h, v1alpha1.NewService(id), serviceEvent)
+			})
+		})
+	}
+
+	eg.Go(func() error {
+		return h.runWithRetries(ctx, logger, func() error {
+			return recordEvents(ctx, h, runtime.NewMachineStatus(), machineStatusEvent)
+		})
+	})
+
+	eg.Go(func() error {
+		return h.runWithRetries(ctx, logger, func() error {
+			return recordEvents(ctx, h, network.NewNodeAddress(network.NamespaceName, network.NodeAddressDefaultID), h.addressEvent)
+		})
+	})
+}
+
+func serviceEvent(_ context.Context, res *v1alpha1.Service) (*events.EventRequest, error) {
+	id := xid.NewWithTime(res.Metadata().Updated())
+
+	state := "Stopped"
+
+	switch {
+	case res.TypedSpec().Running && res.TypedSpec().Healthy:
+		state = "Running"
+	case res.TypedSpec().Running && !res.TypedSpec().Healthy:
+		state = "Starting"
+	}
+
+	payload := &machine.ServiceEvent{
+		State: state,
+		Ts:    timestamppb.Now(),
+	}
+
+	data, err := anypb.New(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &events.EventRequest{
+		Id:   id.String(),
+		Data: data,
+	}, nil
+}
+
+func machineStatusEvent(_ context.Context, res *runtime.MachineStatus) (*events.EventRequest, error) {
+	id := xid.NewWithTime(res.Metadata().Updated())
+
+	payload := &machine.MachineStatusEvent{
+		Stage: machine.MachineStatusEvent_MachineStage(res.TypedSpec().Stage),
+		Status: &machine.MachineStatusEvent_MachineStatus{
+			Ready: res.TypedSpec().Status.Ready,
+			UnmetConditions: xslices.Map(res.TypedSpec().Status.UnmetConditions, func(cond runtime.UnmetCondition) *machine.MachineStatusEvent_MachineStatus_UnmetCondition {
+				return &machine.MachineStatusEvent_MachineStatus_UnmetCondition{
+					Name:   cond.Name,
+					Reason: cond.Reason,
+				}
+			}),
+		},
+	}
+
+	data, err := anypb.New(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &events.EventRequest{
+		Id:   id.String(),
+		Data: data,
+	}, nil
+}
+
+// addressEvent reports the node addresses together with the hostname, the same way Talos does.
+func (h *Handler) addressEvent(ctx context.Context, res *network.NodeAddress) (*events.EventRequest, error) {
+	id := xid.NewWithTime(res.Metadata().Updated())
+
+	payload := &machine.AddressEvent{
+		Addresses: xslices.Map(res.TypedSpec().Addresses, func(addr netip.Prefix) string {
+			return addr.Addr().String()
+		}),
+	}
+
+	hostname, err := safe.ReaderGetByID[*network.HostnameStatus](ctx, h.state, network.HostnameID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	if hostname != nil {
+		payload.Hostname = hostname.TypedSpec().FQDN()
+	}
+
+	data, err := anypb.New(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &events.EventRequest{
+		Id:   id.String(),
+		Data: data,
+	}, nil
+}
+
 func (h *Handler) runWithRetries(ctx context.Context, logger *zap.Logger, cb func() error) error {
 	backoff := time.Second
 
@@ -273,7 +362,9 @@ func (h *Handler) runWithRetries(ctx context.Context, logger *zap.Logger, cb fun
 }
 
 //nolint:gocognit,gocyclo,cyclop
-func generateEvents[T resource.Resource](ctx context.Context, h *Handler, res T, client events.EventSinkServiceClient, callback func(res T) (*events.EventRequest, error), logger *zap.Logger) error {
+func generateEvents[T resource.Resource](ctx context.Context, h *Handler, res T, client events.EventSinkServiceClient,
+	callback func(ctx context.Context, res T) (*events.EventRequest, error), logger *zap.Logger,
+) error {
 	latest, err := h.state.Get(ctx, res.Metadata())
 	if err != nil && !state.IsNotFoundError(err) {
 		return err
@@ -342,7 +433,7 @@ func generateEvents[T resource.Resource](ctx context.Context, h *Handler, res T,
 
 						var event *events.EventRequest
 
-						event, err = callback(res)
+						event, err = callback(ctx, res)
 						if err != nil {
 							return err
 						}
@@ -368,3 +459,52 @@ func generateEvents[T resource.Resource](ctx context.Context, h *Handler, res T,
 		}
 	}
 }
+
+// recordEvents appends an event to the history on each resource change.
+func recordEvents[T resource.Resource](ctx context.Context, h *Handler, res T, callback func(ctx context.Context, res T) (*events.EventRequest, error)) error {
+	eventCh := make(chan safe.WrappedStateEvent[T])
+
+	if err := safe.StateWatch(ctx, h.state, res.Metadata(), eventCh); err != nil {
+		return err
+	}
+
+	// the watch is restarted on errors, so the versions already recorded are skipped
+	var lastVersion uint64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-eventCh:
+			switch event.Type() {
+			case state.Errored:
+				return event.Error()
+			case state.Bootstrapped, state.Noop:
+			case state.Destroyed:
+				lastVersion = 0
+			case state.Created, state.Updated:
+				res, err := event.Resource()
+				if err != nil {
+					return err
+				}
+
+				version := res.Metadata().Version().Value()
+				if version <= lastVersion {
+					continue
+				}
+
+				lastVersion = version
+
+				request, err := callback(ctx, res)
+				if err != nil {
+					return err
+				}
+
+				h.history.Append(&machine.Event{
+					Id:   request.Id,
+					Data: request.Data,
+				})
+			}
+		}
+	}
+}
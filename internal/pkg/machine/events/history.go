@@ -0,0 +1,199 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/siderolabs/talos/pkg/machinery/api/common"
+	"github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// historyEvents is the number of the events the history keeps.
+const historyEvents = 1000
+
+// WatchOptions selects the past events sent before the new ones.
+//
+// Without any of the tail options only the new events are sent.
+type WatchOptions struct {
+	// TailID sends the events after the event with the ID, all kept events are sent if the event is gone.
+	TailID string
+	// ActorID filters the events by the actor.
+	ActorID string
+	// TailEvents is the number of the past events to send, all kept events are sent if it is negative.
+	TailEvents int
+	// TailSeconds sends the events of the last seconds.
+	TailSeconds int
+}
+
+// History keeps the recent events of the machine, the way machined keeps them for the Events API.
+type History struct {
+	// updated is closed and replaced on each event, so that the watchers wake up
+	updated chan struct{}
+	events  []*machine.Event
+	// written is the number of the events ever published
+	written int
+	mu      sync.Mutex
+}
+
+// NewHistory creates the empty event history.
+func NewHistory() *History {
+	return &History{
+		updated: make(chan struct{}),
+	}
+}
+
+// Append adds the event to the history.
+func (h *History) Append(event *machine.Event) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.events) < historyEvents {
+		h.events = append(h.events, event)
+	} else {
+		h.events[h.written%historyEvents] = event
+	}
+
+	h.written++
+
+	close(h.updated)
+	h.updated = make(chan struct{})
+}
+
+// Publish adds the new event of the actor with the payload to the history.
+func (h *History) Publish(actorID string, payload proto.Message) error {
+	if h == nil {
+		return nil
+	}
+
+	data, err := anypb.New(payload)
+	if err != nil {
+		return err
+	}
+
+	h.Append(&machine.Event{
+		Id:      xid.New().String(),
+		Data:    data,
+		ActorId: actorID,
+	})
+
+	return nil
+}
+
+// Sequence publishes the start of the sequence run by the actor, the returned function publishes its stop with the sequence error.
+func (h *History) Sequence(sequence, actorID string) func(err error) {
+	h.Publish(actorID, &machine.SequenceEvent{ //nolint:errcheck
+		Sequence: sequence,
+		Action:   machine.SequenceEvent_START,
+	})
+
+	return func(err error) {
+		event := &machine.SequenceEvent{
+			Sequence: sequence,
+			Action:   machine.SequenceEvent_STOP,
+		}
+
+		if err != nil {
+			event.Error = &common.Error{
+				Message: err.Error(),
+				Code:    common.Code_FATAL,
+			}
+		}
+
+		h.Publish(actorID, event) //nolint:errcheck
+	}
+}
+
+// Watch sends the past events selected by the options and then the new events until the context is done.
+func (h *History) Watch(ctx context.Context, opts WatchOptions, send func(event *machine.Event) error) error {
+	h.mu.Lock()
+
+	pos := h.tailPosition(opts)
+
+	for {
+		// the events could have been overwritten while the previous batch was sent
+		pos = max(pos, h.first())
+
+		batch := make([]*machine.Event, 0, h.written-pos)
+
+		for ; pos < h.written; pos++ {
+			if event := h.events[pos%historyEvents]; opts.ActorID == "" || event.ActorId == opts.ActorID {
+				batch = append(batch, event)
+			}
+		}
+
+		updated := h.updated
+
+		h.mu.Unlock()
+
+		for _, event := range batch {
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-updated:
+		}
+
+		h.mu.Lock()
+	}
+}
+
+// tailPosition returns the number of the first event to send.
+func (h *History) tailPosition(opts WatchOptions) int {
+	switch {
+	case opts.TailEvents < 0:
+		return h.first()
+	case opts.TailEvents > 0:
+		return max(h.first(), h.written-opts.TailEvents)
+	case opts.TailID != "":
+		for pos := h.written - 1; pos >= h.first(); pos-- {
+			if h.events[pos%historyEvents].Id == opts.TailID {
+				return pos + 1
+			}
+		}
+
+		return h.first()
+	case opts.TailSeconds > 0:
+		since := time.Now().Add(-time.Duration(opts.TailSeconds) * time.Second)
+
+		pos := h.written
+
+		for pos > h.first() && !eventTime(h.events[(pos-1)%historyEvents]).Before(since) {
+			pos--
+		}
+
+		return pos
+	default:
+		return h.written
+	}
+}
+
+// first returns the number of the oldest event kept.
+func (h *History) first() int {
+	return h.written - len(h.events)
+}
+
+// eventTime returns the time the event was generated at, encoded in the event ID.
+func eventTime(event *machine.Event) time.Time {
+	id, err := xid.FromString(event.Id)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return id.Time()
+}
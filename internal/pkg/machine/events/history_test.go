@@ -0,0 +1,88 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package events_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/events"
+)
+
+func TestHistoryTail(t *testing.T) {
+	t.Parallel()
+
+	history := events.NewHistory()
+
+	history.Sequence("boot", "")(nil)
+	history.Sequence("reboot", "actor")(nil)
+
+	// the watch sends the past events before it notices the context is done
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	read := func(opts events.WatchOptions) []*machine.Event {
+		var sent []*machine.Event
+
+		require.NoError(t, history.Watch(ctx, opts, func(event *machine.Event) error {
+			sent = append(sent, event)
+
+			return nil
+		}))
+
+		return sent
+	}
+
+	all := read(events.WatchOptions{TailEvents: -1})
+	require.Len(t, all, 4)
+
+	assert.Empty(t, read(events.WatchOptions{}))
+	assert.Len(t, read(events.WatchOptions{TailEvents: 3}), 3)
+	assert.Equal(t, all[2:], read(events.WatchOptions{TailID: all[1].Id}))
+	assert.Len(t, read(events.WatchOptions{TailSeconds: 60}), 4)
+	assert.Equal(t, all[2:], read(events.WatchOptions{TailEvents: -1, ActorID: "actor"}))
+
+	var sequence machine.SequenceEvent
+
+	require.NoError(t, all[3].Data.UnmarshalTo(&sequence))
+	assert.Equal(t, "reboot", sequence.Sequence)
+	assert.Equal(t, machine.SequenceEvent_STOP, sequence.Action)
+}
+
+func TestHistoryFollow(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	history := events.NewHistory()
+
+	sent := make(chan *machine.Event)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- history.Watch(ctx, events.WatchOptions{}, func(event *machine.Event) error {
+			sent <- event
+
+			return nil
+		})
+	}()
+
+	require.NoError(t, history.Publish("", &machine.AddressEvent{Hostname: "talos-1"}))
+
+	var address machine.AddressEvent
+
+	require.NoError(t, (<-sent).Data.UnmarshalTo(&address))
+	assert.Equal(t, "talos-1", address.Hostname)
+
+	cancel()
+
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,244 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package faults implements the fault injection into the emulated Talos API.
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v3"
+)
+
+// Targets of the fault rules.
+const (
+	// TargetAPID matches the calls on the apid router, which are the calls coming from Omni and talosctl.
+	TargetAPID = "apid"
+	// TargetMachined matches the calls on the local machined server, after the apid routing.
+	TargetMachined = "machined"
+)
+
+// Spec is the fault rules file.
+type Spec struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Rule describes a fault injected into the calls matching the method regex.
+//
+// The latency is added first, then the call either hangs, fails with the code, or has its stream dropped.
+type Rule struct {
+	// Machines limits the rule to the machine IDs, the rule applies to all machines if empty.
+	// It is only used in the rules file.
+	Machines []string `yaml:"machines,omitempty" json:"machines,omitempty"`
+	// Method is the regex matched against the full gRPC method name, e.g. "^/machine.MachineService/Upgrade$".
+	Method string `yaml:"method" json:"method"`
+	// Target is either apid or machined, defaults to apid.
+	Target string `yaml:"target,omitempty" json:"target,omitempty"`
+	// Code is the gRPC status code name returned from the call, e.g. "Unavailable".
+	Code string `yaml:"code,omitempty" json:"code,omitempty"`
+	// Message is the message of the returned status.
+	Message string `yaml:"message,omitempty" json:"message,omitempty"`
+	// Latency is added to the call before it is handled.
+	Latency Duration `yaml:"latency,omitempty" json:"latency,omitempty"`
+	// DropAfter drops the stream after sending that many messages, the call fails with the code, or Unavailable if the code is not set.
+	DropAfter int `yaml:"drop_after,omitempty" json:"drop_after,omitempty"`
+	// Probability is the chance of the rule to apply to a matching call, the rule always applies if it is zero.
+	Probability float64 `yaml:"probability,omitempty" json:"probability,omitempty"`
+	// Times limits the number of the calls the rule applies to, the rule is removed after that, zero means no limit.
+	Times int `yaml:"times,omitempty" json:"times,omitempty"`
+	// Hang blocks the call until the client gives up.
+	Hang bool `yaml:"hang,omitempty" json:"hang,omitempty"`
+}
+
+// Duration is the time.Duration which is encoded as a string, e.g. "1.5s".
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+
+	return nil
+}
+
+// Validate the rule.
+func (rule Rule) Validate() error {
+	var errs error
+
+	if rule.Method == "" {
+		errs = errors.Join(errs, errors.New("method is required"))
+	} else if _, err := regexp.Compile(rule.Method); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("invalid method regex: %w", err))
+	}
+
+	switch rule.Target {
+	case "", TargetAPID, TargetMachined:
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown target %q, should be %s or %s", rule.Target, TargetAPID, TargetMachined))
+	}
+
+	if rule.Code != "" {
+		if code, err := ParseCode(rule.Code); err != nil {
+			errs = errors.Join(errs, err)
+		} else if code == codes.OK {
+			errs = errors.Join(errs, errors.New("code OK is not a fault"))
+		}
+	}
+
+	if rule.Latency < 0 {
+		errs = errors.Join(errs, errors.New("latency can not be negative"))
+	}
+
+	if rule.DropAfter < 0 {
+		errs = errors.Join(errs, errors.New("drop_after can not be negative"))
+	}
+
+	if rule.Times < 0 {
+		errs = errors.Join(errs, errors.New("times can not be negative"))
+	}
+
+	if rule.Probability < 0 || rule.Probability > 1 {
+		errs = errors.Join(errs, errors.New("probability should be between 0 and 1"))
+	}
+
+	return errs
+}
+
+// ParseCode parses the gRPC status code name, the name is case-insensitive.
+func ParseCode(name string) (codes.Code, error) {
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if strings.EqualFold(code.String(), name) {
+			return code, nil
+		}
+	}
+
+	return codes.Unknown, fmt.Errorf("unknown gRPC code %q", name)
+}
+
+// Validate all rules.
+func Validate(rules []Rule) error {
+	var errs error
+
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("rule %d: %w", i, err))
+		}
+	}
+
+	return errs
+}
+
+// Load reads and validates the rules file.
+func Load(path string) (*Spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	spec, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fault rules file %q: %w", path, err)
+	}
+
+	return spec, nil
+}
+
+// Parse decodes and validates the rules file.
+func Parse(r io.Reader) (*Spec, error) {
+	var spec Spec
+
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&spec); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if err := Validate(spec.Rules); err != nil {
+		return nil, err
+	}
+
+	return &spec, nil
+}
+
+// Registry keeps the fault injectors of all machines.
+type Registry struct {
+	injectors map[string]*Injector
+	rules     []Rule
+	mu        sync.Mutex
+}
+
+// NewRegistry creates the registry, the machines get the rules from the spec matching their IDs.
+//
+// The spec can be nil.
+func NewRegistry(spec *Spec) *Registry {
+	registry := &Registry{
+		injectors: map[string]*Injector{},
+	}
+
+	if spec != nil {
+		registry.rules = spec.Rules
+	}
+
+	return registry
+}
+
+// Injector returns the fault injector of the machine, creating it if it doesn't exist.
+//
+// The injector outlives the machine runs, so the rules are kept through the reboots.
+func (registry *Registry) Injector(machineID string) *Injector {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if injector, ok := registry.injectors[machineID]; ok {
+		return injector
+	}
+
+	injector := NewInjector()
+
+	rules := make([]Rule, 0, len(registry.rules))
+
+	for _, rule := range registry.rules {
+		if len(rule.Machines) == 0 || slices.Contains(rule.Machines, machineID) {
+			rule.Machines = nil
+
+			rules = append(rules, rule)
+		}
+	}
+
+	// the file rules are validated when the file is parsed
+	injector.Set(rules) //nolint:errcheck
+
+	registry.injectors[machineID] = injector
+
+	return injector
+}
+
+// Forget removes the machine injector, so a new machine with the same ID starts with the file rules.
+func (registry *Registry) Forget(machineID string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	delete(registry.injectors, machineID)
+}
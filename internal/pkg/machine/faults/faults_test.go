@@ -0,0 +1,169 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package faults_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+)
+
+const rulesYAML = `rules:
+  - machines: ["1000"]
+    method: ^/machine.MachineService/Upgrade$
+    code: failedprecondition
+    message: upgrade is broken
+  - method: ^/machine.MachineService/Version$
+    latency: 50ms
+  - method: ^/machine.MachineService/Logs$
+    target: machined
+    drop_after: 1
+`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	spec, err := faults.Parse(strings.NewReader(rulesYAML))
+	require.NoError(t, err)
+	require.Len(t, spec.Rules, 3)
+
+	assert.Equal(t, faults.Duration(50*time.Millisecond), spec.Rules[1].Latency)
+
+	_, err = faults.Parse(strings.NewReader(`rules:
+  - method: "("
+    target: trustd
+    code: Broken
+    probability: 2
+`))
+	require.Error(t, err)
+
+	for _, msg := range []string{"invalid method regex", "unknown target", `unknown gRPC code "Broken"`, "probability"} {
+		assert.ErrorContains(t, err, msg)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	spec, err := faults.Parse(strings.NewReader(rulesYAML))
+	require.NoError(t, err)
+
+	registry := faults.NewRegistry(spec)
+
+	assert.Len(t, registry.Injector("1000").Rules(), 3)
+	assert.Len(t, registry.Injector("1001").Rules(), 2)
+
+	require.NoError(t, registry.Injector("1000").Set(nil))
+	assert.Empty(t, registry.Injector("1000").Rules())
+
+	registry.Forget("1000")
+	assert.Len(t, registry.Injector("1000").Rules(), 3)
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	spec, err := faults.Parse(strings.NewReader(rulesYAML))
+	require.NoError(t, err)
+
+	interceptor := faults.NewRegistry(spec).Injector("1000").UnaryServerInterceptor(faults.TargetAPID)
+
+	var called int
+
+	handler := func(context.Context, any) (any, error) {
+		called++
+
+		return "ok", nil
+	}
+
+	call := func(method string) error {
+		_, err := interceptor(t.Context(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+
+		return err
+	}
+
+	err = call("/machine.MachineService/Upgrade")
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, "upgrade is broken", status.Convert(err).Message())
+	assert.Zero(t, called)
+
+	start := time.Now()
+
+	require.NoError(t, call("/machine.MachineService/Version"))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, 1, called)
+
+	// the rule targets machined, so it doesn't match the apid calls
+	require.NoError(t, call("/machine.MachineService/Logs"))
+	assert.Equal(t, 2, called)
+}
+
+func TestHang(t *testing.T) {
+	t.Parallel()
+
+	injector := faults.NewInjector()
+
+	require.NoError(t, injector.Set([]faults.Rule{{Method: "Reboot", Hang: true}}))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := injector.UnaryServerInterceptor(faults.TargetAPID)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/machine.MachineService/Reboot"},
+		func(context.Context, any) (any, error) {
+			return nil, nil
+		},
+	)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+type stream struct {
+	grpc.ServerStream
+	ctx  context.Context //nolint:containedctx
+	sent []any
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stream) SendMsg(m any) error {
+	s.sent = append(s.sent, m)
+
+	return nil
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	t.Parallel()
+
+	spec, err := faults.Parse(strings.NewReader(rulesYAML))
+	require.NoError(t, err)
+
+	interceptor := faults.NewRegistry(spec).Injector("1001").StreamServerInterceptor(faults.TargetMachined)
+
+	ss := &stream{ctx: t.Context()}
+
+	err = interceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: "/machine.MachineService/Logs"}, func(_ any, ss grpc.ServerStream) error {
+		for i := range 3 {
+			if err := ss.SendMsg(i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, []any{0}, ss.sent)
+}
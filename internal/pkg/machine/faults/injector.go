@@ -0,0 +1,329 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package faults
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/siderolabs/talemu/internal/pkg/constants"
+)
+
+// Injector injects the faults into a single machine.
+//
+// The gRPC call rules can be changed at any time, the first rule matching the call applies.
+// Besides the calls, the injector can partition the machine from SideroLink and mark its services unhealthy,
+// the machine controllers watch the injector to apply these faults.
+type Injector struct {
+	unhealthy   map[string]struct{}
+	watchers    map[chan struct{}]struct{}
+	rules       []compiledRule
+	mu          sync.Mutex
+	partitioned bool
+}
+
+// services are the services which can be forced to report unhealthy.
+var services = []string{constants.ETCDService}
+
+type compiledRule struct {
+	method *regexp.Regexp
+	Rule
+	code      codes.Code
+	remaining int
+}
+
+// NewInjector creates the injector without any rules.
+func NewInjector() *Injector {
+	return &Injector{}
+}
+
+// Set replaces the rules of the injector.
+func (injector *Injector) Set(rules []Rule) error {
+	if err := Validate(rules); err != nil {
+		return err
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+
+	for _, rule := range rules {
+		c := compiledRule{
+			Rule:      rule,
+			method:    regexp.MustCompile(rule.Method),
+			code:      codes.Unavailable,
+			remaining: rule.Times,
+		}
+
+		if rule.Target == "" {
+			c.Target = TargetAPID
+		}
+
+		if rule.Code != "" {
+			c.code, _ = ParseCode(rule.Code) //nolint:errcheck
+		}
+
+		compiled = append(compiled, c)
+	}
+
+	injector.mu.Lock()
+	injector.rules = compiled
+	injector.mu.Unlock()
+
+	return nil
+}
+
+// SetPartitioned brings the SideroLink link of the machine down or up.
+func (injector *Injector) SetPartitioned(partitioned bool) {
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	if injector.partitioned == partitioned {
+		return
+	}
+
+	injector.partitioned = partitioned
+
+	injector.notify()
+}
+
+// Partitioned returns true if the machine is partitioned from SideroLink.
+func (injector *Injector) Partitioned() bool {
+	if injector == nil {
+		return false
+	}
+
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	return injector.partitioned
+}
+
+// SetServiceUnhealthy forces the service of the machine to report unhealthy.
+//
+// Only etcd is supported.
+func (injector *Injector) SetServiceUnhealthy(service string, unhealthy bool) error {
+	if !slices.Contains(services, service) {
+		return fmt.Errorf("unsupported service %q, the supported services are %s", service, strings.Join(services, ", "))
+	}
+
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	if _, ok := injector.unhealthy[service]; ok == unhealthy {
+		return nil
+	}
+
+	if unhealthy {
+		if injector.unhealthy == nil {
+			injector.unhealthy = map[string]struct{}{}
+		}
+
+		injector.unhealthy[service] = struct{}{}
+	} else {
+		delete(injector.unhealthy, service)
+	}
+
+	injector.notify()
+
+	return nil
+}
+
+// ServiceUnhealthy returns true if the service is forced to report unhealthy.
+func (injector *Injector) ServiceUnhealthy(service string) bool {
+	if injector == nil {
+		return false
+	}
+
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	_, ok := injector.unhealthy[service]
+
+	return ok
+}
+
+// Watch returns the channel which gets notified when the partition or the service health changes.
+//
+// The returned function stops the watch.
+func (injector *Injector) Watch() (<-chan struct{}, func()) {
+	if injector == nil {
+		return nil, func() {}
+	}
+
+	ch := make(chan struct{}, 1)
+
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	if injector.watchers == nil {
+		injector.watchers = map[chan struct{}]struct{}{}
+	}
+
+	injector.watchers[ch] = struct{}{}
+
+	return ch, func() {
+		injector.mu.Lock()
+		defer injector.mu.Unlock()
+
+		delete(injector.watchers, ch)
+	}
+}
+
+func (injector *Injector) notify() {
+	for ch := range injector.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Rules returns the current rules of the injector.
+func (injector *Injector) Rules() []Rule {
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	rules := make([]Rule, 0, len(injector.rules))
+
+	for _, rule := range injector.rules {
+		// report the calls left, so that setting the returned rules back doesn't reset the counters
+		rule.Times = rule.remaining
+
+		rules = append(rules, rule.Rule)
+	}
+
+	return rules
+}
+
+// UnaryServerInterceptor injects the faults into the unary calls of the target server.
+func (injector *Injector) UnaryServerInterceptor(target string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		rule, ok := injector.match(target, info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		if err := rule.delay(ctx); err != nil {
+			return nil, err
+		}
+
+		// a unary call has nothing to drop, so it just fails
+		if rule.Code != "" || rule.DropAfter > 0 {
+			return nil, rule.err()
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor injects the faults into the streaming calls of the target server.
+//
+// The apid router handles all calls as streams, so it is the only interceptor which applies to it.
+func (injector *Injector) StreamServerInterceptor(target string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		rule, ok := injector.match(target, info.FullMethod)
+		if !ok {
+			return handler(srv, ss)
+		}
+
+		if err := rule.delay(ss.Context()); err != nil {
+			return err
+		}
+
+		switch {
+		case rule.DropAfter > 0:
+			return handler(srv, &droppingStream{ServerStream: ss, rule: rule})
+		case rule.Code != "":
+			return rule.err()
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func (injector *Injector) match(target, method string) (compiledRule, bool) {
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+
+	idx := slices.IndexFunc(injector.rules, func(rule compiledRule) bool {
+		return rule.Target == target && rule.method.MatchString(method)
+	})
+	if idx == -1 {
+		return compiledRule{}, false
+	}
+
+	rule := injector.rules[idx]
+
+	if rule.Probability > 0 && rand.Float64() >= rule.Probability { //nolint:gosec
+		return compiledRule{}, false
+	}
+
+	if rule.Times > 0 {
+		injector.rules[idx].remaining--
+
+		if injector.rules[idx].remaining == 0 {
+			injector.rules = slices.Delete(injector.rules, idx, idx+1)
+		}
+	}
+
+	return rule, true
+}
+
+// delay adds the rule latency, and hangs the call if the rule says so.
+func (rule compiledRule) delay(ctx context.Context) error {
+	if rule.Latency > 0 {
+		timer := time.NewTimer(time.Duration(rule.Latency))
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
+	}
+
+	if rule.Hang {
+		<-ctx.Done()
+
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	return nil
+}
+
+func (rule compiledRule) err() error {
+	message := rule.Message
+	if message == "" {
+		message = "injected fault"
+	}
+
+	return status.Error(rule.code, message)
+}
+
+// droppingStream fails the stream after the rule number of messages is sent.
+type droppingStream struct {
+	grpc.ServerStream
+	rule compiledRule
+	sent int
+}
+
+func (s *droppingStream) SendMsg(m any) error {
+	if s.sent >= s.rule.DropAfter {
+		return s.rule.err()
+	}
+
+	s.sent++
+
+	return s.ServerStream.SendMsg(m)
+}
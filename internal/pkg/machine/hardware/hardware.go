@@ -0,0 +1,718 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package hardware implements pluggable hardware profiles of the emulated machines.
+package hardware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/siderolabs/talos/pkg/machinery/resources/block"
+	hardwareres "github.com/siderolabs/talos/pkg/machinery/resources/hardware"
+)
+
+// Disk types supported by the profile.
+const (
+	DiskTypeVirtio = "virtio"
+	DiskTypeNVMe   = "nvme"
+	DiskTypeSATA   = "sata"
+	DiskTypeUSB    = "usb"
+	DiskTypeCDROM  = "cdrom"
+)
+
+// NIC types supported by the profile.
+const (
+	NICTypeVirtio   = "virtio"
+	NICTypeIntel    = "intel"
+	NICTypeMellanox = "mellanox"
+)
+
+const (
+	mib = 1024 * 1024
+	gib = 1024 * mib
+
+	// firstNICSlot is the PCI slot of the first NIC, storage controllers are placed after the NICs, but not before firstStorageSlot.
+	firstNICSlot     = 0x01
+	firstStorageSlot = 0x05
+)
+
+// Profile describes the hardware of an emulated machine.
+//
+// The profile generates all hardware, disk, discovered volume and PCI device resources of the machine.
+type Profile struct {
+	System SystemInfo `yaml:"system"`
+	CPUs   []CPU      `yaml:"cpus"`
+	Memory []DIMM     `yaml:"memory"`
+	Disks  []Disk     `yaml:"disks"`
+	NICs   []NIC      `yaml:"nics"`
+}
+
+// SystemInfo is the SMBIOS system information.
+type SystemInfo struct {
+	Manufacturer string `yaml:"manufacturer"`
+	ProductName  string `yaml:"product_name"`
+	Version      string `yaml:"version"`
+	SerialNumber string `yaml:"serial_number"`
+	SKUNumber    string `yaml:"sku_number"`
+}
+
+// CPU is a single CPU socket.
+type CPU struct {
+	Manufacturer string `yaml:"manufacturer"`
+	ProductName  string `yaml:"product_name"`
+	SerialNumber string `yaml:"serial_number"`
+	CoreCount    uint32 `yaml:"core_count"`
+	ThreadCount  uint32 `yaml:"thread_count"`
+	// MaxSpeed is in megahertz.
+	MaxSpeed uint32 `yaml:"max_speed"`
+}
+
+// DIMM is a single memory module.
+type DIMM struct {
+	Manufacturer string `yaml:"manufacturer"`
+	SerialNumber string `yaml:"serial_number"`
+	// Size is in mebibytes.
+	Size  uint32 `yaml:"size"`
+	Speed uint32 `yaml:"speed"`
+}
+
+// Disk is a single block device.
+type Disk struct {
+	// Type is one of virtio, nvme, sata, usb and cdrom.
+	Type string `yaml:"type"`
+	// Name overrides the generated device name (e.g. vda, nvme0n1, sda, sr0).
+	Name     string `yaml:"name"`
+	Model    string `yaml:"model"`
+	Serial   string `yaml:"serial"`
+	WWID     string `yaml:"wwid"`
+	Modalias string `yaml:"modalias"`
+	// BusPath overrides the generated bus path.
+	BusPath    string `yaml:"bus_path"`
+	Size       uint64 `yaml:"size"`
+	Rotational bool   `yaml:"rotational"`
+	Readonly   bool   `yaml:"readonly"`
+	// System marks the disk Talos is booted from, defaults to the first virtio, NVMe or SATA disk.
+	System bool `yaml:"system"`
+}
+
+// NIC is a single network card.
+type NIC struct {
+	// Type is one of virtio, intel and mellanox.
+	Type string `yaml:"type"`
+	// Product overrides the product name of the card.
+	Product string `yaml:"product"`
+}
+
+// Default returns the hardware profile used when nothing else is configured.
+func Default() *Profile {
+	return &Profile{
+		System: SystemInfo{
+			Manufacturer: "qemu",
+			ProductName:  "Talos Emulator",
+		},
+		CPUs: []CPU{
+			{
+				Manufacturer: "qemu",
+				ProductName:  "Fake CPU",
+				CoreCount:    64,
+				ThreadCount:  2,
+				MaxSpeed:     4000,
+			},
+		},
+		Memory: []DIMM{
+			{
+				Manufacturer: "SideroLabs UltraMem",
+				Size:         64 * 1024,
+			},
+		},
+		Disks: []Disk{
+			{
+				Type:       DiskTypeVirtio,
+				Model:      "CM5514",
+				Size:       50 * gib,
+				Rotational: true,
+				BusPath:    "/pci0000:00/0000:00:05.0/0000:01:01.0/virtio2/host2/target2:0:0/2:0:0:0/",
+			},
+		},
+		NICs: []NIC{
+			{
+				Type: NICTypeVirtio,
+			},
+		},
+	}
+}
+
+// Validate the profile.
+func (p *Profile) Validate() error {
+	var errs error
+
+	if len(p.CPUs) == 0 {
+		errs = errors.Join(errs, errors.New("at least one CPU is required"))
+	}
+
+	if len(p.Memory) == 0 {
+		errs = errors.Join(errs, errors.New("at least one memory module is required"))
+	}
+
+	systemDisks := 0
+	systemIndex := p.systemDiskIndex()
+
+	for i, disk := range p.Disks {
+		switch disk.Type {
+		case DiskTypeVirtio, DiskTypeNVMe, DiskTypeSATA, DiskTypeUSB:
+			if i == systemIndex && disk.Size < minSystemDiskSize {
+				errs = errors.Join(errs, fmt.Errorf("disk %d: system disk should be at least %d bytes", i, uint64(minSystemDiskSize)))
+			}
+		case DiskTypeCDROM:
+			if disk.System {
+				errs = errors.Join(errs, fmt.Errorf("disk %d: CD-ROM can not be the system disk", i))
+			}
+		default:
+			errs = errors.Join(errs, fmt.Errorf("disk %d: unknown disk type %q", i, disk.Type))
+		}
+
+		if disk.System {
+			systemDisks++
+		}
+	}
+
+	if systemDisks > 1 {
+		errs = errors.Join(errs, errors.New("only one disk can be marked as the system disk"))
+	}
+
+	for i, nic := range p.NICs {
+		if _, ok := nicModels[nic.Type]; !ok {
+			errs = errors.Join(errs, fmt.Errorf("nic %d: unknown NIC type %q", i, nic.Type))
+		}
+	}
+
+	return errs
+}
+
+// Resources generates all hardware resources of the profile.
+func (p *Profile) Resources(uuid string) ([]resource.Resource, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	resources := make([]resource.Resource, 0, 16)
+
+	systemInformation := hardwareres.NewSystemInformation(hardwareres.SystemInformationID)
+	systemInformation.TypedSpec().UUID = uuid
+	systemInformation.TypedSpec().Manufacturer = p.System.Manufacturer
+	systemInformation.TypedSpec().ProductName = p.System.ProductName
+	systemInformation.TypedSpec().Version = p.System.Version
+	systemInformation.TypedSpec().SerialNumber = p.System.SerialNumber
+	systemInformation.TypedSpec().SKUNumber = p.System.SKUNumber
+
+	resources = append(resources, systemInformation)
+
+	for i, cpu := range p.CPUs {
+		processor := hardwareres.NewProcessorInfo(fmt.Sprintf("%d", i+1))
+		processor.TypedSpec().Socket = fmt.Sprintf("CPU %d", i)
+		processor.TypedSpec().Manufacturer = cpu.Manufacturer
+		processor.TypedSpec().ProductName = cpu.ProductName
+		processor.TypedSpec().SerialNumber = cpu.SerialNumber
+		processor.TypedSpec().CoreCount = cpu.CoreCount
+		processor.TypedSpec().CoreEnabled = cpu.CoreCount
+		processor.TypedSpec().ThreadCount = cpu.ThreadCount
+		processor.TypedSpec().MaxSpeed = cpu.MaxSpeed
+		processor.TypedSpec().BootSpeed = cpu.MaxSpeed
+
+		resources = append(resources, processor)
+	}
+
+	for i, dimm := range p.Memory {
+		memory := hardwareres.NewMemoryModuleInfo(fmt.Sprintf("%d", i+1))
+		memory.TypedSpec().Manufacturer = dimm.Manufacturer
+		memory.TypedSpec().SerialNumber = dimm.SerialNumber
+		memory.TypedSpec().Size = dimm.Size
+		memory.TypedSpec().Speed = dimm.Speed
+		memory.TypedSpec().DeviceLocator = fmt.Sprintf("DIMM %d", i)
+		memory.TypedSpec().BankLocator = fmt.Sprintf("BANK %d", i)
+
+		resources = append(resources, memory)
+	}
+
+	pciSlot := firstNICSlot
+
+	for _, nic := range p.NICs {
+		resources = append(resources, nicModels[nic.Type].device(pciAddress(pciSlot), nic.Product))
+
+		pciSlot++
+	}
+
+	pciSlot = max(pciSlot, firstStorageSlot)
+
+	disks, controllers := p.layoutDisks(pciSlot)
+
+	resources = append(resources, controllers...)
+
+	for _, disk := range disks {
+		resources = append(resources, disk.resources()...)
+	}
+
+	return resources, nil
+}
+
+// systemDiskIndex returns the index of the disk Talos is installed to, or -1 if there is none.
+func (p *Profile) systemDiskIndex() int {
+	if index := slices.IndexFunc(p.Disks, func(d Disk) bool { return d.System }); index != -1 {
+		return index
+	}
+
+	return slices.IndexFunc(p.Disks, func(d Disk) bool {
+		return d.Type == DiskTypeVirtio || d.Type == DiskTypeNVMe || d.Type == DiskTypeSATA
+	})
+}
+
+// laidOutDisk is a disk with the generated device name and bus location.
+type laidOutDisk struct {
+	Disk
+
+	busPath string
+	system  bool
+}
+
+// layoutDisks assigns device names and PCI controllers to the disks.
+//
+// Each virtio and NVMe disk gets its own PCI function, SATA disks and CD-ROMs share an AHCI controller,
+// and USB disks share an xHCI controller.
+func (p *Profile) layoutDisks(pciSlot int) ([]laidOutDisk, []resource.Resource) {
+	var (
+		disks       []laidOutDisk
+		controllers []resource.Resource
+		sharedSlots = map[string]int{}
+		virtio      int
+		nvme        int
+		scsi        int
+		cdrom       int
+	)
+
+	systemIndex := p.systemDiskIndex()
+
+	sharedController := func(diskType string) string {
+		slot, ok := sharedSlots[diskType]
+		if !ok {
+			slot = pciSlot
+			sharedSlots[diskType] = slot
+
+			pciSlot++
+
+			controllers = append(controllers, storageControllers[diskType].device(pciAddress(slot), ""))
+		}
+
+		return pciAddress(slot)
+	}
+
+	for i, disk := range p.Disks {
+		var (
+			name    string
+			busPath string
+		)
+
+		switch disk.Type {
+		case DiskTypeVirtio:
+			name = "vd" + driveLetters(virtio)
+			address := pciAddress(pciSlot)
+			busPath = fmt.Sprintf("/pci0000:00/%s/virtio%d/", address, virtio)
+
+			controllers = append(controllers, storageControllers[DiskTypeVirtio].device(address, ""))
+
+			pciSlot++
+			virtio++
+		case DiskTypeNVMe:
+			name = fmt.Sprintf("nvme%dn1", nvme)
+			address := pciAddress(pciSlot)
+			busPath = fmt.Sprintf("/pci0000:00/%s/nvme/nvme%d/nvme%dn1/", address, nvme, nvme)
+
+			controllers = append(controllers, storageControllers[DiskTypeNVMe].device(address, ""))
+
+			pciSlot++
+			nvme++
+		case DiskTypeSATA, DiskTypeCDROM:
+			address := sharedController(DiskTypeSATA)
+
+			if disk.Type == DiskTypeCDROM {
+				name = fmt.Sprintf("sr%d", cdrom)
+				cdrom++
+			} else {
+				name = "sd" + driveLetters(scsi)
+				scsi++
+			}
+
+			busPath = fmt.Sprintf("/pci0000:00/%s/ata%d/host%d/target%d:0:0/%d:0:0:0/", address, i+1, i, i, i)
+		case DiskTypeUSB:
+			address := sharedController(DiskTypeUSB)
+			name = "sd" + driveLetters(scsi)
+			busPath = fmt.Sprintf("/pci0000:00/%s/usb1/1-%d/1-%d:1.0/host%d/target%d:0:0/%d:0:0:0/", address, i+1, i+1, i, i, i)
+
+			scsi++
+		}
+
+		if disk.Name != "" {
+			name = disk.Name
+		}
+
+		if disk.BusPath != "" {
+			busPath = disk.BusPath
+		}
+
+		disk.Name = name
+
+		disks = append(disks, laidOutDisk{
+			Disk:    disk,
+			busPath: busPath,
+			system:  i == systemIndex,
+		})
+	}
+
+	return disks, controllers
+}
+
+func (d laidOutDisk) resources() []resource.Resource {
+	devPath := filepath.Join("/dev", d.Name)
+
+	transport := d.Type
+	modalias := d.Modalias
+	subsystem := "/sys/class/block"
+
+	switch d.Type {
+	case DiskTypeCDROM:
+		transport = DiskTypeSATA
+	case DiskTypeNVMe:
+		transport = "nvme"
+	}
+
+	if modalias == "" {
+		switch d.Type {
+		case DiskTypeVirtio:
+			modalias = "virtio:d00000002v00001AF4"
+		case DiskTypeNVMe:
+			modalias = "nvme:" + d.Name
+		case DiskTypeCDROM:
+			modalias = "scsi:t-0x05"
+		default:
+			modalias = "scsi:t-0x00"
+		}
+	}
+
+	readonly := d.Readonly || d.Type == DiskTypeCDROM
+
+	disk := block.NewDisk(block.NamespaceName, d.Name)
+	disk.TypedSpec().DevPath = devPath
+	disk.TypedSpec().SetSize(d.Size)
+	disk.TypedSpec().IOSize = 512
+	disk.TypedSpec().SectorSize = 512
+	disk.TypedSpec().Model = d.Model
+	disk.TypedSpec().Serial = d.Serial
+	disk.TypedSpec().WWID = d.WWID
+	disk.TypedSpec().Modalias = modalias
+	disk.TypedSpec().Transport = transport
+	disk.TypedSpec().SubSystem = subsystem
+	disk.TypedSpec().Rotational = d.Rotational
+	disk.TypedSpec().Readonly = readonly
+	disk.TypedSpec().CDROM = d.Type == DiskTypeCDROM
+	disk.TypedSpec().BusPath = d.busPath
+
+	discovered := block.NewDiscoveredVolume(block.NamespaceName, d.Name)
+	discovered.TypedSpec().Type = "disk"
+	discovered.TypedSpec().DevPath = devPath
+	discovered.TypedSpec().DevicePath = devPath
+	discovered.TypedSpec().Name = d.Name
+	discovered.TypedSpec().SetSize(d.Size)
+	discovered.TypedSpec().SectorSize = 512
+	discovered.TypedSpec().IOSize = 512
+
+	resources := []resource.Resource{disk, discovered}
+
+	if d.system {
+		resources = append(resources, d.systemPartitions(devPath)...)
+	}
+
+	return resources
+}
+
+// minSystemDiskSize is the smallest disk which fits the Talos partitions with some room for EPHEMERAL.
+const minSystemDiskSize = 1 * gib
+
+// ephemeralOffset is the offset of the EPHEMERAL partition, it follows EFI, BOOT, META and STATE.
+const ephemeralOffset = 304 * mib
+
+// systemPartitions generates the Talos partition layout on the system disk.
+func (d laidOutDisk) systemPartitions(devPath string) []resource.Resource {
+	partitions := []struct {
+		label  string
+		offset uint64
+		size   uint64
+	}{
+		{"EFI", 1 * mib, 100 * mib},
+		{"BOOT", 101 * mib, 100 * mib},
+		{"META", 202 * mib, 2 * mib},
+		{"STATE", 204 * mib, 100 * mib},
+		{"EPHEMERAL", ephemeralOffset, d.Size - ephemeralOffset},
+	}
+
+	resources := make([]resource.Resource, 0, len(partitions)+2)
+
+	for i, partition := range partitions {
+		name := partitionName(d.Name, i+1)
+		partPath := filepath.Join("/dev", name)
+
+		discovered := block.NewDiscoveredVolume(block.NamespaceName, name)
+		discovered.TypedSpec().Type = "part"
+		discovered.TypedSpec().DevPath = partPath
+		discovered.TypedSpec().DevicePath = partPath
+		discovered.TypedSpec().Parent = d.Name
+		discovered.TypedSpec().ParentDevPath = devPath
+		discovered.TypedSpec().Name = name
+		discovered.TypedSpec().PartitionLabel = partition.label
+		discovered.TypedSpec().PartitionIndex = uint(i + 1)
+		discovered.TypedSpec().Offset = partition.offset
+		discovered.TypedSpec().SetSize(partition.size)
+
+		resources = append(resources, discovered)
+
+		var mountLocation string
+
+		switch partition.label {
+		case "STATE":
+			mountLocation = "/system/state"
+		case "EPHEMERAL":
+			mountLocation = "/var"
+		default:
+			continue
+		}
+
+		volume := block.NewVolumeStatus(block.NamespaceName, partition.label)
+		volume.TypedSpec().Phase = block.VolumePhaseReady
+		volume.TypedSpec().Type = block.VolumeTypePartition
+		volume.TypedSpec().Location = partPath
+		volume.TypedSpec().MountLocation = mountLocation
+		volume.TypedSpec().ParentLocation = devPath
+		volume.TypedSpec().PartitionIndex = i + 1
+		volume.TypedSpec().Filesystem = block.FilesystemTypeXFS
+		volume.TypedSpec().SetSize(partition.size)
+
+		resources = append(resources, volume)
+	}
+
+	return resources
+}
+
+// pciModel is the PCI identity of an emulated device.
+type pciModel struct {
+	class, subclass, vendor, product         string
+	classID, subclassID, vendorID, productID string
+	driver                                   string
+}
+
+func (m pciModel) device(address, product string) *hardwareres.PCIDevice {
+	if product == "" {
+		product = m.product
+	}
+
+	device := hardwareres.NewPCIDeviceInfo(address)
+	device.TypedSpec().Class = m.class
+	device.TypedSpec().Subclass = m.subclass
+	device.TypedSpec().Vendor = m.vendor
+	device.TypedSpec().Product = product
+	device.TypedSpec().ClassID = m.classID
+	device.TypedSpec().SubclassID = m.subclassID
+	device.TypedSpec().VendorID = m.vendorID
+	device.TypedSpec().ProductID = m.productID
+	device.TypedSpec().Driver = m.driver
+
+	return device
+}
+
+var nicModels = map[string]pciModel{
+	NICTypeVirtio: {
+		class: "Network controller", subclass: "Ethernet controller", vendor: "Red Hat, Inc.", product: "Virtio network device",
+		classID: "0x02", subclassID: "0x00", vendorID: "0x1af4", productID: "0x1000", driver: "virtio-pci",
+	},
+	NICTypeIntel: {
+		class: "Network controller", subclass: "Ethernet controller", vendor: "Intel Corporation", product: "I350 Gigabit Network Connection",
+		classID: "0x02", subclassID: "0x00", vendorID: "0x8086", productID: "0x1521", driver: "igb",
+	},
+	NICTypeMellanox: {
+		class: "Network controller", subclass: "Ethernet controller", vendor: "Mellanox Technologies", product: "MT27800 Family [ConnectX-5]",
+		classID: "0x02", subclassID: "0x00", vendorID: "0x15b3", productID: "0x1017", driver: "mlx5_core",
+	},
+}
+
+var storageControllers = map[string]pciModel{
+	DiskTypeVirtio: {
+		class: "Mass storage controller", subclass: "SCSI storage controller", vendor: "Red Hat, Inc.", product: "Virtio block device",
+		classID: "0x01", subclassID: "0x00", vendorID: "0x1af4", productID: "0x1001", driver: "virtio-pci",
+	},
+	DiskTypeNVMe: {
+		class: "Mass storage controller", subclass: "Non-Volatile memory controller", vendor: "Samsung Electronics Co Ltd", product: "NVMe SSD Controller PM9A1/PM9A3/980PRO",
+		classID: "0x01", subclassID: "0x08", vendorID: "0x144d", productID: "0xa80a", driver: "nvme",
+	},
+	DiskTypeSATA: {
+		class: "Mass storage controller", subclass: "SATA controller", vendor: "Intel Corporation", product: "82801IR/IO/IH (ICH9R/DO/DH) 6 port SATA Controller [AHCI mode]",
+		classID: "0x01", subclassID: "0x06", vendorID: "0x8086", productID: "0x2922", driver: "ahci",
+	},
+	DiskTypeUSB: {
+		class: "Serial bus controller", subclass: "USB controller", vendor: "Red Hat, Inc.", product: "QEMU XHCI Host Controller",
+		classID: "0x0c", subclassID: "0x03", vendorID: "0x1b36", productID: "0x000d", driver: "xhci_hcd",
+	},
+}
+
+// Totals are the aggregated capacities of the machine hardware.
+type Totals struct {
+	// Cores is the number of CPU cores across all sockets.
+	Cores uint32
+	// MemoryBytes is the total size of all memory modules.
+	MemoryBytes uint64
+}
+
+// ReadTotals computes the machine capacities from the hardware resources.
+//
+// Machines without the hardware resources report the capacities of the default profile.
+func ReadTotals(ctx context.Context, r controller.Reader) (Totals, error) {
+	processors, err := safe.ReaderListAll[*hardwareres.Processor](ctx, r)
+	if err != nil {
+		return Totals{}, err
+	}
+
+	memoryModules, err := safe.ReaderListAll[*hardwareres.MemoryModule](ctx, r)
+	if err != nil {
+		return Totals{}, err
+	}
+
+	var totals Totals
+
+	for processor := range processors.All() {
+		totals.Cores += processor.TypedSpec().CoreCount
+	}
+
+	for module := range memoryModules.All() {
+		totals.MemoryBytes += uint64(module.TypedSpec().Size) * mib
+	}
+
+	defaults := Default()
+
+	if totals.Cores == 0 {
+		totals.Cores = defaults.CPUs[0].CoreCount
+	}
+
+	if totals.MemoryBytes == 0 {
+		totals.MemoryBytes = uint64(defaults.Memory[0].Size) * mib
+	}
+
+	return totals, nil
+}
+
+// Inventory is the hardware of the machine the way the kernel discovers it on boot.
+type Inventory struct {
+	System SystemInfo
+	// EphemeralPartition is the device name of the EPHEMERAL partition, empty if there is no system disk.
+	EphemeralPartition string
+	Disks              []InventoryDisk
+	NICs               []InventoryNIC
+	Cores              uint32
+	MemoryBytes        uint64
+}
+
+// InventoryDisk is a block device of the inventory.
+type InventoryDisk struct {
+	Name string
+	Type string
+	Size uint64
+}
+
+// InventoryNIC is a network card of the inventory.
+type InventoryNIC struct {
+	// Link is the name of the link, the links are named in the order of the cards.
+	Link    string
+	Address string
+	Driver  string
+	Product string
+}
+
+// Inventory returns the hardware of the profile, the device names are the same as in the generated resources.
+func (p *Profile) Inventory() Inventory {
+	inventory := Inventory{
+		System: p.System,
+	}
+
+	for _, cpu := range p.CPUs {
+		inventory.Cores += cpu.CoreCount
+	}
+
+	for _, dimm := range p.Memory {
+		inventory.MemoryBytes += uint64(dimm.Size) * mib
+	}
+
+	pciSlot := firstNICSlot
+
+	for i, nic := range p.NICs {
+		model := nicModels[nic.Type]
+
+		product := nic.Product
+		if product == "" {
+			product = model.product
+		}
+
+		inventory.NICs = append(inventory.NICs, InventoryNIC{
+			Link:    fmt.Sprintf("eth%d", i),
+			Address: pciAddress(pciSlot),
+			Driver:  model.driver,
+			Product: product,
+		})
+
+		pciSlot++
+	}
+
+	disks, _ := p.layoutDisks(max(pciSlot, firstStorageSlot))
+
+	for _, disk := range disks {
+		inventory.Disks = append(inventory.Disks, InventoryDisk{
+			Name: disk.Name,
+			Type: disk.Type,
+			Size: disk.Size,
+		})
+
+		if disk.system {
+			// EPHEMERAL is the last of the five Talos partitions
+			inventory.EphemeralPartition = partitionName(disk.Name, 5)
+		}
+	}
+
+	return inventory
+}
+
+func pciAddress(slot int) string {
+	return fmt.Sprintf("0000:00:%02x.0", slot)
+}
+
+// partitionName builds the partition device name, NVMe partitions have the "p" separator.
+func partitionName(disk string, index int) string {
+	last := disk[len(disk)-1]
+	if last >= '0' && last <= '9' {
+		return fmt.Sprintf("%sp%d", disk, index)
+	}
+
+	return fmt.Sprintf("%s%d", disk, index)
+}
+
+// driveLetters converts the drive index into the Linux drive suffix: a, b, ..., z, aa, ab, ...
+func driveLetters(index int) string {
+	var suffix []byte
+
+	for index++; index > 0; index = (index - 1) / 26 {
+		suffix = append([]byte{byte('a' + (index-1)%26)}, suffix...)
+	}
+
+	return string(suffix)
+}
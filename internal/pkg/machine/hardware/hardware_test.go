@@ -0,0 +1,190 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package hardware_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/siderolabs/talos/pkg/machinery/resources/block"
+	hardwareres "github.com/siderolabs/talos/pkg/machinery/resources/hardware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/hardware"
+)
+
+func byID[T resource.Resource](resources []resource.Resource) map[resource.ID]T {
+	result := map[resource.ID]T{}
+
+	for _, r := range resources {
+		if typed, ok := r.(T); ok {
+			result[r.Metadata().ID()] = typed
+		}
+	}
+
+	return result
+}
+
+func TestDefault(t *testing.T) {
+	t.Parallel()
+
+	resources, err := hardware.Default().Resources("uuid")
+	require.NoError(t, err)
+
+	disks := byID[*block.Disk](resources)
+	require.Len(t, disks, 1)
+	assert.Equal(t, "/pci0000:00/0000:00:05.0/0000:01:01.0/virtio2/host2/target2:0:0/2:0:0:0/", disks["vda"].TypedSpec().BusPath)
+	assert.EqualValues(t, 50*1024*1024*1024, disks["vda"].TypedSpec().Size)
+
+	volumes := byID[*block.DiscoveredVolume](resources)
+	assert.Equal(t, "STATE", volumes["vda4"].TypedSpec().PartitionLabel)
+	assert.Equal(t, "EPHEMERAL", volumes["vda5"].TypedSpec().PartitionLabel)
+
+	statuses := byID[*block.VolumeStatus](resources)
+	assert.Equal(t, "/dev/vda4", statuses["STATE"].TypedSpec().Location)
+	assert.Equal(t, "/dev/vda5", statuses["EPHEMERAL"].TypedSpec().Location)
+
+	pciDevices := byID[*hardwareres.PCIDevice](resources)
+	require.Len(t, pciDevices, 2)
+	assert.Equal(t, "Virtio network device", pciDevices["0000:00:01.0"].TypedSpec().Product)
+	assert.Equal(t, "Virtio block device", pciDevices["0000:00:05.0"].TypedSpec().Product)
+
+	assert.Equal(t, "uuid", byID[*hardwareres.SystemInformation](resources)[hardwareres.SystemInformationID].TypedSpec().UUID)
+}
+
+func TestMixedDisks(t *testing.T) {
+	t.Parallel()
+
+	profile := hardware.Default()
+	profile.CPUs = append(profile.CPUs, profile.CPUs[0])
+	profile.NICs = []hardware.NIC{{Type: hardware.NICTypeIntel}, {Type: hardware.NICTypeIntel}, {Type: hardware.NICTypeMellanox}}
+	profile.Disks = []hardware.Disk{
+		{Type: hardware.DiskTypeUSB, Size: 16 * 1024 * 1024 * 1024, Serial: "usb-stick"},
+		{Type: hardware.DiskTypeSATA, Size: 500 * 1024 * 1024 * 1024, Model: "Samsung SSD 870", WWID: "naa.5002538f4132e5a1"},
+		{Type: hardware.DiskTypeNVMe, Size: 1024 * 1024 * 1024 * 1024, Model: "Samsung SSD 980", System: true},
+		{Type: hardware.DiskTypeNVMe, Size: 1024 * 1024 * 1024 * 1024},
+		{Type: hardware.DiskTypeCDROM},
+	}
+
+	resources, err := profile.Resources("uuid")
+	require.NoError(t, err)
+
+	disks := byID[*block.Disk](resources)
+	require.Len(t, disks, 5)
+
+	assert.Equal(t, "usb", disks["sda"].TypedSpec().Transport)
+	assert.Equal(t, "usb-stick", disks["sda"].TypedSpec().Serial)
+	assert.Equal(t, "sata", disks["sdb"].TypedSpec().Transport)
+	assert.Equal(t, "naa.5002538f4132e5a1", disks["sdb"].TypedSpec().WWID)
+	assert.Equal(t, "nvme", disks["nvme0n1"].TypedSpec().Transport)
+	assert.Equal(t, "/dev/nvme1n1", disks["nvme1n1"].TypedSpec().DevPath)
+	assert.True(t, disks["sr0"].TypedSpec().CDROM)
+	assert.True(t, disks["sr0"].TypedSpec().Readonly)
+
+	// the partitions are created only on the system disk
+	statuses := byID[*block.VolumeStatus](resources)
+	assert.Equal(t, "/dev/nvme0n1p5", statuses["EPHEMERAL"].TypedSpec().Location)
+	assert.Equal(t, "/dev/nvme0n1", statuses["EPHEMERAL"].TypedSpec().ParentLocation)
+
+	volumes := byID[*block.DiscoveredVolume](resources)
+	assert.Len(t, volumes, 5+5)
+
+	pciDevices := byID[*hardwareres.PCIDevice](resources)
+	// 3 NICs, the xHCI controller, the AHCI controller shared by SATA and CD-ROM, and 2 NVMe controllers
+	require.Len(t, pciDevices, 7)
+	assert.Equal(t, "igb", pciDevices["0000:00:01.0"].TypedSpec().Driver)
+	assert.Equal(t, "mlx5_core", pciDevices["0000:00:03.0"].TypedSpec().Driver)
+	assert.Equal(t, "xhci_hcd", pciDevices["0000:00:05.0"].TypedSpec().Driver)
+	assert.Equal(t, "ahci", pciDevices["0000:00:06.0"].TypedSpec().Driver)
+	assert.Equal(t, "nvme", pciDevices["0000:00:08.0"].TypedSpec().Driver)
+
+	assert.Len(t, byID[*hardwareres.Processor](resources), 2)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	profile := hardware.Default()
+	profile.Disks = []hardware.Disk{
+		{Type: "floppy"},
+		{Type: hardware.DiskTypeCDROM, System: true},
+	}
+	profile.NICs = []hardware.NIC{{Type: "tokenring"}}
+
+	_, err := profile.Resources("uuid")
+	require.Error(t, err)
+
+	assert.ErrorContains(t, err, `disk 0: unknown disk type "floppy"`)
+	assert.ErrorContains(t, err, "disk 1: CD-ROM can not be the system disk")
+	assert.ErrorContains(t, err, `nic 0: unknown NIC type "tokenring"`)
+
+	profile = hardware.Default()
+	profile.Disks[0].Size = 1024
+
+	_, err = profile.Resources("uuid")
+	assert.ErrorContains(t, err, "disk 0: system disk should be at least")
+}
+
+func TestReadTotals(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	totals, err := hardware.ReadTotals(ctx, st)
+	require.NoError(t, err)
+	assert.Equal(t, hardware.Totals{Cores: 64, MemoryBytes: 64 * 1024 * 1024 * 1024}, totals)
+
+	profile := hardware.Default()
+	profile.CPUs = []hardware.CPU{{CoreCount: 8}, {CoreCount: 8}}
+	profile.Memory = []hardware.DIMM{{Size: 16 * 1024}, {Size: 16 * 1024}}
+
+	resources, err := profile.Resources("uuid")
+	require.NoError(t, err)
+
+	for _, r := range resources {
+		require.NoError(t, st.Create(ctx, r))
+	}
+
+	totals, err = hardware.ReadTotals(ctx, st)
+	require.NoError(t, err)
+	assert.Equal(t, hardware.Totals{Cores: 16, MemoryBytes: 32 * 1024 * 1024 * 1024}, totals)
+}
+
+func TestInventory(t *testing.T) {
+	t.Parallel()
+
+	profile := hardware.Default()
+	profile.CPUs = []hardware.CPU{{CoreCount: 8}, {CoreCount: 8}}
+	profile.NICs = []hardware.NIC{{Type: hardware.NICTypeIntel}, {Type: hardware.NICTypeMellanox, Product: "ConnectX-6"}}
+	profile.Disks = []hardware.Disk{
+		{Type: hardware.DiskTypeCDROM},
+		{Type: hardware.DiskTypeNVMe, Size: 1024 * 1024 * 1024 * 1024},
+	}
+
+	inventory := profile.Inventory()
+
+	assert.EqualValues(t, 16, inventory.Cores)
+	assert.EqualValues(t, 64*1024*1024*1024, inventory.MemoryBytes)
+	assert.Equal(t, "Talos Emulator", inventory.System.ProductName)
+	assert.Equal(t, []hardware.InventoryNIC{
+		{Link: "eth0", Address: "0000:00:01.0", Driver: "igb", Product: "I350 Gigabit Network Connection"},
+		{Link: "eth1", Address: "0000:00:02.0", Driver: "mlx5_core", Product: "ConnectX-6"},
+	}, inventory.NICs)
+	assert.Equal(t, []hardware.InventoryDisk{
+		{Name: "sr0", Type: hardware.DiskTypeCDROM},
+		{Name: "nvme0n1", Type: hardware.DiskTypeNVMe, Size: 1024 * 1024 * 1024 * 1024},
+	}, inventory.Disks)
+	assert.Equal(t, "nvme0n1p5", inventory.EphemeralPartition)
+
+	profile.Disks = []hardware.Disk{{Type: hardware.DiskTypeCDROM}}
+
+	assert.Empty(t, profile.Inventory().EphemeralPartition)
+}
@@ -0,0 +1,459 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	emuconst "github.com/siderolabs/talemu/internal/pkg/constants"
+	"github.com/siderolabs/talemu/internal/pkg/machine/hardware"
+)
+
+// kmsgMessages is the number of the messages the kernel ring buffer keeps.
+const kmsgMessages = 4096
+
+// Kernel message facilities.
+const (
+	KmsgFacilityKern = "kern"
+	KmsgFacilityUser = "user"
+)
+
+// Kernel message priorities.
+const (
+	KmsgPriorityErr     = "err"
+	KmsgPriorityWarning = "warning"
+	KmsgPriorityNotice  = "notice"
+	KmsgPriorityInfo    = "info"
+	KmsgPriorityDebug   = "debug"
+)
+
+// KmsgMessage is a single message of the kernel ring buffer.
+type KmsgMessage struct {
+	Timestamp time.Time
+	Facility  string
+	Priority  string
+	Message   string
+	// Clock is the time since the boot.
+	Clock time.Duration
+	// Sequence is the number of the message within the boot.
+	Sequence int
+}
+
+// String renders the message the way talosctl dmesg prints it.
+func (msg KmsgMessage) String() string {
+	return fmt.Sprintf("%s: %7s: [%s]: %s\n", msg.Facility, msg.Priority, msg.Timestamp.Format(time.RFC3339Nano), msg.Message)
+}
+
+// LogEvent converts the message to the event in the Talos kmsg delivery format.
+func (msg KmsgMessage) LogEvent() *LogEvent {
+	return &LogEvent{
+		Msg:   msg.Message,
+		Time:  msg.Timestamp,
+		Level: kmsgPriorityLevel(msg.Priority),
+		Fields: map[string]any{
+			"facility": msg.Facility,
+			"seq":      msg.Sequence,
+			"clock":    msg.Clock.Microseconds(),
+			"priority": msg.Priority,
+		},
+	}
+}
+
+// Kmsg emulates the kernel ring buffer of the machine.
+//
+// The buffer is filled with the boot messages on each boot, the previous boot messages are lost.
+type Kmsg struct {
+	bootTime time.Time
+	// updated is closed and replaced on each write, so that the followers wake up
+	updated chan struct{}
+	// rebooted is closed and replaced on each boot, so that the followers stop
+	rebooted   chan struct{}
+	kernelArgs string
+	inventory  hardware.Inventory
+	messages   []KmsgMessage
+	// written is the number of the messages written since the boot
+	written int
+	mu      sync.Mutex
+}
+
+// NewKmsg creates the kernel ring buffer of the machine booted with the kernel args.
+//
+// The boot messages report the hardware of the inventory.
+func NewKmsg(kernelArgs string, inventory hardware.Inventory) *Kmsg {
+	kmsg := &Kmsg{
+		kernelArgs: kernelArgs,
+		inventory:  inventory,
+		updated:    make(chan struct{}),
+		rebooted:   make(chan struct{}),
+	}
+
+	kmsg.Reboot()
+
+	return kmsg
+}
+
+// Reboot clears the buffer and writes the boot messages.
+func (kmsg *Kmsg) Reboot() {
+	if kmsg == nil {
+		return
+	}
+
+	now := time.Now()
+
+	kmsg.mu.Lock()
+	defer kmsg.mu.Unlock()
+
+	kmsg.messages = nil
+	kmsg.written = 0
+
+	close(kmsg.rebooted)
+	kmsg.rebooted = make(chan struct{})
+
+	// the emulated boot takes about two seconds, so the boot messages are spread over that time
+	kmsg.bootTime = now.Add(-2 * time.Second)
+
+	for _, msg := range bootMessages(kmsg.kernelArgs, kmsg.inventory) {
+		kmsg.append(msg.facility, msg.priority, msg.clock, msg.message)
+	}
+}
+
+// Printf appends the message to the buffer.
+func (kmsg *Kmsg) Printf(facility, priority, format string, args ...any) {
+	if kmsg == nil {
+		return
+	}
+
+	message := fmt.Sprintf(format, args...)
+
+	kmsg.mu.Lock()
+	defer kmsg.mu.Unlock()
+
+	kmsg.append(facility, priority, time.Since(kmsg.bootTime), message)
+}
+
+// Stream sends the last tail messages of the buffer, all messages are sent if tail is negative.
+//
+// If follow is set, the new messages are sent as they are written until the context is done or the machine reboots.
+func (kmsg *Kmsg) Stream(ctx context.Context, tail int, follow bool, send func(msg KmsgMessage) error) error {
+	kmsg.mu.Lock()
+
+	rebooted := kmsg.rebooted
+
+	pos := kmsg.first()
+	if tail >= 0 {
+		pos = max(pos, kmsg.written-tail)
+	}
+
+	for {
+		if rebooted != kmsg.rebooted {
+			kmsg.mu.Unlock()
+
+			return nil
+		}
+
+		// the messages could have been overwritten while the previous batch was sent
+		pos = max(pos, kmsg.first())
+
+		batch := make([]KmsgMessage, 0, kmsg.written-pos)
+
+		for ; pos < kmsg.written; pos++ {
+			batch = append(batch, kmsg.messages[pos%kmsgMessages])
+		}
+
+		updated := kmsg.updated
+
+		kmsg.mu.Unlock()
+
+		for _, msg := range batch {
+			if err := send(msg); err != nil {
+				return err
+			}
+		}
+
+		if !follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-rebooted:
+			return nil
+		case <-updated:
+		}
+
+		kmsg.mu.Lock()
+	}
+}
+
+// Deliver sends the messages of each boot to the log senders until the context is done.
+//
+// A message is retried until all senders accept it, so that the messages are delivered in order.
+func (kmsg *Kmsg) Deliver(ctx context.Context, senders []*LogSender) error {
+	for ctx.Err() == nil {
+		err := kmsg.Stream(ctx, -1, true, func(msg KmsgMessage) error {
+			return deliver(ctx, senders, msg.LogEvent())
+		})
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ZapCore returns the zap core which writes the log entries into the buffer, the same way machined logs to the kernel log.
+func (kmsg *Kmsg) ZapCore(enabler zapcore.LevelEnabler) zapcore.Core {
+	return &kmsgCore{
+		LevelEnabler: enabler,
+		kmsg:         kmsg,
+		encoder: zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
+			MessageKey:       "msg",
+			ConsoleSeparator: " ",
+		}),
+	}
+}
+
+func (kmsg *Kmsg) append(facility, priority string, clock time.Duration, message string) {
+	msg := KmsgMessage{
+		Timestamp: kmsg.bootTime.Add(clock),
+		Facility:  facility,
+		Priority:  priority,
+		Message:   message,
+		Clock:     clock,
+		Sequence:  kmsg.written,
+	}
+
+	if len(kmsg.messages) < kmsgMessages {
+		kmsg.messages = append(kmsg.messages, msg)
+	} else {
+		kmsg.messages[kmsg.written%kmsgMessages] = msg
+	}
+
+	kmsg.written++
+
+	close(kmsg.updated)
+	kmsg.updated = make(chan struct{})
+}
+
+// first returns the number of the oldest message kept.
+func (kmsg *Kmsg) first() int {
+	return kmsg.written - len(kmsg.messages)
+}
+
+// deliver sends the event to each sender, the failed sends are retried until the context is done.
+func deliver(ctx context.Context, senders []*LogSender, event *LogEvent) error {
+	for _, sender := range senders {
+		for {
+			sendCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err := sender.Send(sendCtx, event)
+
+			cancel()
+
+			if err == nil {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+	}
+
+	return nil
+}
+
+// kmsgPriorityLevel maps the kernel message priority to the log level the same way Talos does.
+func kmsgPriorityLevel(priority string) zapcore.Level {
+	switch priority {
+	case KmsgPriorityWarning:
+		return zapcore.WarnLevel
+	case KmsgPriorityNotice, KmsgPriorityInfo:
+		return zapcore.InfoLevel
+	case KmsgPriorityDebug:
+		return zapcore.DebugLevel
+	default:
+		return zapcore.ErrorLevel
+	}
+}
+
+// kmsgCore writes the log entries into the kernel ring buffer.
+type kmsgCore struct {
+	zapcore.LevelEnabler
+
+	kmsg    *Kmsg
+	encoder zapcore.Encoder
+}
+
+// With implements zapcore.Core interface.
+func (core *kmsgCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &kmsgCore{
+		LevelEnabler: core.LevelEnabler,
+		kmsg:         core.kmsg,
+		encoder:      core.encoder.Clone(),
+	}
+
+	for _, field := range fields {
+		field.AddTo(clone.encoder)
+	}
+
+	return clone
+}
+
+// Check implements zapcore.Core interface.
+func (core *kmsgCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core.Enabled(entry.Level) {
+		return checked.AddCore(entry, core)
+	}
+
+	return checked
+}
+
+// Write implements zapcore.Core interface.
+func (core *kmsgCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := core.encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+
+	defer buf.Free()
+
+	priority := KmsgPriorityWarning
+	if entry.Level >= zapcore.ErrorLevel {
+		priority = KmsgPriorityErr
+	}
+
+	core.kmsg.Printf(KmsgFacilityUser, priority, "[talos] %s", strings.TrimSuffix(buf.String(), "\n"))
+
+	return nil
+}
+
+// Sync implements zapcore.Core interface.
+func (core *kmsgCore) Sync() error {
+	return nil
+}
+
+// virtioDriver is the driver of the virtio PCI devices.
+const virtioDriver = "virtio-pci"
+
+type bootMessage struct {
+	facility string
+	priority string
+	message  string
+	clock    time.Duration
+}
+
+// bootMessages returns the messages the kernel and the Talos initramfs write on boot.
+func bootMessages(kernelArgs string, inventory hardware.Inventory) []bootMessage {
+	kern := func(clock time.Duration, priority, message string) bootMessage {
+		return bootMessage{facility: KmsgFacilityKern, priority: priority, message: message, clock: clock}
+	}
+
+	talos := func(clock time.Duration, message string) bootMessage {
+		return bootMessage{facility: KmsgFacilityUser, priority: KmsgPriorityWarning, message: "[talos] " + message, clock: clock}
+	}
+
+	memoryKiB := inventory.MemoryBytes / 1024
+
+	messages := []bootMessage{
+		kern(0, KmsgPriorityNotice, "Linux version "+emuconst.KernelVersion+" (@buildkitsandbox) (gcc (GCC) 13.2.0, GNU ld (GNU Binutils) 2.42) #1 SMP PREEMPT_DYNAMIC"),
+		kern(0, KmsgPriorityInfo, "Command line: "+kernelArgs),
+		kern(0, KmsgPriorityInfo, "BIOS-provided physical RAM map:"),
+		kern(0, KmsgPriorityInfo, fmt.Sprintf("DMI: %s %s, BIOS 1.16.3-debian-1.16.3-2 04/01/2014", inventory.System.Manufacturer, inventory.System.ProductName)),
+		kern(0, KmsgPriorityInfo, "Hypervisor detected: KVM"),
+		// the kernel itself and the early allocations take a few percent of the memory
+		kern(12*time.Millisecond, KmsgPriorityInfo, fmt.Sprintf("Memory: %dK/%dK available", memoryKiB-memoryKiB/25, memoryKiB)),
+		kern(150*time.Millisecond, KmsgPriorityInfo, fmt.Sprintf("smpboot: Allowing %d CPUs, 0 hotplug CPUs", inventory.Cores)),
+		kern(420*time.Millisecond, KmsgPriorityNotice, "random: crng init done"),
+	}
+
+	// the virtio devices are numbered in the PCI order, the NICs come first
+	virtio := 0
+
+	for _, nic := range inventory.NICs {
+		if nic.Driver == virtioDriver {
+			virtio++
+		}
+	}
+
+	clock := 500 * time.Millisecond
+
+	for _, disk := range inventory.Disks {
+		messages = append(messages, kern(clock, KmsgPriorityNotice, diskMessage(disk, virtio)))
+
+		if disk.Type == hardware.DiskTypeVirtio {
+			virtio++
+		}
+
+		clock += time.Millisecond
+	}
+
+	virtio = 0
+	clock = 610 * time.Millisecond
+
+	for _, nic := range inventory.NICs {
+		messages = append(messages, kern(clock, KmsgPriorityInfo, nicMessage(nic, virtio)))
+
+		if nic.Driver == virtioDriver {
+			virtio++
+		}
+
+		clock += time.Millisecond
+	}
+
+	messages = append(messages,
+		kern(740*time.Millisecond, KmsgPriorityInfo, "Freeing unused kernel image (initmem) memory: 3164K"),
+		kern(741*time.Millisecond, KmsgPriorityInfo, "Run /init as init process"),
+		talos(780*time.Millisecond, "[initramfs] booting Talos"),
+		talos(790*time.Millisecond, "[initramfs] entering rootfs"),
+		talos(1100*time.Millisecond, "setting resolvers"),
+		talos(1300*time.Millisecond, "task setupLogger (1/1): done"),
+	)
+
+	if inventory.EphemeralPartition != "" {
+		messages = append(messages,
+			kern(1600*time.Millisecond, KmsgPriorityNotice, fmt.Sprintf("XFS (%s): Mounting V5 Filesystem", inventory.EphemeralPartition)),
+			kern(1700*time.Millisecond, KmsgPriorityInfo, fmt.Sprintf("XFS (%s): Ending clean mount", inventory.EphemeralPartition)),
+		)
+	}
+
+	return append(messages, talos(1900*time.Millisecond, "task startAllServices (1/1): waiting for 3 services"))
+}
+
+// diskMessage returns the message the block driver writes when the disk is attached.
+func diskMessage(disk hardware.InventoryDisk, virtio int) string {
+	if disk.Type == hardware.DiskTypeCDROM {
+		return fmt.Sprintf("sr 0:0:0:0: [%s] scsi3-mmc drive: 4x/4x cd/rw xa/form2 tray", disk.Name)
+	}
+
+	sectors := disk.Size / 512
+	size := fmt.Sprintf("%d 512-byte logical blocks: (%.1f GB/%.1f GiB)", sectors, float64(disk.Size)/1e9, float64(disk.Size)/(1<<30))
+
+	switch disk.Type {
+	case hardware.DiskTypeVirtio:
+		return fmt.Sprintf("virtio_blk virtio%d: [%s] %s", virtio, disk.Name, size)
+	case hardware.DiskTypeNVMe:
+		return fmt.Sprintf("nvme %s: %s", strings.TrimSuffix(disk.Name, "n1"), size)
+	default:
+		return fmt.Sprintf("sd 0:0:0:0: [%s] %s", disk.Name, size)
+	}
+}
+
+// nicMessage returns the message the network driver writes when the card is probed.
+func nicMessage(nic hardware.InventoryNIC, virtio int) string {
+	if nic.Driver == virtioDriver {
+		return fmt.Sprintf("virtio_net virtio%d %s: %s", virtio, nic.Link, nic.Product)
+	}
+
+	return fmt.Sprintf("%s %s %s: %s", nic.Driver, nic.Address, nic.Link, nic.Product)
+}
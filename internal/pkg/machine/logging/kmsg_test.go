@@ -0,0 +1,145 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logging_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/hardware"
+	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
+)
+
+func TestKmsgBoot(t *testing.T) {
+	t.Parallel()
+
+	profile := hardware.Default()
+	profile.CPUs[0].CoreCount = 4
+	profile.NICs = append(profile.NICs, hardware.NIC{Type: hardware.NICTypeIntel})
+
+	kmsg := logging.NewKmsg("console=ttyS0 talos.platform=metal", profile.Inventory())
+
+	read := func(tail int) []logging.KmsgMessage {
+		var messages []logging.KmsgMessage
+
+		require.NoError(t, kmsg.Stream(t.Context(), tail, false, func(msg logging.KmsgMessage) error {
+			messages = append(messages, msg)
+
+			return nil
+		}))
+
+		return messages
+	}
+
+	boot := read(-1)
+	require.NotEmpty(t, boot)
+	assert.True(t, strings.HasPrefix(boot[0].Message, "Linux version "), boot[0].Message)
+	assert.Equal(t, "Command line: console=ttyS0 talos.platform=metal", boot[1].Message)
+	assert.Empty(t, read(0))
+
+	var bootText strings.Builder
+
+	for _, msg := range boot {
+		bootText.WriteString(msg.String())
+	}
+
+	// the boot messages follow the hardware profile
+	assert.Contains(t, bootText.String(), "smpboot: Allowing 4 CPUs, 0 hotplug CPUs")
+	assert.Contains(t, bootText.String(), "Memory: 64424510K/67108864K available")
+	assert.Contains(t, bootText.String(), "virtio_blk virtio1: [vda] 104857600 512-byte logical blocks: (53.7 GB/50.0 GiB)")
+	assert.Contains(t, bootText.String(), "virtio_net virtio0 eth0: Virtio network device")
+	assert.Contains(t, bootText.String(), "igb 0000:00:02.0 eth1: I350 Gigabit Network Connection")
+	assert.Contains(t, bootText.String(), "XFS (vda5): Mounting V5 Filesystem")
+
+	for i, msg := range boot {
+		assert.Equal(t, i, msg.Sequence)
+	}
+
+	kmsg.Printf(logging.KmsgFacilityUser, logging.KmsgPriorityWarning, "[talos] reboot via API received")
+
+	last := read(1)
+	require.Len(t, last, 1)
+	assert.Equal(t, len(boot), last[0].Sequence)
+	assert.True(t, strings.HasPrefix(last[0].String(), "user: warning: ["), last[0].String())
+
+	event := last[0].LogEvent()
+	assert.Equal(t, zapcore.WarnLevel, event.Level)
+	assert.Equal(t, "user", event.Fields["facility"])
+	assert.Equal(t, "warning", event.Fields["priority"])
+	assert.Equal(t, len(boot), event.Fields["seq"])
+
+	kmsg.Reboot()
+
+	assert.Len(t, read(-1), len(boot))
+}
+
+func TestKmsgFollow(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	kmsg := logging.NewKmsg("", hardware.Default().Inventory())
+
+	messages := make(chan string)
+	done := make(chan error, 1)
+
+	kmsg.Printf(logging.KmsgFacilityKern, logging.KmsgPriorityInfo, "eth0: link up")
+
+	go func() {
+		done <- kmsg.Stream(ctx, 1, true, func(msg logging.KmsgMessage) error {
+			messages <- msg.Message
+
+			return nil
+		})
+	}()
+
+	assert.Equal(t, "eth0: link up", <-messages)
+
+	// the stream follows from the last message sent
+	kmsg.Printf(logging.KmsgFacilityKern, logging.KmsgPriorityInfo, "eth0: link down")
+
+	assert.Equal(t, "eth0: link down", <-messages)
+
+	// the reboot ends the stream, as the connection to the machine is lost
+	kmsg.Reboot()
+
+	require.NoError(t, <-done)
+}
+
+func TestKmsgZapCore(t *testing.T) {
+	t.Parallel()
+
+	kmsg := logging.NewKmsg("", hardware.Default().Inventory())
+	logger := zap.New(kmsg.ZapCore(zapcore.InfoLevel)).With(zap.String("component", "controller-runtime"))
+
+	logger.Debug("skipped")
+	logger.Info("controller starting", zap.String("controller", "network.LinkStatusController"))
+	logger.Error("controller failed")
+
+	var messages []logging.KmsgMessage
+
+	require.NoError(t, kmsg.Stream(t.Context(), 2, false, func(msg logging.KmsgMessage) error {
+		messages = append(messages, msg)
+
+		return nil
+	}))
+
+	require.Len(t, messages, 2)
+
+	assert.Equal(t, logging.KmsgFacilityUser, messages[0].Facility)
+	assert.Equal(t, logging.KmsgPriorityWarning, messages[0].Priority)
+	assert.Equal(t, `[talos] controller starting {"component": "controller-runtime", "controller": "network.LinkStatusController"}`, messages[0].Message)
+
+	assert.Equal(t, logging.KmsgPriorityErr, messages[1].Priority)
+	assert.Equal(t, `[talos] controller failed {"component": "controller-runtime"}`, messages[1].Message)
+}
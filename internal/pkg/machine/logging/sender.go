@@ -21,6 +21,7 @@ import (
 // LogSender writes zap logs to the remote destination.
 type LogSender struct {
 	conn      net.Conn
+	nc        *network.Client
 	endpoint  *url.URL
 	sema      chan struct{}
 	localAddr netip.Prefix
@@ -32,25 +33,20 @@ type LogSender struct {
 
 // NewLogSender returns log sender that sends logs in JSON over TCP (newline-delimited)
 // or UDP (one message per packet).
-func NewLogSender(endpoint *url.URL) *LogSender {
+func NewLogSender(endpoint *url.URL, nc *network.Client) *LogSender {
 	sema := make(chan struct{}, 1)
 	sema <- struct{}{}
 
 	return &LogSender{
 		endpoint: endpoint,
+		nc:       nc,
 
 		sema: sema,
 	}
 }
 
-func (j *LogSender) ready() bool {
-	j.mu.Lock()
-	defer j.mu.Unlock()
-
-	return j.iface != ""
-}
-
-func (j *LogSender) configure(iface string, localAddr netip.Prefix) {
+// Configure sets the interface and the address the sender connects from.
+func (j *LogSender) Configure(iface string, localAddr netip.Prefix) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
@@ -116,14 +112,9 @@ func (j *LogSender) Send(ctx context.Context, e *LogEvent) error {
 		j.conn = nil
 	}
 
-	var dialer net.Dialer
-
-	dialer.LocalAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(localAddr.Addr(), 0))
-	dialer.Control = network.BindToInterface(iface)
-
 	// Connect (or "connect" for UDP) if no connection is established already.
 	if j.conn == nil {
-		conn, err := dialer.DialContext(ctx, j.endpoint.Scheme, j.endpoint.Host)
+		conn, err := j.nc.DialContext(ctx, iface, localAddr.Addr(), j.endpoint.Scheme, j.endpoint.Host)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,198 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	emuconst "github.com/siderolabs/talemu/internal/pkg/constants"
+)
+
+// ErrServiceNotFound is returned when the service is not known to the logs.
+var ErrServiceNotFound = errors.New("service not found")
+
+// serviceLogLines is the number of the lines each service keeps.
+const serviceLogLines = 4096
+
+// ServiceLogs keeps the circular log buffers of the emulated machine services.
+//
+// The lines are formatted the way the real service writes them, so that talosctl logs shows the familiar output.
+type ServiceLogs struct {
+	services map[string]*serviceLog
+	mu       sync.Mutex
+}
+
+// serviceLog is the ring of the service log lines.
+type serviceLog struct {
+	// updated is closed and replaced on each write, so that the followers wake up
+	updated chan struct{}
+	lines   [][]byte
+	// written is the number of the lines ever written
+	written int
+}
+
+// NewServiceLogs creates the empty service log buffers.
+func NewServiceLogs() *ServiceLogs {
+	return &ServiceLogs{
+		services: map[string]*serviceLog{},
+	}
+}
+
+// Printf appends the line to the service log, the service buffer is created on the first write.
+func (logs *ServiceLogs) Printf(service, format string, args ...any) {
+	if logs == nil {
+		return
+	}
+
+	line := formatLine(service, time.Now(), fmt.Sprintf(format, args...))
+
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+
+	log := logs.service(service)
+
+	if len(log.lines) < serviceLogLines {
+		log.lines = append(log.lines, line)
+	} else {
+		log.lines[log.written%serviceLogLines] = line
+	}
+
+	log.written++
+
+	close(log.updated)
+	log.updated = make(chan struct{})
+}
+
+// Register creates the empty buffer of the service which hasn't written any lines yet,
+// so that its logs can be streamed and followed until the service writes them.
+func (logs *ServiceLogs) Register(service string) {
+	if logs == nil {
+		return
+	}
+
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+
+	logs.service(service)
+}
+
+// service returns the service buffer, creating it if needed, the lock should be held.
+func (logs *ServiceLogs) service(service string) *serviceLog {
+	log, ok := logs.services[service]
+	if !ok {
+		log = &serviceLog{
+			updated: make(chan struct{}),
+		}
+
+		logs.services[service] = log
+	}
+
+	return log
+}
+
+// Has returns true if the service has written any logs.
+func (logs *ServiceLogs) Has(service string) bool {
+	if logs == nil {
+		return false
+	}
+
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+
+	_, ok := logs.services[service]
+
+	return ok
+}
+
+// Stream sends the last tailLines lines of the service log, all lines are sent if tailLines is negative.
+//
+// If follow is set, the new lines are sent as they are written until the context is done.
+func (logs *ServiceLogs) Stream(ctx context.Context, service string, tailLines int, follow bool, send func(line []byte) error) error {
+	logs.mu.Lock()
+
+	log, ok := logs.services[service]
+	if !ok {
+		logs.mu.Unlock()
+
+		return fmt.Errorf("%w: %q", ErrServiceNotFound, service)
+	}
+
+	pos := log.first()
+	if tailLines >= 0 {
+		pos = max(pos, log.written-tailLines)
+	}
+
+	for {
+		// the lines could have been overwritten while the previous batch was sent
+		pos = max(pos, log.first())
+
+		batch := make([][]byte, 0, log.written-pos)
+
+		for ; pos < log.written; pos++ {
+			batch = append(batch, log.lines[pos%serviceLogLines])
+		}
+
+		updated := log.updated
+
+		logs.mu.Unlock()
+
+		for _, line := range batch {
+			if err := send(line); err != nil {
+				return err
+			}
+		}
+
+		if !follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-updated:
+		}
+
+		logs.mu.Lock()
+	}
+}
+
+// first returns the number of the oldest line kept.
+func (log *serviceLog) first() int {
+	return log.written - len(log.lines)
+}
+
+// formatLine renders the message in the log format of the service.
+func formatLine(service string, t time.Time, msg string) []byte {
+	switch service {
+	case emuconst.ETCDService:
+		line, err := json.Marshal(struct {
+			Level  string `json:"level"`
+			TS     string `json:"ts"`
+			Caller string `json:"caller"`
+			Msg    string `json:"msg"`
+		}{
+			Level:  "info",
+			TS:     t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+			Caller: "etcdserver/server.go:1",
+			Msg:    msg,
+		})
+		if err != nil {
+			return fmt.Appendf(nil, "%s\n", msg)
+		}
+
+		return append(line, '\n')
+	case emuconst.KubeletService:
+		return fmt.Appendf(nil, "I%s       1 kubelet.go:1] %s\n", t.UTC().Format("0102 15:04:05.000000"), msg)
+	case emuconst.MachinedService:
+		return fmt.Appendf(nil, "[talos] %s %s\n", t.UTC().Format("2006/01/02 15:04:05"), msg)
+	default:
+		return fmt.Appendf(nil, "%s %s\n", t.UTC().Format("2006/01/02 15:04:05"), msg)
+	}
+}
@@ -0,0 +1,124 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logging_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
+)
+
+func TestServiceLogsTail(t *testing.T) {
+	t.Parallel()
+
+	logs := logging.NewServiceLogs()
+
+	for i := range 5 {
+		logs.Printf("apid", "line %d", i)
+	}
+
+	read := func(tailLines int) []string {
+		var lines []string
+
+		require.NoError(t, logs.Stream(t.Context(), "apid", tailLines, false, func(line []byte) error {
+			lines = append(lines, string(line))
+
+			return nil
+		}))
+
+		return lines
+	}
+
+	assert.Len(t, read(-1), 5)
+	assert.Empty(t, read(0))
+
+	tail := read(2)
+	require.Len(t, tail, 2)
+	assert.True(t, strings.HasSuffix(tail[0], " line 3\n"), tail[0])
+	assert.True(t, strings.HasSuffix(tail[1], " line 4\n"), tail[1])
+
+	err := logs.Stream(t.Context(), "etcd", -1, false, func([]byte) error { return nil })
+	require.ErrorIs(t, err, logging.ErrServiceNotFound)
+}
+
+func TestServiceLogsFollow(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	logs := logging.NewServiceLogs()
+
+	logs.Printf("etcd", "added member")
+
+	lines := make(chan string)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- logs.Stream(ctx, "etcd", 1, true, func(line []byte) error {
+			lines <- string(line)
+
+			return nil
+		})
+	}()
+
+	assert.Contains(t, <-lines, `"msg":"added member"`)
+
+	logs.Printf("etcd", "serving client traffic")
+
+	assert.Contains(t, <-lines, `"msg":"serving client traffic"`)
+
+	cancel()
+
+	require.NoError(t, <-done)
+}
+
+func TestServiceLogsRegister(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	logs := logging.NewServiceLogs()
+
+	err := logs.Stream(ctx, "kubelet", -1, false, func([]byte) error { return nil })
+	require.ErrorIs(t, err, logging.ErrServiceNotFound)
+
+	logs.Register("kubelet")
+
+	// the registered service without the logs streams the empty log
+	require.NoError(t, logs.Stream(ctx, "kubelet", -1, false, func([]byte) error {
+		return assert.AnError
+	}))
+
+	lines := make(chan string)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- logs.Stream(ctx, "kubelet", -1, true, func(line []byte) error {
+			lines <- string(line)
+
+			return nil
+		})
+	}()
+
+	logs.Printf("kubelet", "node registered")
+
+	assert.Contains(t, <-lines, "] node registered\n")
+
+	// registering again keeps the written lines
+	logs.Register("kubelet")
+	assert.True(t, logs.Has("kubelet"))
+
+	cancel()
+
+	require.NoError(t, <-done)
+}
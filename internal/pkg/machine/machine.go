@@ -7,18 +7,18 @@ package machine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/netip"
 	"net/url"
+	"time"
 
 	"github.com/cosi-project/runtime/pkg/resource"
 	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/jsimonetti/rtnetlink"
 	"github.com/siderolabs/talos/pkg/machinery/nethelpers"
-	"github.com/siderolabs/talos/pkg/machinery/resources/block"
 	"github.com/siderolabs/talos/pkg/machinery/resources/config"
-	"github.com/siderolabs/talos/pkg/machinery/resources/hardware"
 	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
 	"github.com/siderolabs/talos/pkg/machinery/resources/network"
 	"github.com/siderolabs/talos/pkg/machinery/resources/runtime"
@@ -31,24 +31,18 @@ import (
 	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
 	"github.com/siderolabs/talemu/internal/pkg/machine/controllers"
 	"github.com/siderolabs/talemu/internal/pkg/machine/events"
+	"github.com/siderolabs/talemu/internal/pkg/machine/hardware"
 	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
+	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
 	machinenetwork "github.com/siderolabs/talemu/internal/pkg/machine/network"
 	truntime "github.com/siderolabs/talemu/internal/pkg/machine/runtime"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/talos"
+	"github.com/siderolabs/talemu/internal/pkg/machine/services"
 	"github.com/siderolabs/talemu/internal/pkg/schematic"
 )
 
-const (
-	diskDevName      = "vda"
-	diskDevPath      = "/dev/vda"
-	diskPartType     = "part"
-	stateDevPath     = "/dev/vda4"
-	ephemeralDevPath = "/dev/vda5"
-
-	diskSize        = 50 * 1024 * 1024 * 1024
-	ephemeralOffset = 304 * 1024 * 1024
-	ephemeralSize   = diskSize - ephemeralOffset
-)
+// ErrPoweredOff is returned by Run when the emulated machine powers itself off, e.g. after a reset without a reboot.
+var ErrPoweredOff = errors.New("the machine is powered off")
 
 // Machine is a single Talos machine.
 type Machine struct {
@@ -56,22 +50,27 @@ type Machine struct {
 	runtime           *truntime.Runtime
 	logger            *zap.Logger
 	shutdown          chan struct{}
+	powerOff          chan struct{}
 	schematicService  *schematic.Service
 	enterpriseChecker controllers.EnterpriseChecker
 	uuid              string
+	instance          truntime.Instance
+	isolatedNetwork   bool
 }
 
 // NewMachine creates a Machine.
 func NewMachine(uuid string, logger *zap.Logger, globalState state.State, schematicService *schematic.Service,
-	enterpriseChecker controllers.EnterpriseChecker,
+	enterpriseChecker controllers.EnterpriseChecker, instance truntime.Instance,
 ) (*Machine, error) {
 	return &Machine{
 		uuid:              uuid,
+		instance:          instance,
 		logger:            logger,
 		globalState:       globalState,
 		schematicService:  schematicService,
 		enterpriseChecker: enterpriseChecker,
 		shutdown:          make(chan struct{}, 1),
+		powerOff:          make(chan struct{}, 1),
 	}, nil
 }
 
@@ -87,30 +86,52 @@ func (m *Machine) Run(ctx context.Context, siderolinkParams *SideroLinkParams, s
 	}
 
 	if opts.nc == nil {
-		opts.nc = machinenetwork.NewClient()
+		switch {
+		case opts.userspaceNetwork:
+			opts.nc = machinenetwork.NewUserspaceClient()
+		case opts.networkNamespace:
+			nc, err := newNamespaceClient(m.instance.Bridge, slot)
+			if err != nil {
+				return fmt.Errorf("network namespace creation failed: %w", err)
+			}
+
+			opts.nc = nc
+		default:
+			opts.nc = machinenetwork.NewClient()
+		}
 
 		if err := opts.nc.Run(ctx); err != nil {
+			if ns := opts.nc.Namespace(); ns != nil {
+				ns.Close() //nolint:errcheck
+			}
+
 			return fmt.Errorf("netclient creation failed: %w", err)
 		}
 
 		defer opts.nc.Close() //nolint:errcheck
 	}
 
-	logSink, err := logging.NewZapCore(siderolinkParams.LogsEndpoint)
-	if err != nil {
-		return fmt.Errorf("log sink creation failed: %w", err)
-	}
+	m.isolatedNetwork = opts.nc.Userspace() != nil || opts.nc.Namespace() != nil
 
-	core := zapcore.NewTee(m.logger.Core(), logSink)
+	hardwareProfile := opts.hardwareProfile
+	if hardwareProfile == nil {
+		hardwareProfile = hardware.Default()
+	}
 
-	defer logSink.Close(ctx) //nolint:errcheck
+	// the kernel ring buffer is filled with the boot messages, it is rebooted together with the emulated reboots
+	kmsg := logging.NewKmsg(siderolinkParams.RawKernelArgs, hardwareProfile.Inventory())
 
 	// The internal machine identifier is derived from the unique slot rather than the UUID:
 	// UUIDs can be duplicated (e.g. when forcing UUID conflicts), and using them for per-machine
 	// state would make machines clobber each other's state directory and resources.
 	machineID := truntime.MachineID(slot)
 
-	m.logger = zap.New(core).With(zap.String("machine", machineID), zap.String("uuid", m.uuid))
+	// the machine logs go to the kernel log the same way as on Talos, so they are delivered to the kernel log endpoints,
+	// the machine identifiers are only needed in the emulator own logs
+	m.logger = zap.New(zapcore.NewTee(
+		m.logger.Core().With([]zap.Field{zap.String("machine", machineID), zap.String("uuid", m.uuid)}),
+		kmsg.ZapCore(zapcore.InfoLevel),
+	))
 
 	// the configured base URL is used as-is, so a plain-HTTP factory keeps working
 	bootFactoryURL := opts.bootFactoryURL
@@ -118,10 +139,21 @@ func (m *Machine) Run(ctx context.Context, siderolinkParams *SideroLinkParams, s
 		bootFactoryURL = m.schematicService.ImageFactoryBaseURL()
 	}
 
+	// the service logs start empty on each boot, as they are kept in memory by Talos
+	serviceLogs := logging.NewServiceLogs()
+
+	serviceLogs.Printf(constants.MachinedService, "Talos is booting, machine %s, UUID %s", machineID, m.uuid)
+
+	// the event history starts with the boot sequence, the machine is up right away
+	history := events.NewHistory()
+
+	history.Sequence("boot", "")(nil)
+
 	rt, err := truntime.NewRuntime(
-		ctx, m.logger, slot, machineID, m.globalState,
-		kubernetes, opts.nc, logSink, siderolinkParams.RawKernelArgs, m.schematicService,
-		m.enterpriseChecker, m.schematicService.ImageFactoryHost(), bootFactoryURL, opts.nodeProxyingDisabled,
+		ctx, m.logger, slot, machineID, m.instance, m.globalState,
+		kubernetes, opts.nc, serviceLogs, kmsg, history, siderolinkParams.RawKernelArgs, m.schematicService,
+		m.enterpriseChecker, m.schematicService.ImageFactoryHost(), bootFactoryURL, opts.nodeProxyingDisabled, opts.kubeControllers, opts.upgradeTimings,
+		opts.faultInjector, m.PowerOff,
 	)
 	if err != nil {
 		return fmt.Errorf("COSI runtime creation failed: %w", err)
@@ -129,14 +161,9 @@ func (m *Machine) Run(ctx context.Context, siderolinkParams *SideroLinkParams, s
 
 	m.runtime = rt
 
-	resources := make([]resource.Resource, 0, 11)
+	resources := make([]resource.Resource, 0, 32)
 
 	// populate the initial machine state
-	hardwareInformation := hardware.NewSystemInformation(hardware.SystemInformationID)
-	hardwareInformation.TypedSpec().UUID = m.uuid
-	hardwareInformation.TypedSpec().ProductName = "Talos Emulator"
-	hardwareInformation.TypedSpec().Manufacturer = "qemu"
-
 	siderolinkConfig := siderolink.NewConfig(config.NamespaceName, siderolink.ConfigID)
 	siderolinkConfig.TypedSpec().APIEndpoint = siderolinkParams.APIEndpoint
 	siderolinkConfig.TypedSpec().JoinToken = siderolinkParams.JoinToken
@@ -148,13 +175,6 @@ func (m *Machine) Run(ctx context.Context, siderolinkParams *SideroLinkParams, s
 	platformMetadata.TypedSpec().Platform = "metal"
 	platformMetadata.TypedSpec().Hostname = m.uuid
 
-	processorInfo := hardware.NewProcessorInfo("1")
-	processorInfo.TypedSpec().Manufacturer = "qemu"
-	processorInfo.TypedSpec().CoreCount = 64
-	processorInfo.TypedSpec().MaxSpeed = 4000
-	processorInfo.TypedSpec().ProductName = "Fake CPU"
-	processorInfo.TypedSpec().ThreadCount = 2
-
 	securityState := runtime.NewSecurityStateSpec(runtime.NamespaceName)
 	securityState.TypedSpec().SecureBoot = opts.secureBoot
 
@@ -181,152 +201,23 @@ func (m *Machine) Run(ctx context.Context, siderolinkParams *SideroLinkParams, s
 	defaultRoute.TypedSpec().Type = nethelpers.TypeAnycast
 	defaultRoute.TypedSpec().Protocol = nethelpers.ProtocolBoot
 
-	memory := hardware.NewMemoryModuleInfo("1")
-	memory.TypedSpec().Size = 64 * 1024
-	memory.TypedSpec().Manufacturer = "SideroLabs UltraMem"
-
-	disk := block.NewDisk(block.NamespaceName, diskDevName)
-	disk.TypedSpec().Size = diskSize
-	disk.TypedSpec().Model = "CM5514"
-	disk.TypedSpec().Transport = "virtio"
-	disk.TypedSpec().Rotational = true
-	disk.TypedSpec().BusPath = "/pci0000:00/0000:00:05.0/0000:01:01.0/virtio2/host2/target2:0:0/2:0:0:0/"
-
-	discoveredDisk := block.NewDiscoveredVolume(block.NamespaceName, diskDevName)
-	discoveredDisk.TypedSpec().Type = "disk"
-	discoveredDisk.TypedSpec().DevPath = diskDevPath
-	discoveredDisk.TypedSpec().DevicePath = diskDevPath
-	discoveredDisk.TypedSpec().Name = diskDevName
-	discoveredDisk.TypedSpec().SetSize(diskSize)
-	discoveredDisk.TypedSpec().SectorSize = 512
-	discoveredDisk.TypedSpec().IOSize = 512
-
-	discoveredEfi := block.NewDiscoveredVolume(block.NamespaceName, "vda1")
-	discoveredEfi.TypedSpec().Type = diskPartType
-	discoveredEfi.TypedSpec().DevPath = "/dev/vda1"
-	discoveredEfi.TypedSpec().DevicePath = "/dev/vda1"
-	discoveredEfi.TypedSpec().Parent = diskDevName
-	discoveredEfi.TypedSpec().ParentDevPath = diskDevPath
-	discoveredEfi.TypedSpec().Name = "vda1"
-	discoveredEfi.TypedSpec().PartitionLabel = "EFI"
-	discoveredEfi.TypedSpec().PartitionIndex = 1
-	discoveredEfi.TypedSpec().Offset = 1024 * 1024
-	discoveredEfi.TypedSpec().SetSize(100 * 1024 * 1024)
-
-	discoveredBoot := block.NewDiscoveredVolume(block.NamespaceName, "vda2")
-	discoveredBoot.TypedSpec().Type = diskPartType
-	discoveredBoot.TypedSpec().DevPath = "/dev/vda2"
-	discoveredBoot.TypedSpec().DevicePath = "/dev/vda2"
-	discoveredBoot.TypedSpec().Parent = diskDevName
-	discoveredBoot.TypedSpec().ParentDevPath = diskDevPath
-	discoveredBoot.TypedSpec().Name = "vda2"
-	discoveredBoot.TypedSpec().PartitionLabel = "BOOT"
-	discoveredBoot.TypedSpec().PartitionIndex = 2
-	discoveredBoot.TypedSpec().Offset = 101 * 1024 * 1024
-	discoveredBoot.TypedSpec().SetSize(100 * 1024 * 1024)
-
-	discoveredMeta := block.NewDiscoveredVolume(block.NamespaceName, "vda3")
-	discoveredMeta.TypedSpec().Type = diskPartType
-	discoveredMeta.TypedSpec().DevPath = "/dev/vda3"
-	discoveredMeta.TypedSpec().DevicePath = "/dev/vda3"
-	discoveredMeta.TypedSpec().Parent = diskDevName
-	discoveredMeta.TypedSpec().ParentDevPath = diskDevPath
-	discoveredMeta.TypedSpec().Name = "vda3"
-	discoveredMeta.TypedSpec().PartitionLabel = "META"
-	discoveredMeta.TypedSpec().PartitionIndex = 3
-	discoveredMeta.TypedSpec().Offset = 202 * 1024 * 1024
-	discoveredMeta.TypedSpec().SetSize(2 * 1024 * 1024)
-
-	discoveredState := block.NewDiscoveredVolume(block.NamespaceName, "vda4")
-	discoveredState.TypedSpec().Type = diskPartType
-	discoveredState.TypedSpec().DevPath = stateDevPath
-	discoveredState.TypedSpec().DevicePath = stateDevPath
-	discoveredState.TypedSpec().Parent = diskDevName
-	discoveredState.TypedSpec().ParentDevPath = diskDevPath
-	discoveredState.TypedSpec().Name = "vda4"
-	discoveredState.TypedSpec().PartitionLabel = "STATE"
-	discoveredState.TypedSpec().PartitionIndex = 4
-	discoveredState.TypedSpec().Offset = 204 * 1024 * 1024
-	discoveredState.TypedSpec().SetSize(100 * 1024 * 1024)
-
-	discoveredEphemeral := block.NewDiscoveredVolume(block.NamespaceName, "vda5")
-	discoveredEphemeral.TypedSpec().Type = diskPartType
-	discoveredEphemeral.TypedSpec().DevPath = ephemeralDevPath
-	discoveredEphemeral.TypedSpec().DevicePath = ephemeralDevPath
-	discoveredEphemeral.TypedSpec().Parent = diskDevName
-	discoveredEphemeral.TypedSpec().ParentDevPath = diskDevPath
-	discoveredEphemeral.TypedSpec().Name = "vda5"
-	discoveredEphemeral.TypedSpec().PartitionLabel = "EPHEMERAL"
-	discoveredEphemeral.TypedSpec().PartitionIndex = 5
-	discoveredEphemeral.TypedSpec().Offset = ephemeralOffset
-	discoveredEphemeral.TypedSpec().SetSize(ephemeralSize)
-
-	volumeState := block.NewVolumeStatus(block.NamespaceName, "STATE")
-	volumeState.TypedSpec().Phase = block.VolumePhaseReady
-	volumeState.TypedSpec().Type = block.VolumeTypePartition
-	volumeState.TypedSpec().Location = stateDevPath
-	volumeState.TypedSpec().MountLocation = "/system/state"
-	volumeState.TypedSpec().ParentLocation = diskDevPath
-	volumeState.TypedSpec().PartitionIndex = 4
-	volumeState.TypedSpec().Filesystem = block.FilesystemTypeXFS
-	volumeState.TypedSpec().SetSize(100 * 1024 * 1024)
-
-	volumeEphemeral := block.NewVolumeStatus(block.NamespaceName, "EPHEMERAL")
-	volumeEphemeral.TypedSpec().Phase = block.VolumePhaseReady
-	volumeEphemeral.TypedSpec().Type = block.VolumeTypePartition
-	volumeEphemeral.TypedSpec().Location = ephemeralDevPath
-	volumeEphemeral.TypedSpec().MountLocation = "/var"
-	volumeEphemeral.TypedSpec().ParentLocation = diskDevPath
-	volumeEphemeral.TypedSpec().PartitionIndex = 5
-	volumeEphemeral.TypedSpec().Filesystem = block.FilesystemTypeXFS
-	volumeEphemeral.TypedSpec().SetSize(ephemeralSize)
-
-	pciNet := hardware.NewPCIDeviceInfo("0000:00:01.0")
-	pciNet.TypedSpec().Class = "Network controller"
-	pciNet.TypedSpec().Subclass = "Ethernet controller"
-	pciNet.TypedSpec().Vendor = "Red Hat, Inc."
-	pciNet.TypedSpec().Product = "Virtio network device"
-	pciNet.TypedSpec().ClassID = "0x02"
-	pciNet.TypedSpec().SubclassID = "0x00"
-	pciNet.TypedSpec().VendorID = "0x1af4"
-	pciNet.TypedSpec().ProductID = "0x1000"
-	pciNet.TypedSpec().Driver = "virtio-pci"
-
-	pciDisk := hardware.NewPCIDeviceInfo("0000:00:05.0")
-	pciDisk.TypedSpec().Class = "Mass storage controller"
-	pciDisk.TypedSpec().Subclass = "SCSI storage controller"
-	pciDisk.TypedSpec().Vendor = "Red Hat, Inc."
-	pciDisk.TypedSpec().Product = "Virtio block device"
-	pciDisk.TypedSpec().ClassID = "0x01"
-	pciDisk.TypedSpec().SubclassID = "0x00"
-	pciDisk.TypedSpec().VendorID = "0x1af4"
-	pciDisk.TypedSpec().ProductID = "0x1001"
-	pciDisk.TypedSpec().Driver = "virtio-pci"
-
 	resources = append(
 		resources,
-		hardwareInformation,
 		siderolinkConfig,
 		platformMetadata,
-		processorInfo,
 		securityState,
 		trustdEndpoint,
 		eventSinkConfig,
-		disk,
 		defaultRoute,
-		memory,
-		discoveredDisk,
-		discoveredEfi,
-		discoveredBoot,
-		discoveredMeta,
-		discoveredState,
-		discoveredEphemeral,
-		volumeState,
-		volumeEphemeral,
-		pciNet,
-		pciDisk,
 	)
 
+	hardwareResources, err := hardwareProfile.Resources(m.uuid)
+	if err != nil {
+		return fmt.Errorf("invalid hardware profile: %w", err)
+	}
+
+	resources = append(resources, hardwareResources...)
+
 	if opts.schematic != "" || opts.talosVersion != "" {
 		image := talos.NewImage(talos.NamespaceName, talos.ImageID)
 
@@ -358,18 +249,40 @@ func (m *Machine) Run(ctx context.Context, siderolinkParams *SideroLinkParams, s
 		}
 	}
 
-	sink, err := events.NewHandler(rt.State())
+	// the machine boots with the persistent config, so the staged config becomes active
+	if _, err = machineconfig.ActivatePersistent(ctx, rt.State()); err != nil {
+		return fmt.Errorf("failed to activate the persistent config: %w", err)
+	}
+
+	sink, err := events.NewHandler(rt.State(), opts.nc, m.instance.InterfacePrefix, history)
 	if err != nil {
 		return err
 	}
 
-	var eg errgroup.Group
+	var (
+		eg         errgroup.Group
+		poweredOff bool
+	)
 
 	eg.Go(func() error {
 		select {
 		case <-ctx.Done():
 		case <-m.shutdown:
 			cancel()
+		case <-m.powerOff:
+			m.logger.Info("powering off")
+
+			poweredOff = true
+
+			// the kubelet stops posting the node status
+			notReadyCtx, notReadyCancel := context.WithTimeout(ctx, 5*time.Second)
+
+			if err := services.SetNodeNotReady(notReadyCtx, rt.State(), m.globalState); err != nil {
+				m.logger.Warn("failed to mark the node not ready", zap.Error(err))
+			}
+
+			notReadyCancel()
+			cancel()
 		}
 
 		return nil
@@ -383,7 +296,21 @@ func (m *Machine) Run(ctx context.Context, siderolinkParams *SideroLinkParams, s
 		return sink.Run(ctx, m.logger)
 	})
 
-	return eg.Wait()
+	err = eg.Wait()
+
+	if poweredOff {
+		return ErrPoweredOff
+	}
+
+	return err
+}
+
+// PowerOff stops the running machine, Run returns ErrPoweredOff then.
+func (m *Machine) PowerOff() {
+	select {
+	case m.powerOff <- struct{}{}:
+	default:
+	}
 }
 
 // Cleanup removes created network interfaces.
@@ -397,6 +324,11 @@ func (m *Machine) Cleanup(ctx context.Context) error {
 	default:
 	}
 
+	// the userspace links and the network namespace are gone together with the machine network client
+	if m.isolatedNetwork {
+		return nil
+	}
+
 	// remove all created interfaces
 	links, err := safe.ReaderListAll[*network.LinkSpec](ctx, m.runtime.State())
 	if err != nil {
@@ -428,6 +360,22 @@ func (m *Machine) Cleanup(ctx context.Context) error {
 	})
 }
 
+// newNamespaceClient creates the machine network namespace connected to the host bridge.
+func newNamespaceClient(bridge machinenetwork.Bridge, slot int) (*machinenetwork.Client, error) {
+	ns, err := machinenetwork.NewNamespace()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ns.Connect(bridge, slot); err != nil {
+		ns.Close() //nolint:errcheck
+
+		return nil, err
+	}
+
+	return machinenetwork.NewNamespaceClient(ns), nil
+}
+
 // hostOfURL extracts the host part of a base URL.
 func hostOfURL(rawURL string) (string, error) {
 	parsed, err := url.Parse(rawURL)
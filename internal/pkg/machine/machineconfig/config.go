@@ -2,14 +2,18 @@
 // License, v. 2.0. If a copy of the MPL was not distributed with this
 // file, You can obtain one at http://mozilla.org/MPL/2.0/.
 
-// Package machineconfig provides a utility method to retrieve complete machine config.
+// Package machineconfig provides utility methods to retrieve and store the machine config.
 package machineconfig
 
 import (
+	"bytes"
 	"context"
 
 	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/resource"
 	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	talosconfig "github.com/siderolabs/talos/pkg/machinery/config"
 	"github.com/siderolabs/talos/pkg/machinery/resources/config"
 )
 
@@ -36,3 +40,66 @@ func GetComplete(ctx context.Context, st controller.Reader) (*config.MachineConf
 
 	return conf, nil
 }
+
+// Put creates or replaces the MachineConfig with the given ID.
+func Put(ctx context.Context, st state.State, provider talosconfig.Provider, id resource.ID) error {
+	cfg := config.NewMachineConfigWithID(provider, id)
+
+	err := st.Create(ctx, cfg)
+	if err == nil || !state.IsConflictError(err) {
+		return err
+	}
+
+	r, err := st.Get(ctx, cfg.Metadata())
+	if err != nil {
+		return err
+	}
+
+	cfg.Metadata().SetVersion(r.Metadata().Version())
+
+	return st.Update(ctx, cfg)
+}
+
+// ActivatePersistent makes the persistent config active, as Talos loads the persistent config on boot.
+//
+// The persistent config differs from the active one when the config was staged or applied in try mode.
+// It returns true if the active config was changed.
+func ActivatePersistent(ctx context.Context, st state.State) (bool, error) {
+	persistent, err := safe.StateGetByID[*config.MachineConfig](ctx, st, config.PersistentID)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	active, err := safe.StateGetByID[*config.MachineConfig](ctx, st, config.ActiveID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return false, err
+	}
+
+	if active != nil {
+		var equal bool
+
+		if equal, err = sameConfig(active.Provider(), persistent.Provider()); err != nil || equal {
+			return false, err
+		}
+	}
+
+	return true, Put(ctx, st, persistent.Provider(), config.ActiveID)
+}
+
+func sameConfig(a, b talosconfig.Provider) (bool, error) {
+	aBytes, err := a.Bytes()
+	if err != nil {
+		return false, err
+	}
+
+	bBytes, err := b.Bytes()
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(aBytes, bBytes), nil
+}
@@ -7,11 +7,15 @@ package network
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/netip"
 
 	"github.com/jsimonetti/rtnetlink"
 	"github.com/mdlayher/ethtool"
 	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
+	"github.com/siderolabs/talemu/internal/pkg/machine/network/userspace"
 	"github.com/siderolabs/talemu/internal/pkg/machine/network/watch"
 )
 
@@ -40,6 +44,8 @@ type Client struct {
 	ethIoctlClient   EthToolIoctlClient
 	ethClient        *ethtool.Client
 	wgClient         *wgctrl.Client
+	userspace        *userspace.Stack
+	netns            *Namespace
 
 	listeners map[string]func()
 }
@@ -51,6 +57,26 @@ func NewClient() *Client {
 	}
 }
 
+// NewUserspaceClient creates a network client of a single machine which keeps all links in the userspace.
+//
+// It doesn't need any privileges, but the machine addresses are not reachable from the host network.
+func NewUserspaceClient() *Client {
+	return &Client{
+		listeners: make(map[string]func()),
+		userspace: userspace.NewStack(),
+	}
+}
+
+// NewNamespaceClient creates a network client of a single machine which manages the links in the machine network namespace.
+//
+// The client owns the namespace and closes it on Close.
+func NewNamespaceClient(ns *Namespace) *Client {
+	return &Client{
+		listeners: make(map[string]func()),
+		netns:     ns,
+	}
+}
+
 // QueueReconcile implements watch.Trigger.
 func (nc *Client) QueueReconcile() {
 	for _, listener := range nc.listeners {
@@ -70,6 +96,17 @@ func (nc *Client) RemoveListener(id string) {
 
 // Run starts the network clients.
 func (nc *Client) Run(ctx context.Context) error {
+	if nc.userspace != nil {
+		return nil
+	}
+
+	// all netlink sockets should be created in the machine namespace, as they stay bound to it
+	return nc.Do(func() error {
+		return nc.run(ctx)
+	})
+}
+
+func (nc *Client) run(ctx context.Context) error {
 	var err error
 
 	// create watch connections to rtnetlink and ethtool via genetlink
@@ -110,6 +147,10 @@ func (nc *Client) Run(ctx context.Context) error {
 
 // Close all underlying clients.
 func (nc *Client) Close() error {
+	if nc.userspace != nil {
+		return nc.userspace.Close()
+	}
+
 	if err := nc.ethClient.Close(); err != nil {
 		return err
 	}
@@ -122,7 +163,15 @@ func (nc *Client) Close() error {
 	nc.ethtoolWatcher.Done()
 	nc.rtnetlinkWatcher.Done()
 
-	return nc.rtnetlinkConn.Close()
+	if err := nc.rtnetlinkConn.Close(); err != nil {
+		return err
+	}
+
+	if nc.netns != nil {
+		return nc.netns.Close()
+	}
+
+	return nil
 }
 
 // Conn returns rtnetlink conn.
@@ -144,3 +193,141 @@ func (nc *Client) Eth() *ethtool.Client {
 func (nc *Client) Wg() *wgctrl.Client {
 	return nc.wgClient
 }
+
+// Userspace returns the userspace network stack, nil if the client manages the kernel links.
+func (nc *Client) Userspace() *userspace.Stack {
+	return nc.userspace
+}
+
+// Namespace returns the machine network namespace, nil if the client manages the links of the host.
+func (nc *Client) Namespace() *Namespace {
+	return nc.netns
+}
+
+// TrackAddress makes the address assigned in the machine network namespace reachable through DialContext.
+func (nc *Client) TrackAddress(addr netip.Addr, assigned bool) {
+	if nc.netns == nil {
+		return
+	}
+
+	trackNamespaceAddress(nc.netns, addr, assigned)
+}
+
+// WireguardDevice reads the WireGuard device state.
+func (nc *Client) WireguardDevice(name string) (*wgtypes.Device, error) {
+	if nc.userspace != nil {
+		return nc.userspace.Device(name)
+	}
+
+	return nc.wgClient.Device(name)
+}
+
+// Listen creates a TCP listener on the machine link.
+func (nc *Client) Listen(ctx context.Context, iface, address string) (net.Listener, error) {
+	if nc.userspace != nil {
+		return nc.userspace.Listen(iface, address)
+	}
+
+	var (
+		lc  net.ListenConfig
+		lis net.Listener
+	)
+
+	lc.Control = BindToInterface(iface)
+
+	err := nc.Do(func() error {
+		var err error
+
+		lis, err = lc.Listen(ctx, "tcp", address)
+
+		return err
+	})
+
+	return lis, err
+}
+
+// ListenHostLoopback makes the listener created by Listen also reachable on a random host loopback port.
+//
+// The listener reports the loopback address, so the servers which build the clients to themselves
+// from the listener address (e.g. kube-apiserver) can reach it from the host network.
+// The listener is returned as is if the machine links are in the host network.
+func (nc *Client) ListenHostLoopback(ctx context.Context, lis net.Listener) (net.Listener, error) {
+	switch {
+	case nc.userspace != nil:
+		return userspace.ListenHostLoopback(ctx, lis)
+	case nc.netns != nil:
+		return listenHostLoopback(ctx, lis)
+	default:
+		return lis, nil
+	}
+}
+
+// DialContext connects to the address from the machine link using the local address as the source.
+func (nc *Client) DialContext(ctx context.Context, iface string, localAddr netip.Addr, network, address string) (net.Conn, error) {
+	if nc.userspace != nil {
+		return nc.userspace.DialContext(ctx, iface, network, address)
+	}
+
+	var dialer net.Dialer
+
+	switch network {
+	case "udp", "udp4", "udp6":
+		dialer.LocalAddr = net.UDPAddrFromAddrPort(netip.AddrPortFrom(localAddr, 0))
+	default:
+		dialer.LocalAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(localAddr, 0))
+	}
+
+	dialer.Control = BindToInterface(iface)
+
+	var conn net.Conn
+
+	err := nc.Do(func() error {
+		var err error
+
+		conn, err = dialer.DialContext(ctx, network, address)
+
+		return err
+	})
+
+	return conn, err
+}
+
+// Do runs the function in the machine network namespace, if there is one.
+func (nc *Client) Do(fn func() error) error {
+	if nc.netns == nil {
+		return fn()
+	}
+
+	return nc.netns.Do(fn)
+}
+
+// DialContext connects to the address from the host network.
+//
+// The addresses of the machines running in the userspace network mode are reachable only through this method.
+// The addresses of the machines running in their own network namespaces are dialed from these namespaces,
+// as the host might have no route to them.
+func DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if conn, ok, err := userspace.DialLocal(ctx, network, address); ok {
+		return conn, err
+	}
+
+	var dialer net.Dialer
+
+	if addrPort, err := netip.ParseAddrPort(address); err == nil {
+		if ns := lookupNamespace(addrPort.Addr().Unmap()); ns != nil {
+			var conn net.Conn
+
+			err = ns.Do(func() error {
+				var dialErr error
+
+				conn, dialErr = dialer.DialContext(ctx, network, address)
+
+				return dialErr
+			})
+
+			return conn, err
+		}
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
@@ -0,0 +1,91 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package network
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// loopbackListener accepts the connections from both the machine listener and the host loopback listener.
+type loopbackListener struct {
+	net.Listener
+
+	host      net.Listener
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func listenHostLoopback(ctx context.Context, lis net.Listener) (net.Listener, error) {
+	var lc net.ListenConfig
+
+	host, err := lc.Listen(ctx, "tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	l := &loopbackListener{
+		Listener: lis,
+		host:     host,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+
+	go l.acceptFrom(lis)
+	go l.acceptFrom(host)
+
+	return l, nil
+}
+
+// Addr implements net.Listener.
+func (l *loopbackListener) Addr() net.Addr {
+	return l.host.Addr()
+}
+
+// Accept implements net.Listener.
+func (l *loopbackListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (l *loopbackListener) Close() error {
+	var err error
+
+	l.closeOnce.Do(func() {
+		close(l.done)
+
+		l.host.Close() //nolint:errcheck
+
+		err = l.Listener.Close()
+	})
+
+	return err
+}
+
+func (l *loopbackListener) acceptFrom(lis net.Listener) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			l.Close() //nolint:errcheck
+
+			return
+		}
+
+		select {
+		case l.conns <- conn:
+		case <-l.done:
+			conn.Close() //nolint:errcheck
+
+			return
+		}
+	}
+}
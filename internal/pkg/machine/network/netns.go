@@ -0,0 +1,136 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+	"strconv"
+	"sync"
+)
+
+// NamespaceLinkName is the name of the machine side of the veth pair.
+const NamespaceLinkName = "eth0"
+
+// Bridge is the host bridge which connects the machine network namespaces of an emulator instance.
+type Bridge struct {
+	// Name is the name of the bridge link.
+	Name string
+	// LinkPrefix is the name prefix of the host side of the veth pairs, the machine slot is appended to it.
+	LinkPrefix string
+	// Address is the host address of the bridge, it is the default gateway in the machine network namespaces.
+	Address netip.Prefix
+}
+
+// DefaultBridge is the bridge of the emulator instance without an ID.
+var DefaultBridge = Bridge{
+	Name:       "talemu0",
+	LinkPrefix: "tlm",
+	Address:    netip.MustParsePrefix("172.31.0.1/16"),
+}
+
+// NewBridge derives the bridge of the emulator instance from the instance ID, the empty ID gets the default bridge.
+//
+// The bridge is named after the instance, the veth names and the 10.x.0.0/16 bridge network are picked by the hash of the ID,
+// so the emulators running on the same host don't share the links.
+func NewBridge(instanceID string) Bridge {
+	if instanceID == "" {
+		return DefaultBridge
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(instanceID)) //nolint:errcheck
+
+	sum := hash.Sum32()
+
+	return Bridge{
+		Name:       instanceID + "-br",
+		LinkPrefix: fmt.Sprintf("tlm%06x", sum&0xffffff),
+		Address:    netip.PrefixFrom(netip.AddrFrom4([4]byte{10, byte(sum >> 24), 0, 1}), 16),
+	}
+}
+
+// LinkName returns the name of the host side of the machine veth pair.
+func (b Bridge) LinkName(slot int) string {
+	return b.LinkPrefix + strconv.Itoa(slot)
+}
+
+// NamespaceAddress returns the address of the machine in the bridge network.
+func (b Bridge) NamespaceAddress(slot int) (netip.Prefix, error) {
+	// the first address is the bridge, the last one is the broadcast
+	if slot < 2 || slot >= 1<<(32-b.Address.Bits())-1 {
+		return netip.Prefix{}, fmt.Errorf("slot %d doesn't fit into the bridge network %s", slot, b.Address.Masked())
+	}
+
+	base := b.Address.Masked().Addr().As4()
+	offset := binary.BigEndian.Uint32(base[:]) + uint32(slot) //nolint:gosec
+
+	var addr [4]byte
+
+	binary.BigEndian.PutUint32(addr[:], offset)
+
+	return netip.PrefixFrom(netip.AddrFrom4(addr), b.Address.Bits()), nil
+}
+
+// Namespace is the network namespace of a single machine.
+//
+// The namespace is removed as soon as it is closed and all sockets created in it are closed.
+type Namespace struct {
+	tasks  chan namespaceTask
+	done   chan struct{}
+	fd     int
+	mu     sync.RWMutex
+	closed bool
+}
+
+// namespaceTask is a function run by one of the namespace threads.
+type namespaceTask struct {
+	fn    func() error
+	errCh chan error
+}
+
+// namespaceAddresses maps the addresses assigned in the machine namespaces to these namespaces,
+// so that the in-process clients can reach them.
+var namespaceAddresses = struct {
+	addresses map[netip.Addr]*Namespace
+	mu        sync.Mutex
+}{
+	addresses: map[netip.Addr]*Namespace{},
+}
+
+func trackNamespaceAddress(ns *Namespace, addr netip.Addr, assigned bool) {
+	namespaceAddresses.mu.Lock()
+	defer namespaceAddresses.mu.Unlock()
+
+	if assigned {
+		namespaceAddresses.addresses[addr] = ns
+
+		return
+	}
+
+	if namespaceAddresses.addresses[addr] == ns {
+		delete(namespaceAddresses.addresses, addr)
+	}
+}
+
+func lookupNamespace(addr netip.Addr) *Namespace {
+	namespaceAddresses.mu.Lock()
+	defer namespaceAddresses.mu.Unlock()
+
+	return namespaceAddresses.addresses[addr]
+}
+
+func forgetNamespace(ns *Namespace) {
+	namespaceAddresses.mu.Lock()
+	defer namespaceAddresses.mu.Unlock()
+
+	for addr, owner := range namespaceAddresses.addresses {
+		if owner == ns {
+			delete(namespaceAddresses.addresses, addr)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build linux
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// vethInfoPeer is VETH_INFO_PEER from linux/veth.h.
+const vethInfoPeer = 1
+
+// bridgeMu serializes the bridge setup between the machines.
+var bridgeMu sync.Mutex
+
+var errNamespaceClosed = errors.New("network namespace is closed")
+
+// NewNamespace creates a new network namespace.
+func NewNamespace() (*Namespace, error) {
+	ns := &Namespace{
+		tasks: make(chan namespaceTask),
+		done:  make(chan struct{}),
+	}
+
+	created := make(chan error, 1)
+
+	go func() {
+		// the thread is never unlocked: it is switched to the new namespace, so the runtime should terminate it
+		runtime.LockOSThread()
+
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			created <- fmt.Errorf("error creating network namespace: %w", err)
+
+			return
+		}
+
+		fd, err := unix.Open("/proc/thread-self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			created <- fmt.Errorf("error opening network namespace: %w", err)
+
+			return
+		}
+
+		ns.fd = fd
+
+		created <- nil
+
+		ns.runTasks()
+	}()
+
+	if err := <-created; err != nil {
+		return nil, err
+	}
+
+	return ns, nil
+}
+
+// Do runs the function in the network namespace.
+//
+// All sockets created by the function stay in the namespace.
+// The functions run on the threads which stay in the namespace until it is closed:
+// an idle thread picks the function up, a new one enters the namespace only if all of them are busy.
+func (ns *Namespace) Do(fn func() error) error {
+	task := namespaceTask{
+		fn:    fn,
+		errCh: make(chan error, 1),
+	}
+
+	if err := ns.dispatch(task); err != nil {
+		return err
+	}
+
+	return <-task.errCh
+}
+
+func (ns *Namespace) dispatch(task namespaceTask) error {
+	// the namespace isn't closed until the new thread enters it
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	if ns.closed {
+		return errNamespaceClosed
+	}
+
+	select {
+	case ns.tasks <- task:
+		return nil
+	default:
+	}
+
+	entered := make(chan error, 1)
+
+	go func() {
+		// the thread is never unlocked: it is switched to the machine namespace, so the runtime should terminate it
+		runtime.LockOSThread()
+
+		if err := unix.Setns(ns.fd, unix.CLONE_NEWNET); err != nil {
+			entered <- fmt.Errorf("error entering network namespace: %w", err)
+
+			return
+		}
+
+		entered <- nil
+
+		task.errCh <- task.fn()
+
+		ns.runTasks()
+	}()
+
+	return <-entered
+}
+
+// runTasks runs the namespace functions on the current thread until the namespace is closed.
+func (ns *Namespace) runTasks() {
+	for {
+		select {
+		case task := <-ns.tasks:
+			task.errCh <- task.fn()
+		case <-ns.done:
+			return
+		}
+	}
+}
+
+// Close releases the namespace.
+func (ns *Namespace) Close() error {
+	forgetNamespace(ns)
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if ns.closed {
+		return nil
+	}
+
+	ns.closed = true
+
+	close(ns.done)
+
+	return unix.Close(ns.fd)
+}
+
+// Connect plugs the namespace into the host bridge using a veth pair and routes all the namespace traffic through the bridge.
+func (ns *Namespace) Connect(bridge Bridge, slot int) error {
+	address, err := bridge.NamespaceAddress(slot)
+	if err != nil {
+		return err
+	}
+
+	conn, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return fmt.Errorf("error dialing rtnetlink socket: %w", err)
+	}
+
+	defer conn.Close() //nolint:errcheck
+
+	bridgeIndex, err := ensureBridge(conn, bridge)
+	if err != nil {
+		return err
+	}
+
+	hostLink := bridge.LinkName(slot)
+
+	peer, err := vethPeer(NamespaceLinkName, ns.fd)
+	if err != nil {
+		return err
+	}
+
+	if err = conn.Link.New(&rtnetlink.LinkMessage{
+		Family: unix.AF_UNSPEC,
+		Attributes: &rtnetlink.LinkAttributes{
+			Name:   hostLink,
+			Master: &bridgeIndex,
+			Info: &rtnetlink.LinkInfo{
+				Kind: "veth",
+				Data: peer,
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("error creating veth pair %q: %w", hostLink, err)
+	}
+
+	if err = setLinkUp(conn, hostLink); err != nil {
+		return err
+	}
+
+	return ns.Do(func() error {
+		nsConn, nsErr := rtnetlink.Dial(nil)
+		if nsErr != nil {
+			return fmt.Errorf("error dialing rtnetlink socket: %w", nsErr)
+		}
+
+		defer nsConn.Close() //nolint:errcheck
+
+		if nsErr = setLinkUp(nsConn, "lo"); nsErr != nil {
+			return nsErr
+		}
+
+		if nsErr = setLinkUp(nsConn, NamespaceLinkName); nsErr != nil {
+			return nsErr
+		}
+
+		index, nsErr := linkIndex(nsConn, NamespaceLinkName)
+		if nsErr != nil {
+			return nsErr
+		}
+
+		if nsErr = addAddress(nsConn, index, address); nsErr != nil {
+			return nsErr
+		}
+
+		if nsErr = nsConn.Route.Add(&rtnetlink.RouteMessage{
+			Family:   unix.AF_INET,
+			Table:    unix.RT_TABLE_MAIN,
+			Protocol: unix.RTPROT_STATIC,
+			Scope:    unix.RT_SCOPE_UNIVERSE,
+			Type:     unix.RTN_UNICAST,
+			Attributes: rtnetlink.RouteAttributes{
+				Gateway:  bridge.Address.Addr().AsSlice(),
+				OutIface: index,
+			},
+		}); nsErr != nil {
+			return fmt.Errorf("error adding default route: %w", nsErr)
+		}
+
+		return nil
+	})
+}
+
+// ensureBridge creates the host bridge if it doesn't exist yet.
+func ensureBridge(conn *rtnetlink.Conn, bridge Bridge) (uint32, error) {
+	bridgeMu.Lock()
+	defer bridgeMu.Unlock()
+
+	index, err := linkIndex(conn, bridge.Name)
+	if err == nil {
+		return index, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	if err = checkBridgeNetwork(conn, bridge); err != nil {
+		return 0, err
+	}
+
+	if err = conn.Link.New(&rtnetlink.LinkMessage{
+		Family: unix.AF_UNSPEC,
+		Attributes: &rtnetlink.LinkAttributes{
+			Name: bridge.Name,
+			Info: &rtnetlink.LinkInfo{
+				Kind: "bridge",
+			},
+		},
+	}); err != nil {
+		return 0, fmt.Errorf("error creating bridge %q: %w", bridge.Name, err)
+	}
+
+	if index, err = linkIndex(conn, bridge.Name); err != nil {
+		return 0, err
+	}
+
+	if err = addAddress(conn, index, bridge.Address); err != nil {
+		return 0, err
+	}
+
+	return index, setLinkUp(conn, bridge.Name)
+}
+
+// checkBridgeNetwork makes sure the bridge network isn't used on the host yet, e.g. by the bridge of another emulator instance.
+func checkBridgeNetwork(conn *rtnetlink.Conn, bridge Bridge) error {
+	addresses, err := conn.Address.List()
+	if err != nil {
+		return fmt.Errorf("error listing addresses: %w", err)
+	}
+
+	for _, address := range addresses {
+		if address.Family != unix.AF_INET || address.Attributes == nil {
+			continue
+		}
+
+		addr, ok := netip.AddrFromSlice(address.Attributes.Address)
+		if !ok {
+			continue
+		}
+
+		if prefix := netip.PrefixFrom(addr.Unmap(), int(address.PrefixLength)); prefix.Overlaps(bridge.Address.Masked()) {
+			return fmt.Errorf("bridge %q network %s overlaps the host address %s", bridge.Name, bridge.Address.Masked(), prefix)
+		}
+	}
+
+	return nil
+}
+
+// vethPeer encodes the veth peer which is created right in the namespace.
+func vethPeer(name string, netnsFD int) ([]byte, error) {
+	ae := netlink.NewAttributeEncoder()
+	ae.String(unix.IFLA_IFNAME, name)
+	ae.Uint32(unix.IFLA_NET_NS_FD, uint32(netnsFD)) //nolint:gosec
+
+	attrs, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	// the peer is a full link message: an empty ifinfomsg header followed by the attributes
+	peer := append(make([]byte, unix.SizeofIfInfomsg), attrs...)
+
+	ae = netlink.NewAttributeEncoder()
+	ae.Bytes(vethInfoPeer, peer)
+
+	return ae.Encode()
+}
+
+func linkIndex(conn *rtnetlink.Conn, name string) (uint32, error) {
+	links, err := conn.Link.List()
+	if err != nil {
+		return 0, fmt.Errorf("error listing links: %w", err)
+	}
+
+	index := slices.IndexFunc(links, func(link rtnetlink.LinkMessage) bool {
+		return link.Attributes.Name == name
+	})
+	if index == -1 {
+		return 0, fmt.Errorf("link %q: %w", name, os.ErrNotExist)
+	}
+
+	return links[index].Index, nil
+}
+
+func setLinkUp(conn *rtnetlink.Conn, name string) error {
+	index, err := linkIndex(conn, name)
+	if err != nil {
+		return err
+	}
+
+	if err = conn.Link.Set(&rtnetlink.LinkMessage{
+		Family: unix.AF_UNSPEC,
+		Index:  index,
+		Flags:  unix.IFF_UP,
+		Change: unix.IFF_UP,
+	}); err != nil {
+		return fmt.Errorf("error bringing link %q up: %w", name, err)
+	}
+
+	return nil
+}
+
+func addAddress(conn *rtnetlink.Conn, index uint32, address netip.Prefix) error {
+	if err := conn.Address.New(&rtnetlink.AddressMessage{
+		Family:       unix.AF_INET,
+		PrefixLength: uint8(address.Bits()),
+		Scope:        unix.RT_SCOPE_UNIVERSE,
+		Index:        index,
+		Attributes: &rtnetlink.AddressAttributes{
+			Address: address.Addr().AsSlice(),
+			Local:   address.Addr().AsSlice(),
+		},
+	}); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("error adding address %s: %w", address, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build linux
+
+package network_test
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/network"
+)
+
+func TestNamespaceDo(t *testing.T) {
+	t.Parallel()
+
+	if os.Geteuid() != 0 {
+		t.Skip("network namespaces need root")
+	}
+
+	hostNamespace, err := os.Readlink("/proc/thread-self/ns/net")
+	require.NoError(t, err)
+
+	ns, err := network.NewNamespace()
+	require.NoError(t, err)
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		namespaces = map[string]struct{}{}
+		release    = make(chan struct{})
+	)
+
+	// the concurrent calls don't wait for each other, and all of them run in the same namespace
+	for range 4 {
+		wg.Go(func() {
+			assert.NoError(t, ns.Do(func() error {
+				current, readErr := os.Readlink("/proc/thread-self/ns/net")
+				if readErr != nil {
+					return readErr
+				}
+
+				mu.Lock()
+				namespaces[current] = struct{}{}
+				mu.Unlock()
+
+				<-release
+
+				return nil
+			}))
+		})
+	}
+
+	close(release)
+	wg.Wait()
+
+	require.Len(t, namespaces, 1)
+	assert.NotContains(t, namespaces, hostNamespace)
+
+	require.NoError(t, ns.Close())
+	require.Error(t, ns.Do(func() error { return nil }))
+}
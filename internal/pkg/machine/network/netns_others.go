@@ -0,0 +1,33 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !linux
+
+package network
+
+import "errors"
+
+var errNamespacesNotSupported = errors.New("network namespaces are not supported on this platform")
+
+// NewNamespace creates a new network namespace.
+func NewNamespace() (*Namespace, error) {
+	return nil, errNamespacesNotSupported
+}
+
+// Do runs the function in the network namespace.
+func (ns *Namespace) Do(func() error) error {
+	return errNamespacesNotSupported
+}
+
+// Close releases the namespace.
+func (ns *Namespace) Close() error {
+	forgetNamespace(ns)
+
+	return nil
+}
+
+// Connect plugs the namespace into the host bridge.
+func (ns *Namespace) Connect(Bridge, int) error {
+	return errNamespacesNotSupported
+}
@@ -0,0 +1,69 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package network_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/network"
+)
+
+func TestNamespaceAddress(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		expected string
+		slot     int
+	}{
+		{slot: 2, expected: "172.31.0.2/16"},
+		{slot: 1000, expected: "172.31.3.232/16"},
+		{slot: 65534, expected: "172.31.255.254/16"},
+	} {
+		address, err := network.DefaultBridge.NamespaceAddress(tt.slot)
+		require.NoError(t, err)
+
+		assert.Equal(t, tt.expected, address.String())
+	}
+
+	for _, slot := range []int{0, 1, 65535, 70000} {
+		_, err := network.DefaultBridge.NamespaceAddress(slot)
+		require.Error(t, err, "slot %d", slot)
+	}
+}
+
+func TestNewBridge(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, network.DefaultBridge, network.NewBridge(""))
+	assert.Equal(t, "tlm1000", network.DefaultBridge.LinkName(1000))
+
+	emua := network.NewBridge("emua")
+	emub := network.NewBridge("emub")
+
+	assert.Equal(t, "emua-br", emua.Name)
+	assert.Equal(t, emua, network.NewBridge("emua"))
+	assert.NotEqual(t, emua.LinkPrefix, emub.LinkPrefix)
+	assert.NotEqual(t, emua.Address, emub.Address)
+
+	// the longest instance ID and slot still fit into the 15 characters link names
+	longest := network.NewBridge("abcdefghij")
+
+	assert.LessOrEqual(t, len(longest.Name), 15)
+	assert.LessOrEqual(t, len(longest.LinkName(65534)), 15)
+
+	assert.True(t, netip.MustParsePrefix("10.0.0.0/8").Contains(emua.Address.Addr()))
+	assert.Equal(t, 16, emua.Address.Bits())
+	assert.Equal(t, byte(1), emua.Address.Addr().As4()[3])
+
+	address, err := emua.NamespaceAddress(2)
+	require.NoError(t, err)
+
+	assert.True(t, emua.Address.Masked().Contains(address.Addr()))
+	assert.Equal(t, emua.Address.Bits(), address.Bits())
+}
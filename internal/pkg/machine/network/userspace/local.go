@@ -0,0 +1,181 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package userspace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+)
+
+// localListeners are all netstack listeners of the process.
+//
+// The host kernel has no routes to the netstack addresses, so the in-process clients
+// (Kubernetes clients, Talos API clients of the emulator itself) connect to them through the in-memory pipes.
+var localListeners = struct {
+	listeners map[netip.AddrPort]*localListener
+	mu        sync.Mutex
+}{
+	listeners: map[netip.AddrPort]*localListener{},
+}
+
+// localListener accepts the connections from both the netstack and the in-process clients.
+type localListener struct {
+	net.Listener
+
+	host      net.Listener
+	conns     chan net.Conn
+	done      chan struct{}
+	addrPort  netip.AddrPort
+	closeOnce sync.Once
+}
+
+// registerLocal makes the netstack listener reachable through DialLocal.
+func registerLocal(addrPort netip.AddrPort, lis net.Listener) (net.Listener, error) {
+	localListeners.mu.Lock()
+	defer localListeners.mu.Unlock()
+
+	if _, ok := localListeners.listeners[addrPort]; ok {
+		return nil, fmt.Errorf("address %s is already in use", addrPort)
+	}
+
+	l := &localListener{
+		Listener: lis,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+		addrPort: addrPort,
+	}
+
+	localListeners.listeners[addrPort] = l
+
+	go l.acceptFrom(lis)
+
+	return l, nil
+}
+
+// DialLocal connects to the netstack listener registered in this process.
+//
+// The second return value is false if there is no such listener.
+func DialLocal(ctx context.Context, network, address string) (net.Conn, bool, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, false, nil
+	}
+
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return nil, false, nil //nolint:nilerr
+	}
+
+	localListeners.mu.Lock()
+	l, ok := localListeners.listeners[addrPort]
+	localListeners.mu.Unlock()
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	server, client := net.Pipe()
+
+	select {
+	case l.conns <- server:
+		return client, true, nil
+	case <-l.done:
+		client.Close() //nolint:errcheck
+		server.Close() //nolint:errcheck
+
+		return nil, true, net.ErrClosed
+	case <-ctx.Done():
+		client.Close() //nolint:errcheck
+		server.Close() //nolint:errcheck
+
+		return nil, true, ctx.Err()
+	}
+}
+
+// ListenHostLoopback makes the listener created by Stack.Listen also reachable on a random host loopback port.
+//
+// The listener reports the loopback address, so the servers which build the clients to themselves
+// from the listener address (e.g. kube-apiserver) don't need the netstack to reach it.
+func ListenHostLoopback(ctx context.Context, lis net.Listener) (net.Listener, error) {
+	l, ok := lis.(*localListener)
+	if !ok {
+		return nil, fmt.Errorf("listener %s is not in the userspace network", lis.Addr())
+	}
+
+	var lc net.ListenConfig
+
+	host, err := lc.Listen(ctx, "tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	l.host = host
+
+	go l.acceptFrom(host)
+
+	return l, nil
+}
+
+// Addr implements net.Listener.
+func (l *localListener) Addr() net.Addr {
+	if l.host != nil {
+		return l.host.Addr()
+	}
+
+	return l.Listener.Addr()
+}
+
+// Accept implements net.Listener.
+func (l *localListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (l *localListener) Close() error {
+	var err error
+
+	l.closeOnce.Do(func() {
+		localListeners.mu.Lock()
+		delete(localListeners.listeners, l.addrPort)
+		localListeners.mu.Unlock()
+
+		close(l.done)
+
+		if l.host != nil {
+			l.host.Close() //nolint:errcheck
+		}
+
+		err = l.Listener.Close()
+	})
+
+	return err
+}
+
+func (l *localListener) acceptFrom(lis net.Listener) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			// the netstack is gone together with the link, or the listener is closed
+			l.Close() //nolint:errcheck
+
+			return
+		}
+
+		select {
+		case l.conns <- conn:
+		case <-l.done:
+			conn.Close() //nolint:errcheck
+
+			return
+		}
+	}
+}
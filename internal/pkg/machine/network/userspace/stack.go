@@ -0,0 +1,369 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package userspace implements the machine network which doesn't need any privileges.
+//
+// SideroLink WireGuard links run in wireguard-go on top of the gVisor netstack,
+// all sockets of the machine are created in the netstack instead of the host kernel.
+package userspace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Stack is the userspace network of a single machine.
+type Stack struct {
+	links     map[string]*link
+	nextIndex uint32
+	mu        sync.Mutex
+}
+
+// LinkStatus is the current state of a userspace link.
+type LinkStatus struct {
+	Name  string
+	Index uint32
+	MTU   uint32
+	Up    bool
+}
+
+// link is a single WireGuard device with its own netstack.
+type link struct {
+	device    *device.Device
+	tun       *netTUN
+	spec      network.WireguardSpec
+	addresses []netip.Prefix
+	index     uint32
+	mtu       uint32
+	up        bool
+}
+
+// NewStack creates a new userspace network stack.
+func NewStack() *Stack {
+	return &Stack{
+		links:     map[string]*link{},
+		nextIndex: 1,
+	}
+}
+
+// SetLink creates the WireGuard link or updates its configuration.
+//
+// It reports whether the link has been changed.
+func (s *Stack) SetLink(name string, spec network.WireguardSpec, mtu uint32, up bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mtu == 0 {
+		mtu = device.DefaultMTU
+	}
+
+	l, ok := s.links[name]
+	if !ok {
+		l = &link{
+			index: s.nextIndex,
+		}
+
+		s.nextIndex++
+		s.links[name] = l
+	}
+
+	spec.Sort()
+
+	if l.device == nil || l.mtu != mtu {
+		l.spec = spec
+		l.mtu = mtu
+		l.up = up
+
+		return true, l.rebuild()
+	}
+
+	changed := false
+
+	if !l.spec.Equal(&spec) {
+		if err := l.configure(spec); err != nil {
+			return false, err
+		}
+
+		changed = true
+	}
+
+	if l.up != up {
+		if err := l.setUp(up); err != nil {
+			return false, err
+		}
+
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// RemoveLink tears down the WireGuard link.
+func (s *Stack) RemoveLink(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[name]
+	if !ok {
+		return
+	}
+
+	l.close()
+
+	delete(s.links, name)
+}
+
+// AddAddress assigns the address to the link.
+//
+// The address is added to the running netstack, so the listeners and the connections of the link are kept.
+func (s *Stack) AddAddress(name string, address netip.Prefix) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[name]
+	if !ok {
+		return fmt.Errorf("link %q: %w", name, os.ErrNotExist)
+	}
+
+	if slices.Contains(l.addresses, address) {
+		return nil
+	}
+
+	if l.tun != nil {
+		if err := l.tun.addAddress(address.Addr()); err != nil {
+			return err
+		}
+	}
+
+	l.addresses = append(l.addresses, address)
+
+	return nil
+}
+
+// RemoveAddress removes the address from the link.
+func (s *Stack) RemoveAddress(name string, address netip.Prefix) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[name]
+	if !ok {
+		return nil
+	}
+
+	index := slices.Index(l.addresses, address)
+	if index == -1 {
+		return nil
+	}
+
+	if l.tun != nil {
+		if err := l.tun.removeAddress(address.Addr()); err != nil {
+			return err
+		}
+	}
+
+	l.addresses = slices.Delete(l.addresses, index, index+1)
+
+	return nil
+}
+
+// HasAddress checks if the address is assigned to the link.
+func (s *Stack) HasAddress(name string, address netip.Prefix) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[name]
+
+	return ok && slices.Contains(l.addresses, address)
+}
+
+// Links returns the state of all links.
+func (s *Stack) Links() []LinkStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links := make([]LinkStatus, 0, len(s.links))
+
+	for name, l := range s.links {
+		links = append(links, LinkStatus{
+			Name:  name,
+			Index: l.index,
+			MTU:   l.mtu,
+			Up:    l.up,
+		})
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+
+	return links
+}
+
+// Device reads the WireGuard device state in the same format wgctrl reports it for the kernel devices.
+func (s *Stack) Device(name string) (*wgtypes.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[name]
+	if !ok || l.device == nil {
+		return nil, fmt.Errorf("wireguard device %q: %w", name, os.ErrNotExist)
+	}
+
+	uapi, err := l.device.IpcGet()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDevice(name, uapi)
+}
+
+// Listen creates a TCP listener on the link netstack.
+//
+// The listener is also reachable by the in-process clients through DialLocal.
+func (s *Stack) Listen(name, address string) (net.Listener, error) {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	dev, err := s.tun(name)
+	if err != nil {
+		return nil, err
+	}
+
+	lis, err := dev.listen(addrPort)
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := registerLocal(addrPort, lis)
+	if err != nil {
+		lis.Close() //nolint:errcheck
+
+		return nil, err
+	}
+
+	return local, nil
+}
+
+// DialContext connects to the address through the link netstack.
+func (s *Stack) DialContext(ctx context.Context, name, network, address string) (net.Conn, error) {
+	if conn, ok, err := DialLocal(ctx, network, address); ok {
+		return conn, err
+	}
+
+	dev, err := s.tun(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return dev.dialContext(ctx, network, address)
+}
+
+// Close tears down all links.
+func (s *Stack) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, l := range s.links {
+		l.close()
+
+		delete(s.links, name)
+	}
+
+	return nil
+}
+
+func (s *Stack) tun(name string) (*netTUN, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[name]
+	if !ok || l.tun == nil {
+		return nil, fmt.Errorf("link %q: %w", name, os.ErrNotExist)
+	}
+
+	return l.tun, nil
+}
+
+// rebuild recreates the netstack and the WireGuard device with the current link configuration.
+func (l *link) rebuild() error {
+	l.close()
+
+	tunDevice, err := newNetTUN(int(l.mtu))
+	if err != nil {
+		return fmt.Errorf("error creating netstack: %w", err)
+	}
+
+	for _, address := range l.addresses {
+		if err = tunDevice.addAddress(address.Addr()); err != nil {
+			tunDevice.Close() //nolint:errcheck
+
+			return err
+		}
+	}
+
+	l.device = device.NewDevice(tunDevice, conn.NewDefaultBind(), device.NewLogger(device.LogLevelSilent, ""))
+	l.tun = tunDevice
+
+	if err = l.configure(l.spec); err != nil {
+		l.close()
+
+		return err
+	}
+
+	return l.setUp(l.up)
+}
+
+func (l *link) configure(spec network.WireguardSpec) error {
+	uapi, err := encodeSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	if err = l.device.IpcSet(uapi); err != nil {
+		return fmt.Errorf("error configuring wireguard device: %w", err)
+	}
+
+	l.spec = spec
+
+	return nil
+}
+
+func (l *link) setUp(up bool) error {
+	var err error
+
+	if up {
+		err = l.device.Up()
+	} else {
+		err = l.device.Down()
+	}
+
+	if err != nil {
+		return fmt.Errorf("error changing the link state: %w", err)
+	}
+
+	l.up = up
+
+	return nil
+}
+
+func (l *link) close() {
+	if l.device != nil {
+		// closing the device also closes the netstack and all sockets in it
+		l.device.Close()
+	}
+
+	l.device = nil
+	l.tun = nil
+}
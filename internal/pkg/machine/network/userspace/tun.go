@@ -0,0 +1,242 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package userspace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"syscall"
+
+	"golang.zx2c4.com/wireguard/tun"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+// nicID is the ID of the only NIC of the link netstack.
+const nicID tcpip.NICID = 1
+
+// netTUN is the TUN device of the WireGuard link backed by the gVisor netstack.
+//
+// It works as the wireguard-go netstack device, but keeps the stack at hand,
+// so the link addresses are changed in place and the sockets of the link survive the change.
+type netTUN struct {
+	ep             *channel.Endpoint
+	stack          *stack.Stack
+	notifyHandle   *channel.NotificationHandle
+	events         chan tun.Event
+	incomingPacket chan *buffer.View
+	mtu            int
+}
+
+func newNetTUN(mtu int) (*netTUN, error) {
+	dev := &netTUN{
+		ep: channel.New(1024, uint32(mtu), ""), //nolint:gosec
+		stack: stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol, icmp.NewProtocol6, icmp.NewProtocol4},
+			HandleLocal:        true,
+		}),
+		events:         make(chan tun.Event, 10),
+		incomingPacket: make(chan *buffer.View),
+		mtu:            mtu,
+	}
+
+	sackEnabled := tcpip.TCPSACKEnabled(true)
+
+	if tcpipErr := dev.stack.SetTransportProtocolOption(tcp.ProtocolNumber, &sackEnabled); tcpipErr != nil {
+		return nil, fmt.Errorf("error enabling TCP SACK: %v", tcpipErr)
+	}
+
+	dev.notifyHandle = dev.ep.AddNotify(dev)
+
+	if tcpipErr := dev.stack.CreateNIC(nicID, dev.ep); tcpipErr != nil {
+		return nil, fmt.Errorf("error creating NIC: %v", tcpipErr)
+	}
+
+	// the routes don't depend on the addresses, so they are set up once for both families
+	dev.stack.AddRoute(tcpip.Route{Destination: header.IPv4EmptySubnet, NIC: nicID})
+	dev.stack.AddRoute(tcpip.Route{Destination: header.IPv6EmptySubnet, NIC: nicID})
+
+	dev.events <- tun.EventUp
+
+	return dev, nil
+}
+
+// File implements tun.Device.
+func (dev *netTUN) File() *os.File {
+	return nil
+}
+
+// Read implements tun.Device.
+func (dev *netTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	view, ok := <-dev.incomingPacket
+	if !ok {
+		return 0, os.ErrClosed
+	}
+
+	n, err := view.Read(bufs[0][offset:])
+	if err != nil {
+		return 0, err
+	}
+
+	sizes[0] = n
+
+	return 1, nil
+}
+
+// Write implements tun.Device.
+func (dev *netTUN) Write(bufs [][]byte, offset int) (int, error) {
+	for _, buf := range bufs {
+		packet := buf[offset:]
+		if len(packet) == 0 {
+			continue
+		}
+
+		pkb := stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: buffer.MakeWithData(packet)})
+
+		switch packet[0] >> 4 {
+		case 4:
+			dev.ep.InjectInbound(header.IPv4ProtocolNumber, pkb)
+		case 6:
+			dev.ep.InjectInbound(header.IPv6ProtocolNumber, pkb)
+		default:
+			return 0, syscall.EAFNOSUPPORT
+		}
+	}
+
+	return len(bufs), nil
+}
+
+// WriteNotify implements channel.Notification, it passes the outgoing packets of the netstack to the WireGuard device.
+func (dev *netTUN) WriteNotify() {
+	pkt := dev.ep.Read()
+	if pkt == nil {
+		return
+	}
+
+	view := pkt.ToView()
+	pkt.DecRef()
+
+	dev.incomingPacket <- view
+}
+
+// MTU implements tun.Device.
+func (dev *netTUN) MTU() (int, error) {
+	return dev.mtu, nil
+}
+
+// Name implements tun.Device.
+func (dev *netTUN) Name() (string, error) {
+	return "go", nil
+}
+
+// Events implements tun.Device.
+func (dev *netTUN) Events() <-chan tun.Event {
+	return dev.events
+}
+
+// Close implements tun.Device.
+func (dev *netTUN) Close() error {
+	dev.stack.RemoveNIC(nicID)
+	dev.stack.Close()
+	dev.ep.RemoveNotify(dev.notifyHandle)
+	dev.ep.Close()
+
+	close(dev.events)
+	close(dev.incomingPacket)
+
+	return nil
+}
+
+// BatchSize implements tun.Device.
+func (dev *netTUN) BatchSize() int {
+	return 1
+}
+
+func (dev *netTUN) addAddress(address netip.Addr) error {
+	protocol, _ := fullAddress(netip.AddrPortFrom(address, 0))
+
+	if tcpipErr := dev.stack.AddProtocolAddress(nicID, tcpip.ProtocolAddress{
+		Protocol:          protocol,
+		AddressWithPrefix: tcpip.AddrFromSlice(address.AsSlice()).WithPrefix(),
+	}, stack.AddressProperties{}); tcpipErr != nil {
+		return fmt.Errorf("error adding address %s: %v", address, tcpipErr)
+	}
+
+	return nil
+}
+
+func (dev *netTUN) removeAddress(address netip.Addr) error {
+	if tcpipErr := dev.stack.RemoveAddress(nicID, tcpip.AddrFromSlice(address.AsSlice())); tcpipErr != nil {
+		return fmt.Errorf("error removing address %s: %v", address, tcpipErr)
+	}
+
+	return nil
+}
+
+func (dev *netTUN) listen(addrPort netip.AddrPort) (net.Listener, error) {
+	protocol, address := fullAddress(addrPort)
+
+	lis, err := gonet.ListenTCP(dev.stack, address, protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	return lis, nil
+}
+
+// dialContext connects to the address through the netstack, the links have no DNS servers, so only the IP addresses are dialed.
+func (dev *netTUN) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	protocol, remote := fullAddress(addrPort)
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		conn, err := gonet.DialContextTCP(ctx, dev.stack, remote, protocol)
+		if err != nil {
+			return nil, err
+		}
+
+		return conn, nil
+	case "udp", "udp4", "udp6":
+		conn, err := gonet.DialUDP(dev.stack, nil, &remote, protocol)
+		if err != nil {
+			return nil, err
+		}
+
+		return conn, nil
+	default:
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+}
+
+func fullAddress(addrPort netip.AddrPort) (tcpip.NetworkProtocolNumber, tcpip.FullAddress) {
+	protocol := ipv6.ProtocolNumber
+	if addrPort.Addr().Is4() {
+		protocol = ipv4.ProtocolNumber
+	}
+
+	return protocol, tcpip.FullAddress{
+		NIC:  nicID,
+		Addr: tcpip.AddrFromSlice(addrPort.Addr().AsSlice()),
+		Port: addrPort.Port(),
+	}
+}
@@ -0,0 +1,198 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package userspace
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// encodeSpec converts the spec to the wireguard-go UAPI configuration, replacing all existing peers.
+func encodeSpec(spec network.WireguardSpec) (string, error) {
+	var sb strings.Builder
+
+	if spec.PrivateKey != "" {
+		key, err := hexKey(spec.PrivateKey)
+		if err != nil {
+			return "", fmt.Errorf("invalid private key: %w", err)
+		}
+
+		fmt.Fprintf(&sb, "private_key=%s\n", key)
+	}
+
+	fmt.Fprintf(&sb, "listen_port=%d\n", spec.ListenPort)
+	sb.WriteString("replace_peers=true\n")
+
+	for _, peer := range spec.Peers {
+		key, err := hexKey(peer.PublicKey)
+		if err != nil {
+			return "", fmt.Errorf("invalid peer public key: %w", err)
+		}
+
+		fmt.Fprintf(&sb, "public_key=%s\n", key)
+
+		if peer.PresharedKey != "" {
+			if key, err = hexKey(peer.PresharedKey); err != nil {
+				return "", fmt.Errorf("invalid peer preshared key: %w", err)
+			}
+
+			fmt.Fprintf(&sb, "preshared_key=%s\n", key)
+		}
+
+		if peer.Endpoint != "" {
+			endpoint, err := net.ResolveUDPAddr("udp", peer.Endpoint)
+			if err != nil {
+				return "", fmt.Errorf("invalid peer endpoint: %w", err)
+			}
+
+			fmt.Fprintf(&sb, "endpoint=%s\n", endpoint.AddrPort())
+		}
+
+		fmt.Fprintf(&sb, "persistent_keepalive_interval=%d\n", int(peer.PersistentKeepaliveInterval/time.Second))
+		sb.WriteString("replace_allowed_ips=true\n")
+
+		for _, allowedIP := range peer.AllowedIPs {
+			fmt.Fprintf(&sb, "allowed_ip=%s\n", allowedIP)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// parseDevice converts the wireguard-go UAPI state dump to the wgctrl device.
+//
+//nolint:gocyclo,cyclop
+func parseDevice(name, uapi string) (*wgtypes.Device, error) {
+	dev := &wgtypes.Device{
+		Name: name,
+		Type: wgtypes.Userspace,
+	}
+
+	var (
+		peer              *wgtypes.Peer
+		handshakeSec      int64
+		handshakeNanoSecs int64
+	)
+
+	flushPeer := func() {
+		if peer == nil {
+			return
+		}
+
+		if handshakeSec != 0 || handshakeNanoSecs != 0 {
+			peer.LastHandshakeTime = time.Unix(handshakeSec, handshakeNanoSecs)
+		}
+
+		dev.Peers = append(dev.Peers, *peer)
+
+		peer = nil
+		handshakeSec, handshakeNanoSecs = 0, 0
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(uapi))
+
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		var err error
+
+		switch key {
+		case "private_key":
+			if dev.PrivateKey, err = parseHexKey(value); err == nil {
+				dev.PublicKey = dev.PrivateKey.PublicKey()
+			}
+		case "listen_port":
+			dev.ListenPort, err = strconv.Atoi(value)
+		case "fwmark":
+			dev.FirewallMark, err = strconv.Atoi(value)
+		case "public_key":
+			flushPeer()
+
+			peer = &wgtypes.Peer{}
+			peer.PublicKey, err = parseHexKey(value)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %q: %w", key, err)
+		}
+
+		if peer == nil {
+			continue
+		}
+
+		switch key {
+		case "preshared_key":
+			peer.PresharedKey, err = parseHexKey(value)
+		case "endpoint":
+			peer.Endpoint, err = net.ResolveUDPAddr("udp", value)
+		case "last_handshake_time_sec":
+			handshakeSec, err = strconv.ParseInt(value, 10, 64)
+		case "last_handshake_time_nsec":
+			handshakeNanoSecs, err = strconv.ParseInt(value, 10, 64)
+		case "persistent_keepalive_interval":
+			var seconds int
+
+			seconds, err = strconv.Atoi(value)
+			peer.PersistentKeepaliveInterval = time.Duration(seconds) * time.Second
+		case "rx_bytes":
+			peer.ReceiveBytes, err = strconv.ParseInt(value, 10, 64)
+		case "tx_bytes":
+			peer.TransmitBytes, err = strconv.ParseInt(value, 10, 64)
+		case "protocol_version":
+			peer.ProtocolVersion, err = strconv.Atoi(value)
+		case "allowed_ip":
+			var prefix netip.Prefix
+
+			if prefix, err = netip.ParsePrefix(value); err == nil {
+				peer.AllowedIPs = append(peer.AllowedIPs, net.IPNet{
+					IP:   prefix.Addr().AsSlice(),
+					Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+				})
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %q: %w", key, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	flushPeer()
+
+	return dev, nil
+}
+
+func hexKey(key string) (string, error) {
+	parsed, err := wgtypes.ParseKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(parsed[:]), nil
+}
+
+func parseHexKey(value string) (wgtypes.Key, error) {
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	return wgtypes.NewKey(b)
+}
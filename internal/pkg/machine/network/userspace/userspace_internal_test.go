@@ -0,0 +1,204 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package userspace
+
+import (
+	"encoding/hex"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestEncodeSpec(t *testing.T) {
+	t.Parallel()
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	peerKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	uapi, err := encodeSpec(network.WireguardSpec{
+		PrivateKey: privateKey.String(),
+		ListenPort: 51821,
+		Peers: []network.WireguardPeer{
+			{
+				PublicKey:                   peerKey.PublicKey().String(),
+				Endpoint:                    "127.0.0.1:50180",
+				PersistentKeepaliveInterval: 25 * time.Second,
+				AllowedIPs:                  []netip.Prefix{netip.MustParsePrefix("fdae:41e4:649b:9303::1/128")},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	publicKey := peerKey.PublicKey()
+
+	assert.Equal(t, "private_key="+hex.EncodeToString(privateKey[:])+"\n"+
+		"listen_port=51821\n"+
+		"replace_peers=true\n"+
+		"public_key="+hex.EncodeToString(publicKey[:])+"\n"+
+		"endpoint=127.0.0.1:50180\n"+
+		"persistent_keepalive_interval=25\n"+
+		"replace_allowed_ips=true\n"+
+		"allowed_ip=fdae:41e4:649b:9303::1/128\n", uapi)
+
+	_, err = encodeSpec(network.WireguardSpec{PrivateKey: "garbage"})
+	require.ErrorContains(t, err, "invalid private key")
+}
+
+func TestParseDevice(t *testing.T) {
+	t.Parallel()
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	peerKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	publicKey := peerKey.PublicKey()
+
+	dev, err := parseDevice("siderolink", "private_key="+hex.EncodeToString(privateKey[:])+"\n"+
+		"listen_port=51821\n"+
+		"public_key="+hex.EncodeToString(publicKey[:])+"\n"+
+		"endpoint=127.0.0.1:50180\n"+
+		"last_handshake_time_sec=1700000000\n"+
+		"last_handshake_time_nsec=0\n"+
+		"tx_bytes=100\n"+
+		"rx_bytes=200\n"+
+		"persistent_keepalive_interval=25\n"+
+		"allowed_ip=fdae:41e4:649b:9303::1/128\n"+
+		"protocol_version=1\n"+
+		"errno=0\n")
+	require.NoError(t, err)
+
+	assert.Equal(t, "siderolink", dev.Name)
+	assert.Equal(t, wgtypes.Userspace, dev.Type)
+	assert.Equal(t, privateKey.PublicKey(), dev.PublicKey)
+	assert.Equal(t, 51821, dev.ListenPort)
+
+	require.Len(t, dev.Peers, 1)
+
+	peer := dev.Peers[0]
+	assert.Equal(t, publicKey, peer.PublicKey)
+	assert.Equal(t, "127.0.0.1:50180", peer.Endpoint.String())
+	assert.Equal(t, time.Unix(1700000000, 0), peer.LastHandshakeTime)
+	assert.EqualValues(t, 100, peer.TransmitBytes)
+	assert.EqualValues(t, 200, peer.ReceiveBytes)
+	assert.Equal(t, 25*time.Second, peer.PersistentKeepaliveInterval)
+	require.Len(t, peer.AllowedIPs, 1)
+	assert.Equal(t, "fdae:41e4:649b:9303::1/128", peer.AllowedIPs[0].String())
+}
+
+func TestDialLocal(t *testing.T) {
+	t.Parallel()
+
+	addrPort := netip.MustParseAddrPort("[fdae:41e4:649b:9303::2]:50000")
+
+	_, ok, err := DialLocal(t.Context(), "tcp", addrPort.String())
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// a host listener stands in for the netstack one
+	hostListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	lis, err := registerLocal(addrPort, hostListener)
+	require.NoError(t, err)
+
+	_, err = registerLocal(addrPort, nil)
+	require.ErrorContains(t, err, "already in use")
+
+	go func() {
+		conn, acceptErr := lis.Accept()
+		if acceptErr != nil {
+			return
+		}
+
+		defer conn.Close() //nolint:errcheck
+
+		conn.Write([]byte("hello")) //nolint:errcheck
+	}()
+
+	conn, ok, err := DialLocal(t.Context(), "tcp", addrPort.String())
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	require.NoError(t, lis.Close())
+
+	_, ok, err = DialLocal(t.Context(), "tcp", addrPort.String())
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestStackAddressChange(t *testing.T) {
+	t.Parallel()
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	stack := NewStack()
+
+	t.Cleanup(func() { require.NoError(t, stack.Close()) })
+
+	_, err = stack.SetLink("siderolink", network.WireguardSpec{PrivateKey: privateKey.String()}, 0, true)
+	require.NoError(t, err)
+
+	address := netip.MustParsePrefix("fdae:41e4:649b:9303::2/64")
+	require.NoError(t, stack.AddAddress("siderolink", address))
+
+	dev, err := stack.tun("siderolink")
+	require.NoError(t, err)
+
+	lis, err := dev.listen(netip.AddrPortFrom(address.Addr(), 50000))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { lis.Close() }) //nolint:errcheck
+
+	go func() {
+		for {
+			conn, acceptErr := lis.Accept()
+			if acceptErr != nil {
+				return
+			}
+
+			conn.Write([]byte("hello")) //nolint:errcheck
+			conn.Close()                //nolint:errcheck
+		}
+	}()
+
+	// the address changes don't recreate the netstack, so the listener keeps accepting the connections
+	other := netip.MustParsePrefix("172.20.0.2/24")
+
+	require.NoError(t, stack.AddAddress("siderolink", other))
+	assert.True(t, stack.HasAddress("siderolink", other))
+
+	require.NoError(t, stack.RemoveAddress("siderolink", other))
+	assert.False(t, stack.HasAddress("siderolink", other))
+
+	devAfter, err := stack.tun("siderolink")
+	require.NoError(t, err)
+	assert.Same(t, dev, devAfter)
+
+	conn, err := dev.dialContext(t.Context(), "tcp", netip.AddrPortFrom(address.Addr(), 50000).String())
+	require.NoError(t, err)
+
+	t.Cleanup(func() { conn.Close() }) //nolint:errcheck
+
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
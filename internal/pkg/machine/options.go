@@ -7,17 +7,26 @@ package machine
 import (
 	"strings"
 
+	"github.com/siderolabs/talemu/internal/pkg/machine/controllers"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+	"github.com/siderolabs/talemu/internal/pkg/machine/hardware"
 	"github.com/siderolabs/talemu/internal/pkg/machine/network"
 )
 
 // Options is the extra machine options.
 type Options struct {
 	nc                   *network.Client
+	hardwareProfile      *hardware.Profile
+	faultInjector        *faults.Injector
+	upgradeTimings       controllers.UpgradeTimings
 	talosVersion         string
 	schematic            string
 	bootFactoryURL       string
 	secureBoot           bool
 	nodeProxyingDisabled bool
+	kubeControllers      bool
+	userspaceNetwork     bool
+	networkNamespace     bool
 }
 
 // Option represents a single extra machine option.
@@ -48,6 +57,22 @@ func WithNetworkClient(nc *network.Client) Option {
 	}
 }
 
+// WithUserspaceNetwork runs the machine network in the userspace netstack instead of the kernel.
+// It has no effect if the network client is set explicitly.
+func WithUserspaceNetwork(value bool) Option {
+	return func(o *Options) {
+		o.userspaceNetwork = value
+	}
+}
+
+// WithNetworkNamespace runs the machine network in its own network namespace connected to the host bridge.
+// It has no effect if the network client is set explicitly.
+func WithNetworkNamespace(value bool) Option {
+	return func(o *Options) {
+		o.networkNamespace = value
+	}
+}
+
 // WithSecureBoot simulates secure boot mode for the machine.
 func WithSecureBoot(value bool) Option {
 	return func(o *Options) {
@@ -64,6 +89,22 @@ func WithNodeProxyingDisabled(value bool) Option {
 	}
 }
 
+// WithKubeControllers runs the embedded kube-controller-manager and kube-scheduler on the control plane machine,
+// the machine runs them while it holds their leader leases.
+func WithKubeControllers(value bool) Option {
+	return func(o *Options) {
+		o.kubeControllers = value
+	}
+}
+
+// WithUpgradeTimings sets the timings of the emulated Kubernetes upgrade steps.
+// The zero timings mean the defaults.
+func WithUpgradeTimings(value controllers.UpgradeTimings) Option {
+	return func(o *Options) {
+		o.upgradeTimings = value
+	}
+}
+
 // WithBootFactoryURL sets the base URL of the image factory the machine's boot media is
 // pretended to come from. Empty means the configured image factory.
 func WithBootFactoryURL(value string) Option {
@@ -71,3 +112,36 @@ func WithBootFactoryURL(value string) Option {
 		o.bootFactoryURL = value
 	}
 }
+
+// WithHardwareProfile sets the emulated hardware of the machine.
+// Nil means the default profile.
+func WithHardwareProfile(profile *hardware.Profile) Option {
+	return func(o *Options) {
+		o.hardwareProfile = profile
+	}
+}
+
+// WithFaultInjector injects the faults into the machine API calls.
+func WithFaultInjector(injector *faults.Injector) Option {
+	return func(o *Options) {
+		o.faultInjector = injector
+	}
+}
+
+// IsolatedNetwork reports whether the options run the machine network apart from the host links:
+// in the userspace netstack or in the machine network namespace.
+//
+// The isolated network is torn down as soon as the machine stops.
+func IsolatedNetwork(options ...Option) bool {
+	var opts Options
+
+	for _, o := range options {
+		o(&opts)
+	}
+
+	if opts.nc != nil {
+		return opts.nc.Userspace() != nil || opts.nc.Namespace() != nil
+	}
+
+	return opts.userspaceNetwork || opts.networkNamespace
+}
@@ -0,0 +1,153 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package podcidr splits the cluster pod CIDRs into the node pod CIDRs, as the kube-controller-manager node IPAM does,
+// and assigns the pod IPs from the node pod CIDRs, as the CNI host-local IPAM does.
+//
+// The node pod CIDRs are kept in the global cluster status by their index, so that the nodes of the cluster never
+// get the same pod CIDR.
+package podcidr
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+
+	"github.com/siderolabs/talemu/api/specs"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
+)
+
+// Node pod CIDR mask sizes, the kube-controller-manager defaults.
+const (
+	NodeMaskSizeIPv4 = 24
+	NodeMaskSizeIPv6 = 64
+)
+
+// Reserve allocates the node pod CIDR index of the machine in the cluster status.
+//
+// The machine keeps its index until it is released.
+func Reserve(ctx context.Context, st state.State, clusterID, machineID string) (uint32, error) {
+	var index uint32
+
+	if _, err := safe.StateUpdateWithConflicts(ctx, st, emu.NewClusterStatus(emu.NamespaceName, clusterID).Metadata(), func(res *emu.ClusterStatus) error {
+		index = Allocate(res.TypedSpec().Value, machineID)
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return index, nil
+}
+
+// Free releases the node pod CIDR index of the machine in the cluster status.
+func Free(ctx context.Context, st state.State, clusterID, machineID string) error {
+	_, err := safe.StateUpdateWithConflicts(ctx, st, emu.NewClusterStatus(emu.NamespaceName, clusterID).Metadata(), func(res *emu.ClusterStatus) error {
+		Release(res.TypedSpec().Value, machineID)
+
+		return nil
+	})
+
+	return err
+}
+
+// Allocate returns the node pod CIDR index of the machine, the lowest free index is allocated if the machine has none.
+func Allocate(spec *specs.ClusterStatusSpec, machineID string) uint32 {
+	if index, ok := spec.NodeCidrIndexes[machineID]; ok {
+		return index
+	}
+
+	used := make(map[uint32]struct{}, len(spec.NodeCidrIndexes))
+
+	for _, index := range spec.NodeCidrIndexes {
+		used[index] = struct{}{}
+	}
+
+	var index uint32
+
+	for {
+		if _, ok := used[index]; !ok {
+			break
+		}
+
+		index++
+	}
+
+	if spec.NodeCidrIndexes == nil {
+		spec.NodeCidrIndexes = map[string]uint32{}
+	}
+
+	spec.NodeCidrIndexes[machineID] = index
+
+	return index
+}
+
+// Release frees the node pod CIDR index of the machine.
+func Release(spec *specs.ClusterStatusSpec, machineID string) {
+	delete(spec.NodeCidrIndexes, machineID)
+}
+
+// NodeCIDRs returns the node pod CIDRs with the index, one for each cluster pod CIDR.
+//
+// The cluster pod CIDRs narrower than the node mask size are not split, so only the index 0 fits them.
+func NodeCIDRs(clusterCIDRs []netip.Prefix, index uint32) ([]netip.Prefix, error) {
+	nodeCIDRs := make([]netip.Prefix, 0, len(clusterCIDRs))
+
+	for _, clusterCIDR := range clusterCIDRs {
+		clusterCIDR = clusterCIDR.Masked()
+
+		maskSize := NodeMaskSizeIPv4
+		if clusterCIDR.Addr().Is6() {
+			maskSize = NodeMaskSizeIPv6
+		}
+
+		maskSize = max(maskSize, clusterCIDR.Bits())
+
+		if subnetBits := maskSize - clusterCIDR.Bits(); subnetBits < 32 && uint64(index) >= 1<<subnetBits {
+			return nil, fmt.Errorf("pod CIDR %s has no free node pod CIDRs", clusterCIDR)
+		}
+
+		addr := clusterCIDR.Addr().AsSlice()
+
+		addShifted(addr, uint64(index), len(addr)*8-maskSize)
+
+		nodeAddr, _ := netip.AddrFromSlice(addr)
+
+		nodeCIDRs = append(nodeCIDRs, netip.PrefixFrom(nodeAddr, maskSize))
+	}
+
+	return nodeCIDRs, nil
+}
+
+// NextAddress returns the lowest pod IP of the node pod CIDR which is not used.
+//
+// The network address and the first address, which is the gateway of the CNI bridge, are never assigned,
+// neither is the last address of the pod CIDR.
+func NextAddress(nodeCIDR netip.Prefix, used func(netip.Addr) bool) (netip.Addr, error) {
+	nodeCIDR = nodeCIDR.Masked()
+
+	for addr := nodeCIDR.Addr().Next().Next(); nodeCIDR.Contains(addr.Next()); addr = addr.Next() {
+		if !used(addr) {
+			return addr, nil
+		}
+	}
+
+	return netip.Addr{}, fmt.Errorf("node pod CIDR %s has no free addresses", nodeCIDR)
+}
+
+// addShifted adds the value shifted left by the number of bits to the big-endian number.
+func addShifted(number []byte, value uint64, shift int) {
+	// the index is 32 bits, so the value shifted by up to 7 bits still fits
+	value <<= shift % 8
+
+	for i := len(number) - 1 - shift/8; i >= 0 && value > 0; i-- {
+		sum := uint64(number[i]) + value&0xff
+
+		number[i] = byte(sum)
+		value = value>>8 + sum>>8
+	}
+}
@@ -0,0 +1,121 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package podcidr_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/api/specs"
+	"github.com/siderolabs/talemu/internal/pkg/machine/podcidr"
+)
+
+func TestAllocate(t *testing.T) {
+	t.Parallel()
+
+	spec := &specs.ClusterStatusSpec{}
+
+	assert.EqualValues(t, 0, podcidr.Allocate(spec, "a"))
+	assert.EqualValues(t, 1, podcidr.Allocate(spec, "b"))
+	assert.EqualValues(t, 2, podcidr.Allocate(spec, "c"))
+	assert.EqualValues(t, 1, podcidr.Allocate(spec, "b"), "the machine keeps its index")
+
+	podcidr.Release(spec, "b")
+
+	assert.EqualValues(t, 1, podcidr.Allocate(spec, "d"), "the released index is allocated again")
+	assert.EqualValues(t, 3, podcidr.Allocate(spec, "b"))
+}
+
+func TestNodeCIDRs(t *testing.T) {
+	t.Parallel()
+
+	clusterCIDRs := []netip.Prefix{
+		netip.MustParsePrefix("10.244.0.0/16"),
+		netip.MustParsePrefix("fd00:10:244::/48"),
+	}
+
+	for _, test := range []struct {
+		expected []string
+		index    uint32
+	}{
+		{
+			index:    0,
+			expected: []string{"10.244.0.0/24", "fd00:10:244::/64"},
+		},
+		{
+			index:    3,
+			expected: []string{"10.244.3.0/24", "fd00:10:244:3::/64"},
+		},
+		{
+			index:    255,
+			expected: []string{"10.244.255.0/24", "fd00:10:244:ff::/64"},
+		},
+	} {
+		nodeCIDRs, err := podcidr.NodeCIDRs(clusterCIDRs, test.index)
+		require.NoError(t, err)
+
+		var actual []string
+
+		for _, nodeCIDR := range nodeCIDRs {
+			actual = append(actual, nodeCIDR.String())
+		}
+
+		assert.Equal(t, test.expected, actual)
+	}
+
+	_, err := podcidr.NodeCIDRs(clusterCIDRs, 256)
+	assert.Error(t, err, "the IPv4 pod CIDR only has 256 node pod CIDRs")
+
+	nodeCIDRs, err := podcidr.NodeCIDRs([]netip.Prefix{netip.MustParsePrefix("192.168.10.0/26")}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("192.168.10.0/26")}, nodeCIDRs, "the narrow pod CIDR is not split")
+
+	_, err = podcidr.NodeCIDRs([]netip.Prefix{netip.MustParsePrefix("192.168.10.0/26")}, 1)
+	assert.Error(t, err)
+}
+
+func TestNextAddress(t *testing.T) {
+	t.Parallel()
+
+	used := map[netip.Addr]struct{}{}
+
+	next := func(nodeCIDR string) (netip.Addr, error) {
+		addr, err := podcidr.NextAddress(netip.MustParsePrefix(nodeCIDR), func(addr netip.Addr) bool {
+			_, ok := used[addr]
+
+			return ok
+		})
+		if err == nil {
+			used[addr] = struct{}{}
+		}
+
+		return addr, err
+	}
+
+	for _, expected := range []string{"10.244.3.2", "10.244.3.3", "10.244.3.4"} {
+		addr, err := next("10.244.3.0/24")
+		require.NoError(t, err)
+		assert.Equal(t, expected, addr.String())
+	}
+
+	delete(used, netip.MustParseAddr("10.244.3.3"))
+
+	addr, err := next("10.244.3.0/24")
+	require.NoError(t, err)
+	assert.Equal(t, "10.244.3.3", addr.String())
+
+	addr, err = next("fd00:10:244:3::/64")
+	require.NoError(t, err)
+	assert.Equal(t, "fd00:10:244:3::2", addr.String())
+
+	_, err = next("10.244.4.0/30")
+	require.NoError(t, err)
+
+	_, err = next("10.244.4.0/30")
+	assert.Error(t, err, "the network, gateway and last addresses are not assigned")
+}
@@ -21,6 +21,8 @@ import (
 
 	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
 	"github.com/siderolabs/talemu/internal/pkg/machine/controllers"
+	"github.com/siderolabs/talemu/internal/pkg/machine/events"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
 	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
 	"github.com/siderolabs/talemu/internal/pkg/machine/network"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
@@ -41,11 +43,18 @@ type Runtime struct {
 }
 
 // NewRuntime creates new runtime.
-func NewRuntime(ctx context.Context, logger *zap.Logger, slot int, id string, globalState state.State,
-	kubernetes *kubefactory.Kubernetes, nc *network.Client, logSink *logging.ZapCore, baseKernelArgs string, schematicService *schematic.Service,
-	enterpriseChecker controllers.EnterpriseChecker, imageFactoryHost, bootFactoryURL string, nodeProxyingDisabled bool,
+func NewRuntime(ctx context.Context, logger *zap.Logger, slot int, id string, instance Instance, globalState state.State,
+	kubernetes *kubefactory.Kubernetes, nc *network.Client, serviceLogs *logging.ServiceLogs, kmsg *logging.Kmsg, history *events.History, baseKernelArgs string, schematicService *schematic.Service,
+	enterpriseChecker controllers.EnterpriseChecker, imageFactoryHost, bootFactoryURL string, nodeProxyingDisabled, kubeControllers bool, upgradeTimings controllers.UpgradeTimings,
+	faultInjector *faults.Injector,
+	powerOff func(),
 ) (*Runtime, error) {
-	stateDir := GetStateDir(id)
+	if faultInjector == nil {
+		faultInjector = faults.NewInjector()
+	}
+
+	stateDir := instance.GetStateDir(id)
+	certsDir := filepath.Join(stateDir, "certs")
 
 	err := os.MkdirAll(stateDir, 0o755)
 	if err != nil && !errors.Is(err, os.ErrExist) {
@@ -76,24 +85,40 @@ func NewRuntime(ctx context.Context, logger *zap.Logger, slot int, id string, gl
 		return nil, fmt.Errorf("failed to create local address provider: %w", err)
 	}
 
+	// the node leases are watched only by the node lifecycle controller of the embedded kube-controller-manager
+	var nodeLeaseControllers []controller.Controller
+
+	if kubeControllers {
+		nodeLeaseControllers = append(nodeLeaseControllers, &controllers.NodeLeaseController{
+			GlobalState: globalState,
+		})
+	}
+
 	controllers := []controller.Controller{
 		&controllers.ManagerController{
-			Slot: slot,
-			NC:   nc,
+			Slot:            slot,
+			NC:              nc,
+			InterfacePrefix: instance.InterfacePrefix,
+			Faults:          faultInjector,
 		},
 		&controllers.LinkSpecController{
 			NC: nc,
 		},
 		&controllers.LinkStatusController{
-			NC: nc,
+			NC:              nc,
+			InterfacePrefix: instance.InterfacePrefix,
 		},
 		&controllers.APIDController{
-			APID: services.NewAPID(id, st, globalState, imageFactoryHost, localAddressProvider, nodeProxyingDisabled),
+			APID:            services.NewAPID(id, st, globalState, imageFactoryHost, localAddressProvider, nodeProxyingDisabled, nc, faultInjector, serviceLogs, kmsg, history, powerOff, kubernetes),
+			InterfacePrefix: instance.InterfacePrefix,
 		},
 		&controllers.AddressSpecController{
 			NC: nc,
 		},
-		&controllers.GRPCTLSController{},
+		&controllers.GRPCTLSController{
+			NC:              nc,
+			InterfacePrefix: instance.InterfacePrefix,
+		},
 		&controllers.MachineTypeController{},
 		&controllers.HostnameConfigController{},
 		&controllers.HostnameMergeController{},
@@ -109,6 +134,7 @@ func NewRuntime(ctx context.Context, logger *zap.Logger, slot int, id string, gl
 		controllers.NewRootOSController(),
 		&controllers.ExtensionStatusController{
 			SchematicService: schematicService,
+			ServiceLogs:      serviceLogs,
 			ImageFactoryHost: imageFactoryHost,
 		},
 		&controllers.KernelCmdlineController{
@@ -132,6 +158,8 @@ func NewRuntime(ctx context.Context, logger *zap.Logger, slot int, id string, gl
 		&controllers.EtcdController{
 			GlobalState: globalState,
 			MachineID:   id,
+			Faults:      faultInjector,
+			ServiceLogs: serviceLogs,
 		},
 		&controllers.MountStatusController{},
 		&controllers.PerfStatsController{},
@@ -143,29 +171,58 @@ func NewRuntime(ctx context.Context, logger *zap.Logger, slot int, id string, gl
 		&controllers.KubernetesSecretsController{},
 		&controllers.KubernetesDynamicCertsController{},
 		&controllers.KubernetesController{
-			Kubernetes: kubernetes,
-			MachineID:  id,
+			Kubernetes:      kubernetes,
+			NC:              nc,
+			MachineID:       id,
+			CertsDir:        certsDir,
+			InterfacePrefix: instance.InterfacePrefix,
+			KubeControllers: kubeControllers,
 		},
 		controllers.NewRootKubernetesController(),
 		&controllers.KubernetesCertSANsController{},
 		&controllers.RenderSecretsStaticPodController{
-			MachineID: id,
+			CertsDir: certsDir,
 		},
 		&controllers.KubernetesNodeController{
-			MachineID:   id,
-			GlobalState: globalState,
+			MachineID:           id,
+			GlobalState:         globalState,
+			ServiceLogs:         serviceLogs,
+			KubeletRestartDelay: upgradeTimings.KubeletRestart,
 		},
 		&controllers.KubeconfigController{
 			GlobalState: globalState,
 		},
 		&controllers.StaticPodController{
-			MachineID: id,
+			MachineID:    id,
+			RestartDelay: upgradeTimings.StaticPodRestart,
 		},
-		&controllers.LogSinkController{
-			LogSink: logSink,
+		&controllers.KubeletPodController{
+			MachineID:   id,
+			GlobalState: globalState,
+			ServiceLogs: serviceLogs,
+		},
+		&controllers.DaemonSetPodController{
+			GlobalState:     globalState,
+			KubeControllers: kubeControllers,
+			RolloutDelay:    upgradeTimings.DaemonSetRollout,
+		},
+		controllers.NewBootstrapManifestsConfigController(),
+		&controllers.ManifestController{},
+		&controllers.ManifestApplyController{
+			GlobalState: globalState,
+		},
+		&controllers.KmsgLogConfigController{
+			BaseKernelArgs: baseKernelArgs,
+		},
+		&controllers.KmsgLogDeliveryController{
+			Kmsg:            kmsg,
+			NC:              nc,
+			InterfacePrefix: instance.InterfacePrefix,
 		},
 	}
 
+	controllers = append(controllers, nodeLeaseControllers...)
+
 	runtime, err := runtime.NewRuntime(st, logger)
 	if err != nil {
 		return nil, err
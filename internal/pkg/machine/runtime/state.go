@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/cosi-project/runtime/pkg/resource"
 	"github.com/cosi-project/runtime/pkg/resource/meta"
@@ -19,8 +20,11 @@ import (
 	"github.com/cosi-project/runtime/pkg/state/impl/store"
 	"github.com/cosi-project/runtime/pkg/state/impl/store/bolt"
 	"github.com/siderolabs/gen/xslices"
+	"github.com/siderolabs/talos/pkg/machinery/constants"
 	"go.etcd.io/bbolt"
 	"go.uber.org/zap"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/network"
 )
 
 // NamespacedState defines additional namespaced state to pass to the namespaced.NewState.
@@ -135,9 +139,49 @@ func newBoltStateBuilder(path string, options *bbolt.Options, compact bool, logg
 	}, boltStore, nil
 }
 
+// Instance keeps the settings which isolate the emulator processes running on the same host.
+type Instance struct {
+	// StateDir is the root directory of the emulator state.
+	StateDir string
+	// InterfacePrefix is the name prefix of the machine SideroLink interfaces, the machine slot is appended to it.
+	InterfacePrefix string
+	// Bridge is the host bridge of the machine network namespaces.
+	Bridge network.Bridge
+}
+
+// maxInstanceIDLength leaves room for the 5 digit slot in the 15 characters interface name.
+const maxInstanceIDLength = 10
+
+// NewInstance creates the settings of the emulator process.
+//
+// The instance ID replaces the default SideroLink interface name prefix and picks the bridge of the machine network namespaces,
+// empty ID keeps the defaults.
+func NewInstance(stateDir, instanceID string) (Instance, error) {
+	if len(instanceID) > maxInstanceIDLength {
+		return Instance{}, fmt.Errorf("instance ID %q is longer than %d characters", instanceID, maxInstanceIDLength)
+	}
+
+	if strings.ContainsFunc(instanceID, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-')
+	}) {
+		return Instance{}, fmt.Errorf("instance ID %q should contain only letters, digits and dashes", instanceID)
+	}
+
+	interfacePrefix := constants.SideroLinkName
+	if instanceID != "" {
+		interfacePrefix = instanceID
+	}
+
+	return Instance{
+		StateDir:        stateDir,
+		InterfacePrefix: interfacePrefix,
+		Bridge:          network.NewBridge(instanceID),
+	}, nil
+}
+
 // GetStateDir constructs state directory for the machine.
-func GetStateDir(id string) string {
-	return filepath.Join("_out/state/machines", id)
+func (i Instance) GetStateDir(id string) string {
+	return filepath.Join(i.StateDir, "machines", id)
 }
 
 // MachineID returns the stable unique identifier for the machine occupying the given slot.
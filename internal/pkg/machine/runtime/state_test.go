@@ -0,0 +1,39 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/network"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime"
+)
+
+func TestNewInstance(t *testing.T) {
+	t.Parallel()
+
+	instance, err := runtime.NewInstance("_out/state", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, "siderolink", instance.InterfacePrefix)
+	assert.Equal(t, network.DefaultBridge, instance.Bridge)
+	assert.Equal(t, "_out/state/machines/1000", instance.GetStateDir("1000"))
+
+	instance, err = runtime.NewInstance("/tmp/talemu-a", "emua")
+	require.NoError(t, err)
+
+	assert.Equal(t, "emua", instance.InterfacePrefix)
+	assert.Equal(t, "emua-br", instance.Bridge.Name)
+	assert.Equal(t, "/tmp/talemu-a/machines/1000", instance.GetStateDir("1000"))
+
+	_, err = runtime.NewInstance("_out/state", "toolonginstance")
+	require.ErrorContains(t, err, "longer than 10 characters")
+
+	_, err = runtime.NewInstance("_out/state", "emu/a")
+	require.ErrorContains(t, err, "only letters, digits and dashes")
+}
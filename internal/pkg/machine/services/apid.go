@@ -36,8 +36,14 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
+	emuconst "github.com/siderolabs/talemu/internal/pkg/constants"
+	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
+	"github.com/siderolabs/talemu/internal/pkg/machine/events"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
 	"github.com/siderolabs/talemu/internal/pkg/machine/network"
 	"github.com/siderolabs/talemu/internal/pkg/machine/services/apid/pkg/backend"
 	"github.com/siderolabs/talemu/internal/pkg/machine/services/apid/pkg/director"
@@ -48,24 +54,42 @@ type APID struct {
 	state                state.State
 	globalState          state.State
 	localAddressProvider director.LocalAddressProvider
+	faults               *faults.Injector
 	shutdown             chan struct{}
 	eg                   *errgroup.Group
 	sharedMachineState   *machineState
+	nc                   *network.Client
 	machineID            string
 	imageFactoryHost     string
 	nodeProxyingDisabled bool
 }
 
 // NewAPID creates new APID.
-func NewAPID(machineID string, state state.State, globalState state.State, imageFactoryHost string, localAddressProvider director.LocalAddressProvider, nodeProxyingDisabled bool) *APID {
+//
+// The fault injector can be nil, then the calls are never altered.
+// The service logs get the apid access log and the machined activity, they can be nil, then they are kept by the APID only.
+// The kernel ring buffer is rebooted with the machine, it can be nil, then it is kept by the APID only.
+// The event history gets the sequence events, it can be nil, then it is kept by the APID only.
+// The powerOff function is called when the machine is asked to power off, e.g. by a reset without a reboot.
+// The etcd snapshots are taken from and restored to the Kubernetes etcd, they are not supported if it is nil.
+func NewAPID(machineID string, state state.State, globalState state.State, imageFactoryHost string, localAddressProvider director.LocalAddressProvider, nodeProxyingDisabled bool,
+	nc *network.Client, faultInjector *faults.Injector, serviceLogs *logging.ServiceLogs, kmsg *logging.Kmsg, history *events.History, powerOff func(),
+	kubernetes *kubefactory.Kubernetes,
+) *APID {
+	if faultInjector == nil {
+		faultInjector = faults.NewInjector()
+	}
+
 	return &APID{
+		faults:               faultInjector,
 		machineID:            machineID,
+		nc:                   nc,
 		state:                state,
 		globalState:          globalState,
 		imageFactoryHost:     imageFactoryHost,
 		localAddressProvider: localAddressProvider,
 		nodeProxyingDisabled: nodeProxyingDisabled,
-		sharedMachineState:   newMachineState(),
+		sharedMachineState:   newMachineState(powerOff, serviceLogs, kmsg, history, kubernetes),
 	}
 }
 
@@ -81,11 +105,7 @@ func (apid *APID) Run(ctx context.Context, endpoint netip.Prefix, logger *zap.Lo
 
 	logger.Info("starting APID", zap.String("endpoint", endpoint.Addr().String()), zap.String("interface", iface), zap.Bool("insecure", apiCerts == nil))
 
-	var lc net.ListenConfig
-
-	lc.Control = network.BindToInterface(iface)
-
-	lis, err := lc.Listen(ctx, "tcp", net.JoinHostPort(endpoint.Addr().String(), strconv.FormatInt(constants.ApidPort, 10)))
+	lis, err := apid.nc.Listen(ctx, iface, net.JoinHostPort(endpoint.Addr().String(), strconv.FormatInt(constants.ApidPort, 10)))
 	if err != nil {
 		return err
 	}
@@ -125,6 +145,7 @@ func (apid *APID) Run(ctx context.Context, endpoint netip.Prefix, logger *zap.Lo
 		"/machine.MachineService/Copy",
 		"/machine.MachineService/DiskUsage",
 		"/machine.MachineService/Dmesg",
+		"/machine.MachineService/EtcdRecover",
 		"/machine.MachineService/EtcdSnapshot",
 		"/machine.MachineService/Events",
 		"/machine.MachineService/ImageList",
@@ -156,6 +177,8 @@ func (apid *APID) Run(ctx context.Context, endpoint netip.Prefix, logger *zap.Lo
 			),
 		),
 		grpc.SharedWriteBuffer(true),
+		grpc.ChainUnaryInterceptor(apid.logUnaryCall, apid.faults.UnaryServerInterceptor(faults.TargetAPID)),
+		grpc.ChainStreamInterceptor(apid.logStreamCall, apid.faults.StreamServerInterceptor(faults.TargetAPID)),
 	}
 
 	s := grpc.NewServer(
@@ -176,8 +199,14 @@ func (apid *APID) Run(ctx context.Context, endpoint netip.Prefix, logger *zap.Lo
 		grpc.Creds(insecure.NewCredentials()),
 		grpc.ForceServerCodecV2(proxy.Codec()),
 		grpc.SharedWriteBuffer(true),
-		grpc.ChainUnaryInterceptor(recovery.UnaryServerInterceptor(recoveryOption)),
-		grpc.ChainStreamInterceptor(recovery.StreamServerInterceptor(recoveryOption)),
+		grpc.ChainUnaryInterceptor(
+			recovery.UnaryServerInterceptor(recoveryOption),
+			apid.faults.UnaryServerInterceptor(faults.TargetMachined),
+		),
+		grpc.ChainStreamInterceptor(
+			recovery.StreamServerInterceptor(recoveryOption),
+			apid.faults.StreamServerInterceptor(faults.TargetMachined),
+		),
 	)
 
 	machine.RegisterMachineServiceServer(localServer, machineSrv)
@@ -439,3 +468,35 @@ func ServerGracefulStop(server *grpc.Server, shutdownCtx context.Context) { //no
 		server.Stop()
 	}
 }
+
+// logUnaryCall writes the unary call to the apid access log.
+func (apid *APID) logUnaryCall(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+
+	apid.logCall(ctx, info.FullMethod, start, err)
+
+	return resp, err
+}
+
+// logStreamCall writes the streaming call to the apid access log, the proxied calls are all handled as streams.
+func (apid *APID) logStreamCall(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+
+	err := handler(srv, ss)
+
+	apid.logCall(ss.Context(), info.FullMethod, start, err)
+
+	return err
+}
+
+func (apid *APID) logCall(ctx context.Context, method string, start time.Time, err error) {
+	remote := "unknown"
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remote = p.Addr.String()
+	}
+
+	apid.sharedMachineState.serviceLogs.Printf(emuconst.APIDService, "%s %s %s %s", status.Code(err), method, time.Since(start).Round(time.Microsecond), remote)
+}
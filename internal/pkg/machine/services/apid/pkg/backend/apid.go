@@ -8,6 +8,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	stdnet "net"
 	"sync"
 	"time"
 
@@ -23,6 +24,8 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protowire"
+
+	emunet "github.com/siderolabs/talemu/internal/pkg/machine/network"
 )
 
 // GracefulShutdownTimeout is the timeout for graceful shutdown of the backend connection.
@@ -116,6 +119,10 @@ func (a *APID) GetConnection(ctx context.Context, _ string) (context.Context, *g
 		),
 		grpc.WithDefaultCallOptions(grpc.ForceCodecV2(proxy.Codec())),
 		grpc.WithSharedWriteBuffer(true),
+		// the machines running in the userspace network mode are reachable only through the in-process dialer
+		grpc.WithContextDialer(func(ctx context.Context, address string) (stdnet.Conn, error) {
+			return emunet.DialContext(ctx, "tcp", address)
+		}),
 	)
 
 	return outCtx, a.conn, err
@@ -0,0 +1,213 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
+	"github.com/siderolabs/talos/pkg/machinery/resources/secrets"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
+	machinenetwork "github.com/siderolabs/talemu/internal/pkg/machine/network"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
+)
+
+// SetNodeNotReady marks the node of the machine not ready, as the node lifecycle controller does
+// when the kubelet stops posting the node status.
+//
+// Nothing is done if the machine is not configured, or its node is not registered.
+func SetNodeNotReady(ctx context.Context, st, globalState state.State) error {
+	cfg, err := machineconfig.GetComplete(ctx, st)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	client, nodename, err := kubernetesNode(ctx, st, globalState, cfg)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	node, err := client.CoreV1().Nodes().Get(ctx, nodename, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for i := range node.Status.Conditions {
+		condition := &node.Status.Conditions[i]
+
+		if condition.Type != v1.NodeReady {
+			continue
+		}
+
+		condition.Status = v1.ConditionUnknown
+		condition.Reason = "NodeStatusUnknown"
+		condition.Message = "Kubelet stopped posting node status."
+		condition.LastTransitionTime = metav1.Now()
+	}
+
+	_, err = client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{})
+
+	return err
+}
+
+// kubernetesNode returns the client of the cluster the machine is in, and the name of the machine node.
+//
+// The control planes use their own admin kubeconfig, the workers use the one the emulator keeps for the cluster.
+func kubernetesNode(ctx context.Context, st, globalState state.State, machineConfig *config.MachineConfig) (*kubernetes.Clientset, string, error) {
+	nodename, err := safe.ReaderGetByID[*k8s.Nodename](ctx, st, k8s.NodenameID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var kubeconfig []byte
+
+	kubernetesSecrets, err := safe.ReaderGetByID[*secrets.Kubernetes](ctx, st, secrets.KubernetesID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return nil, "", err
+	}
+
+	if kubernetesSecrets != nil {
+		kubeconfig = []byte(kubernetesSecrets.TypedSpec().LocalhostAdminKubeconfig)
+	}
+
+	if kubeconfig == nil {
+		var cluster *emu.ClusterStatus
+
+		cluster, err = safe.ReaderGetByID[*emu.ClusterStatus](ctx, globalState, machineConfig.Provider().Cluster().ID())
+		if err != nil {
+			return nil, "", err
+		}
+
+		kubeconfig = cluster.TypedSpec().Value.Kubeconfig
+
+		if kubeconfig == nil {
+			return nil, "", fmt.Errorf("the kubeconfig is not present in the cluster yet")
+		}
+	}
+
+	cfg, err := clientcmd.NewClientConfigFromBytes(kubeconfig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientCfg, err := cfg.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the apiserver might be running in the userspace network
+	clientCfg.Dial = machinenetwork.DialContext
+
+	client, err := kubernetes.NewForConfig(clientCfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, nodename.TypedSpec().Nodename, nil
+}
+
+// cordonAndDrain marks the node unschedulable and evicts its pods, as Talos does before leaving the cluster.
+//
+// The static pod mirrors and the DaemonSet pods are left in place, as kubectl drain does.
+func cordonAndDrain(ctx context.Context, client *kubernetes.Clientset, node string) error {
+	if _, err := client.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, []byte(`{"spec":{"unschedulable":true}}`), metav1.PatchOptions{}); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to cordon the node: %w", err)
+	}
+
+	return forEachNodePod(ctx, client, node, func(pod *v1.Pod) error {
+		if isDaemonSetPod(pod) {
+			return nil
+		}
+
+		err := client.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to evict pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+
+		return nil
+	})
+}
+
+// deleteNodePods removes the pods of the node, as they are gone together with the EPHEMERAL partition.
+//
+// The static pod mirrors are rendered from the machine config, so they come back after the reboot and are kept.
+func deleteNodePods(ctx context.Context, client *kubernetes.Clientset, node string) error {
+	return forEachNodePod(ctx, client, node, func(pod *v1.Pod) error {
+		err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, *metav1.NewDeleteOptions(0))
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+
+		return nil
+	})
+}
+
+// forEachNodePod calls the function for each pod of the node, except for the static pod mirrors.
+func forEachNodePod(ctx context.Context, client *kubernetes.Clientset, node string, f func(pod *v1.Pod) error) error {
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list the node pods: %w", err)
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		if _, ok := pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+
+		if err = f(pod); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isDaemonSetPod(pod *v1.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return true
+		}
+	}
+
+	return false
+}
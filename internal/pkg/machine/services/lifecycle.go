@@ -32,7 +32,7 @@ type LifecycleService struct {
 // NewLifecycleService creates a new LifecycleService.
 func NewLifecycleService(st state.State, imageFactoryHost string, logger *zap.Logger, sharedMachineState *machineState) *LifecycleService {
 	if sharedMachineState == nil {
-		sharedMachineState = newMachineState()
+		sharedMachineState = newMachineState(nil, nil, nil, nil, nil)
 	}
 
 	return &LifecycleService{state: st, imageFactoryHost: imageFactoryHost, logger: logger, sharedMachineState: sharedMachineState}
@@ -5,9 +5,13 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -23,7 +27,10 @@ import (
 	"github.com/siderolabs/talos/pkg/machinery/api/common"
 	"github.com/siderolabs/talos/pkg/machinery/api/machine"
 	"github.com/siderolabs/talos/pkg/machinery/api/storage"
+	talosconfig "github.com/siderolabs/talos/pkg/machinery/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/configdiff"
 	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	talosconstants "github.com/siderolabs/talos/pkg/machinery/constants"
 	"github.com/siderolabs/talos/pkg/machinery/meta"
 	"github.com/siderolabs/talos/pkg/machinery/resources/block"
 	"github.com/siderolabs/talos/pkg/machinery/resources/config"
@@ -39,9 +46,17 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/siderolabs/talemu/api/specs"
+	emuconst "github.com/siderolabs/talemu/internal/pkg/constants"
+	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
+	"github.com/siderolabs/talemu/internal/pkg/machine/etcdcluster"
+	"github.com/siderolabs/talemu/internal/pkg/machine/events"
+	machinehardware "github.com/siderolabs/talemu/internal/pkg/machine/hardware"
+	"github.com/siderolabs/talemu/internal/pkg/machine/logging"
 	"github.com/siderolabs/talemu/internal/pkg/machine/machineconfig"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
 	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/talos"
+	"github.com/siderolabs/talemu/internal/pkg/machine/vfs"
 )
 
 // MachineService is a GRPC service emulating the behavior of the Talos machine service.
@@ -61,7 +76,7 @@ type MachineService struct {
 // across apid restarts; when nil (e.g. in tests) a fresh one is allocated.
 func NewMachineService(machineID string, state, globalState state.State, imageFactoryHost string, logger *zap.Logger, sharedMachineState *machineState) *MachineService {
 	if sharedMachineState == nil {
-		sharedMachineState = newMachineState()
+		sharedMachineState = newMachineState(nil, nil, nil, nil, nil)
 	}
 
 	return &MachineService{
@@ -96,31 +111,55 @@ func (c *MachineService) ApplyConfiguration(ctx context.Context, request *machin
 		return nil, err
 	}
 
-	if err = c.state.Create(ctx, cfg); err != nil {
-		if !state.IsConflictError(err) {
-			return nil, err
-		}
+	allocated := existingCompleteConfig == nil && !isPartialConfig
+
+	mode, modeDetails, err := applyMode(request, existingCompleteConfig != nil, allocated)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.GetDryRun() {
+		return c.dryRunApplyConfiguration(ctx, cfgProvider, mode, modeDetails)
+	}
 
-		var r resource.Resource
+	c.logf("apply config request: mode %s", strings.ToLower(mode.String()))
 
-		// update config
-		r, err = c.state.Get(ctx, cfg.Metadata())
-		if err != nil {
+	switch mode { //nolint:exhaustive
+	case machine.ApplyConfigurationRequest_STAGED:
+		if err = machineconfig.Put(ctx, c.state, cfgProvider, config.PersistentID); err != nil {
 			return nil, err
 		}
+	case machine.ApplyConfigurationRequest_TRY:
+		if err = c.tryConfiguration(ctx, cfgProvider, existingCompleteConfig, request.GetTryModeTimeout()); err != nil {
+			return nil, err
+		}
+	default:
+		// a regular apply confirms the config applied in try mode
+		c.sharedMachineState.tryConfig.cancel()
 
-		cfg.Metadata().SetVersion(r.Metadata().Version())
+		if err = machineconfig.Put(ctx, c.state, cfgProvider, config.ActiveID); err != nil {
+			return nil, err
+		}
 
-		if err = c.state.Update(ctx, cfg); err != nil {
+		if err = machineconfig.Put(ctx, c.state, cfgProvider, config.PersistentID); err != nil {
 			return nil, err
 		}
 	}
 
-	allocated := existingCompleteConfig == nil && !isPartialConfig
+	resp := &machine.ApplyConfigurationResponse{
+		Messages: []*machine.ApplyConfiguration{{Mode: mode, ModeDetails: modeDetails}},
+	}
+
+	c.logf("applied the machine config: %s", modeDetails)
+
 	if !allocated {
-		return &machine.ApplyConfigurationResponse{
-			Messages: []*machine.ApplyConfiguration{{Mode: machine.ApplyConfigurationRequest_NO_REBOOT}},
-		}, nil
+		if request.GetMode() == machine.ApplyConfigurationRequest_REBOOT { //nolint:staticcheck
+			if err = c.requestReboot(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		return resp, nil
 	}
 
 	id := cfgProvider.Cluster().ID()
@@ -170,17 +209,116 @@ func (c *MachineService) ApplyConfiguration(ctx context.Context, request *machin
 		return nil, err
 	}
 
+	return resp, nil
+}
+
+// applyMode resolves the mode the config is applied in, and describes it the way Talos does.
+//
+// The emulated machine applies any config change on the fly, so the auto mode never needs a reboot,
+// except for the first complete config, which installs Talos on the machine in maintenance mode.
+func applyMode(request *machine.ApplyConfigurationRequest, configured, allocated bool) (machine.ApplyConfigurationRequest_Mode, string, error) {
+	mode := request.GetMode()
+
+	if !configured && (mode == machine.ApplyConfigurationRequest_STAGED || mode == machine.ApplyConfigurationRequest_TRY) {
+		return 0, "", status.Errorf(codes.InvalidArgument, "apply configuration in %s mode is not supported in maintenance mode", mode)
+	}
+
+	switch mode {
+	case machine.ApplyConfigurationRequest_STAGED:
+		return mode, "Staged configuration to be applied after the next reboot", nil
+	case machine.ApplyConfigurationRequest_TRY:
+		return mode, fmt.Sprintf("Applied configuration without a reboot\nThe config is applied in 'try' mode and will be automatically reverted back in %s",
+			tryModeTimeout(request.GetTryModeTimeout())), nil
+	case machine.ApplyConfigurationRequest_REBOOT: //nolint:staticcheck
+		return mode, "Applied configuration with a reboot", nil
+	case machine.ApplyConfigurationRequest_AUTO, machine.ApplyConfigurationRequest_NO_REBOOT:
+		if allocated {
+			return machine.ApplyConfigurationRequest_REBOOT, "Applied configuration with a reboot", nil //nolint:staticcheck
+		}
+
+		return machine.ApplyConfigurationRequest_NO_REBOOT, "Applied configuration without a reboot", nil
+	}
+
+	return 0, "", status.Errorf(codes.InvalidArgument, "unknown apply configuration mode %s", mode)
+}
+
+// tryModeTimeout returns the time after which the config applied in try mode is reverted.
+func tryModeTimeout(timeout *durationpb.Duration) time.Duration {
+	if timeout == nil || timeout.AsDuration() <= 0 {
+		return talosconstants.ConfigTryTimeout
+	}
+
+	return timeout.AsDuration()
+}
+
+// dryRunApplyConfiguration describes the changes the config would make without applying it.
+//
+// The staged config is compared with the persistent config, any other one with the active config.
+func (c *MachineService) dryRunApplyConfiguration(ctx context.Context, cfgProvider talosconfig.Provider, mode machine.ApplyConfigurationRequest_Mode,
+	modeDetails string,
+) (*machine.ApplyConfigurationResponse, error) {
+	id := config.ActiveID
+	if mode == machine.ApplyConfigurationRequest_STAGED {
+		id = config.PersistentID
+	}
+
+	var current talosconfig.Encoder
+
+	currentConfig, err := safe.StateGetByID[*config.MachineConfig](ctx, c.state, id)
+	if err != nil {
+		if !state.IsNotFoundError(err) {
+			return nil, err
+		}
+	} else {
+		current = currentConfig.Provider()
+	}
+
+	diff, err := configdiff.DiffConfigs(current, cfgProvider)
+	if err != nil {
+		return nil, err
+	}
+
 	return &machine.ApplyConfigurationResponse{
 		Messages: []*machine.ApplyConfiguration{
 			{
-				Mode: machine.ApplyConfigurationRequest_REBOOT, //nolint:staticcheck
+				Mode:        mode,
+				ModeDetails: fmt.Sprintf("Dry run summary:\n%s (skipped in dry-run).\n\nConfig diff:\n\n%s", modeDetails, diff),
 			},
 		},
 	}, nil
 }
 
+// tryConfiguration applies the config without persisting it, and reverts to the previous config after the timeout,
+// unless the config is confirmed by a regular apply, or the machine reboots into the persistent config.
+func (c *MachineService) tryConfiguration(ctx context.Context, cfgProvider talosconfig.Provider, previous *config.MachineConfig, timeout *durationpb.Duration) error {
+	if err := machineconfig.Put(ctx, c.state, cfgProvider, config.ActiveID); err != nil {
+		return err
+	}
+
+	previousProvider := previous.Provider()
+	logger := c.logger
+	st := c.state
+
+	c.sharedMachineState.tryConfig.arm(tryModeTimeout(timeout), func() {
+		revertCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := machineconfig.Put(revertCtx, st, previousProvider, config.ActiveID); err != nil {
+			logger.Error("failed to revert the config applied in try mode", zap.Error(err))
+
+			return
+		}
+
+		logger.Info("reverted the config applied in try mode")
+	})
+
+	return nil
+}
+
 // Bootstrap implements machine.MachineServiceServer.
-func (c *MachineService) Bootstrap(ctx context.Context, _ *machine.BootstrapRequest) (*machine.BootstrapResponse, error) {
+//
+// The etcd recovery restores the Kubernetes state of the cluster from the snapshot uploaded with EtcdRecover.
+func (c *MachineService) Bootstrap(ctx context.Context, req *machine.BootstrapRequest) (*machine.BootstrapResponse, error) {
 	config, err := machineconfig.GetComplete(ctx, c.state)
 	if err != nil {
 		if state.IsNotFoundError(err) {
@@ -205,6 +343,12 @@ func (c *MachineService) Bootstrap(ctx context.Context, _ *machine.BootstrapRequ
 		return nil, status.Errorf(codes.InvalidArgument, "the cluster was already bootstrapped")
 	}
 
+	if req.GetRecoverEtcd() {
+		if err = c.recoverEtcd(ctx, id, req.GetRecoverSkipHashCheck()); err != nil {
+			return nil, err
+		}
+	}
+
 	if _, err = safe.StateUpdateWithConflicts(ctx, c.globalState, clusterStatus.Metadata(), func(s *emu.ClusterStatus) error {
 		s.TypedSpec().Value.Bootstrapped = true
 
@@ -216,36 +360,271 @@ func (c *MachineService) Bootstrap(ctx context.Context, _ *machine.BootstrapRequ
 	return &machine.BootstrapResponse{}, nil
 }
 
+// recoverEtcd restores the cluster etcd state from the uploaded snapshot.
+func (c *MachineService) recoverEtcd(ctx context.Context, clusterID string, skipHashCheck bool) error {
+	snapshot := c.sharedMachineState.etcdRecovery.get()
+	if snapshot == nil {
+		return status.Error(codes.FailedPrecondition, "etcd recovery snapshot is not uploaded")
+	}
+
+	kvs, err := kubefactory.ReadSnapshot(ctx, snapshot, skipHashCheck)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid etcd snapshot: %s", err)
+	}
+
+	if c.sharedMachineState.kubernetes == nil {
+		return errEtcdSnapshotsUnsupported
+	}
+
+	if err = c.sharedMachineState.kubernetes.RestoreEtcdState(ctx, clusterID, kvs); err != nil {
+		return fmt.Errorf("failed to recover etcd: %w", err)
+	}
+
+	c.sharedMachineState.etcdRecovery.set(nil)
+
+	c.sharedMachineState.serviceLogs.Printf(emuconst.ETCDService, "recovered %d keys from the snapshot", len(kvs))
+
+	return nil
+}
+
 // Reset implements machine.MachineServiceServer.
-func (c *MachineService) Reset(ctx context.Context, request *machine.ResetRequest) (*machine.ResetResponse, error) {
-	if slices.IndexFunc(request.SystemPartitionsToWipe, func(s *machine.ResetPartitionSpec) bool {
-		return s.Label == "STATE"
-	}) == -1 {
-		return nil, status.Errorf(codes.Unimplemented, "this reset mode is not supported")
+//
+// A graceful reset leaves etcd and drains the node first.
+// Wiping STATE brings the machine back into maintenance mode, and wiping EPHEMERAL drops the cached images and the node pods.
+// The machine reboots after the reset, or powers off if the reboot is not requested.
+func (c *MachineService) Reset(ctx context.Context, request *machine.ResetRequest) (_ *machine.ResetResponse, err error) {
+	if !c.sharedMachineState.sequenceMu.TryLock() {
+		return nil, errSequenceInProgress
 	}
+	defer c.sharedMachineState.sequenceMu.Unlock()
 
-	cfg, err := machineconfig.GetComplete(ctx, c.state)
+	wipeState, wipeEphemeral, err := systemPartitionsToWipe(request)
 	if err != nil {
-		if state.IsNotFoundError(err) {
-			return nil, status.Errorf(codes.InvalidArgument, "the machine is not configured")
-		}
+		return nil, err
+	}
 
+	if err = c.validateUserDisksToWipe(ctx, request); err != nil {
 		return nil, err
 	}
 
-	if err = destroyResourceByID[*config.MachineConfig](ctx, c.state, cfg.Metadata().ID()); err != nil {
+	if !request.GetReboot() && c.sharedMachineState.powerOff == nil {
+		return nil, errPowerOffUnsupported
+	}
+
+	cfg, err := machineconfig.GetComplete(ctx, c.state)
+	if err != nil && !state.IsNotFoundError(err) {
 		return nil, err
 	}
 
+	if cfg == nil && wipeState {
+		return nil, status.Errorf(codes.InvalidArgument, "the machine is not configured")
+	}
+
+	actorID, stop := c.startSequence("reset")
+	defer func() { stop(err) }()
+
+	if cfg != nil && request.GetGraceful() {
+		if err = c.leaveCluster(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if wipeEphemeral {
+		if err = c.wipeEphemeral(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if wipeState {
+		if err = c.wipeState(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.GetReboot() {
+		if err = c.requestReboot(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		c.schedulePowerOff()
+	}
+
+	return &machine.ResetResponse{
+		Messages: []*machine.Reset{
+			{
+				ActorId: actorID,
+			},
+		},
+	}, nil
+}
+
+// powerOffDelay is the time the machine keeps running after the power off was requested.
+const powerOffDelay = time.Second
+
+// errPowerOffUnsupported is returned when the machine runs without the power control, e.g. in tests.
+var errPowerOffUnsupported = status.Error(codes.Unimplemented, "the machine can not be powered off")
+
+// schedulePowerOff powers off the machine after a short delay, which gives the response a chance to reach the client.
+func (c *MachineService) schedulePowerOff() {
+	time.AfterFunc(powerOffDelay, c.sharedMachineState.powerOff)
+}
+
+// systemPartitionsToWipe returns which of the system partitions the reset wipes.
+//
+// Wiping all partitions is requested by the empty list, and the user disks wipe mode doesn't touch the system disk.
+func systemPartitionsToWipe(request *machine.ResetRequest) (wipeState, wipeEphemeral bool, err error) {
+	if request.GetMode() == machine.ResetRequest_USER_DISKS {
+		return false, false, nil
+	}
+
+	if len(request.GetSystemPartitionsToWipe()) == 0 {
+		return true, true, nil
+	}
+
+	for _, spec := range request.GetSystemPartitionsToWipe() {
+		switch spec.GetLabel() {
+		case talosconstants.StatePartitionLabel:
+			wipeState = true
+		case talosconstants.EphemeralPartitionLabel:
+			wipeEphemeral = true
+		default:
+			return false, false, status.Errorf(codes.Unimplemented, "wiping the %s partition is not supported", spec.GetLabel())
+		}
+	}
+
+	return wipeState, wipeEphemeral, nil
+}
+
+// validateUserDisksToWipe checks that the user disks exist and are not the system disk.
+//
+// The emulated disks hold no data, so there is nothing else to wipe.
+func (c *MachineService) validateUserDisksToWipe(ctx context.Context, request *machine.ResetRequest) error {
+	if request.GetMode() == machine.ResetRequest_SYSTEM_DISK {
+		return nil
+	}
+
+	systemDisk, err := safe.StateGetByID[*block.SystemDisk](ctx, c.state, block.SystemDiskID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return err
+	}
+
+	for _, devPath := range request.GetUserDisksToWipe() {
+		id := strings.TrimPrefix(devPath, "/dev/")
+
+		if _, err = safe.StateGetByID[*block.Disk](ctx, c.state, id); err != nil {
+			if state.IsNotFoundError(err) {
+				return status.Errorf(codes.InvalidArgument, "disk %q not found", devPath)
+			}
+
+			return err
+		}
+
+		if systemDisk != nil && systemDisk.TypedSpec().DiskID == id {
+			return status.Errorf(codes.InvalidArgument, "disk %q is the system disk", devPath)
+		}
+	}
+
+	return nil
+}
+
+// leaveCluster cordons and drains the Kubernetes node, and removes the control plane from etcd.
+func (c *MachineService) leaveCluster(ctx context.Context, cfg *config.MachineConfig) error {
+	if err := c.drainNode(ctx, cfg); err != nil {
+		return err
+	}
+
+	if !cfg.Provider().Machine().Type().IsControlPlane() {
+		return nil
+	}
+
+	member, err := safe.ReaderGetByID[*etcd.Member](ctx, c.state, etcd.LocalMemberID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return fmt.Errorf("failed to get etcd member %w", err)
+	}
+
+	if member == nil || member.TypedSpec().MemberID == "" {
+		return nil
+	}
+
+	return c.denyEtcdMember(ctx, cfg.Provider().Cluster().ID(), member.TypedSpec().MemberID)
+}
+
+// drainNode cordons and drains the Kubernetes node of the machine.
+//
+// The drain is skipped if the cluster can't be reached, as there is nothing to drain the workloads from then.
+func (c *MachineService) drainNode(ctx context.Context, cfg *config.MachineConfig) error {
+	client, node, err := kubernetesNode(ctx, c.state, c.globalState, cfg)
+	if err != nil {
+		if !state.IsNotFoundError(err) {
+			c.logger.Warn("skipped draining the node", zap.Error(err))
+		}
+
+		return nil
+	}
+
+	drainCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if err = cordonAndDrain(drainCtx, client, node); err != nil {
+		return status.Errorf(codes.FailedPrecondition, "failed to drain the node: %s", err)
+	}
+
+	return nil
+}
+
+// wipeEphemeral drops the cached images and the pods of the node, the machine config is kept.
+func (c *MachineService) wipeEphemeral(ctx context.Context, cfg *config.MachineConfig) error {
+	images, err := safe.StateListAll[*talos.CachedImage](ctx, c.state)
+	if err != nil {
+		return err
+	}
+
+	if err = images.ForEachErr(func(r *talos.CachedImage) error {
+		return c.state.Destroy(ctx, r.Metadata())
+	}); err != nil {
+		return err
+	}
+
+	if cfg == nil {
+		return nil
+	}
+
+	client, node, err := kubernetesNode(ctx, c.state, c.globalState, cfg)
+	if err != nil {
+		if !state.IsNotFoundError(err) {
+			c.logger.Warn("skipped removing the node pods", zap.Error(err))
+		}
+
+		return nil
+	}
+
+	deleteCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return deleteNodePods(deleteCtx, client, node)
+}
+
+// wipeState removes the machine config, so the machine gets back into maintenance mode, and the machine leaves the cluster.
+func (c *MachineService) wipeState(ctx context.Context, cfg *config.MachineConfig) error {
+	c.sharedMachineState.tryConfig.cancel()
+
+	if err := destroyResourceByID[*config.MachineConfig](ctx, c.state, config.PersistentID); err != nil && !state.IsNotFoundError(err) {
+		return err
+	}
+
+	if err := destroyResourceByID[*config.MachineConfig](ctx, c.state, cfg.Metadata().ID()); err != nil {
+		return err
+	}
+
 	id := cfg.Provider().Cluster().ID()
 
 	clusterStatus, err := safe.ReaderGetByID[*emu.ClusterStatus](ctx, c.globalState, id)
 	if err != nil {
 		if state.IsNotFoundError(err) {
-			return nil, status.Errorf(codes.Internal, "the emulator doesn't have the cluster with id %q", id)
+			return status.Errorf(codes.Internal, "the emulator doesn't have the cluster with id %q", id)
 		}
 
-		return nil, err
+		return err
 	}
 
 	clusterStatus, err = safe.StateUpdateWithConflicts(ctx, c.globalState, clusterStatus.Metadata(), func(r *emu.ClusterStatus) error {
@@ -264,35 +643,26 @@ func (c *MachineService) Reset(ctx context.Context, request *machine.ResetReques
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if clusterStatus.TypedSpec().Value.ControlPlanes == 0 && clusterStatus.TypedSpec().Value.Workers == 0 {
 		if _, err = c.globalState.Teardown(ctx, clusterStatus.Metadata()); err != nil {
-			return nil, err
+			return err
 		}
 	}
 
 	machineStatus := emu.NewMachineStatus(emu.NamespaceName, c.machineID)
 
-	if _, err = safe.StateUpdateWithConflicts(ctx, c.globalState, machineStatus.Metadata(), func(r *emu.MachineStatus) error {
+	_, err = safe.StateUpdateWithConflicts(ctx, c.globalState, machineStatus.Metadata(), func(r *emu.MachineStatus) error {
 		r.Metadata().Labels().Delete(emu.LabelCluster)
 		r.Metadata().Labels().Delete(emu.LabelControlPlaneRole)
 		r.Metadata().Labels().Delete(emu.LabelWorkerRole)
 
 		return nil
-	}); err != nil {
-		return nil, err
-	}
+	})
 
-	return &machine.ResetResponse{
-		Messages: []*machine.Reset{
-			{
-				// TODO: implement some real actor id
-				ActorId: "0",
-			},
-		},
-	}, nil
+	return err
 }
 
 // Version implements machine.MachineServiceServer.
@@ -324,7 +694,7 @@ func (c *MachineService) Version(ctx context.Context, _ *emptypb.Empty) (*machin
 }
 
 // Upgrade implements machine.MachineServiceServer.
-func (c *MachineService) Upgrade(ctx context.Context, req *machine.UpgradeRequest) (*machine.UpgradeResponse, error) {
+func (c *MachineService) Upgrade(ctx context.Context, req *machine.UpgradeRequest) (_ *machine.UpgradeResponse, err error) {
 	if !c.sharedMachineState.sequenceMu.TryLock() {
 		return nil, errSequenceInProgress
 	}
@@ -343,6 +713,11 @@ func (c *MachineService) Upgrade(ctx context.Context, req *machine.UpgradeReques
 		return nil, err
 	}
 
+	actorID, stop := c.startSequence("upgrade")
+	defer func() { stop(err) }()
+
+	c.logf("upgrade request received: image %s, stage %t, force %t", req.GetImage(), req.GetStage(), req.GetForce())
+
 	changed, err := setImage(ctx, c.state, c.imageFactoryHost, req.Image)
 	if err != nil {
 		return nil, err
@@ -351,7 +726,7 @@ func (c *MachineService) Upgrade(ctx context.Context, req *machine.UpgradeReques
 	// Only reboot when the target image actually differs, so a redundant upgrade (e.g. an Omni
 	// retry to the running version) does not needlessly drop the apid connection.
 	if changed {
-		if err := c.requestReboot(ctx); err != nil {
+		if err = c.requestReboot(ctx); err != nil {
 			return nil, err
 		}
 	}
@@ -360,101 +735,115 @@ func (c *MachineService) Upgrade(ctx context.Context, req *machine.UpgradeReques
 		Messages: []*machine.Upgrade{
 			{
 				Ack:     "Upgrade request received",
-				ActorId: "0",
+				ActorId: actorID,
 			},
 		},
 	}, nil
 }
 
 // Reboot implements machine.MachineServiceServer.
-func (c *MachineService) Reboot(ctx context.Context, _ *machine.RebootRequest) (*machine.RebootResponse, error) {
+func (c *MachineService) Reboot(ctx context.Context, _ *machine.RebootRequest) (_ *machine.RebootResponse, err error) {
 	if !c.sharedMachineState.sequenceMu.TryLock() {
 		return nil, errSequenceInProgress
 	}
 	defer c.sharedMachineState.sequenceMu.Unlock()
 
-	if err := c.requestReboot(ctx); err != nil {
+	actorID, stop := c.startSequence("reboot")
+	defer func() { stop(err) }()
+
+	c.logf("reboot via API received")
+
+	if err = c.requestReboot(ctx); err != nil {
 		return nil, err
 	}
 
 	return &machine.RebootResponse{
 		Messages: []*machine.Reboot{
-			{},
+			{
+				ActorId: actorID,
+			},
 		},
 	}, nil
 }
 
-// Read implements machine.MachineServiceServer. The emulator only serves the kernel boot ID file.
-func (c *MachineService) Read(req *machine.ReadRequest, srv machine.MachineService_ReadServer) error {
-	if req.GetPath() != BootIDPath {
-		return status.Errorf(codes.Unimplemented, "reading %q is not supported by the emulator", req.GetPath())
+// Shutdown implements machine.MachineServiceServer.
+//
+// The node is cordoned and drained first, unless the shutdown is forced.
+func (c *MachineService) Shutdown(ctx context.Context, request *machine.ShutdownRequest) (_ *machine.ShutdownResponse, err error) {
+	if c.sharedMachineState.powerOff == nil {
+		return nil, errPowerOffUnsupported
 	}
 
-	return srv.Send(&common.Data{Bytes: []byte(c.currentBootID() + "\n")})
-}
-
-// BootIDPath is the kernel-provided per-boot identifier; its value changes on every reboot.
-const BootIDPath = "/proc/sys/kernel/random/boot_id"
-
-// EtcdMemberList implements machine.MachineServiceServer.
-func (c *MachineService) EtcdMemberList(ctx context.Context, _ *machine.EtcdMemberListRequest) (*machine.EtcdMemberListResponse, error) {
-	config, err := machineconfig.GetComplete(ctx, c.state)
-	if err != nil {
-		if state.IsNotFoundError(err) {
-			return nil, status.Errorf(codes.InvalidArgument, "the machine is not configured")
-		}
+	if !c.sharedMachineState.sequenceMu.TryLock() {
+		return nil, errSequenceInProgress
+	}
+	defer c.sharedMachineState.sequenceMu.Unlock()
 
+	cfg, err := machineconfig.GetComplete(ctx, c.state)
+	if err != nil && !state.IsNotFoundError(err) {
 		return nil, err
 	}
 
-	if !config.Provider().Machine().Type().IsControlPlane() {
-		return nil, status.Errorf(codes.InvalidArgument, "the machine is not a control plane")
+	actorID, stop := c.startSequence("shutdown")
+	defer func() { stop(err) }()
+
+	if cfg != nil && !request.GetForce() {
+		if err = c.drainNode(ctx, cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	clusterStatus, err := safe.ReaderGetByID[*emu.ClusterStatus](ctx, c.globalState, config.Provider().Cluster().ID())
+	c.logf("shutdown via API received")
+
+	c.schedulePowerOff()
+
+	return &machine.ShutdownResponse{
+		Messages: []*machine.Shutdown{
+			{
+				ActorId: actorID,
+			},
+		},
+	}, nil
+}
+
+// Read implements machine.MachineServiceServer.
+func (c *MachineService) Read(req *machine.ReadRequest, srv machine.MachineService_ReadServer) error {
+	fsys, err := c.filesystem(srv.Context())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cluster status: %w", err)
+		return err
 	}
 
-	machines, err := safe.ReaderListAll[*emu.MachineStatus](
-		ctx, c.globalState,
-		state.WithLabelQuery(
-			resource.LabelEqual(emu.LabelCluster, config.Provider().Cluster().ID()),
-			resource.LabelExists(emu.LabelControlPlaneRole),
-		),
-	)
+	data, err := fsys.ReadFile(req.GetPath())
 	if err != nil {
-		return nil, err
+		return fileStatusError(err)
 	}
 
-	members := make([]*machine.EtcdMember, 0, machines.Len())
+	return srv.Send(&common.Data{Bytes: data})
+}
 
-	err = machines.ForEachErr(func(m *emu.MachineStatus) error {
-		id := m.TypedSpec().Value.EtcdMemberId
-		if id == "" {
-			return nil
-		}
+// BootIDPath is the kernel-provided per-boot identifier; its value changes on every reboot.
+const BootIDPath = vfs.BootIDPath
 
-		var memberID uint64
+// EtcdMemberList implements machine.MachineServiceServer.
+func (c *MachineService) EtcdMemberList(ctx context.Context, _ *machine.EtcdMemberListRequest) (*machine.EtcdMemberListResponse, error) {
+	_, cluster, err := c.etcdCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		memberID, err = etcd.ParseMemberID(m.TypedSpec().Value.EtcdMemberId)
-		if err != nil {
-			return err
-		}
+	members := make([]*machine.EtcdMember, 0, len(cluster.EtcdMembers))
 
-		if slices.Contains(clusterStatus.TypedSpec().Value.DenyEtcdMembers, m.TypedSpec().Value.EtcdMemberId) {
-			return nil
+	for _, member := range cluster.EtcdMembers {
+		memberID, parseErr := etcd.ParseMemberID(member.Id)
+		if parseErr != nil {
+			return nil, fmt.Errorf("failed to compute etcd members %w", parseErr)
 		}
 
 		members = append(members, &machine.EtcdMember{
-			Id:       memberID,
-			Hostname: m.TypedSpec().Value.Hostname,
+			Id:        memberID,
+			Hostname:  member.Hostname,
+			IsLearner: member.Learner,
 		})
-
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to compute etcd members %w", err)
 	}
 
 	res := &machine.EtcdMemberListResponse{
@@ -470,45 +859,135 @@ func (c *MachineService) EtcdMemberList(ctx context.Context, _ *machine.EtcdMemb
 
 // EtcdRemoveMemberByID implements machine.MachineServiceServer.
 func (c *MachineService) EtcdRemoveMemberByID(ctx context.Context, req *machine.EtcdRemoveMemberByIDRequest) (*machine.EtcdRemoveMemberByIDResponse, error) {
-	config, err := machineconfig.GetComplete(ctx, c.state)
+	config, _, err := c.etcdCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.denyEtcdMember(ctx, config.Provider().Cluster().ID(), etcd.FormatMemberID(req.MemberId)); err != nil {
+		return nil, err
+	}
+
+	return &machine.EtcdRemoveMemberByIDResponse{
+		Messages: []*machine.EtcdRemoveMemberByID{
+			{},
+		},
+	}, nil
+}
+
+// EtcdLeaveCluster implements machine.MachineServiceServer.
+func (c *MachineService) EtcdLeaveCluster(ctx context.Context, _ *machine.EtcdLeaveClusterRequest) (*machine.EtcdLeaveClusterResponse, error) {
+	config, _, err := c.etcdCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := safe.ReaderGetByID[*etcd.Member](ctx, c.state, etcd.LocalMemberID)
 	if err != nil {
 		if state.IsNotFoundError(err) {
-			return nil, status.Errorf(codes.InvalidArgument, "the machine is not configured")
+			return nil, status.Errorf(codes.InvalidArgument, "the machine doesn't have etcd member")
 		}
 
+		return nil, fmt.Errorf("failed to get etcd member %w", err)
+	}
+
+	if member.TypedSpec().MemberID == "" {
+		return nil, status.Errorf(codes.FailedPrecondition, "the machine doesn't have etcd member ID")
+	}
+
+	if err = c.denyEtcdMember(ctx, config.Provider().Cluster().ID(), member.TypedSpec().MemberID); err != nil {
 		return nil, err
 	}
 
-	if !config.Provider().Machine().Type().IsControlPlane() {
-		return nil, status.Errorf(codes.InvalidArgument, "the machine is not a control plane")
+	return &machine.EtcdLeaveClusterResponse{
+		Messages: []*machine.EtcdLeaveCluster{
+			{},
+		},
+	}, nil
+}
+
+// denyEtcdMember removes the member from the emulated etcd cluster.
+func (c *MachineService) denyEtcdMember(ctx context.Context, clusterID, memberID string) error {
+	_, err := etcdcluster.Update(ctx, c.globalState, clusterID, func(spec *specs.ClusterStatusSpec) error {
+		etcdcluster.Remove(spec, memberID)
+
+		return nil
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to update cluster status %s", err)
+	}
+
+	c.sharedMachineState.serviceLogs.Printf(emuconst.ETCDService, "removed member %s from the cluster", memberID)
+
+	return nil
+}
+
+// EtcdSnapshot implements machine.MachineServiceServer.
+//
+// The snapshot contains the Kubernetes state of the cluster the emulator keeps in the embedded etcd.
+func (c *MachineService) EtcdSnapshot(_ *machine.EtcdSnapshotRequest, serv machine.MachineService_EtcdSnapshotServer) error {
+	ctx := serv.Context()
+
+	config, err := c.etcdControlPlaneConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = safe.ReaderGetByID[*etcd.Member](ctx, c.state, etcd.LocalMemberID); err != nil {
+		if state.IsNotFoundError(err) {
+			return status.Errorf(codes.FailedPrecondition, "etcd is not running")
+		}
+
+		return fmt.Errorf("failed to get etcd member %w", err)
+	}
+
+	if c.sharedMachineState.kubernetes == nil {
+		return errEtcdSnapshotsUnsupported
+	}
+
+	var buf bytes.Buffer
+
+	if err = c.sharedMachineState.kubernetes.SnapshotEtcdState(ctx, config.Provider().Cluster().ID(), &buf); err != nil {
+		return fmt.Errorf("failed to snapshot etcd: %w", err)
 	}
 
-	memberID := etcd.FormatMemberID(req.MemberId)
+	return sendChunks(buf.Bytes(), serv.Send)
+}
+
+// EtcdRecover implements machine.MachineServiceServer.
+//
+// The snapshot is kept until the cluster is bootstrapped with the etcd recovery.
+func (c *MachineService) EtcdRecover(serv machine.MachineService_EtcdRecoverServer) error {
+	if _, err := c.etcdControlPlaneConfig(serv.Context()); err != nil {
+		return err
+	}
 
-	clusterStatus := emu.NewClusterStatus(emu.NamespaceName, config.Provider().Cluster().ID()).Metadata()
+	var buf bytes.Buffer
 
-	_, err = safe.StateUpdateWithConflicts(ctx, c.globalState, clusterStatus, func(res *emu.ClusterStatus) error {
-		if slices.Contains(res.TypedSpec().Value.DenyEtcdMembers, memberID) {
-			return nil
+	for {
+		data, err := serv.Recv()
+		if errors.Is(err, io.EOF) {
+			break
 		}
 
-		res.TypedSpec().Value.DenyEtcdMembers = append(res.TypedSpec().Value.DenyEtcdMembers, memberID)
+		if err != nil {
+			return err
+		}
 
-		return nil
-	})
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to update cluster status %s", err)
+		buf.Write(data.GetBytes())
 	}
 
-	return &machine.EtcdRemoveMemberByIDResponse{
-		Messages: []*machine.EtcdRemoveMemberByID{
+	c.sharedMachineState.etcdRecovery.set(buf.Bytes())
+
+	return serv.SendAndClose(&machine.EtcdRecoverResponse{
+		Messages: []*machine.EtcdRecover{
 			{},
 		},
-	}, nil
+	})
 }
 
-// EtcdLeaveCluster implements machine.MachineServiceServer.
-func (c *MachineService) EtcdLeaveCluster(ctx context.Context, _ *machine.EtcdLeaveClusterRequest) (*machine.EtcdLeaveClusterResponse, error) {
+// etcdControlPlaneConfig returns the config of the control plane machine, etcd only runs on the control planes.
+func (c *MachineService) etcdControlPlaneConfig(ctx context.Context) (*config.MachineConfig, error) {
 	config, err := machineconfig.GetComplete(ctx, c.state)
 	if err != nil {
 		if state.IsNotFoundError(err) {
@@ -522,27 +1001,56 @@ func (c *MachineService) EtcdLeaveCluster(ctx context.Context, _ *machine.EtcdLe
 		return nil, status.Errorf(codes.InvalidArgument, "the machine is not a control plane")
 	}
 
-	member, err := safe.ReaderGetByID[*etcd.Member](ctx, c.state, etcd.LocalMemberID)
+	return config, nil
+}
+
+// etcdCluster returns the config of the control plane machine and its etcd cluster.
+//
+// The cluster without the quorum can't serve the requests, the same way etcd fails them without the leader.
+func (c *MachineService) etcdCluster(ctx context.Context) (*config.MachineConfig, *specs.ClusterStatusSpec, error) {
+	config, err := c.etcdControlPlaneConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clusterStatus, err := safe.ReaderGetByID[*emu.ClusterStatus](ctx, c.globalState, config.Provider().Cluster().ID())
 	if err != nil {
 		if state.IsNotFoundError(err) {
-			return nil, status.Errorf(codes.InvalidArgument, "the machine doesn't have etcd member")
+			return nil, nil, errEtcdNoLeader
 		}
 
-		return nil, fmt.Errorf("failed to get etcd member %w", err)
+		return nil, nil, fmt.Errorf("failed to get cluster status: %w", err)
 	}
 
-	if member.TypedSpec().MemberID == "" {
-		return nil, status.Errorf(codes.FailedPrecondition, "the machine doesn't have etcd member ID")
+	if !etcdcluster.HasQuorum(clusterStatus.TypedSpec().Value) {
+		return nil, nil, errEtcdNoLeader
 	}
 
-	clusterStatus := emu.NewClusterStatus(emu.NamespaceName, config.Provider().Cluster().ID()).Metadata()
+	return config, clusterStatus.TypedSpec().Value, nil
+}
 
-	_, err = safe.StateUpdateWithConflicts(ctx, c.globalState, clusterStatus, func(res *emu.ClusterStatus) error {
-		if slices.Contains(res.TypedSpec().Value.DenyEtcdMembers, member.TypedSpec().MemberID) {
-			return nil
+// EtcdForfeitLeadership implements machine.MachineServiceServer.
+//
+// The leadership moves to the next voter, nothing changes if the member is not the leader.
+func (c *MachineService) EtcdForfeitLeadership(ctx context.Context, _ *machine.EtcdForfeitLeadershipRequest) (*machine.EtcdForfeitLeadershipResponse, error) {
+	config, _, err := c.etcdCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := safe.ReaderGetByID[*etcd.Member](ctx, c.state, etcd.LocalMemberID)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return nil, status.Errorf(codes.FailedPrecondition, "etcd is not running")
 		}
 
-		res.TypedSpec().Value.DenyEtcdMembers = append(res.TypedSpec().Value.DenyEtcdMembers, member.TypedSpec().MemberID)
+		return nil, fmt.Errorf("failed to get etcd member %w", err)
+	}
+
+	var leader string
+
+	cluster, err := etcdcluster.Update(ctx, c.globalState, config.Provider().Cluster().ID(), func(spec *specs.ClusterStatusSpec) error {
+		leader = etcdcluster.ForfeitLeadership(spec, member.TypedSpec().MemberID)
 
 		return nil
 	})
@@ -550,22 +1058,98 @@ func (c *MachineService) EtcdLeaveCluster(ctx context.Context, _ *machine.EtcdLe
 		return nil, status.Errorf(codes.Internal, "failed to update cluster status %s", err)
 	}
 
-	return &machine.EtcdLeaveClusterResponse{
-		Messages: []*machine.EtcdLeaveCluster{
-			{},
+	var leaderName string
+
+	if leaderMember := etcdcluster.Member(cluster, leader); leaderMember != nil {
+		leaderName = leaderMember.Hostname
+
+		c.sharedMachineState.serviceLogs.Printf(emuconst.ETCDService, "moved the leadership from %s to %s", member.TypedSpec().MemberID, leader)
+	}
+
+	return &machine.EtcdForfeitLeadershipResponse{
+		Messages: []*machine.EtcdForfeitLeadership{
+			{
+				Member: leaderName,
+			},
 		},
 	}, nil
 }
 
-// EtcdForfeitLeadership implements machine.MachineServiceServer.
-func (c *MachineService) EtcdForfeitLeadership(context.Context, *machine.EtcdForfeitLeadershipRequest) (*machine.EtcdForfeitLeadershipResponse, error) {
-	return &machine.EtcdForfeitLeadershipResponse{
-		Messages: []*machine.EtcdForfeitLeadership{
-			{},
+// EtcdAlarmList implements machine.MachineServiceServer.
+func (c *MachineService) EtcdAlarmList(ctx context.Context, _ *emptypb.Empty) (*machine.EtcdAlarmListResponse, error) {
+	_, cluster, err := c.etcdCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	alarms, err := etcdMemberAlarms(cluster.EtcdAlarms)
+	if err != nil {
+		return nil, err
+	}
+
+	return &machine.EtcdAlarmListResponse{
+		Messages: []*machine.EtcdAlarm{
+			{
+				MemberAlarms: alarms,
+			},
+		},
+	}, nil
+}
+
+// EtcdAlarmDisarm implements machine.MachineServiceServer.
+//
+// All alarms of the cluster are disarmed.
+func (c *MachineService) EtcdAlarmDisarm(ctx context.Context, _ *emptypb.Empty) (*machine.EtcdAlarmDisarmResponse, error) {
+	config, _, err := c.etcdCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var disarmed []*specs.ClusterStatusSpec_EtcdAlarm
+
+	if _, err = etcdcluster.Update(ctx, c.globalState, config.Provider().Cluster().ID(), func(spec *specs.ClusterStatusSpec) error {
+		disarmed = etcdcluster.DisarmAlarms(spec)
+
+		return nil
+	}); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to update cluster status %s", err)
+	}
+
+	alarms, err := etcdMemberAlarms(disarmed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &machine.EtcdAlarmDisarmResponse{
+		Messages: []*machine.EtcdAlarmDisarm{
+			{
+				MemberAlarms: alarms,
+			},
 		},
 	}, nil
 }
 
+func etcdMemberAlarms(alarms []*specs.ClusterStatusSpec_EtcdAlarm) ([]*machine.EtcdMemberAlarm, error) {
+	memberAlarms := make([]*machine.EtcdMemberAlarm, 0, len(alarms))
+
+	for _, alarm := range alarms {
+		memberID, err := etcd.ParseMemberID(alarm.MemberId)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to parse etcd member id %s", err.Error())
+		}
+
+		memberAlarms = append(memberAlarms, &machine.EtcdMemberAlarm{
+			MemberId: memberID,
+			Alarm:    machine.EtcdMemberAlarm_AlarmType(machine.EtcdMemberAlarm_AlarmType_value[alarm.Type]),
+		})
+	}
+
+	return memberAlarms, nil
+}
+
+// EtcdStatus implements machine.MachineServiceServer.
+//
+// The status reports the leader and the raft term of the emulated cluster, and the member alarms as the errors.
 func (c *MachineService) EtcdStatus(ctx context.Context, _ *emptypb.Empty) (*machine.EtcdStatusResponse, error) {
 	// Read the member from the shared global status, the same durable source EtcdMemberList uses, so the two
 	// RPCs always agree and both survive reboots.
@@ -588,12 +1172,43 @@ func (c *MachineService) EtcdStatus(ctx context.Context, _ *emptypb.Empty) (*mac
 		return nil, status.Errorf(codes.Internal, "failed to parse etcd member id %s", err.Error())
 	}
 
+	memberStatus := &machine.EtcdMemberStatus{
+		MemberId: id,
+	}
+
+	clusterID, _ := machineStatus.Metadata().Labels().Get(emu.LabelCluster)
+
+	clusterStatus, err := safe.ReaderGetByID[*emu.ClusterStatus](ctx, c.globalState, clusterID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return nil, fmt.Errorf("failed to get cluster status: %w", err)
+	}
+
+	if clusterStatus != nil {
+		cluster := clusterStatus.TypedSpec().Value
+
+		if member := etcdcluster.Member(cluster, memberID); member != nil {
+			memberStatus.IsLearner = member.Learner
+		}
+
+		memberStatus.RaftTerm = cluster.EtcdRaftTerm
+
+		if cluster.EtcdLeader != "" {
+			if memberStatus.Leader, err = etcd.ParseMemberID(cluster.EtcdLeader); err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to parse etcd member id %s", err.Error())
+			}
+		} else {
+			memberStatus.Errors = append(memberStatus.Errors, "etcdserver: no leader")
+		}
+
+		for _, alarm := range etcdcluster.MemberAlarms(cluster, memberID) {
+			memberStatus.Errors = append(memberStatus.Errors, fmt.Sprintf("memberID:%d alarm:%s", id, alarm))
+		}
+	}
+
 	return &machine.EtcdStatusResponse{
 		Messages: []*machine.EtcdStatus{
 			{
-				MemberStatus: &machine.EtcdMemberStatus{
-					MemberId: id,
-				},
+				MemberStatus: memberStatus,
 			},
 		},
 	}, nil
@@ -601,25 +1216,149 @@ func (c *MachineService) EtcdStatus(ctx context.Context, _ *emptypb.Empty) (*mac
 
 // List implements machine.MachineServiceServer.
 func (c *MachineService) List(req *machine.ListRequest, serv machine.MachineService_ListServer) error {
-	if req.Root == "/var/lib/etcd/member" {
-		member, err := safe.ReaderGetByID[*etcd.Member](serv.Context(), c.state, etcd.LocalMemberID)
-		if err != nil && !state.IsNotFoundError(err) {
-			return err
+	root := req.GetRoot()
+	if root == "" {
+		root = "/"
+	}
+
+	maxDepth := 1
+
+	if req.GetRecurse() {
+		maxDepth = int(req.GetRecursionDepth())
+		if maxDepth == 0 {
+			maxDepth = -1
 		}
+	}
+
+	fsys, err := c.filesystem(serv.Context())
+	if err != nil {
+		return err
+	}
 
-		if member == nil {
-			return fmt.Errorf("no such file or directory")
+	err = fsys.Walk(root, maxDepth, func(file *vfs.File, _ int) error {
+		if !listedType(req.GetTypes(), file) {
+			return nil
 		}
 
 		return serv.Send(&machine.FileInfo{
-			Name: "db",
-			Size: 1024,
+			Name:         file.Path,
+			RelativeName: vfs.RelativePath(root, file),
+			Size:         file.Size(),
+			Mode:         uint32(file.Mode),
+			Modified:     file.ModTime.Unix(),
+			IsDir:        file.IsDir(),
+		})
+	})
+
+	return fileStatusError(err)
+}
+
+// DiskUsage implements machine.MachineServiceServer.
+//
+// The directories are always reported, the files only if all files are requested.
+func (c *MachineService) DiskUsage(req *machine.DiskUsageRequest, serv machine.MachineService_DiskUsageServer) error {
+	fsys, err := c.filesystem(serv.Context())
+	if err != nil {
+		return err
+	}
+
+	for _, root := range req.GetPaths() {
+		err = fsys.Usage(root, func(file *vfs.File, size int64, depth int) error {
+			switch {
+			case depth > 0 && !file.IsDir() && !req.GetAll():
+				return nil
+			case req.GetRecursionDepth() > 0 && depth > int(req.GetRecursionDepth()):
+				return nil
+			case req.GetThreshold() > 0 && size < req.GetThreshold():
+				return nil
+			case req.GetThreshold() < 0 && size > -req.GetThreshold():
+				return nil
+			}
+
+			return serv.Send(&machine.DiskUsageInfo{
+				Name:         file.Path,
+				RelativeName: vfs.RelativePath(root, file),
+				Size:         size,
+			})
 		})
+		if errors.Is(err, fs.ErrNotExist) {
+			err = serv.Send(&machine.DiskUsageInfo{
+				Name:  root,
+				Error: err.Error(),
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Copy implements machine.MachineServiceServer.
+//
+// The path is sent as the gzipped tarball.
+func (c *MachineService) Copy(req *machine.CopyRequest, serv machine.MachineService_CopyServer) error {
+	fsys, err := c.filesystem(serv.Context())
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	if err = fsys.TarGz(&buf, req.GetRootPath()); err != nil {
+		return fileStatusError(err)
+	}
+
+	return sendChunks(buf.Bytes(), serv.Send)
+}
+
+// dataChunkSize is the size of the chunks the file streams are sent in.
+const dataChunkSize = 32 * 1024
+
+// sendChunks sends the data in chunks.
+func sendChunks(data []byte, send func(*common.Data) error) error {
+	for chunk := range slices.Chunk(data, dataChunkSize) {
+		if err := send(&common.Data{Bytes: chunk}); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// filesystem generates the current filesystem of the machine.
+func (c *MachineService) filesystem(ctx context.Context) (*vfs.FS, error) {
+	return vfs.Build(ctx, c.state, c.startTime, c.currentBootID())
+}
+
+// listedType returns true if the file matches the requested types, all files match if no types are requested.
+func listedType(types []machine.ListRequest_Type, file *vfs.File) bool {
+	if len(types) == 0 {
+		return true
+	}
+
+	fileType := machine.ListRequest_REGULAR
+	if file.IsDir() {
+		fileType = machine.ListRequest_DIRECTORY
+	}
+
+	return slices.Contains(types, fileType)
+}
+
+// fileStatusError converts the filesystem error to the gRPC status.
+func fileStatusError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, vfs.ErrIsDir):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
 // ServiceList implements machine.MachineServiceServer.
 func (c *MachineService) ServiceList(ctx context.Context, _ *emptypb.Empty) (*machine.ServiceListResponse, error) {
 	res := &machine.ServiceListResponse{}
@@ -790,19 +1529,71 @@ func cacheImage(ctx context.Context, st state.State, ref string) (string, error)
 }
 
 // Dmesg implements machine.MachineServiceServer.
-func (c *MachineService) Dmesg(_ *machine.DmesgRequest, serv machine.MachineService_DmesgServer) error {
-	return serv.Send(&common.Data{
-		Bytes: []byte(
-			"I wish I was a real Talos...",
-		),
+//
+// The tail mode skips the messages written before the call, so it is only useful with follow.
+func (c *MachineService) Dmesg(req *machine.DmesgRequest, serv machine.MachineService_DmesgServer) error {
+	tail := -1
+	if req.GetTail() {
+		tail = 0
+	}
+
+	return c.sharedMachineState.kmsg.Stream(serv.Context(), tail, req.GetFollow(), func(msg logging.KmsgMessage) error {
+		return serv.Send(&common.Data{
+			Bytes: []byte(msg.String()),
+		})
 	})
 }
 
+// Events implements machine.MachineServiceServer.
+//
+// The events are streamed until the client disconnects.
+func (c *MachineService) Events(req *machine.EventsRequest, serv machine.MachineService_EventsServer) error {
+	return c.sharedMachineState.history.Watch(serv.Context(), events.WatchOptions{
+		TailEvents:  int(req.GetTailEvents()),
+		TailID:      req.GetTailId(),
+		TailSeconds: int(req.GetTailSeconds()),
+		ActorID:     req.GetWithActorId(),
+	}, serv.Send)
+}
+
 // Logs implements machine.MachineServiceServer.
+//
+// The negative tail lines send the whole log.
+// The services which haven't written any logs yet stream the empty log, only the unknown services are not found.
 func (c *MachineService) Logs(req *machine.LogsRequest, serv machine.MachineService_LogsServer) error {
-	return serv.Send(&common.Data{
-		Bytes: fmt.Appendf(nil, "I will pretend I know something about the service %q", req.Id),
+	if req.GetDriver() == common.ContainerDriver_CRI {
+		return status.Error(codes.Unimplemented, "the container logs are not emulated")
+	}
+
+	if req.GetId() == emuconst.MachinedService {
+		c.sharedMachineState.serviceLogs.Register(req.GetId())
+	} else {
+		_, err := safe.ReaderGetByID[*v1alpha1.Service](serv.Context(), c.state, req.GetId())
+		if err != nil && !state.IsNotFoundError(err) {
+			return err
+		}
+
+		if err == nil {
+			c.sharedMachineState.serviceLogs.Register(req.GetId())
+		}
+	}
+
+	err := c.sharedMachineState.serviceLogs.Stream(serv.Context(), req.GetId(), int(req.GetTailLines()), req.GetFollow(), func(line []byte) error {
+		return serv.Send(&common.Data{
+			Bytes: line,
+		})
 	})
+	if errors.Is(err, logging.ErrServiceNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	return err
+}
+
+// logf writes the line to the machined logs, machined duplicates its logs to the kernel ring buffer.
+func (c *MachineService) logf(format string, args ...any) {
+	c.sharedMachineState.serviceLogs.Printf(emuconst.MachinedService, format, args...)
+	c.sharedMachineState.kmsg.Printf(logging.KmsgFacilityUser, logging.KmsgPriorityWarning, "[talos] "+format, args...)
 }
 
 // Containers implements machine.MachineServiceServer.
@@ -951,18 +1742,24 @@ func (c *MachineService) overrideNodeUUID(ctx context.Context, uuid string) erro
 //
 // Returns monotonically increasing cumulative CPU jiffies (USER_HZ=100) computed from
 // machine uptime, so consecutive calls produce a stable delta for the Omni monitor chart.
-func (c *MachineService) SystemStat(_ context.Context, _ *emptypb.Empty) (*machine.SystemStatResponse, error) {
+func (c *MachineService) SystemStat(ctx context.Context, _ *emptypb.Empty) (*machine.SystemStatResponse, error) {
 	const (
-		numCores  = 64
 		hz        = 100
 		userPct   = 25.0
 		systemPct = 10.0
 		idlePct   = 65.0
 	)
 
+	totals, err := machinehardware.ReadTotals(ctx, c.state)
+	if err != nil {
+		return nil, err
+	}
+
+	numCores := int(totals.Cores)
+
 	elapsed := time.Since(c.startTime).Seconds()
 
-	totalJiffies := elapsed * numCores * hz
+	totalJiffies := elapsed * float64(numCores) * hz
 	perCoreJiffies := elapsed * hz
 
 	cpuTotal := &machine.CPUStat{
@@ -1074,11 +1871,29 @@ func (c *MachineService) requestReboot(ctx context.Context) error {
 		return err
 	}
 
+	// the machine boots with the persistent config, which activates the staged config and drops the config on trial
+	c.sharedMachineState.tryConfig.cancel()
+
+	if _, err := machineconfig.ActivatePersistent(ctx, c.state); err != nil {
+		return err
+	}
+
 	c.rotateBootID()
+	c.sharedMachineState.kmsg.Reboot()
+
+	// the emulated machine is up right away, the event history survives the reboot
+	c.sharedMachineState.history.Sequence("boot", "")(nil)
 
 	return nil
 }
 
+// startSequence publishes the start of the sequence run by a new actor, the returned function publishes its stop.
+func (c *MachineService) startSequence(sequence string) (string, func(err error)) {
+	actorID := uuid.New().String()
+
+	return actorID, c.sharedMachineState.history.Sequence(sequence, actorID)
+}
+
 // currentBootID returns the current kernel boot ID.
 func (c *MachineService) currentBootID() string {
 	return c.sharedMachineState.bootID.get()
@@ -1092,7 +1907,13 @@ func (c *MachineService) rotateBootID() {
 // errLifecycleInProgress is returned when a lifecycle install or upgrade is already running.
 var errLifecycleInProgress = status.Error(codes.FailedPrecondition, "another install or upgrade is already in progress")
 
-// errSequenceInProgress is returned when a machine-service sequence operation (upgrade or reboot) is already running.
+// errEtcdNoLeader is returned by the etcd requests when the cluster lost the quorum.
+var errEtcdNoLeader = status.Error(codes.Unavailable, "etcdserver: no leader")
+
+// errEtcdSnapshotsUnsupported is returned when the emulator runs without the embedded etcd.
+var errEtcdSnapshotsUnsupported = status.Error(codes.Unimplemented, "etcd snapshots are not supported by the emulator")
+
+// errSequenceInProgress is returned when a machine-service sequence operation (upgrade, reboot or reset) is already running.
 var errSequenceInProgress = status.Error(codes.FailedPrecondition, "another sequence is already running")
 
 // machineState is the per-machine emulator state shared between the machine and lifecycle services.
@@ -1102,13 +1923,108 @@ type machineState struct {
 	bootID *kernelBootID
 	// lifecycleMu serializes LifecycleService.Install and Upgrade, mirroring the lifecycle lock.
 	lifecycleMu sync.Mutex
-	// sequenceMu serializes the machine service's sequence operations (Upgrade and Reboot), lightly mirroring the sequencer lock.
+	// sequenceMu serializes the machine service's sequence operations (Upgrade, Reboot and Reset), lightly mirroring the sequencer lock.
 	sequenceMu sync.Mutex
+	// powerOff stops the emulated machine, it is nil if the machine can't be powered off.
+	powerOff func()
+	// serviceLogs keep the logs of the emulated services.
+	serviceLogs *logging.ServiceLogs
+	// kmsg is the kernel ring buffer.
+	kmsg *logging.Kmsg
+	// history keeps the machine events.
+	history *events.History
+	// kubernetes keeps the etcd state of the emulated clusters, it is nil if the etcd snapshots are not supported.
+	kubernetes *kubefactory.Kubernetes
+	// etcdRecovery is the snapshot uploaded with EtcdRecover, it is used by the next bootstrap with the etcd recovery.
+	etcdRecovery etcdRecoverySnapshot
+	// tryConfig reverts the config applied in try mode.
+	tryConfig tryConfigRevert
+}
+
+// etcdRecoverySnapshot holds the uploaded etcd snapshot, the way Talos keeps it in the etcd data directory.
+type etcdRecoverySnapshot struct {
+	data []byte
+	mu   sync.Mutex
+}
+
+func (s *etcdRecoverySnapshot) set(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = data
+}
+
+func (s *etcdRecoverySnapshot) get() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data
+}
+
+// tryConfigRevert holds the pending revert of the config applied in try mode.
+type tryConfigRevert struct {
+	timer *time.Timer
+	mu    sync.Mutex
+}
+
+// arm schedules the revert, replacing the pending one.
+func (t *tryConfigRevert) arm(timeout time.Duration, revert func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+
+	var timer *time.Timer
+
+	timer = time.AfterFunc(timeout, func() {
+		t.mu.Lock()
+
+		if t.timer != timer {
+			// the revert was cancelled or replaced while the timer was firing
+			t.mu.Unlock()
+
+			return
+		}
+
+		t.timer = nil
+		t.mu.Unlock()
+
+		revert()
+	})
+
+	t.timer = timer
+}
+
+// cancel drops the pending revert, if any.
+func (t *tryConfigRevert) cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
 }
 
 // newMachineState allocates per-machine state with a fresh boot ID.
-func newMachineState() *machineState {
-	return &machineState{bootID: newKernelBootID()}
+//
+// The service logs, the kernel ring buffer and the event history are created if they are not shared with the machine.
+func newMachineState(powerOff func(), serviceLogs *logging.ServiceLogs, kmsg *logging.Kmsg, history *events.History, kubernetes *kubefactory.Kubernetes) *machineState {
+	if serviceLogs == nil {
+		serviceLogs = logging.NewServiceLogs()
+	}
+
+	if kmsg == nil {
+		kmsg = logging.NewKmsg("", machinehardware.Default().Inventory())
+	}
+
+	if history == nil {
+		history = events.NewHistory()
+	}
+
+	return &machineState{bootID: newKernelBootID(), powerOff: powerOff, serviceLogs: serviceLogs, kmsg: kmsg, history: history, kubernetes: kubernetes}
 }
 
 // kernelBootID emulates /proc/sys/kernel/random/boot_id.
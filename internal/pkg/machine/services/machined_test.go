@@ -5,22 +5,39 @@
 package services_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"io"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
 	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/siderolabs/gen/xslices"
 	"github.com/siderolabs/talos/pkg/machinery/api/common"
 	"github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/config/container"
+	configv1alpha1 "github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/etcd"
+	"github.com/siderolabs/talos/pkg/machinery/resources/runtime"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 
+	"github.com/siderolabs/talemu/api/specs"
+	"github.com/siderolabs/talemu/internal/pkg/machine/etcdcluster"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/talos"
 	"github.com/siderolabs/talemu/internal/pkg/machine/services"
 )
 
@@ -100,11 +117,85 @@ func TestReadBootID(t *testing.T) {
 	require.NotEmpty(t, strings.TrimSpace(string(srv.sent[0].GetBytes())))
 }
 
-func TestReadUnsupportedPath(t *testing.T) {
+func TestReadMissingPath(t *testing.T) {
 	svc := newMachineService(t)
 
-	err := svc.Read(&machine.ReadRequest{Path: "/etc/hostname"}, &recordingStream[*common.Data]{ctx: t.Context()})
-	require.Equal(t, codes.Unimplemented, status.Code(err))
+	err := svc.Read(&machine.ReadRequest{Path: "/etc/missing"}, &recordingStream[*common.Data]{ctx: t.Context()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	err = svc.Read(&machine.ReadRequest{Path: "/proc"}, &recordingStream[*common.Data]{ctx: t.Context()})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestFilesystem asserts the machine files are served consistently by Read, List, DiskUsage and Copy.
+func TestFilesystem(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	svc, _ := newMaintenanceMachineService(t)
+
+	_, err := svc.ApplyConfiguration(ctx, &machine.ApplyConfigurationRequest{
+		Data: workerConfig(t, "worker"),
+		Mode: machine.ApplyConfigurationRequest_AUTO,
+	})
+	require.NoError(t, err)
+
+	read := &recordingStream[*common.Data]{ctx: ctx}
+
+	require.NoError(t, svc.Read(&machine.ReadRequest{Path: "/etc/os-release"}, read))
+	require.Len(t, read.sent, 1)
+	assert.Contains(t, string(read.sent[0].GetBytes()), `NAME="Talos"`)
+
+	read = &recordingStream[*common.Data]{ctx: ctx}
+
+	require.NoError(t, svc.Read(&machine.ReadRequest{Path: "/proc/meminfo"}, read))
+	assert.Contains(t, string(read.sent[0].GetBytes()), "MemTotal:")
+
+	read = &recordingStream[*common.Data]{ctx: ctx}
+
+	require.NoError(t, svc.Read(&machine.ReadRequest{Path: "/system/state/config.yaml"}, read))
+	assert.NotEmpty(t, read.sent[0].GetBytes())
+
+	list := &recordingStream[*machine.FileInfo]{ctx: ctx}
+
+	require.NoError(t, svc.List(&machine.ListRequest{Root: "/proc"}, list))
+
+	names := xslices.Map(list.sent, func(info *machine.FileInfo) string { return info.GetRelativeName() })
+	assert.Equal(t, []string{".", "cpuinfo", "meminfo", "sys"}, names)
+
+	list = &recordingStream[*machine.FileInfo]{ctx: ctx}
+
+	require.NoError(t, svc.List(&machine.ListRequest{Root: "/proc", Recurse: true, Types: []machine.ListRequest_Type{machine.ListRequest_REGULAR}}, list))
+
+	names = xslices.Map(list.sent, func(info *machine.FileInfo) string { return info.GetName() })
+	assert.Equal(t, []string{"/proc/cpuinfo", "/proc/meminfo", services.BootIDPath}, names)
+
+	err = svc.List(&machine.ListRequest{Root: "/missing"}, &recordingStream[*machine.FileInfo]{ctx: ctx})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	usage := &recordingStream[*machine.DiskUsageInfo]{ctx: ctx}
+
+	require.NoError(t, svc.DiskUsage(&machine.DiskUsageRequest{Paths: []string{"/system", "/missing"}}, usage))
+	require.Len(t, usage.sent, 3)
+	assert.Equal(t, "/system/state", usage.sent[0].GetName())
+	assert.EqualValues(t, len(read.sent[0].GetBytes()), usage.sent[0].GetSize())
+	assert.Equal(t, "/system", usage.sent[1].GetName())
+	assert.Equal(t, "/missing", usage.sent[2].GetName())
+	assert.NotEmpty(t, usage.sent[2].GetError())
+
+	cp := &recordingStream[*common.Data]{ctx: ctx}
+
+	require.NoError(t, svc.Copy(&machine.CopyRequest{RootPath: "/etc"}, cp))
+	require.NotEmpty(t, cp.sent)
+
+	zr, err := gzip.NewReader(bytes.NewReader(cp.sent[0].GetBytes()))
+	require.NoError(t, err)
+
+	header, err := tar.NewReader(zr).Next()
+	require.NoError(t, err)
+	assert.Equal(t, "etc/os-release", header.Name)
 }
 
 // TestRebootRotatesBootID asserts a reboot rotates the boot ID returned by Read.
@@ -125,3 +216,480 @@ func TestRebootRotatesBootID(t *testing.T) {
 
 	require.NotEqual(t, before, read())
 }
+
+func TestEvents(t *testing.T) {
+	svc := newMachineService(t)
+
+	resp, err := svc.Reboot(t.Context(), &machine.RebootRequest{})
+	require.NoError(t, err)
+
+	actorID := resp.GetMessages()[0].GetActorId()
+	require.NotEmpty(t, actorID)
+
+	// the stream sends the past events before it notices the client is gone
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	srv := &recordingStream[*machine.Event]{ctx: ctx}
+
+	require.NoError(t, svc.Events(&machine.EventsRequest{TailEvents: -1, WithActorId: actorID}, srv))
+	require.Len(t, srv.sent, 2)
+
+	var sequence machine.SequenceEvent
+
+	require.NoError(t, srv.sent[0].GetData().UnmarshalTo(&sequence))
+	assert.Equal(t, "reboot", sequence.Sequence)
+	assert.Equal(t, machine.SequenceEvent_START, sequence.Action)
+
+	// the machine boots during the reboot sequence
+	srv = &recordingStream[*machine.Event]{ctx: ctx}
+
+	require.NoError(t, svc.Events(&machine.EventsRequest{TailEvents: -1}, srv))
+	require.Len(t, srv.sent, 4)
+
+	require.NoError(t, srv.sent[1].GetData().UnmarshalTo(&sequence))
+	assert.Equal(t, "boot", sequence.Sequence)
+	assert.Empty(t, srv.sent[1].GetActorId())
+}
+
+func workerConfig(t *testing.T, hostname string) []byte {
+	t.Helper()
+
+	return machineConfig(t, "worker", hostname)
+}
+
+func machineConfig(t *testing.T, machineType, hostname string) []byte {
+	t.Helper()
+
+	provider, err := container.New(&configv1alpha1.Config{
+		ConfigVersion: "v1alpha1",
+		MachineConfig: &configv1alpha1.MachineConfig{
+			MachineType: machineType,
+			MachineInstall: &configv1alpha1.InstallConfig{
+				InstallImage: "factory.talos.dev/installer/abc123:v1.14.0",
+			},
+			MachineNetwork: &configv1alpha1.NetworkConfig{
+				NetworkHostname: hostname,
+			},
+		},
+		ClusterConfig: &configv1alpha1.ClusterConfig{
+			ClusterID: "test-cluster",
+		},
+	})
+	require.NoError(t, err)
+
+	data, err := provider.Bytes()
+	require.NoError(t, err)
+
+	return data
+}
+
+// newMaintenanceMachineService creates the machine service of a machine in maintenance mode, which accepts the configs.
+func newMaintenanceMachineService(t *testing.T) (*services.MachineService, state.State) {
+	t.Helper()
+
+	apidState := state.WrapCore(namespaced.NewState(inmem.Build))
+	globalState := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	require.NoError(t, apidState.Create(t.Context(), runtime.NewSecurityStateSpec(runtime.NamespaceName)))
+	require.NoError(t, globalState.Create(t.Context(), emu.NewMachineStatus(emu.NamespaceName, "test-machine-id")))
+
+	return services.NewMachineService("test-machine-id", apidState, globalState, "factory.talos.dev", zaptest.NewLogger(t), nil), apidState
+}
+
+func TestApplyConfigurationModes(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	svc, apidState := newMaintenanceMachineService(t)
+
+	apply := func(hostname string, mode machine.ApplyConfigurationRequest_Mode, dryRun bool) (*machine.ApplyConfiguration, error) {
+		resp, err := svc.ApplyConfiguration(ctx, &machine.ApplyConfigurationRequest{
+			Data:           workerConfig(t, hostname),
+			Mode:           mode,
+			DryRun:         dryRun,
+			TryModeTimeout: durationpb.New(100 * time.Millisecond),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.Messages[0], nil
+	}
+
+	hostname := func(id string) string {
+		cfg, err := safe.StateGetByID[*config.MachineConfig](ctx, apidState, id)
+		require.NoError(t, err)
+
+		return cfg.Config().Machine().Network().Hostname()
+	}
+
+	_, err := apply("staged", machine.ApplyConfigurationRequest_STAGED, false)
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "staged mode is not supported in maintenance mode")
+
+	msg, err := apply("initial", machine.ApplyConfigurationRequest_AUTO, false)
+	require.NoError(t, err)
+	assert.Equal(t, machine.ApplyConfigurationRequest_REBOOT, msg.Mode) //nolint:staticcheck
+	assert.Equal(t, "initial", hostname(config.ActiveID))
+	assert.Equal(t, "initial", hostname(config.PersistentID))
+
+	msg, err = apply("dry-run", machine.ApplyConfigurationRequest_NO_REBOOT, true)
+	require.NoError(t, err)
+	assert.Contains(t, msg.ModeDetails, "Dry run summary")
+	assert.Contains(t, msg.ModeDetails, "-    hostname: initial")
+	assert.Contains(t, msg.ModeDetails, "+    hostname: dry-run")
+	assert.Equal(t, "initial", hostname(config.ActiveID))
+
+	// the staged config is activated on reboot
+	msg, err = apply("staged", machine.ApplyConfigurationRequest_STAGED, false)
+	require.NoError(t, err)
+	assert.Equal(t, machine.ApplyConfigurationRequest_STAGED, msg.Mode)
+	assert.Equal(t, "initial", hostname(config.ActiveID))
+	assert.Equal(t, "staged", hostname(config.PersistentID))
+
+	_, err = svc.Reboot(ctx, &machine.RebootRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "staged", hostname(config.ActiveID))
+
+	// the config applied in try mode is reverted after the timeout
+	msg, err = apply("try", machine.ApplyConfigurationRequest_TRY, false)
+	require.NoError(t, err)
+	assert.Contains(t, msg.ModeDetails, "will be automatically reverted back in 100ms")
+	assert.Equal(t, "try", hostname(config.ActiveID))
+	assert.Equal(t, "staged", hostname(config.PersistentID))
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		cfg, err := safe.StateGetByID[*config.MachineConfig](ctx, apidState, config.ActiveID)
+		require.NoError(collect, err)
+		assert.Equal(collect, "staged", cfg.Config().Machine().Network().Hostname())
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// a regular apply confirms the config
+	_, err = apply("try", machine.ApplyConfigurationRequest_TRY, false)
+	require.NoError(t, err)
+
+	msg, err = apply("confirmed", machine.ApplyConfigurationRequest_NO_REBOOT, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Applied configuration without a reboot", msg.ModeDetails)
+
+	time.Sleep(300 * time.Millisecond)
+
+	assert.Equal(t, "confirmed", hostname(config.ActiveID))
+	assert.Equal(t, "confirmed", hostname(config.PersistentID))
+}
+
+func TestReset(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	svc, apidState := newMaintenanceMachineService(t)
+
+	_, err := svc.ApplyConfiguration(ctx, &machine.ApplyConfigurationRequest{
+		Data: workerConfig(t, "worker"),
+		Mode: machine.ApplyConfigurationRequest_AUTO,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, apidState.Create(ctx, talos.NewCachedImage(talos.NamespaceName, "ghcr.io/siderolabs/kubelet:v1.30.0")))
+
+	for _, tt := range []struct {
+		request *machine.ResetRequest
+		name    string
+		code    codes.Code
+	}{
+		{
+			name: "unsupported partition",
+			request: &machine.ResetRequest{
+				Reboot:                 true,
+				SystemPartitionsToWipe: []*machine.ResetPartitionSpec{{Label: "META", Wipe: true}},
+			},
+			code: codes.Unimplemented,
+		},
+		{
+			name: "missing user disk",
+			request: &machine.ResetRequest{
+				Reboot:          true,
+				Mode:            machine.ResetRequest_USER_DISKS,
+				UserDisksToWipe: []string{"/dev/sdz"},
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name:    "power off is not available",
+			request: &machine.ResetRequest{},
+			code:    codes.Unimplemented,
+		},
+	} {
+		_, err = svc.Reset(ctx, tt.request)
+		assert.Equal(t, tt.code, status.Code(err), tt.name)
+	}
+
+	// wiping EPHEMERAL keeps the config
+	_, err = svc.Reset(ctx, &machine.ResetRequest{
+		Graceful:               true,
+		Reboot:                 true,
+		SystemPartitionsToWipe: []*machine.ResetPartitionSpec{{Label: "EPHEMERAL", Wipe: true}},
+	})
+	require.NoError(t, err)
+
+	images, err := safe.StateListAll[*talos.CachedImage](ctx, apidState)
+	require.NoError(t, err)
+	assert.Zero(t, images.Len())
+
+	_, err = safe.StateGetByID[*config.MachineConfig](ctx, apidState, config.ActiveID)
+	require.NoError(t, err)
+
+	// wiping STATE brings the machine back into maintenance mode
+	_, err = svc.Reset(ctx, &machine.ResetRequest{
+		Graceful:               true,
+		Reboot:                 true,
+		SystemPartitionsToWipe: []*machine.ResetPartitionSpec{{Label: "STATE", Wipe: true}},
+	})
+	require.NoError(t, err)
+
+	for _, id := range []string{config.ActiveID, config.PersistentID} {
+		_, err = safe.StateGetByID[*config.MachineConfig](ctx, apidState, id)
+		assert.True(t, state.IsNotFoundError(err), id)
+	}
+}
+
+func TestShutdownWithoutPower(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := newMaintenanceMachineService(t)
+
+	_, err := svc.Shutdown(t.Context(), &machine.ShutdownRequest{Force: true})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestDmesg(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	svc := newMachineService(t)
+
+	srv := &recordingStream[*common.Data]{ctx: ctx}
+
+	require.NoError(t, svc.Dmesg(&machine.DmesgRequest{}, srv))
+	require.NotEmpty(t, srv.sent)
+	assert.True(t, strings.HasPrefix(string(srv.sent[0].Bytes), "kern:  notice: ["), string(srv.sent[0].Bytes))
+	assert.Contains(t, string(srv.sent[0].Bytes), "Linux version")
+
+	// the tail mode only sends the new messages
+	srv = &recordingStream[*common.Data]{ctx: ctx}
+
+	require.NoError(t, svc.Dmesg(&machine.DmesgRequest{Tail: true}, srv))
+	assert.Empty(t, srv.sent)
+}
+
+func TestLogs(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	svc, _ := newMaintenanceMachineService(t)
+
+	_, err := svc.ApplyConfiguration(ctx, &machine.ApplyConfigurationRequest{
+		Data: workerConfig(t, "worker"),
+		Mode: machine.ApplyConfigurationRequest_AUTO,
+	})
+	require.NoError(t, err)
+
+	srv := &recordingStream[*common.Data]{ctx: ctx}
+
+	require.NoError(t, svc.Logs(&machine.LogsRequest{Id: "machined", TailLines: 1}, srv))
+	require.Len(t, srv.sent, 1)
+	assert.True(t, strings.HasPrefix(string(srv.sent[0].Bytes), "[talos] "), string(srv.sent[0].Bytes))
+	assert.Contains(t, string(srv.sent[0].Bytes), "applied the machine config")
+
+	err = svc.Logs(&machine.LogsRequest{Id: "kube-proxy", TailLines: -1}, &recordingStream[*common.Data]{ctx: ctx})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// recoverStream is a fake client-streaming gRPC stream of the EtcdRecover call.
+type recoverStream struct {
+	grpc.ServerStream
+
+	ctx      context.Context //nolint:containedctx
+	resp     *machine.EtcdRecoverResponse
+	received [][]byte
+}
+
+func (s *recoverStream) Context() context.Context { return s.ctx }
+
+func (s *recoverStream) Recv() (*common.Data, error) {
+	if len(s.received) == 0 {
+		return nil, io.EOF
+	}
+
+	data := s.received[0]
+	s.received = s.received[1:]
+
+	return &common.Data{Bytes: data}, nil
+}
+
+func (s *recoverStream) SendAndClose(resp *machine.EtcdRecoverResponse) error {
+	s.resp = resp
+
+	return nil
+}
+
+func TestEtcdRecover(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	svc, _ := newMaintenanceMachineService(t)
+
+	_, err := svc.ApplyConfiguration(ctx, &machine.ApplyConfigurationRequest{
+		Data: machineConfig(t, "controlplane", "cp"),
+		Mode: machine.ApplyConfigurationRequest_AUTO,
+	})
+	require.NoError(t, err)
+
+	// the recovery requires the uploaded snapshot
+	_, err = svc.Bootstrap(ctx, &machine.BootstrapRequest{RecoverEtcd: true})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	srv := &recoverStream{ctx: ctx, received: [][]byte{[]byte("not a "), []byte("snapshot")}}
+
+	require.NoError(t, svc.EtcdRecover(srv))
+	require.NotNil(t, srv.resp)
+
+	_, err = svc.Bootstrap(ctx, &machine.BootstrapRequest{RecoverEtcd: true})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the failed recovery doesn't bootstrap the cluster
+	_, err = svc.Bootstrap(ctx, &machine.BootstrapRequest{})
+	require.NoError(t, err)
+}
+
+func TestEtcdSnapshotNotRunning(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	svc, _ := newMaintenanceMachineService(t)
+
+	_, err := svc.ApplyConfiguration(ctx, &machine.ApplyConfigurationRequest{
+		Data: machineConfig(t, "controlplane", "cp"),
+		Mode: machine.ApplyConfigurationRequest_AUTO,
+	})
+	require.NoError(t, err)
+
+	err = svc.EtcdSnapshot(&machine.EtcdSnapshotRequest{}, &recordingStream[*common.Data]{ctx: ctx})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestEtcdCluster(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	apidState := state.WrapCore(namespaced.NewState(inmem.Build))
+	globalState := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	require.NoError(t, apidState.Create(ctx, runtime.NewSecurityStateSpec(runtime.NamespaceName)))
+	require.NoError(t, globalState.Create(ctx, emu.NewMachineStatus(emu.NamespaceName, "test-machine-id")))
+
+	svc := services.NewMachineService("test-machine-id", apidState, globalState, "factory.talos.dev", zaptest.NewLogger(t), nil)
+
+	_, err := svc.ApplyConfiguration(ctx, &machine.ApplyConfigurationRequest{
+		Data: machineConfig(t, "controlplane", "cp"),
+		Mode: machine.ApplyConfigurationRequest_AUTO,
+	})
+	require.NoError(t, err)
+
+	_, err = svc.Bootstrap(ctx, &machine.BootstrapRequest{})
+	require.NoError(t, err)
+
+	// etcd has no leader until the members join
+	_, err = svc.EtcdMemberList(ctx, &machine.EtcdMemberListRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	local, other := etcd.FormatMemberID(1), etcd.FormatMemberID(2)
+
+	member := etcd.NewMember(etcd.NamespaceName, etcd.LocalMemberID)
+	member.TypedSpec().MemberID = local
+
+	require.NoError(t, apidState.Create(ctx, member))
+
+	_, err = safe.StateUpdateWithConflicts(ctx, globalState, emu.NewMachineStatus(emu.NamespaceName, "test-machine-id").Metadata(), func(res *emu.MachineStatus) error {
+		res.TypedSpec().Value.EtcdMemberId = local
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = etcdcluster.Update(ctx, globalState, "test-cluster", func(spec *specs.ClusterStatusSpec) error {
+		etcdcluster.Join(spec, local, "test-machine-id", "cp")
+		etcdcluster.Join(spec, other, "other-machine-id", "other")
+		etcdcluster.SetUp(spec, local, true)
+		etcdcluster.SetUp(spec, other, true)
+
+		return etcdcluster.SetAlarm(spec, local, etcdcluster.AlarmNoSpace, true)
+	})
+	require.NoError(t, err)
+
+	members, err := svc.EtcdMemberList(ctx, &machine.EtcdMemberListRequest{})
+	require.NoError(t, err)
+	require.Len(t, members.Messages[0].Members, 2)
+	assert.False(t, members.Messages[0].Members[0].IsLearner)
+	assert.True(t, members.Messages[0].Members[1].IsLearner)
+
+	etcdStatus, err := svc.EtcdStatus(ctx, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, etcdStatus.Messages[0].MemberStatus.Leader)
+	assert.Equal(t, []string{"memberID:1 alarm:NOSPACE"}, etcdStatus.Messages[0].MemberStatus.Errors)
+
+	alarms, err := svc.EtcdAlarmList(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, alarms.Messages[0].MemberAlarms, 1)
+	assert.Equal(t, machine.EtcdMemberAlarm_NOSPACE, alarms.Messages[0].MemberAlarms[0].Alarm)
+
+	// the learner can't lead the cluster
+	forfeit, err := svc.EtcdForfeitLeadership(ctx, &machine.EtcdForfeitLeadershipRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, forfeit.Messages[0].Member)
+
+	_, err = etcdcluster.Update(ctx, globalState, "test-cluster", func(spec *specs.ClusterStatusSpec) error {
+		etcdcluster.Promote(spec, other)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	forfeit, err = svc.EtcdForfeitLeadership(ctx, &machine.EtcdForfeitLeadershipRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "other", forfeit.Messages[0].Member)
+
+	disarmed, err := svc.EtcdAlarmDisarm(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, disarmed.Messages[0].MemberAlarms, 1)
+
+	etcdStatus, err = svc.EtcdStatus(ctx, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, etcdStatus.Messages[0].MemberStatus.Leader)
+	assert.Empty(t, etcdStatus.Messages[0].MemberStatus.Errors)
+
+	// the cluster loses the quorum when the other voter is down
+	_, err = etcdcluster.Update(ctx, globalState, "test-cluster", func(spec *specs.ClusterStatusSpec) error {
+		etcdcluster.SetUp(spec, other, false)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = svc.EtcdAlarmList(ctx, nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -0,0 +1,228 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/controller"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/omni/client/pkg/constants"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"github.com/siderolabs/talos/pkg/machinery/resources/etcd"
+	hardwareres "github.com/siderolabs/talos/pkg/machinery/resources/hardware"
+	"github.com/siderolabs/talos/pkg/machinery/resources/perf"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/hardware"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/talos"
+)
+
+// Paths of the generated files.
+const (
+	BootIDPath    = "/proc/sys/kernel/random/boot_id"
+	MemInfoPath   = "/proc/meminfo"
+	CPUInfoPath   = "/proc/cpuinfo"
+	OSReleasePath = "/etc/os-release"
+	ConfigPath    = "/system/state/config.yaml"
+	EtcdDBPath    = "/var/lib/etcd/member/db"
+	AuditLogPath  = "/var/log/audit/kube/kube-apiserver.log"
+)
+
+// etcdDBSize is the size of the emulated etcd database file.
+const etcdDBSize = 1024
+
+// Build generates the filesystem of the machine from its resources.
+//
+// The files are generated on each call, so they always reflect the current machine state.
+func Build(ctx context.Context, r controller.Reader, bootTime time.Time, bootID string) (*FS, error) {
+	fsys := New(bootTime)
+
+	fsys.WriteFile(BootIDPath, []byte(bootID+"\n"), 0o444, bootTime)
+
+	memInfo, err := memInfo(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys.WriteFile(MemInfoPath, memInfo, 0o444, bootTime)
+
+	cpuInfo, err := cpuInfo(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys.WriteFile(CPUInfoPath, cpuInfo, 0o444, bootTime)
+
+	osRelease, err := osRelease(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys.WriteFile(OSReleasePath, osRelease, 0o644, bootTime)
+
+	fsys.Mkdir("/var/log/containers", bootTime)
+	fsys.Mkdir("/var/log/pods", bootTime)
+
+	cfg, err := safe.ReaderGetByID[*config.MachineConfig](ctx, r, config.ActiveID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	if cfg != nil {
+		var data []byte
+
+		if data, err = cfg.Provider().Bytes(); err != nil {
+			return nil, err
+		}
+
+		fsys.WriteFile(ConfigPath, data, 0o600, cfg.Metadata().Updated())
+
+		if cfg.Provider().Machine() != nil && cfg.Provider().Machine().Type().IsControlPlane() {
+			fsys.WriteFile(AuditLogPath, nil, 0o600, bootTime)
+		}
+	}
+
+	member, err := safe.ReaderGetByID[*etcd.Member](ctx, r, etcd.LocalMemberID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	if member != nil {
+		fsys.WriteFile(EtcdDBPath, make([]byte, etcdDBSize), 0o600, member.Metadata().Updated())
+	}
+
+	return fsys, nil
+}
+
+// memInfo renders /proc/meminfo from the memory modules and the memory usage stats.
+func memInfo(ctx context.Context, r controller.Reader) ([]byte, error) {
+	totals, err := hardware.ReadTotals(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	const kib = 1024
+
+	total := totals.MemoryBytes
+	// the idle machine before the first stats update
+	used := total / 10 //nolint:mnd
+	available := total - used
+
+	var cached, buffers, active, inactive uint64
+
+	stats, err := safe.ReaderGetByID[*perf.Memory](ctx, r, perf.MemoryID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	if stats != nil && stats.TypedSpec().MemTotal == total {
+		used = stats.TypedSpec().MemUsed
+		available = stats.TypedSpec().MemAvailable
+		cached = stats.TypedSpec().Cached
+		buffers = stats.TypedSpec().Buffers
+		active = stats.TypedSpec().Active
+		inactive = stats.TypedSpec().Inactive
+	}
+
+	var sb strings.Builder
+
+	for _, line := range []struct {
+		name  string
+		bytes uint64
+	}{
+		{"MemTotal", total},
+		{"MemFree", total - used},
+		{"MemAvailable", available},
+		{"Buffers", buffers},
+		{"Cached", cached},
+		{"SwapCached", 0},
+		{"Active", active},
+		{"Inactive", inactive},
+		{"SwapTotal", 0},
+		{"SwapFree", 0},
+	} {
+		fmt.Fprintf(&sb, "%-15s %8d kB\n", line.name+":", line.bytes/kib)
+	}
+
+	return []byte(sb.String()), nil
+}
+
+// cpuInfo renders /proc/cpuinfo with an entry for each hardware thread of the processors.
+func cpuInfo(ctx context.Context, r controller.Reader) ([]byte, error) {
+	processors, err := safe.ReaderListAll[*hardwareres.Processor](ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := safe.ToSlice(processors, func(p *hardwareres.Processor) hardwareres.ProcessorSpec {
+		return *p.TypedSpec()
+	})
+
+	if len(specs) == 0 {
+		for _, cpu := range hardware.Default().CPUs {
+			specs = append(specs, hardwareres.ProcessorSpec{
+				Manufacturer: cpu.Manufacturer,
+				ProductName:  cpu.ProductName,
+				CoreCount:    cpu.CoreCount,
+				ThreadCount:  cpu.ThreadCount,
+				MaxSpeed:     cpu.MaxSpeed,
+			})
+		}
+	}
+
+	var (
+		sb        strings.Builder
+		processor int
+	)
+
+	for socket, spec := range specs {
+		cores := max(spec.CoreCount, 1)
+		threads := max(spec.ThreadCount, cores)
+
+		for thread := range threads {
+			fmt.Fprintf(&sb, "processor\t: %d\n", processor)
+			fmt.Fprintf(&sb, "vendor_id\t: %s\n", spec.Manufacturer)
+			fmt.Fprintf(&sb, "model name\t: %s\n", spec.ProductName)
+			fmt.Fprintf(&sb, "cpu MHz\t\t: %d.000\n", spec.MaxSpeed)
+			fmt.Fprintf(&sb, "physical id\t: %d\n", socket)
+			fmt.Fprintf(&sb, "siblings\t: %d\n", threads)
+			fmt.Fprintf(&sb, "core id\t\t: %d\n", thread%cores)
+			fmt.Fprintf(&sb, "cpu cores\t: %d\n", cores)
+			fmt.Fprintf(&sb, "flags\t\t: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr pge mca cmov pat pse36 clflush mmx fxsr sse sse2 ht syscall nx lm\n\n")
+
+			processor++
+		}
+	}
+
+	return []byte(sb.String()), nil
+}
+
+// osRelease renders /etc/os-release of the installed Talos version.
+func osRelease(ctx context.Context, r controller.Reader) ([]byte, error) {
+	version := "v" + constants.DefaultTalosVersion
+
+	res, err := safe.ReaderGetByID[*talos.Version](ctx, r, talos.VersionID)
+	if err != nil && !state.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	if res != nil {
+		version = res.TypedSpec().Value.Value
+	}
+
+	return fmt.Appendf(nil, `NAME="Talos"
+ID=talos
+VERSION_ID=%[1]s
+PRETTY_NAME="Talos (%[1]s)"
+HOME_URL="https://www.talos.dev/"
+BUG_REPORT_URL="https://github.com/siderolabs/talos/issues"
+VENDOR_NAME="Sidero Labs"
+VENDOR_URL="https://www.siderolabs.com/"
+`, version), nil
+}
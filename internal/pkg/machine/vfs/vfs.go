@@ -0,0 +1,265 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package vfs implements the read-only virtual filesystem of the emulated machine.
+package vfs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrIsDir is returned when a directory is read as a file.
+var ErrIsDir = errors.New("is a directory")
+
+// File is a file or a directory of the filesystem.
+type File struct {
+	ModTime time.Time
+	// Path is the absolute path of the file.
+	Path string
+	Data []byte
+	Mode fs.FileMode
+}
+
+// IsDir returns true if the file is a directory.
+func (f *File) IsDir() bool {
+	return f.Mode.IsDir()
+}
+
+// Size returns the size of the file contents.
+func (f *File) Size() int64 {
+	return int64(len(f.Data))
+}
+
+// FS is a snapshot of the machine files.
+type FS struct {
+	files map[string]*File
+}
+
+// New creates the filesystem with the empty root directory.
+func New(modTime time.Time) *FS {
+	return &FS{
+		files: map[string]*File{
+			"/": {
+				Path:    "/",
+				Mode:    fs.ModeDir | 0o755,
+				ModTime: modTime,
+			},
+		},
+	}
+}
+
+// Mkdir creates the directory together with its parents.
+func (fsys *FS) Mkdir(name string, modTime time.Time) {
+	name = clean(name)
+
+	if _, ok := fsys.files[name]; ok {
+		return
+	}
+
+	fsys.Mkdir(path.Dir(name), modTime)
+
+	fsys.files[name] = &File{
+		Path:    name,
+		Mode:    fs.ModeDir | 0o755,
+		ModTime: modTime,
+	}
+}
+
+// WriteFile creates the file together with its parent directories.
+func (fsys *FS) WriteFile(name string, data []byte, perm fs.FileMode, modTime time.Time) {
+	name = clean(name)
+
+	fsys.Mkdir(path.Dir(name), modTime)
+
+	fsys.files[name] = &File{
+		Path:    name,
+		Data:    data,
+		Mode:    perm,
+		ModTime: modTime,
+	}
+}
+
+// Stat returns the file.
+func (fsys *FS) Stat(name string) (*File, error) {
+	file, ok := fsys.files[clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return file, nil
+}
+
+// ReadFile returns the file contents.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	file, err := fsys.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: ErrIsDir}
+	}
+
+	return file.Data, nil
+}
+
+// Walk calls fn for the root and its descendants down to maxDepth, the depth is unlimited if maxDepth is negative.
+//
+// The directory is visited before its children, the children are visited in the name order.
+func (fsys *FS) Walk(root string, maxDepth int, fn func(file *File, depth int) error) error {
+	file, err := fsys.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	return fsys.walk(file, 0, maxDepth, fn)
+}
+
+func (fsys *FS) walk(file *File, depth, maxDepth int, fn func(file *File, depth int) error) error {
+	if err := fn(file, depth); err != nil {
+		return err
+	}
+
+	if !file.IsDir() || depth == maxDepth {
+		return nil
+	}
+
+	for _, child := range fsys.children(file.Path) {
+		if err := fsys.walk(child, depth+1, maxDepth, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Usage calls fn for the root and its descendants with their sizes, the directory size includes all its contents.
+//
+// The children are visited before their directory, the same way du reports them.
+func (fsys *FS) Usage(root string, fn func(file *File, size int64, depth int) error) error {
+	file, err := fsys.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	_, err = fsys.usage(file, 0, fn)
+
+	return err
+}
+
+func (fsys *FS) usage(file *File, depth int, fn func(file *File, size int64, depth int) error) (int64, error) {
+	size := file.Size()
+
+	if file.IsDir() {
+		for _, child := range fsys.children(file.Path) {
+			childSize, err := fsys.usage(child, depth+1, fn)
+			if err != nil {
+				return 0, err
+			}
+
+			size += childSize
+		}
+	}
+
+	return size, fn(file, size, depth)
+}
+
+// TarGz writes the gzipped tarball of the root, the names are relative to the root parent directory.
+func (fsys *FS) TarGz(w io.Writer, root string) error {
+	file, err := fsys.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	parent := path.Dir(file.Path)
+
+	if err = fsys.walk(file, 0, -1, func(file *File, _ int) error {
+		name := strings.TrimPrefix(strings.TrimPrefix(file.Path, parent), "/")
+		if name == "" {
+			// the root directory itself
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(fileInfo{file}, "")
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+
+		if file.IsDir() {
+			header.Name += "/"
+		}
+
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		_, err = tw.Write(file.Data)
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// RelativePath returns the path of the file relative to the root.
+func RelativePath(root string, file *File) string {
+	root = clean(root)
+
+	if file.Path == root {
+		return "."
+	}
+
+	return strings.TrimPrefix(strings.TrimPrefix(file.Path, root), "/")
+}
+
+// children returns the directory entries in the name order.
+func (fsys *FS) children(dir string) []*File {
+	var children []*File
+
+	for name, file := range fsys.files {
+		if name != "/" && path.Dir(name) == dir {
+			children = append(children, file)
+		}
+	}
+
+	slices.SortFunc(children, func(a, b *File) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return children
+}
+
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
+
+// fileInfo adapts the file to fs.FileInfo.
+type fileInfo struct {
+	file *File
+}
+
+func (fi fileInfo) Name() string       { return path.Base(fi.file.Path) }
+func (fi fileInfo) Size() int64        { return fi.file.Size() }
+func (fi fileInfo) Mode() fs.FileMode  { return fi.file.Mode }
+func (fi fileInfo) ModTime() time.Time { return fi.file.ModTime }
+func (fi fileInfo) IsDir() bool        { return fi.file.IsDir() }
+func (fi fileInfo) Sys() any           { return nil }
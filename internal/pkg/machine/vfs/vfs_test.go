@@ -0,0 +1,126 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package vfs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/talemu/internal/pkg/machine/vfs"
+)
+
+func newFS() *vfs.FS {
+	now := time.Now()
+
+	fsys := vfs.New(now)
+
+	fsys.WriteFile("/var/log/audit/kube.log", []byte("audit"), 0o600, now)
+	fsys.WriteFile("/var/lib/etcd/member/db", make([]byte, 1024), 0o600, now)
+	fsys.Mkdir("/var/log/pods", now)
+
+	return fsys
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	fsys := newFS()
+
+	data, err := fsys.ReadFile("/var/log/audit/kube.log")
+	require.NoError(t, err)
+	assert.Equal(t, "audit", string(data))
+
+	_, err = fsys.ReadFile("/var/log")
+	assert.True(t, errors.Is(err, vfs.ErrIsDir))
+
+	_, err = fsys.ReadFile("/var/log/missing")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestWalk(t *testing.T) {
+	t.Parallel()
+
+	fsys := newFS()
+
+	walk := func(root string, maxDepth int) []string {
+		var paths []string
+
+		require.NoError(t, fsys.Walk(root, maxDepth, func(file *vfs.File, _ int) error {
+			paths = append(paths, vfs.RelativePath(root, file))
+
+			return nil
+		}))
+
+		return paths
+	}
+
+	assert.Equal(t, []string{".", "audit", "pods"}, walk("/var/log", 1))
+	assert.Equal(t, []string{".", "audit", "audit/kube.log", "pods"}, walk("/var/log", -1))
+	assert.Equal(t, []string{"."}, walk("/var/log/audit/kube.log", -1))
+}
+
+func TestUsage(t *testing.T) {
+	t.Parallel()
+
+	fsys := newFS()
+
+	sizes := map[string]int64{}
+
+	require.NoError(t, fsys.Usage("/var", func(file *vfs.File, size int64, _ int) error {
+		sizes[file.Path] = size
+
+		return nil
+	}))
+
+	assert.EqualValues(t, 1029, sizes["/var"])
+	assert.EqualValues(t, 5, sizes["/var/log"])
+	assert.EqualValues(t, 0, sizes["/var/log/pods"])
+	assert.EqualValues(t, 1024, sizes["/var/lib/etcd/member/db"])
+}
+
+func TestTarGz(t *testing.T) {
+	t.Parallel()
+
+	fsys := newFS()
+
+	var buf bytes.Buffer
+
+	require.NoError(t, fsys.TarGz(&buf, "/var/log"))
+
+	zr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+
+	tr := tar.NewReader(zr)
+
+	var names []string
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		require.NoError(t, err)
+
+		names = append(names, header.Name)
+
+		if header.Name == "log/audit/kube.log" {
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			assert.Equal(t, "audit", string(data))
+		}
+	}
+
+	assert.Equal(t, []string{"log/audit/", "log/audit/kube.log", "log/pods/"}, names)
+}
@@ -7,7 +7,10 @@ package machine
 
 import (
 	"context"
+	"errors"
+	"sync"
 
+	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/cosi-project/runtime/pkg/task"
 	"go.uber.org/zap"
@@ -16,10 +19,54 @@ import (
 	"github.com/siderolabs/talemu/internal/pkg/machine"
 	"github.com/siderolabs/talemu/internal/pkg/machine/controllers"
 	"github.com/siderolabs/talemu/internal/pkg/machine/network"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime/resources/emu"
 	"github.com/siderolabs/talemu/internal/pkg/provider/resources"
 	"github.com/siderolabs/talemu/internal/pkg/schematic"
 )
 
+// Running keeps the machines started by the tasks, so that they can be powered off.
+type Running struct {
+	machines map[string]*machine.Machine
+	mu       sync.Mutex
+}
+
+// NewRunning creates an empty set of the running machines.
+func NewRunning() *Running {
+	return &Running{
+		machines: map[string]*machine.Machine{},
+	}
+}
+
+// PowerOff powers off the machine of the task, returns false if the machine is not running.
+func (r *Running) PowerOff(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.machines[id]
+	if ok {
+		m.PowerOff()
+	}
+
+	return ok
+}
+
+func (r *Running) add(id string, m *machine.Machine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.machines[id] = m
+}
+
+func (r *Running) remove(id string, m *machine.Machine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.machines[id] == m {
+		delete(r.machines, id)
+	}
+}
+
 // TaskSpec runs fake machine.
 type TaskSpec struct {
 	_ [0]func() // make uncomparable
@@ -31,7 +78,11 @@ type TaskSpec struct {
 	Params               *machine.SideroLinkParams
 	Kubernetes           *kubefactory.Kubernetes
 	NC                   *network.Client
+	Instance             runtime.Instance
+	Running              *Running
 	NodeProxyingDisabled bool
+	KubeControllers      bool
+	UpgradeTimings       controllers.UpgradeTimings
 }
 
 // ID implements task.TaskSpec.
@@ -46,14 +97,17 @@ func (s TaskSpec) Equal(other TaskSpec) bool {
 
 // RunTask implements task.TaskSpec.
 func (s TaskSpec) RunTask(ctx context.Context, logger *zap.Logger, _ any) error {
-	m, err := machine.NewMachine(s.Machine.TypedSpec().Value.Uuid, logger, s.GlobalState, s.SchematicService, s.EnterpriseChecker)
+	m, err := machine.NewMachine(s.Machine.TypedSpec().Value.Uuid, logger, s.GlobalState, s.SchematicService, s.EnterpriseChecker, s.Instance)
 	if err != nil {
 		return err
 	}
 
 	defer m.Cleanup(ctx) //nolint:errcheck
 
-	return m.Run(
+	s.Running.add(s.ID(), m)
+	defer s.Running.remove(s.ID(), m)
+
+	err = m.Run(
 		ctx,
 		s.Params,
 		int(s.Machine.TypedSpec().Value.Slot),
@@ -63,6 +117,38 @@ func (s TaskSpec) RunTask(ctx context.Context, logger *zap.Logger, _ any) error
 		machine.WithNetworkClient(s.NC),
 		machine.WithSecureBoot(s.Machine.TypedSpec().Value.SecureBoot),
 		machine.WithNodeProxyingDisabled(s.NodeProxyingDisabled),
+		machine.WithKubeControllers(s.KubeControllers),
+		machine.WithUpgradeTimings(s.UpgradeTimings),
 		machine.WithBootFactoryURL(s.Machine.TypedSpec().Value.BootFactoryUrl),
 	)
+
+	// the powered off machine stays off until the annotation is removed
+	if errors.Is(err, machine.ErrPoweredOff) {
+		logger.Info("machine powered off")
+
+		return SetPoweredOff(ctx, s.GlobalState, s.ID(), true)
+	}
+
+	return err
+}
+
+// SetPoweredOff sets or removes the powered off annotation of the machine task.
+//
+// The machine controller stops the task of the annotated machine, and starts it again once the annotation is removed.
+func SetPoweredOff(ctx context.Context, st state.State, id string, poweredOff bool) error {
+	_, err := safe.StateUpdateWithConflicts(ctx, st, resources.NewMachineTask(emu.NamespaceName, id).Metadata(), func(res *resources.MachineTask) error {
+		if poweredOff {
+			res.Metadata().Annotations().Set(resources.PoweredOffAnnotation, "")
+		} else {
+			res.Metadata().Annotations().Delete(resources.PoweredOffAnnotation)
+		}
+
+		return nil
+	})
+	if state.IsNotFoundError(err) || state.IsPhaseConflictError(err) {
+		// the machine is being removed
+		return nil
+	}
+
+	return err
 }
@@ -36,14 +36,19 @@ type MachineController struct {
 	globalState          state.State
 	schematicService     *schematic.Service
 	enterpriseChecker    controllers.EnterpriseChecker
+	instance             runtime.Instance
+	running              *machinetask.Running
 	nodeProxyingDisabled bool
+	kubeControllers      bool
+	upgradeTimings       controllers.UpgradeTimings
 }
 
 // NewMachineController creates new machine controller.
 func NewMachineController(
 	globalState state.State, kubernetes *kubefactory.Kubernetes, nc *network.Client,
 	schematicService *schematic.Service, enterpriseChecker controllers.EnterpriseChecker,
-	nodeProxyingDisabled bool,
+	instance runtime.Instance, running *machinetask.Running, nodeProxyingDisabled, kubeControllers bool,
+	upgradeTimings controllers.UpgradeTimings,
 ) *MachineController {
 	return &MachineController{
 		runner:               task.NewEqualRunner[machinetask.TaskSpec](),
@@ -52,7 +57,11 @@ func NewMachineController(
 		nc:                   nc,
 		schematicService:     schematicService,
 		enterpriseChecker:    enterpriseChecker,
+		instance:             instance,
+		running:              running,
 		nodeProxyingDisabled: nodeProxyingDisabled,
+		kubeControllers:      kubeControllers,
+		upgradeTimings:       upgradeTimings,
 	}
 }
 
@@ -114,6 +123,12 @@ func (ctrl *MachineController) Run(ctx context.Context, r controller.Runtime, lo
 				}
 			}
 
+			if _, poweredOff := m.Metadata().Annotations().Get(resources.PoweredOffAnnotation); poweredOff {
+				ctrl.runner.StopTask(logger, m.Metadata().ID())
+
+				continue
+			}
+
 			var params *machine.SideroLinkParams
 
 			params, err = machine.ParseKernelArgs(m.TypedSpec().Value.ConnectionArgs)
@@ -129,7 +144,11 @@ func (ctrl *MachineController) Run(ctx context.Context, r controller.Runtime, lo
 				Kubernetes:           ctrl.kubernetes,
 				Params:               params,
 				NC:                   ctrl.nc,
+				Instance:             ctrl.instance,
+				Running:              ctrl.running,
 				NodeProxyingDisabled: ctrl.nodeProxyingDisabled,
+				KubeControllers:      ctrl.kubeControllers,
+				UpgradeTimings:       ctrl.upgradeTimings,
 			}, nil)
 
 			touchedIDs[m.Metadata().ID()] = struct{}{}
@@ -146,7 +165,7 @@ func (ctrl *MachineController) resetMachine(ctx context.Context, m *resources.Ma
 
 	ctrl.runner.StopTask(logger, m.Metadata().ID())
 
-	stateDir := runtime.GetStateDir(machineID)
+	stateDir := ctrl.instance.GetStateDir(machineID)
 
 	err := os.RemoveAll(stateDir)
 	if err != nil && !os.IsNotExist(err) {
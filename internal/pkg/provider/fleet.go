@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+
+	"github.com/siderolabs/talemu/internal/pkg/admin"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+	"github.com/siderolabs/talemu/internal/pkg/machine/runtime"
+	machinetask "github.com/siderolabs/talemu/internal/pkg/provider/controllers/machine"
+	"github.com/siderolabs/talemu/internal/pkg/provider/resources"
+)
+
+// Fleet exposes the power management of the provisioned machines over the admin API.
+//
+// The machines are created and removed by Omni machine requests, so only the power state can be changed.
+type Fleet struct {
+	state   state.State
+	running *machinetask.Running
+}
+
+var _ admin.Fleet = (*Fleet)(nil)
+
+// NewFleet creates the fleet of the provisioned machines.
+func NewFleet(state state.State, running *machinetask.Running) *Fleet {
+	return &Fleet{
+		state:   state,
+		running: running,
+	}
+}
+
+// List implements admin.Fleet.
+func (f *Fleet) List(ctx context.Context) ([]admin.Machine, error) {
+	tasks, err := safe.ReaderListAll[*resources.MachineTask](ctx, f.state)
+	if err != nil {
+		return nil, err
+	}
+
+	machines := make([]admin.Machine, 0, tasks.Len())
+
+	for task := range tasks.All() {
+		var info admin.Machine
+
+		info, err = admin.Describe(ctx, f.state, describeTask(task))
+		if err != nil {
+			return nil, err
+		}
+
+		machines = append(machines, info)
+	}
+
+	slices.SortFunc(machines, func(a, b admin.Machine) int {
+		return a.Slot - b.Slot
+	})
+
+	return machines, nil
+}
+
+// PowerOff implements admin.Fleet.
+//
+// The running machine marks its Kubernetes node not ready, and the task is stopped once the machine is off.
+func (f *Fleet) PowerOff(ctx context.Context, id string) error {
+	task, err := f.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if f.running.PowerOff(task.Metadata().ID()) {
+		return nil
+	}
+
+	return machinetask.SetPoweredOff(ctx, f.state, task.Metadata().ID(), true)
+}
+
+// PowerOn implements admin.Fleet.
+func (f *Fleet) PowerOn(ctx context.Context, id string) error {
+	task, err := f.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return machinetask.SetPoweredOff(ctx, f.state, task.Metadata().ID(), false)
+}
+
+// Resume implements admin.Fleet.
+//
+// The provider machines can't be paused, so it powers on the machine.
+func (f *Fleet) Resume(ctx context.Context, id string) error {
+	return f.PowerOn(ctx, id)
+}
+
+// Kubeconfig implements admin.Fleet.
+func (f *Fleet) Kubeconfig(ctx context.Context, cluster string) ([]byte, error) {
+	return admin.ClusterKubeconfig(ctx, f.state, cluster)
+}
+
+// SetEtcdAlarm implements admin.Fleet.
+func (f *Fleet) SetEtcdAlarm(ctx context.Context, id, alarm string, active bool) error {
+	if _, err := f.get(ctx, id); err != nil {
+		return err
+	}
+
+	return admin.SetEtcdAlarm(ctx, f.state, id, alarm, active)
+}
+
+// Add implements admin.Fleet.
+func (f *Fleet) Add(context.Context, admin.AddRequest) ([]admin.Machine, error) {
+	return nil, unsupported("adding machines")
+}
+
+// Remove implements admin.Fleet.
+func (f *Fleet) Remove(context.Context, string) error {
+	return unsupported("removing machines")
+}
+
+// Pause implements admin.Fleet.
+func (f *Fleet) Pause(context.Context, string) error {
+	return unsupported("pausing machines")
+}
+
+// Reboot implements admin.Fleet.
+func (f *Fleet) Reboot(context.Context, string) error {
+	return unsupported("rebooting machines")
+}
+
+// Faults implements admin.Fleet.
+func (f *Fleet) Faults(context.Context, string) ([]faults.Rule, error) {
+	return nil, unsupported("fault injection")
+}
+
+// SetFaults implements admin.Fleet.
+func (f *Fleet) SetFaults(context.Context, string, []faults.Rule) error {
+	return unsupported("fault injection")
+}
+
+// Partition implements admin.Fleet.
+func (f *Fleet) Partition(context.Context, string) error {
+	return unsupported("fault injection")
+}
+
+// Reconnect implements admin.Fleet.
+func (f *Fleet) Reconnect(context.Context, string) error {
+	return unsupported("fault injection")
+}
+
+// SetServiceHealth implements admin.Fleet.
+func (f *Fleet) SetServiceHealth(context.Context, string, string, bool) error {
+	return unsupported("fault injection")
+}
+
+// get finds the task of the machine by the machine ID.
+func (f *Fleet) get(ctx context.Context, id string) (*resources.MachineTask, error) {
+	tasks, err := safe.ReaderListAll[*resources.MachineTask](ctx, f.state)
+	if err != nil {
+		return nil, err
+	}
+
+	task, ok := tasks.Find(func(task *resources.MachineTask) bool {
+		return runtime.MachineID(int(task.TypedSpec().Value.Slot)) == id
+	})
+	if !ok {
+		return nil, fmt.Errorf("machine %s: %w", id, admin.ErrNotFound)
+	}
+
+	return task, nil
+}
+
+func describeTask(task *resources.MachineTask) admin.Machine {
+	info := admin.Machine{
+		ID:   runtime.MachineID(int(task.TypedSpec().Value.Slot)),
+		UUID: task.TypedSpec().Value.Uuid,
+		// the machines of the provider are grouped by the machine requests
+		Group: task.Metadata().ID(),
+		State: admin.MachineRunning,
+		Slot:  int(task.TypedSpec().Value.Slot),
+	}
+
+	if _, ok := task.Metadata().Annotations().Get(resources.PoweredOffAnnotation); ok {
+		info.State = admin.MachinePoweredOff
+	}
+
+	return info
+}
+
+func unsupported(what string) error {
+	return fmt.Errorf("%w: %s is not supported by the infra provider", admin.ErrInvalidRequest, what)
+}
@@ -12,17 +12,20 @@ import (
 	"github.com/siderolabs/talemu/internal/pkg/kubefactory"
 	machinecontrollers "github.com/siderolabs/talemu/internal/pkg/machine/controllers"
 	"github.com/siderolabs/talemu/internal/pkg/machine/network"
+	machineruntime "github.com/siderolabs/talemu/internal/pkg/machine/runtime"
 	"github.com/siderolabs/talemu/internal/pkg/provider/controllers"
+	machinetask "github.com/siderolabs/talemu/internal/pkg/provider/controllers/machine"
 	"github.com/siderolabs/talemu/internal/pkg/schematic"
 )
 
 // RegisterControllers registers additional controllers required for the infra provider.
 func RegisterControllers(
 	runtime *emu.Runtime, kubernetes *kubefactory.Kubernetes, nc *network.Client, schematicService *schematic.Service,
-	enterpriseChecker machinecontrollers.EnterpriseChecker, nodeProxyingDisabled bool,
+	enterpriseChecker machinecontrollers.EnterpriseChecker, instance machineruntime.Instance, running *machinetask.Running, nodeProxyingDisabled, kubeControllers bool,
+	upgradeTimings machinecontrollers.UpgradeTimings,
 ) error {
 	controllers := []controller.Controller{
-		controllers.NewMachineController(runtime.State(), kubernetes, nc, schematicService, enterpriseChecker, nodeProxyingDisabled),
+		controllers.NewMachineController(runtime.State(), kubernetes, nc, schematicService, enterpriseChecker, instance, running, nodeProxyingDisabled, kubeControllers, upgradeTimings),
 	}
 
 	for _, ctrl := range controllers {
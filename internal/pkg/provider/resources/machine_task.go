@@ -22,6 +22,9 @@ func NewMachineTask(ns, id string) *MachineTask {
 	)
 }
 
+// PoweredOffAnnotation is set on the MachineTask while the machine is powered off.
+const PoweredOffAnnotation = emu.SystemLabelPrefix + "powered-off"
+
 // MachineTaskType is the type of MachineTask resource.
 var MachineTaskType = "MachineTask.talemu.sidero.dev"
 
@@ -0,0 +1,333 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package scenario
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/siderolabs/talemu/internal/pkg/admin"
+	"github.com/siderolabs/talemu/internal/pkg/constants"
+	"github.com/siderolabs/talemu/internal/pkg/machine/etcdcluster"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+)
+
+// upgradeMethod matches both the legacy and the lifecycle service upgrade calls.
+const upgradeMethod = `^/machine\.(MachineService|LifecycleService)/Upgrade$`
+
+// Report is the result of the scenario run.
+type Report struct {
+	Started time.Time     `json:"started"`
+	Name    string        `json:"name,omitempty"`
+	Events  []EventReport `json:"events"`
+}
+
+// EventReport is the result of a single step action or its revert.
+type EventReport struct {
+	Step     string          `json:"step"`
+	Action   string          `json:"action"`
+	Error    string          `json:"error,omitempty"`
+	Machines []string        `json:"machines"`
+	At       faults.Duration `json:"at"`
+	// Started is the actual time since the scenario start when the event started.
+	Started faults.Duration `json:"started"`
+	Took    faults.Duration `json:"took"`
+	Revert  bool            `json:"revert,omitempty"`
+}
+
+// event is a single point of the scenario timeline.
+type event struct {
+	state  *stepState
+	step   Step
+	name   string
+	at     time.Duration
+	revert bool
+}
+
+// stepState keeps the machines the step was applied to, so that the revert applies to the same machines,
+// and the fault rules the step added to each machine, so that the revert removes only them.
+type stepState struct {
+	rules    map[string][]faults.Rule
+	machines []string
+}
+
+// Run runs the scenario against the fleet.
+//
+// The events run one by one in the timeline order, the actions failing on some machines don't stop the scenario,
+// they are recorded in the report, and the joined error is returned after the scenario ends.
+func Run(ctx context.Context, fleet admin.Fleet, spec *Spec, logger *zap.Logger) (*Report, error) {
+	events := make([]event, 0, len(spec.Steps)*2)
+
+	for i, step := range spec.Steps {
+		state := &stepState{}
+
+		events = append(events, event{
+			step:  step,
+			name:  step.name(i),
+			at:    time.Duration(step.At),
+			state: state,
+		})
+
+		if step.Duration > 0 {
+			events = append(events, event{
+				step:   step,
+				name:   step.name(i),
+				at:     time.Duration(step.At + step.Duration),
+				state:  state,
+				revert: true,
+			})
+		}
+	}
+
+	// the sort is stable, so the events at the same time run in the order of the steps
+	slices.SortStableFunc(events, func(a, b event) int {
+		return cmp.Compare(a.at, b.at)
+	})
+
+	report := &Report{
+		Name:    spec.Name,
+		Started: time.Now(),
+		Events:  make([]EventReport, 0, len(events)),
+	}
+
+	logger.Info("scenario started", zap.String("scenario", spec.Name), zap.Int("events", len(events)))
+
+	var errs error
+
+	for _, ev := range events {
+		timer := time.NewTimer(time.Until(report.Started.Add(ev.at)))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return report, errors.Join(errs, ctx.Err())
+		case <-timer.C:
+		}
+
+		started := time.Now()
+
+		machines, err := ev.run(ctx, fleet)
+
+		eventReport := EventReport{
+			Step:     ev.name,
+			Action:   ev.step.Action,
+			Revert:   ev.revert,
+			Machines: machines,
+			At:       faults.Duration(ev.at),
+			Started:  faults.Duration(started.Sub(report.Started)),
+			Took:     faults.Duration(time.Since(started)),
+		}
+
+		fields := []zap.Field{
+			zap.String("step", ev.name),
+			zap.String("action", ev.step.Action),
+			zap.Bool("revert", ev.revert),
+			zap.Strings("machines", machines),
+			zap.Duration("at", ev.at),
+			zap.Duration("took", time.Duration(eventReport.Took)),
+		}
+
+		if err != nil {
+			eventReport.Error = err.Error()
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", ev.name, err))
+
+			logger.Error("scenario event failed", append(fields, zap.Error(err))...)
+		} else {
+			logger.Info("scenario event applied", fields...)
+		}
+
+		report.Events = append(report.Events, eventReport)
+	}
+
+	logger.Info("scenario finished", zap.String("scenario", spec.Name), zap.Duration("took", time.Since(report.Started)))
+
+	return report, errs
+}
+
+func (ev event) run(ctx context.Context, fleet admin.Fleet) ([]string, error) {
+	if ev.revert {
+		return ev.state.machines, ev.apply(ctx, fleet, ev.state.machines)
+	}
+
+	machines, err := ev.step.Selector.resolve(ctx, fleet)
+	if err != nil {
+		return nil, err
+	}
+
+	ev.state.machines = machines
+
+	return machines, ev.apply(ctx, fleet, machines)
+}
+
+func (ev event) apply(ctx context.Context, fleet admin.Fleet, machines []string) error {
+	var errs error
+
+	for _, id := range machines {
+		if err := ev.applyTo(ctx, fleet, id); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("machine %s: %w", id, err))
+		}
+	}
+
+	return errs
+}
+
+//nolint:gocyclo,cyclop
+func (ev event) applyTo(ctx context.Context, fleet admin.Fleet, id string) error {
+	if ev.revert {
+		switch ev.step.Action {
+		case ActionPause, ActionPowerOff:
+			return fleet.Resume(ctx, id)
+		case ActionPartition:
+			return fleet.Reconnect(ctx, id)
+		case ActionEtcdUnhealthy:
+			return fleet.SetServiceHealth(ctx, id, constants.ETCDService, true)
+		case ActionEtcdNoSpace:
+			return fleet.SetEtcdAlarm(ctx, id, etcdcluster.AlarmNoSpace, false)
+		case ActionEtcdCorrupt:
+			return fleet.SetEtcdAlarm(ctx, id, etcdcluster.AlarmCorrupt, false)
+		case ActionFaults, ActionFailUpgrade:
+			return ev.removeFaults(ctx, fleet, id)
+		}
+
+		return fmt.Errorf("action %q can not be reverted", ev.step.Action)
+	}
+
+	switch ev.step.Action {
+	case ActionReboot:
+		return fleet.Reboot(ctx, id)
+	case ActionPowerOff:
+		return fleet.PowerOff(ctx, id)
+	case ActionPause:
+		return fleet.Pause(ctx, id)
+	case ActionResume:
+		return fleet.Resume(ctx, id)
+	case ActionRemove:
+		return fleet.Remove(ctx, id)
+	case ActionPartition:
+		return fleet.Partition(ctx, id)
+	case ActionReconnect:
+		return fleet.Reconnect(ctx, id)
+	case ActionEtcdUnhealthy:
+		return fleet.SetServiceHealth(ctx, id, constants.ETCDService, false)
+	case ActionEtcdHealthy:
+		return fleet.SetServiceHealth(ctx, id, constants.ETCDService, true)
+	case ActionEtcdNoSpace:
+		return fleet.SetEtcdAlarm(ctx, id, etcdcluster.AlarmNoSpace, true)
+	case ActionEtcdCorrupt:
+		return fleet.SetEtcdAlarm(ctx, id, etcdcluster.AlarmCorrupt, true)
+	case ActionClearFaults:
+		return fleet.SetFaults(ctx, id, nil)
+	case ActionFaults:
+		return ev.addFaults(ctx, fleet, id, ev.step.Rules)
+	case ActionFailUpgrade:
+		return ev.addFaults(ctx, fleet, id, []faults.Rule{
+			{
+				Method:  upgradeMethod,
+				Code:    "Internal",
+				Message: "upgrade failed by the scenario",
+				Times:   1,
+			},
+		})
+	}
+
+	return fmt.Errorf("unknown action %q", ev.step.Action)
+}
+
+// addFaults puts the rules in front of the current machine rules, so that they take precedence.
+//
+// The added rules are kept in the step state to be removed on revert.
+func (ev event) addFaults(ctx context.Context, fleet admin.Fleet, id string, rules []faults.Rule) error {
+	current, err := fleet.Faults(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if ev.state.rules == nil {
+		ev.state.rules = map[string][]faults.Rule{}
+	}
+
+	ev.state.rules[id] = rules
+
+	return fleet.SetFaults(ctx, id, append(slices.Clone(rules), current...))
+}
+
+// removeFaults removes the rules added by the step, the rules added by the other steps or set through the admin API meanwhile are kept.
+func (ev event) removeFaults(ctx context.Context, fleet admin.Fleet, id string) error {
+	current, err := fleet.Faults(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, added := range ev.state.rules[id] {
+		if idx := slices.IndexFunc(current, func(rule faults.Rule) bool { return sameRule(rule, added) }); idx != -1 {
+			current = slices.Delete(current, idx, idx+1)
+		}
+	}
+
+	return fleet.SetFaults(ctx, id, current)
+}
+
+// sameRule checks if the current machine rule is the added one.
+//
+// The machine reports the default target, and the calls left for the rules limited by the number of calls,
+// the used up rules are already gone.
+func sameRule(current, added faults.Rule) bool {
+	for _, rule := range []*faults.Rule{&current, &added} {
+		if rule.Target == "" {
+			rule.Target = faults.TargetAPID
+		}
+	}
+
+	if added.Times > 0 && current.Times > 0 && current.Times <= added.Times {
+		current.Times = added.Times
+	}
+
+	return reflect.DeepEqual(current, added)
+}
+
+// resolve returns the IDs of the machines matching the selector.
+func (selector Selector) resolve(ctx context.Context, fleet admin.Fleet) ([]string, error) {
+	machines, err := fleet.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+
+	for _, m := range machines {
+		if selector.matches(m) {
+			ids = append(ids, m.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("no machines match the selector")
+	}
+
+	return ids, nil
+}
+
+func (selector Selector) matches(m admin.Machine) bool {
+	switch {
+	case len(selector.Machines) > 0 && !slices.Contains(selector.Machines, m.ID):
+		return false
+	case selector.Cluster != "" && selector.Cluster != m.Cluster:
+		return false
+	case selector.Role != "" && selector.Role != m.Role:
+		return false
+	case selector.Group != "" && selector.Group != m.Group:
+		return false
+	}
+
+	return true
+}
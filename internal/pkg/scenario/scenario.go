@@ -0,0 +1,187 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package scenario implements the scenarios which apply timed events to the emulated machines.
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/talemu/internal/pkg/admin"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+)
+
+// Actions of the scenario steps.
+const (
+	ActionReboot        = "reboot"
+	ActionPowerOff      = "poweroff"
+	ActionPause         = "pause"
+	ActionResume        = "resume"
+	ActionRemove        = "remove"
+	ActionPartition     = "partition"
+	ActionReconnect     = "reconnect"
+	ActionEtcdUnhealthy = "etcd-unhealthy"
+	ActionEtcdHealthy   = "etcd-healthy"
+	ActionEtcdNoSpace   = "etcd-nospace"
+	ActionEtcdCorrupt   = "etcd-corrupt"
+	ActionFaults        = "faults"
+	ActionClearFaults   = "clear-faults"
+	ActionFailUpgrade   = "fail-upgrade"
+)
+
+// revertible are the actions which can be reverted after the step duration.
+var revertible = []string{
+	ActionPause, ActionPowerOff, ActionPartition, ActionEtcdUnhealthy, ActionEtcdNoSpace, ActionEtcdCorrupt, ActionFaults, ActionFailUpgrade,
+}
+
+var actions = []string{
+	ActionReboot, ActionPowerOff, ActionPause, ActionResume, ActionRemove, ActionPartition, ActionReconnect,
+	ActionEtcdUnhealthy, ActionEtcdHealthy, ActionEtcdNoSpace, ActionEtcdCorrupt, ActionFaults, ActionClearFaults, ActionFailUpgrade,
+}
+
+// Spec is the scenario file.
+type Spec struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+}
+
+// Step applies the action to the selected machines at the time relative to the scenario start.
+type Step struct {
+	Name     string `yaml:"name"`
+	Action   string `yaml:"action"`
+	Selector `yaml:",inline"`
+	// Rules are appended to the machine fault rules by the faults action.
+	Rules []faults.Rule   `yaml:"rules"`
+	At    faults.Duration `yaml:"at"`
+	// Duration reverts the action after the time passes, e.g. a partition is healed, or a paused machine is resumed.
+	Duration faults.Duration `yaml:"duration"`
+}
+
+// Selector selects the machines by their IDs, cluster, role and group.
+//
+// The machines should match all set fields.
+type Selector struct {
+	Cluster  string   `yaml:"cluster"`
+	Role     string   `yaml:"role"`
+	Group    string   `yaml:"group"`
+	Machines []string `yaml:"machines"`
+	All      bool     `yaml:"all"`
+}
+
+// Load reads and validates the scenario file.
+func Load(path string) (*Spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	spec, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse scenario file %q: %w", path, err)
+	}
+
+	return spec, nil
+}
+
+// Parse decodes and validates the scenario.
+func Parse(r io.Reader) (*Spec, error) {
+	var spec Spec
+
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&spec); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the scenario file is empty")
+		}
+
+		return nil, err
+	}
+
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &spec, nil
+}
+
+// Validate the scenario.
+func (spec *Spec) Validate() error {
+	var errs error
+
+	if len(spec.Steps) == 0 {
+		return errors.New("the scenario has no steps")
+	}
+
+	for i, step := range spec.Steps {
+		if err := step.Validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", step.name(i), err))
+		}
+	}
+
+	return errs
+}
+
+// Validate the step.
+func (step Step) Validate() error {
+	var errs error
+
+	if !slices.Contains(actions, step.Action) {
+		errs = errors.Join(errs, fmt.Errorf("unknown action %q", step.Action))
+	}
+
+	if step.At < 0 {
+		errs = errors.Join(errs, errors.New("at can not be negative"))
+	}
+
+	if step.Duration < 0 {
+		errs = errors.Join(errs, errors.New("duration can not be negative"))
+	}
+
+	if step.Duration > 0 && !slices.Contains(revertible, step.Action) {
+		errs = errors.Join(errs, fmt.Errorf("action %q can not be reverted, so it doesn't support duration", step.Action))
+	}
+
+	if step.Action == ActionFaults {
+		if len(step.Rules) == 0 {
+			errs = errors.Join(errs, errors.New("faults action requires rules"))
+		} else if err := faults.Validate(step.Rules); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	} else if len(step.Rules) > 0 {
+		errs = errors.Join(errs, fmt.Errorf("rules are only supported by the %s action", ActionFaults))
+	}
+
+	switch step.Role {
+	case "", admin.RoleControlPlane, admin.RoleWorker:
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown role %q, should be %s or %s", step.Role, admin.RoleControlPlane, admin.RoleWorker))
+	}
+
+	if step.Selector.empty() {
+		errs = errors.Join(errs, errors.New("the step doesn't select any machines, set all: true to select all machines"))
+	}
+
+	return errs
+}
+
+func (step Step) name(index int) string {
+	if step.Name != "" {
+		return step.Name
+	}
+
+	return fmt.Sprintf("step-%d", index)
+}
+
+func (selector Selector) empty() bool {
+	return !selector.All && selector.Cluster == "" && selector.Role == "" && selector.Group == "" && len(selector.Machines) == 0
+}
@@ -0,0 +1,259 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package scenario_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/siderolabs/talemu/internal/pkg/admin"
+	"github.com/siderolabs/talemu/internal/pkg/machine/faults"
+	"github.com/siderolabs/talemu/internal/pkg/scenario"
+)
+
+// recordingFleet records the calls made by the scenario.
+type recordingFleet struct {
+	faults   map[string][]faults.Rule
+	machines []admin.Machine
+	calls    []string
+	mu       sync.Mutex
+}
+
+func (f *recordingFleet) record(call, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, call+" "+id)
+
+	for _, m := range f.machines {
+		if m.ID == id {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("machine %s: %w", id, admin.ErrNotFound)
+}
+
+func (f *recordingFleet) List(context.Context) ([]admin.Machine, error) {
+	return f.machines, nil
+}
+
+func (f *recordingFleet) Add(context.Context, admin.AddRequest) ([]admin.Machine, error) {
+	return nil, admin.ErrInvalidRequest
+}
+
+func (f *recordingFleet) Remove(_ context.Context, id string) error { return f.record("remove", id) }
+func (f *recordingFleet) Pause(_ context.Context, id string) error  { return f.record("pause", id) }
+func (f *recordingFleet) Resume(_ context.Context, id string) error { return f.record("resume", id) }
+func (f *recordingFleet) Reboot(_ context.Context, id string) error { return f.record("reboot", id) }
+
+func (f *recordingFleet) PowerOff(_ context.Context, id string) error {
+	return f.record("poweroff", id)
+}
+
+func (f *recordingFleet) PowerOn(_ context.Context, id string) error {
+	return f.record("poweron", id)
+}
+
+func (f *recordingFleet) Partition(_ context.Context, id string) error {
+	return f.record("partition", id)
+}
+
+func (f *recordingFleet) Reconnect(_ context.Context, id string) error {
+	return f.record("reconnect", id)
+}
+
+func (f *recordingFleet) SetServiceHealth(_ context.Context, id, service string, healthy bool) error {
+	return f.record(fmt.Sprintf("%s-healthy=%t", service, healthy), id)
+}
+
+func (f *recordingFleet) SetEtcdAlarm(_ context.Context, id, alarm string, active bool) error {
+	return f.record(fmt.Sprintf("etcd-%s=%t", alarm, active), id)
+}
+
+func (f *recordingFleet) Kubeconfig(context.Context, string) ([]byte, error) {
+	return nil, admin.ErrNotFound
+}
+
+func (f *recordingFleet) Faults(_ context.Context, id string) ([]faults.Rule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.faults[id], nil
+}
+
+func (f *recordingFleet) SetFaults(_ context.Context, id string, rules []faults.Rule) error {
+	f.mu.Lock()
+	f.faults[id] = rules
+	f.mu.Unlock()
+
+	return f.record(fmt.Sprintf("faults=%d", len(rules)), id)
+}
+
+const scenarioYAML = `name: partition-during-upgrade
+steps:
+  - name: partition
+    at: 20ms
+    action: partition
+    machines: ["1002"]
+    duration: 40ms
+  - name: reboot-workers
+    at: 30ms
+    action: reboot
+    cluster: talos-default
+    role: worker
+  - name: fail-upgrade
+    action: fail-upgrade
+    all: true
+    duration: 50ms
+  - name: unhealthy-etcd
+    at: 10ms
+    action: etcd-unhealthy
+    role: controlplane
+  - name: etcd-nospace
+    at: 15ms
+    action: etcd-nospace
+    machines: ["1000"]
+    duration: 50ms
+  - name: missing
+    at: 70ms
+    action: pause
+    group: missing
+`
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	spec, err := scenario.Parse(strings.NewReader(scenarioYAML))
+	require.NoError(t, err)
+
+	fleet := &recordingFleet{
+		machines: []admin.Machine{
+			{ID: "1000", Cluster: "talos-default", Role: admin.RoleControlPlane},
+			{ID: "1001", Cluster: "talos-default", Role: admin.RoleWorker},
+			{ID: "1002", Cluster: "talos-default", Role: admin.RoleWorker},
+		},
+		faults: map[string][]faults.Rule{
+			"1000": {{Method: "Version", Latency: faults.Duration(time.Second)}},
+		},
+	}
+
+	report, err := scenario.Run(t.Context(), fleet, spec, zaptest.NewLogger(t))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "missing: no machines match the selector")
+
+	assert.Equal(t, []string{
+		"faults=2 1000",
+		"faults=1 1001",
+		"faults=1 1002",
+		"etcd-healthy=false 1000",
+		"etcd-NOSPACE=true 1000",
+		"partition 1002",
+		"reboot 1001",
+		"reboot 1002",
+		"faults=1 1000",
+		"faults=0 1001",
+		"faults=0 1002",
+		"reconnect 1002",
+		"etcd-NOSPACE=false 1000",
+	}, fleet.calls)
+
+	// the revert removes the rules added by the step
+	assert.Equal(t, []faults.Rule{{Method: "Version", Latency: faults.Duration(time.Second)}}, fleet.faults["1000"])
+	assert.Empty(t, fleet.faults["1001"])
+
+	require.Len(t, report.Events, 9)
+
+	for _, ev := range report.Events {
+		assert.GreaterOrEqual(t, ev.Started, ev.At)
+	}
+
+	assert.Equal(t, "fail-upgrade", report.Events[5].Step)
+	assert.True(t, report.Events[5].Revert)
+	assert.Equal(t, "etcd-nospace", report.Events[7].Step)
+	assert.True(t, report.Events[7].Revert)
+	assert.Equal(t, "missing", report.Events[8].Step)
+	assert.NotEmpty(t, report.Events[8].Error)
+}
+
+func TestRunOverlappingFaults(t *testing.T) {
+	t.Parallel()
+
+	spec, err := scenario.Parse(strings.NewReader(`name: overlapping-faults
+steps:
+  - name: slow
+    action: faults
+    machines: ["1000"]
+    duration: 40ms
+    rules:
+      - method: Version
+        latency: 2s
+  - name: fail-upgrade
+    at: 20ms
+    action: fail-upgrade
+    machines: ["1000"]
+    duration: 40ms
+`))
+	require.NoError(t, err)
+
+	original := []faults.Rule{{Method: "Version", Latency: faults.Duration(time.Second)}}
+
+	fleet := &recordingFleet{
+		machines: []admin.Machine{{ID: "1000"}},
+		faults:   map[string][]faults.Rule{"1000": original},
+	}
+
+	_, err = scenario.Run(t.Context(), fleet, spec, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	// the revert of the first step keeps the rules of the second one
+	assert.Equal(t, []string{
+		"faults=2 1000",
+		"faults=3 1000",
+		"faults=2 1000",
+		"faults=1 1000",
+	}, fleet.calls)
+
+	assert.Equal(t, original, fleet.faults["1000"])
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	_, err := scenario.Parse(strings.NewReader(`steps:
+  - action: explode
+    all: true
+  - action: reboot
+    duration: 1m
+    machines: ["1000"]
+  - action: faults
+    role: worker
+  - action: pause
+    role: etcd
+`))
+	require.Error(t, err)
+
+	for _, msg := range []string{
+		`step-0: unknown action "explode"`,
+		`step-1: action "reboot" can not be reverted`,
+		"step-2: faults action requires rules",
+		`step-3: unknown role "etcd"`,
+	} {
+		assert.ErrorContains(t, err, msg)
+	}
+
+	_, err = scenario.Parse(strings.NewReader(`steps:
+  - action: reboot
+`))
+	assert.ErrorContains(t, err, "the step doesn't select any machines")
+}